@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/Mort4lis/memdb/internal/db/compute"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+// authenticate sends AUTH if the user or the password is given.
+func authenticate(c *cli.Context, client *network.TCPClient) error {
+	user, password := c.String("user"), c.String("password")
+	if user == "" && password == "" {
+		return nil
+	}
+	if password == "" {
+		var err error
+		if password, err = promptPassword(user); err != nil {
+			return err
+		}
+	}
+
+	req := compute.AuthCommandName + " " + compute.Quote(password)
+	if user != "" {
+		req = compute.AuthCommandName + " " + compute.Quote(user) + " " + compute.Quote(password)
+	}
+	resp, err := client.Send(req)
+	if err != nil {
+		return fmt.Errorf("send auth request: %w", err)
+	}
+	if !strings.HasPrefix(resp, "[ok]") {
+		return errors.New(resp)
+	}
+	return nil
+}
+
+// promptPassword reads the password from the terminal without echoing it.
+// If the requests are piped, the password is read from the controlling terminal.
+func promptPassword(user string) (string, error) {
+	in, out := os.Stdin, os.Stderr
+	if !term.IsTerminal(int(in.Fd())) { //nolint:gosec // file descriptor fits in int
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return "", fmt.Errorf("open terminal to prompt password: %w", err)
+		}
+		defer tty.Close()
+		in, out = tty, tty
+	}
+
+	_, _ = fmt.Fprintf(out, "Password for %s: ", user)
+	password, err := term.ReadPassword(int(in.Fd())) //nolint:gosec // file descriptor fits in int
+	_, _ = fmt.Fprintln(out)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return string(password), nil
+}
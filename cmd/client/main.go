@@ -16,7 +16,7 @@ const (
 	defaultDialTimeout    = 10 * time.Second
 	defaultReadTimeout    = 10 * time.Second
 	defaultWriteTimeout   = 10 * time.Second
-	defaultReadBufferSize = 4096
+	defaultReadBufferSize = 64 << 20
 )
 
 func main() {
@@ -52,7 +52,16 @@ func main() {
 			&cli.IntFlag{
 				Name:  "read-buffer-size",
 				Value: defaultReadBufferSize,
-				Usage: "Max buffer size for reading response",
+				Usage: "Max size of the response, the buffer is allocated by the size of every response",
+			},
+			&cli.StringFlag{
+				Name:  "user",
+				Usage: "User to authenticate as, the password is prompted unless it's given",
+			},
+			&cli.StringFlag{
+				Name:    "password",
+				EnvVars: []string{"MEMDB_PASSWORD"},
+				Usage:   "Password to authenticate with",
 			},
 		},
 		Action:               action,
@@ -80,6 +89,11 @@ func action(c *cli.Context) error {
 	}
 	defer client.Close()
 
+	if err = authenticate(c, client); err != nil {
+		return err
+	}
+
+	var done chan struct{}
 	sc := bufio.NewScanner(os.Stdin)
 	for sc.Scan() {
 		req := strings.TrimSpace(sc.Text())
@@ -87,6 +101,20 @@ func action(c *cli.Context) error {
 			continue
 		}
 
+		// Once subscribed, the replies and the messages are printed as they come.
+		if done != nil || isSubscribe(req) {
+			var messages <-chan string
+			messages, err = client.Subscribe(req)
+			if err != nil {
+				return fmt.Errorf("send request: %w", err)
+			}
+			if done == nil {
+				done = make(chan struct{})
+				go printMessages(messages, done)
+			}
+			continue
+		}
+
 		var resp string
 		resp, err = client.Send(req)
 		if err != nil {
@@ -94,8 +122,26 @@ func action(c *cli.Context) error {
 		}
 		_, _ = fmt.Fprintln(os.Stdout, resp)
 	}
+	if done != nil {
+		// The subscriber waits for the messages until the connection is closed.
+		<-done
+	}
 	if sc.Err() != nil {
 		return fmt.Errorf("scan error: %w", err)
 	}
 	return nil
 }
+
+// isSubscribe reports whether the request switches the client to the subscribe mode.
+func isSubscribe(req string) bool {
+	name := strings.Fields(req)[0]
+	return name == "SUBSCRIBE" || name == "PSUBSCRIBE" || name == "NOTIFY"
+}
+
+func printMessages(messages <-chan string, done chan<- struct{}) {
+	defer close(done)
+	for msg := range messages {
+		_, _ = fmt.Fprintln(os.Stdout, msg)
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "connection closed")
+}
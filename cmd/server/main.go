@@ -1,21 +1,50 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Mort4lis/memdb/internal/db"
+	"github.com/Mort4lis/memdb/internal/db/auth"
 )
 
 func main() {
-	var confPath string
+	var (
+		confPath     string
+		hashPassword bool
+	)
 
 	flag.StringVar(&confPath, "c", "config.yaml", "The configuration file path")
+	flag.BoolVar(&hashPassword, "hash-password", false, "Print the hash of the password read from stdin for the auth section")
 	flag.Parse()
 
+	if hashPassword {
+		if err := printPasswordHash(); err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurs while hashing the password: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := db.Run(confPath); err != nil {
 		fmt.Fprintf(os.Stderr, "An error occurs while running the database: %v", err)
 		os.Exit(1)
 	}
 }
+
+func printPasswordHash() error {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("read password: %w", err)
+	}
+
+	hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		return err //nolint:wrapcheck // ignore
+	}
+	fmt.Println(hash)
+	return nil
+}
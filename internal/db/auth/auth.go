@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// DefaultUser is the user authenticated by AUTH without the user name.
+const DefaultUser = "default"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username-password pair")
+	ErrNoPermission       = errors.New("no permissions")
+	ErrDefaultUser        = errors.New("the 'default' user cannot be removed")
+)
+
+// User is the user the clients authenticate as together with its permissions.
+type User struct {
+	Name string
+	// PasswordHash is the hash of the password made by HashPassword,
+	// the user without the password can't authenticate.
+	PasswordHash string
+	// Categories are the categories of the commands the user may run.
+	Categories []string
+	// Keys are the glob patterns of the keys the user may access.
+	Keys []string
+	// ReadOnly forbids the commands of the write category.
+	ReadOnly bool
+}
+
+// Access describes what the command is going to access.
+type Access struct {
+	Command string
+	// Categories are all required to run the command, the commands
+	// without the categories may be run by any user.
+	Categories []string
+	Keys       []string
+	// AllKeys is set by the commands accessing the whole keyspace, e.g. SCAN.
+	AllKeys bool
+}
+
+type Option func(a *Authenticator)
+
+// WithACLFile keeps the users in the file. The file is loaded instead of
+// the users passed to NewAuthenticator if it exists and it's rewritten on
+// every change of the users.
+func WithACLFile(path string) Option {
+	return func(a *Authenticator) {
+		a.file = path
+	}
+}
+
+// Authenticator checks the passwords and the permissions of the users.
+type Authenticator struct {
+	file string
+	// iterations is the PBKDF2 iterations of the passwords set by SetUser.
+	iterations int
+
+	// mu guards the users and serializes their changes with writing the file.
+	mu    sync.RWMutex
+	users map[string]*user
+	// dummy is verified for the unknown users, so they can't be told
+	// from the known ones by the response time.
+	dummy passwordHash
+}
+
+func NewAuthenticator(users []User, opts ...Option) (*Authenticator, error) {
+	a := &Authenticator{
+		iterations: DefaultIterations,
+		users:      make(map[string]*user, len(users)),
+		dummy:      passwordHash{iterations: 1, salt: make([]byte, saltSize), key: make([]byte, keySize)},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	parsed, err := a.load(users)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range parsed {
+		if _, ok := a.users[u.name]; ok {
+			return nil, fmt.Errorf("user %s is duplicated", u.name)
+		}
+		a.users[u.name] = u
+		if u.hash != nil {
+			a.dummy.iterations = max(a.dummy.iterations, u.hash.iterations)
+		}
+	}
+	return a, nil
+}
+
+// load parses the users from the ACL file or from the given ones if there is no file.
+func (a *Authenticator) load(users []User) ([]*user, error) {
+	if a.file != "" {
+		parsed, err := readFile(a.file, a.iterations)
+		if err == nil {
+			return parsed, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	parsed := make([]*user, 0, len(users))
+	for _, u := range users {
+		p, err := newUser(u)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// Authenticate returns ErrInvalidCredentials if the user doesn't exist
+// or the password doesn't match.
+func (a *Authenticator) Authenticate(name, password string) error {
+	a.mu.RLock()
+	u, ok := a.users[name]
+	a.mu.RUnlock()
+
+	if !ok || u.hash == nil {
+		a.dummy.verify(password)
+		return ErrInvalidCredentials
+	}
+	if !u.hash.verify(password) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// Authorize returns ErrNoPermission if the user may not run the command.
+// The user deleted after it was authenticated has no permissions.
+func (a *Authenticator) Authorize(name string, access Access) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[name]
+	if !ok {
+		return fmt.Errorf("%w: user %s doesn't exist", ErrNoPermission, name)
+	}
+	for _, c := range access.Categories {
+		if !slices.Contains(u.categories, c) || (c == CategoryWrite && u.readOnly) {
+			return fmt.Errorf("%w to run the '%s' command", ErrNoPermission, access.Command)
+		}
+	}
+	if access.AllKeys && !slices.Contains(u.keys, allKeysPattern) {
+		return fmt.Errorf("%w to access all the keys by the '%s' command", ErrNoPermission, access.Command)
+	}
+	for _, key := range access.Keys {
+		if !u.matchKey(key) {
+			return fmt.Errorf("%w to access the '%s' key", ErrNoPermission, key)
+		}
+	}
+	return nil
+}
+
+// SetUser creates the user or changes the existing one by the rules
+// such as >password, +@read, -@write, ~pattern or readonly.
+// The rules are applied all or none.
+func (a *Authenticator) SetUser(name string, rules []string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	// The passwords are hashed before the lock is taken, the hashing is slow
+	// on purpose and would block the authentication of all the clients.
+	rules, err := prepareRules(rules, a.iterations)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u := &user{name: name}
+	if current, ok := a.users[name]; ok {
+		u = current.clone()
+	}
+	for _, rule := range rules {
+		if err = u.apply(rule, a.iterations); err != nil {
+			return err
+		}
+	}
+
+	users := a.cloneUsers()
+	users[name] = u
+	if err = a.save(users); err != nil {
+		return err
+	}
+	a.users = users
+	return nil
+}
+
+// DelUser deletes the users and returns the number of the existing ones.
+func (a *Authenticator) DelUser(names []string) (int, error) {
+	if slices.Contains(names, DefaultUser) {
+		return 0, ErrDefaultUser
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	users := a.cloneUsers()
+	for _, name := range names {
+		delete(users, name)
+	}
+	n := len(a.users) - len(users)
+	if n == 0 {
+		return 0, nil
+	}
+
+	if err := a.save(users); err != nil {
+		return 0, err
+	}
+	a.users = users
+	return n, nil
+}
+
+// List describes the users by the rules sorted by the user names.
+func (a *Authenticator) List() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return listUsers(a.users)
+}
+
+func (a *Authenticator) cloneUsers() map[string]*user {
+	users := make(map[string]*user, len(a.users))
+	for name, u := range a.users {
+		users[name] = u
+	}
+	return users
+}
+
+func (a *Authenticator) save(users map[string]*user) error {
+	if a.file == "" {
+		return nil
+	}
+	return writeFile(a.file, listUsers(users))
+}
+
+func listUsers(users map[string]*user) []string {
+	lines := make([]string, 0, len(users))
+	for _, u := range users {
+		lines = append(lines, u.String())
+	}
+	sort.Strings(lines)
+	return lines
+}
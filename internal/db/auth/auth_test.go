@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	defaultHash, err := hashPassword("secret", 10)
+	require.NoError(t, err)
+	adminHash, err := hashPassword("admin secret", 10)
+	require.NoError(t, err)
+
+	a, err := NewAuthenticator([]User{
+		{Name: DefaultUser, PasswordHash: defaultHash},
+		{Name: "admin", PasswordHash: adminHash},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		user     string
+		password string
+		wantErr  error
+	}{
+		{user: DefaultUser, password: "secret"},
+		{user: "admin", password: "admin secret"},
+		{user: "admin", password: "secret", wantErr: ErrInvalidCredentials},
+		{user: "unknown", password: "secret", wantErr: ErrInvalidCredentials},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.user+" "+tc.password, func(t *testing.T) {
+			assert.ErrorIs(t, a.Authenticate(tc.user, tc.password), tc.wantErr)
+		})
+	}
+}
+
+func TestNewAuthenticator_invalid(t *testing.T) {
+	hash, err := hashPassword("secret", 10)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		users []User
+	}{
+		{name: "empty name", users: []User{{PasswordHash: hash}}},
+		{name: "duplicated user", users: []User{{Name: "u", PasswordHash: hash}, {Name: "u", PasswordHash: hash}}},
+		{name: "invalid hash", users: []User{{Name: "u", PasswordHash: "secret"}}},
+		{name: "unknown category", users: []User{{Name: "u", Categories: []string{"unknown"}}}},
+		{name: "empty key pattern", users: []User{{Name: "u", Keys: []string{""}}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAuthenticator(tc.users)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthenticator_Authorize(t *testing.T) {
+	a, err := NewAuthenticator([]User{
+		{Name: "admin", Categories: []string{CategoryAll}, Keys: []string{"*"}},
+		{Name: "reader", Categories: []string{CategoryRead, CategoryWrite}, Keys: []string{"user:*", "cache:?"}, ReadOnly: true},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		user    string
+		access  Access
+		wantErr string
+	}{
+		{
+			name:   "admin",
+			user:   "admin",
+			access: Access{Command: "FLUSHALL", Categories: []string{CategoryAdmin, CategoryWrite}, AllKeys: true},
+		},
+		{
+			name:   "no categories",
+			user:   "reader",
+			access: Access{Command: "MULTI"},
+		},
+		{
+			name:   "matching keys",
+			user:   "reader",
+			access: Access{Command: "MGET", Categories: []string{CategoryRead}, Keys: []string{"user:1", "cache:a"}},
+		},
+		{
+			name:    "category not allowed",
+			user:    "reader",
+			access:  Access{Command: "SAVE", Categories: []string{CategoryAdmin}},
+			wantErr: "no permissions to run the 'SAVE' command",
+		},
+		{
+			name:    "read only",
+			user:    "reader",
+			access:  Access{Command: "SET", Categories: []string{CategoryWrite}, Keys: []string{"user:1"}},
+			wantErr: "no permissions to run the 'SET' command",
+		},
+		{
+			name:    "key not allowed",
+			user:    "reader",
+			access:  Access{Command: "MGET", Categories: []string{CategoryRead}, Keys: []string{"user:1", "cache:ab"}},
+			wantErr: "no permissions to access the 'cache:ab' key",
+		},
+		{
+			name:    "all keys not allowed",
+			user:    "reader",
+			access:  Access{Command: "SCAN", Categories: []string{CategoryRead}, AllKeys: true},
+			wantErr: "no permissions to access all the keys by the 'SCAN' command",
+		},
+		{
+			name:    "unknown user",
+			user:    "unknown",
+			access:  Access{Command: "MULTI"},
+			wantErr: "no permissions: user unknown doesn't exist",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := a.Authorize(tc.user, tc.access)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrNoPermission)
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestAuthenticator_SetUser(t *testing.T) {
+	a, err := NewAuthenticator(nil)
+	require.NoError(t, err)
+	a.iterations = 10
+
+	require.NoError(t, a.SetUser("alice", []string{">secret", "+@all", "-@admin", "~user:*", "readonly"}))
+	assert.NoError(t, a.Authenticate("alice", "secret"))
+	assert.NoError(t, a.Authorize("alice", Access{Command: "GET", Categories: []string{CategoryRead}, Keys: []string{"user:1"}}))
+	assert.ErrorIs(t, a.Authorize("alice", Access{Command: "SET", Categories: []string{CategoryWrite}}), ErrNoPermission)
+
+	// The invalid rule leaves the user as it was.
+	assert.ErrorIs(t, a.SetUser("alice", []string{"readwrite", "+@unknown"}), ErrInvalidRule)
+	assert.ErrorIs(t, a.Authorize("alice", Access{Command: "SET", Categories: []string{CategoryWrite}}), ErrNoPermission)
+
+	require.NoError(t, a.SetUser("alice", []string{"readwrite", ">changed"}))
+	assert.NoError(t, a.Authorize("alice", Access{Command: "SET", Categories: []string{CategoryWrite}, Keys: []string{"user:1"}}))
+	assert.ErrorIs(t, a.Authenticate("alice", "secret"), ErrInvalidCredentials)
+	assert.NoError(t, a.Authenticate("alice", "changed"))
+
+	require.NoError(t, a.SetUser("alice", []string{"resetpass"}))
+	assert.ErrorIs(t, a.Authenticate("alice", "changed"), ErrInvalidCredentials)
+
+	assert.Error(t, a.SetUser("bad name", nil))
+}
+
+func TestAuthenticator_DelUser(t *testing.T) {
+	a, err := NewAuthenticator([]User{{Name: DefaultUser}, {Name: "alice"}, {Name: "bob"}})
+	require.NoError(t, err)
+
+	_, err = a.DelUser([]string{"alice", DefaultUser})
+	assert.ErrorIs(t, err, ErrDefaultUser)
+
+	n, err := a.DelUser([]string{"alice", "bob", "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"user default"}, a.List())
+}
+
+func TestAuthenticator_aclFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl", "users.acl")
+	hash, err := hashPassword("secret", 10)
+	require.NoError(t, err)
+
+	a, err := NewAuthenticator([]User{{Name: DefaultUser, PasswordHash: hash, Categories: []string{CategoryAll}, Keys: []string{"*"}}}, WithACLFile(path))
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "the file is written on the first change")
+
+	a.iterations = 10
+	require.NoError(t, a.SetUser("alice", []string{">pass", "+@read", "~user:*", "readonly"}))
+	want := a.List()
+
+	// The file takes precedence over the users from the configuration.
+	reloaded, err := NewAuthenticator([]User{{Name: "bob"}}, WithACLFile(path))
+	require.NoError(t, err)
+	assert.Equal(t, want, reloaded.List())
+	assert.NoError(t, reloaded.Authenticate(DefaultUser, "secret"))
+	assert.NoError(t, reloaded.Authenticate("alice", "pass"))
+	assert.ErrorIs(t, reloaded.Authorize("alice", Access{Command: "SET", Categories: []string{CategoryWrite}}), ErrNoPermission)
+
+	n, err := reloaded.DelUser([]string{"alice"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	reloaded, err = NewAuthenticator(nil, WithACLFile(path))
+	require.NoError(t, err)
+	assert.Len(t, reloaded.List(), 1)
+}
+
+func TestNewAuthenticator_invalidFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{name: "not a user", content: "admin +@all\n"},
+		{name: "no name", content: "user\n"},
+		{name: "invalid rule", content: "# users\n\nuser admin +@all\nuser alice unknown\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "users.acl")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+
+			_, err := NewAuthenticator(nil, WithACLFile(path))
+			assert.Error(t, err)
+		})
+	}
+}
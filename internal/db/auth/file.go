@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errInvalidLine = errors.New("line must be: user <name> [rule ...]")
+
+// readFile reads the users from the ACL file. Every line describes
+// the user by its rules, the empty lines and the comments are skipped.
+func readFile(path string, iterations int) ([]*user, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open acl file: %w", err)
+	}
+	defer f.Close()
+
+	var (
+		users  []*user
+		lineNo int
+		sc     = bufio.NewScanner(f)
+	)
+	for sc.Scan() {
+		lineNo++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 { //nolint:mnd // user and name
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, errInvalidLine)
+		}
+
+		u := &user{name: fields[1]}
+		for _, rule := range fields[2:] {
+			if err = u.apply(rule, iterations); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		}
+		users = append(users, u)
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("read acl file: %w", err)
+	}
+	return users, nil
+}
+
+// writeFile replaces the ACL file by the lines atomically.
+func writeFile(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("create acl file directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create acl file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		_, _ = w.WriteString(line)
+		_ = w.WriteByte('\n')
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("write acl file: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("sync acl file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close acl file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename acl file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Package auth authenticates the clients by the user names and the passwords.
+// The passwords are kept as the salted PBKDF2-HMAC-SHA256 hashes.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultIterations is the number of PBKDF2 iterations of the new hashes.
+const DefaultIterations = 600_000
+
+const (
+	hashScheme = "pbkdf2-sha256"
+	saltSize   = 16
+	keySize    = sha256.Size
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+var b64 = base64.RawStdEncoding
+
+// HashPassword returns the hash of the password in the form
+// pbkdf2-sha256$<iterations>$<salt>$<key> with the base64 salt and key.
+func HashPassword(password string) (string, error) {
+	return hashPassword(password, DefaultIterations)
+}
+
+func hashPassword(password string, iterations int) (string, error) {
+	h, err := newPasswordHash(password, iterations)
+	if err != nil {
+		return "", err
+	}
+	return h.String(), nil
+}
+
+func newPasswordHash(password string, iterations int) (passwordHash, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return passwordHash{}, fmt.Errorf("generate salt: %w", err)
+	}
+
+	h := passwordHash{iterations: iterations, salt: salt}
+	h.key = h.derive(password)
+	return h, nil
+}
+
+type passwordHash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func parseHash(s string) (passwordHash, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 4 || parts[0] != hashScheme { //nolint:mnd // scheme, iterations, salt and key
+		return passwordHash{}, ErrInvalidHash
+	}
+
+	var (
+		h   passwordHash
+		err error
+	)
+	if h.iterations, err = strconv.Atoi(parts[1]); err != nil || h.iterations < 1 {
+		return passwordHash{}, ErrInvalidHash
+	}
+	if h.salt, err = b64.DecodeString(parts[2]); err != nil {
+		return passwordHash{}, ErrInvalidHash
+	}
+	if h.key, err = b64.DecodeString(parts[3]); err != nil || len(h.key) == 0 {
+		return passwordHash{}, ErrInvalidHash
+	}
+	return h, nil
+}
+
+func (h passwordHash) String() string {
+	return strings.Join([]string{hashScheme, strconv.Itoa(h.iterations), b64.EncodeToString(h.salt), b64.EncodeToString(h.key)}, "$")
+}
+
+func (h passwordHash) derive(password string) []byte {
+	return pbkdf2SHA256([]byte(password), h.salt, h.iterations, keySize)
+}
+
+// verify reports whether the password matches the hash in constant time.
+func (h passwordHash) verify(password string) bool {
+	key := pbkdf2SHA256([]byte(password), h.salt, h.iterations, len(h.key))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// pbkdf2SHA256 derives the key of the given length from the password as defined by RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var (
+		dk    = make([]byte, 0, blocks*hashLen)
+		u     = make([]byte, 0, hashLen)
+		index [4]byte
+	)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(index[:], uint32(block)) //nolint:gosec // the key length is small
+		prf.Write(index[:])
+		dk = prf.Sum(dk)
+
+		t := dk[len(dk)-hashLen:]
+		u = append(u[:0], t...)
+		for range iterations - 1 {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	testCases := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			want: "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+				"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			password:   "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			want: "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+				"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+		{
+			password:   "password",
+			salt:       "salt",
+			iterations: 4096,
+			want:       "c5e478d59288c841aa530db6845c4c8d962893a0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.password, func(t *testing.T) {
+			key := pbkdf2SHA256([]byte(tc.password), []byte(tc.salt), tc.iterations, len(tc.want)/2)
+			assert.Equal(t, tc.want, hex.EncodeToString(key))
+		})
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("secret", 10)
+	require.NoError(t, err)
+
+	h, err := parseHash(hash)
+	require.NoError(t, err)
+	assert.Equal(t, 10, h.iterations)
+	assert.Equal(t, hash, h.String())
+	assert.True(t, h.verify("secret"))
+	assert.False(t, h.verify("Secret"))
+
+	// The salt is random, so the hashes of the same password differ.
+	other, err := hashPassword("secret", 10)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestParseHash_invalid(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"secret",
+		"bcrypt$10$c2FsdA$a2V5",
+		"pbkdf2-sha256$0$c2FsdA$a2V5",
+		"pbkdf2-sha256$x$c2FsdA$a2V5",
+		"pbkdf2-sha256$10$!$a2V5",
+		"pbkdf2-sha256$10$c2FsdA$",
+		"pbkdf2-sha256$10$c2FsdA$a2V5$",
+	} {
+		_, err := parseHash(hash)
+		assert.ErrorIs(t, err, ErrInvalidHash, hash)
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Mort4lis/memdb/internal/pkg/glob"
+)
+
+// The categories of the commands.
+const (
+	CategoryRead   = "read"
+	CategoryWrite  = "write"
+	CategoryAdmin  = "admin"
+	CategoryPubSub = "pubsub"
+	// CategoryAll stands for all the categories in the rules.
+	CategoryAll = "all"
+)
+
+var categories = []string{CategoryAdmin, CategoryPubSub, CategoryRead, CategoryWrite}
+
+const allKeysPattern = "*"
+
+var (
+	ErrInvalidRule     = errors.New("syntax error in ACL rule")
+	ErrInvalidUserName = errors.New("user name must be non-empty and contain no whitespace")
+)
+
+// user is the parsed User.
+type user struct {
+	name string
+	hash *passwordHash
+	// categories are sorted and never contain CategoryAll.
+	categories []string
+	keys       []string
+	readOnly   bool
+}
+
+func newUser(u User) (*user, error) {
+	if err := validateName(u.Name); err != nil {
+		return nil, err
+	}
+
+	parsed := &user{name: u.Name, readOnly: u.ReadOnly}
+	if u.PasswordHash != "" {
+		h, err := parseHash(u.PasswordHash)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+		parsed.hash = &h
+	}
+	for _, c := range u.Categories {
+		if err := parsed.apply("+@"+c, 0); err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+	}
+	for _, pattern := range u.Keys {
+		if err := parsed.apply("~"+pattern, 0); err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+	}
+	return parsed, nil
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsFunc(name, isSpace) {
+		return ErrInvalidUserName
+	}
+	return nil
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+func (u *user) clone() *user {
+	c := *u
+	c.categories = slices.Clone(u.categories)
+	c.keys = slices.Clone(u.keys)
+	return &c
+}
+
+// prepareRules validates the rules and replaces the >password rules
+// by the #hash ones, so applying them is cheap.
+func prepareRules(rules []string, iterations int) ([]string, error) {
+	prepared := make([]string, len(rules))
+	scratch := &user{}
+	for i, rule := range rules {
+		if strings.HasPrefix(rule, ">") {
+			h, err := newPasswordHash(rule[1:], iterations)
+			if err != nil {
+				return nil, err
+			}
+			rule = "#" + h.String()
+		}
+		if err := scratch.apply(rule, iterations); err != nil {
+			return nil, err
+		}
+		prepared[i] = rule
+	}
+	return prepared, nil
+}
+
+// apply changes the user by the rule:
+//
+//	>password    sets the password hashed with the iterations
+//	#hash        sets the password hash made by HashPassword
+//	resetpass    removes the password, so the user can't authenticate
+//	+@category   allows the commands of the category or all of them by +@all
+//	-@category   forbids the commands of the category or all of them by -@all
+//	~pattern     allows the keys matching the glob pattern
+//	allkeys      is the alias of ~*
+//	resetkeys    forbids all the keys
+//	readonly     forbids the commands of the write category despite the categories
+//	readwrite    cancels readonly
+//	reset        removes the password and all the permissions
+func (u *user) apply(rule string, iterations int) error {
+	switch {
+	case strings.HasPrefix(rule, ">"):
+		h, err := newPasswordHash(rule[1:], iterations)
+		if err != nil {
+			return err
+		}
+		u.hash = &h
+	case strings.HasPrefix(rule, "#"):
+		h, err := parseHash(rule[1:])
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRule, err)
+		}
+		u.hash = &h
+	case rule == "resetpass":
+		u.hash = nil
+	case strings.HasPrefix(rule, "+@"), strings.HasPrefix(rule, "-@"):
+		return u.applyCategory(rule[2:], rule[0] == '+')
+	case strings.HasPrefix(rule, "~"):
+		pattern := rule[1:]
+		if pattern == "" || strings.ContainsFunc(pattern, isSpace) {
+			return fmt.Errorf("%w '%s'", ErrInvalidRule, rule)
+		}
+		if !slices.Contains(u.keys, pattern) {
+			u.keys = append(u.keys, pattern)
+		}
+	case rule == "allkeys":
+		return u.apply("~"+allKeysPattern, iterations)
+	case rule == "resetkeys":
+		u.keys = nil
+	case rule == "readonly", rule == "readwrite":
+		u.readOnly = rule == "readonly"
+	case rule == "reset":
+		*u = user{name: u.name}
+	default:
+		return fmt.Errorf("%w '%s'", ErrInvalidRule, rule)
+	}
+	return nil
+}
+
+func (u *user) applyCategory(category string, allow bool) error {
+	changed := []string{category}
+	if category == CategoryAll {
+		changed = categories
+	} else if !slices.Contains(categories, category) {
+		return fmt.Errorf("%w: unknown category '%s'", ErrInvalidRule, category)
+	}
+
+	for _, c := range changed {
+		i, found := slices.BinarySearch(u.categories, c)
+		switch {
+		case allow && !found:
+			u.categories = slices.Insert(u.categories, i, c)
+		case !allow && found:
+			u.categories = slices.Delete(u.categories, i, i+1)
+		}
+	}
+	return nil
+}
+
+func (u *user) matchKey(key string) bool {
+	for _, pattern := range u.keys {
+		if glob.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the user by the line of the ACL file,
+// the rules reproduce the user if they are applied in order.
+func (u *user) String() string {
+	rules := []string{"user", u.name}
+	if u.hash != nil {
+		rules = append(rules, "#"+u.hash.String())
+	}
+	for _, pattern := range u.keys {
+		rules = append(rules, "~"+pattern)
+	}
+	if slices.Equal(u.categories, categories) {
+		rules = append(rules, "+@"+CategoryAll)
+	} else {
+		for _, c := range u.categories {
+			rules = append(rules, "+@"+c)
+		}
+	}
+	if u.readOnly {
+		rules = append(rules, "readonly")
+	}
+	return strings.Join(rules, " ")
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUser_apply(t *testing.T) {
+	hash, err := hashPassword("secret", 10)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		rules []string
+		want  string
+	}{
+		{
+			name: "no rules",
+			want: "user alice",
+		},
+		{
+			name:  "all categories",
+			rules: []string{"+@read", "+@all", "allkeys"},
+			want:  "user alice ~* +@all",
+		},
+		{
+			name:  "removed categories",
+			rules: []string{"+@all", "-@admin", "-@pubsub", "-@admin"},
+			want:  "user alice +@read +@write",
+		},
+		{
+			name:  "keys",
+			rules: []string{"~user:*", "~cache:?", "~user:*", "readonly"},
+			want:  "user alice ~user:* ~cache:? readonly",
+		},
+		{
+			name:  "reset keys",
+			rules: []string{"~user:*", "resetkeys", "~cache:*", "readonly", "readwrite"},
+			want:  "user alice ~cache:*",
+		},
+		{
+			name:  "password hash",
+			rules: []string{"#" + hash, "+@read"},
+			want:  "user alice #" + hash + " +@read",
+		},
+		{
+			name:  "reset",
+			rules: []string{"#" + hash, "+@all", "allkeys", "readonly", "reset", "+@pubsub"},
+			want:  "user alice +@pubsub",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &user{name: "alice"}
+			for _, rule := range tc.rules {
+				require.NoError(t, u.apply(rule, 10))
+			}
+			assert.Equal(t, tc.want, u.String())
+		})
+	}
+}
+
+func TestUser_apply_password(t *testing.T) {
+	u := &user{name: "alice"}
+	require.NoError(t, u.apply(">secret", 10))
+	require.NotNil(t, u.hash)
+	assert.True(t, u.hash.verify("secret"))
+
+	require.NoError(t, u.apply("resetpass", 10))
+	assert.Nil(t, u.hash)
+}
+
+func TestUser_apply_invalid(t *testing.T) {
+	for _, rule := range []string{"", "unknown", "+@unknown", "-@", "~", "#secret", "+read"} {
+		t.Run(rule, func(t *testing.T) {
+			assert.Error(t, (&user{name: "alice"}).apply(rule, 10))
+		})
+	}
+}
+
+func TestPrepareRules(t *testing.T) {
+	rules, err := prepareRules([]string{">secret", "+@read"}, 10)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "+@read", rules[1])
+
+	u := &user{name: "alice"}
+	require.NoError(t, u.apply(rules[0], 10))
+	require.NotNil(t, u.hash)
+	assert.True(t, u.hash.verify("secret"))
+
+	_, err = prepareRules([]string{">secret", "+@unknown"}, 10)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
@@ -0,0 +1,154 @@
+package compute
+
+import (
+	"slices"
+	"sync"
+)
+
+// waiter is the client blocked by BLPOP or BRPOP.
+type waiter struct {
+	db   int
+	keys []string
+	// ready is signaled when the client may pop from one of the keys.
+	ready chan struct{}
+}
+
+// waitQueues keeps the blocked clients in FIFO order per key of the database. Only the first
+// client of the queue pops from the key, it passes the turn to the next one
+// leaving the queue. The clients are only woken up here and pop the elements
+// themselves, so no storage lock is held while they are blocked.
+type waitQueues struct {
+	mu     sync.Mutex
+	queues map[string][]*waiter
+}
+
+func newWaitQueues() *waitQueues {
+	return &waitQueues{queues: make(map[string][]*waiter)}
+}
+
+// add puts the client to the end of the queues of the keys of the database.
+func (q *waitQueues) add(db int, keys []string) *waiter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	w := &waiter{db: db, keys: keys, ready: make(chan struct{}, 1)}
+	for _, key := range keys {
+		key = scopedKey(db, key)
+		if !slices.Contains(q.queues[key], w) {
+			q.queues[key] = append(q.queues[key], w)
+		}
+	}
+	return w
+}
+
+// turn returns the keys the client is the first in the queues of.
+func (q *waitQueues) turn(w *waiter) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var keys []string
+	for _, key := range w.keys {
+		if queue := q.queues[scopedKey(w.db, key)]; len(queue) != 0 && queue[0] == w && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// remove takes the client out of the queues waking up the next clients.
+func (q *waitQueues) remove(w *waiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, key := range w.keys {
+		key = scopedKey(w.db, key)
+		queue := q.queues[key]
+		i := slices.Index(queue, w)
+		if i < 0 {
+			continue
+		}
+		queue = slices.Delete(queue, i, i+1)
+		if len(queue) == 0 {
+			delete(q.queues, key)
+			continue
+		}
+		q.queues[key] = queue
+		if i == 0 {
+			q.notifyLocked(key)
+		}
+	}
+}
+
+// notify wakes up the first client blocked by the key of the database.
+func (q *waitQueues) notify(db int, key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notifyLocked(scopedKey(db, key))
+}
+
+func (q *waitQueues) notifyLocked(key string) {
+	queue := q.queues[key]
+	if len(queue) == 0 {
+		return
+	}
+	select {
+	case queue[0].ready <- struct{}{}:
+	default:
+		// The client is already signaled.
+	}
+}
+
+// keySignals wakes up all the clients blocked by the key, unlike waitQueues
+// serving them one by one. It's used by the stream reads not consuming
+// the data, so every blocked client may read it.
+type keySignals struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func newKeySignals() *keySignals {
+	return &keySignals{waiters: make(map[string]map[chan struct{}]struct{})}
+}
+
+// add returns the channel signaled when any of the keys of the database is changed.
+func (s *keySignals) add(db int, keys []string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	for _, key := range keys {
+		key = scopedKey(db, key)
+		if s.waiters[key] == nil {
+			s.waiters[key] = make(map[chan struct{}]struct{})
+		}
+		s.waiters[key][ch] = struct{}{}
+	}
+	return ch
+}
+
+func (s *keySignals) remove(db int, keys []string, ch chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		key = scopedKey(db, key)
+		delete(s.waiters[key], ch)
+		if len(s.waiters[key]) == 0 {
+			delete(s.waiters, key)
+		}
+	}
+}
+
+// notify wakes up all the clients blocked by the key of the database.
+func (s *keySignals) notify(db int, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.waiters[scopedKey(db, key)] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// The client is already signaled.
+		}
+	}
+}
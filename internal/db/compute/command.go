@@ -1,6 +1,10 @@
 package compute
 
 import (
+	"math"
+	"strings"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
 	pkgmaps "github.com/Mort4lis/memdb/internal/pkg/maps"
 )
 
@@ -8,6 +12,107 @@ const (
 	SetCommandName = "SET"
 	GetCommandName = "GET"
 	DelCommandName = "DEL"
+
+	SetNXCommandName  = "SETNX"
+	GetSetCommandName = "GETSET"
+	CASCommandName    = "CAS"
+	GetDelCommandName = "GETDEL"
+
+	MSetCommandName = "MSET"
+	MGetCommandName = "MGET"
+
+	IncrCommandName        = "INCR"
+	DecrCommandName        = "DECR"
+	IncrByCommandName      = "INCRBY"
+	IncrByFloatCommandName = "INCRBYFLOAT"
+
+	HSetCommandName    = "HSET"
+	HGetCommandName    = "HGET"
+	HMGetCommandName   = "HMGET"
+	HDelCommandName    = "HDEL"
+	HLenCommandName    = "HLEN"
+	HExistsCommandName = "HEXISTS"
+	HKeysCommandName   = "HKEYS"
+	HValsCommandName   = "HVALS"
+	HGetAllCommandName = "HGETALL"
+	HIncrByCommandName = "HINCRBY"
+
+	LPushCommandName  = "LPUSH"
+	RPushCommandName  = "RPUSH"
+	LPopCommandName   = "LPOP"
+	RPopCommandName   = "RPOP"
+	LRangeCommandName = "LRANGE"
+	LLenCommandName   = "LLEN"
+	LIndexCommandName = "LINDEX"
+	LTrimCommandName  = "LTRIM"
+	BLPopCommandName  = "BLPOP"
+	BRPopCommandName  = "BRPOP"
+
+	SAddCommandName      = "SADD"
+	SRemCommandName      = "SREM"
+	SIsMemberCommandName = "SISMEMBER"
+	SMembersCommandName  = "SMEMBERS"
+	SCardCommandName     = "SCARD"
+	SInterCommandName    = "SINTER"
+	SUnionCommandName    = "SUNION"
+	SDiffCommandName     = "SDIFF"
+
+	ZAddCommandName          = "ZADD"
+	ZRemCommandName          = "ZREM"
+	ZScoreCommandName        = "ZSCORE"
+	ZRankCommandName         = "ZRANK"
+	ZRangeCommandName        = "ZRANGE"
+	ZRangeByScoreCommandName = "ZRANGEBYSCORE"
+	ZIncrByCommandName       = "ZINCRBY"
+
+	SubscribeCommandName    = "SUBSCRIBE"
+	UnsubscribeCommandName  = "UNSUBSCRIBE"
+	PSubscribeCommandName   = "PSUBSCRIBE"
+	PUnsubscribeCommandName = "PUNSUBSCRIBE"
+	PublishCommandName      = "PUBLISH"
+	NotifyCommandName       = "NOTIFY"
+	UnnotifyCommandName     = "UNNOTIFY"
+
+	XAddCommandName       = "XADD"
+	XRangeCommandName     = "XRANGE"
+	XRevRangeCommandName  = "XREVRANGE"
+	XLenCommandName       = "XLEN"
+	XTrimCommandName      = "XTRIM"
+	XReadCommandName      = "XREAD"
+	XGroupCommandName     = "XGROUP"
+	XReadGroupCommandName = "XREADGROUP"
+	XAckCommandName       = "XACK"
+	XPendingCommandName   = "XPENDING"
+
+	SelectCommandName   = "SELECT"
+	MoveCommandName     = "MOVE"
+	FlushDBCommandName  = "FLUSHDB"
+	FlushAllCommandName = "FLUSHALL"
+	DBSizeCommandName   = "DBSIZE"
+
+	AuthCommandName = "AUTH"
+	ACLCommandName  = "ACL"
+
+	SaveCommandName   = "SAVE"
+	BGSaveCommandName = "BGSAVE"
+	InfoCommandName   = "INFO"
+
+	ExpireCommandName    = "EXPIRE"
+	PExpireCommandName   = "PEXPIRE"
+	ExpireAtCommandName  = "EXPIREAT"
+	PExpireAtCommandName = "PEXPIREAT"
+	TTLCommandName       = "TTL"
+	PTTLCommandName      = "PTTL"
+	PersistCommandName   = "PERSIST"
+
+	ScanCommandName  = "SCAN"
+	RangeCommandName = "RANGE"
+
+	MultiCommandName   = "MULTI"
+	ExecCommandName    = "EXEC"
+	DiscardCommandName = "DISCARD"
+	WatchCommandName   = "WATCH"
+	UnwatchCommandName = "UNWATCH"
 )
 
 type CommandID int
@@ -16,20 +121,563 @@ const (
 	SetCommandID CommandID = iota + 1
 	GetCommandID
 	DelCommandID
+	SaveCommandID
+	BGSaveCommandID
+	ExpireCommandID
+	PExpireCommandID
+	ExpireAtCommandID
+	PExpireAtCommandID
+	TTLCommandID
+	PTTLCommandID
+	PersistCommandID
+	InfoCommandID
+	ScanCommandID
+	RangeCommandID
+	MultiCommandID
+	ExecCommandID
+	DiscardCommandID
+	WatchCommandID
+	UnwatchCommandID
+	MSetCommandID
+	MGetCommandID
+	IncrCommandID
+	DecrCommandID
+	IncrByCommandID
+	IncrByFloatCommandID
+	SetNXCommandID
+	GetSetCommandID
+	CASCommandID
+	GetDelCommandID
+	HSetCommandID
+	HGetCommandID
+	HMGetCommandID
+	HDelCommandID
+	HLenCommandID
+	HExistsCommandID
+	HKeysCommandID
+	HValsCommandID
+	HGetAllCommandID
+	HIncrByCommandID
+	LPushCommandID
+	RPushCommandID
+	LPopCommandID
+	RPopCommandID
+	LRangeCommandID
+	LLenCommandID
+	LIndexCommandID
+	LTrimCommandID
+	BLPopCommandID
+	BRPopCommandID
+	SAddCommandID
+	SRemCommandID
+	SIsMemberCommandID
+	SMembersCommandID
+	SCardCommandID
+	SInterCommandID
+	SUnionCommandID
+	SDiffCommandID
+	ZAddCommandID
+	ZRemCommandID
+	ZScoreCommandID
+	ZRankCommandID
+	ZRangeCommandID
+	ZRangeByScoreCommandID
+	ZIncrByCommandID
+	SubscribeCommandID
+	UnsubscribeCommandID
+	PSubscribeCommandID
+	PUnsubscribeCommandID
+	PublishCommandID
+	NotifyCommandID
+	UnnotifyCommandID
+	XAddCommandID
+	XRangeCommandID
+	XRevRangeCommandID
+	XLenCommandID
+	XTrimCommandID
+	XReadCommandID
+	XGroupCommandID
+	XReadGroupCommandID
+	XAckCommandID
+	XPendingCommandID
+	SelectCommandID
+	MoveCommandID
+	FlushDBCommandID
+	FlushAllCommandID
+	DBSizeCommandID
+	AuthCommandID
+	ACLCommandID
 )
 
 var commandIDNameMapping = map[CommandID]string{
 	SetCommandID: SetCommandName,
 	GetCommandID: GetCommandName,
 	DelCommandID: DelCommandName,
+
+	SetNXCommandID:  SetNXCommandName,
+	GetSetCommandID: GetSetCommandName,
+	CASCommandID:    CASCommandName,
+	GetDelCommandID: GetDelCommandName,
+
+	MSetCommandID: MSetCommandName,
+	MGetCommandID: MGetCommandName,
+
+	IncrCommandID:        IncrCommandName,
+	DecrCommandID:        DecrCommandName,
+	IncrByCommandID:      IncrByCommandName,
+	IncrByFloatCommandID: IncrByFloatCommandName,
+
+	HSetCommandID:    HSetCommandName,
+	HGetCommandID:    HGetCommandName,
+	HMGetCommandID:   HMGetCommandName,
+	HDelCommandID:    HDelCommandName,
+	HLenCommandID:    HLenCommandName,
+	HExistsCommandID: HExistsCommandName,
+	HKeysCommandID:   HKeysCommandName,
+	HValsCommandID:   HValsCommandName,
+	HGetAllCommandID: HGetAllCommandName,
+	HIncrByCommandID: HIncrByCommandName,
+
+	LPushCommandID:  LPushCommandName,
+	RPushCommandID:  RPushCommandName,
+	LPopCommandID:   LPopCommandName,
+	RPopCommandID:   RPopCommandName,
+	LRangeCommandID: LRangeCommandName,
+	LLenCommandID:   LLenCommandName,
+	LIndexCommandID: LIndexCommandName,
+	LTrimCommandID:  LTrimCommandName,
+	BLPopCommandID:  BLPopCommandName,
+	BRPopCommandID:  BRPopCommandName,
+
+	SAddCommandID:      SAddCommandName,
+	SRemCommandID:      SRemCommandName,
+	SIsMemberCommandID: SIsMemberCommandName,
+	SMembersCommandID:  SMembersCommandName,
+	SCardCommandID:     SCardCommandName,
+	SInterCommandID:    SInterCommandName,
+	SUnionCommandID:    SUnionCommandName,
+	SDiffCommandID:     SDiffCommandName,
+
+	ZAddCommandID:          ZAddCommandName,
+	ZRemCommandID:          ZRemCommandName,
+	ZScoreCommandID:        ZScoreCommandName,
+	ZRankCommandID:         ZRankCommandName,
+	ZRangeCommandID:        ZRangeCommandName,
+	ZRangeByScoreCommandID: ZRangeByScoreCommandName,
+	ZIncrByCommandID:       ZIncrByCommandName,
+
+	SubscribeCommandID:    SubscribeCommandName,
+	UnsubscribeCommandID:  UnsubscribeCommandName,
+	PSubscribeCommandID:   PSubscribeCommandName,
+	PUnsubscribeCommandID: PUnsubscribeCommandName,
+	PublishCommandID:      PublishCommandName,
+	NotifyCommandID:       NotifyCommandName,
+	UnnotifyCommandID:     UnnotifyCommandName,
+
+	XAddCommandID:       XAddCommandName,
+	XRangeCommandID:     XRangeCommandName,
+	XRevRangeCommandID:  XRevRangeCommandName,
+	XLenCommandID:       XLenCommandName,
+	XTrimCommandID:      XTrimCommandName,
+	XReadCommandID:      XReadCommandName,
+	XGroupCommandID:     XGroupCommandName,
+	XReadGroupCommandID: XReadGroupCommandName,
+	XAckCommandID:       XAckCommandName,
+	XPendingCommandID:   XPendingCommandName,
+
+	SelectCommandID:   SelectCommandName,
+	MoveCommandID:     MoveCommandName,
+	FlushDBCommandID:  FlushDBCommandName,
+	FlushAllCommandID: FlushAllCommandName,
+	DBSizeCommandID:   DBSizeCommandName,
+
+	AuthCommandID: AuthCommandName,
+	ACLCommandID:  ACLCommandName,
+
+	SaveCommandID:   SaveCommandName,
+	BGSaveCommandID: BGSaveCommandName,
+
+	ExpireCommandID:    ExpireCommandName,
+	PExpireCommandID:   PExpireCommandName,
+	ExpireAtCommandID:  ExpireAtCommandName,
+	PExpireAtCommandID: PExpireAtCommandName,
+	TTLCommandID:       TTLCommandName,
+	PTTLCommandID:      PTTLCommandName,
+	PersistCommandID:   PersistCommandName,
+
+	InfoCommandID: InfoCommandName,
+
+	ScanCommandID:  ScanCommandName,
+	RangeCommandID: RangeCommandName,
+
+	MultiCommandID:   MultiCommandName,
+	ExecCommandID:    ExecCommandName,
+	DiscardCommandID: DiscardCommandName,
+	WatchCommandID:   WatchCommandName,
+	UnwatchCommandID: UnwatchCommandName,
 }
 
 var nameCommandIDMapping = pkgmaps.Reverse(commandIDNameMapping)
 
-var commandIDArgNumbersMapping = map[CommandID]int{
-	SetCommandID: 2, //nolint:mnd // ignore magic number
-	GetCommandID: 1,
-	DelCommandID: 1,
+type argNumbers struct {
+	min int
+	max int
+	// step is the size of the groups the arguments above min come in.
+	step int
+}
+
+func (n argNumbers) valid(num int) bool {
+	if num < n.min || num > n.max {
+		return false
+	}
+	return n.step <= 1 || (num-n.min)%n.step == 0
+}
+
+func exactArgs(n int) argNumbers {
+	return argNumbers{min: n, max: n}
+}
+
+func atLeastArgs(n int) argNumbers {
+	return argNumbers{min: n, max: math.MaxInt}
+}
+
+// argGroups requires one or more groups of the given size, e.g. key-value pairs.
+func argGroups(size int) argNumbers {
+	return argNumbers{min: size, max: math.MaxInt, step: size}
+}
+
+var commandIDArgNumbersMapping = map[CommandID]argNumbers{
+	SetCommandID: {min: 2, max: 6}, //nolint:mnd // ignore magic number
+	GetCommandID: exactArgs(1),
+	DelCommandID: atLeastArgs(1),
+
+	SetNXCommandID:  exactArgs(2), //nolint:mnd // ignore magic number
+	GetSetCommandID: exactArgs(2), //nolint:mnd // ignore magic number
+	CASCommandID:    exactArgs(3), //nolint:mnd // ignore magic number
+	GetDelCommandID: exactArgs(1),
+
+	MSetCommandID: argGroups(2), //nolint:mnd // key and value
+	MGetCommandID: atLeastArgs(1),
+
+	IncrCommandID:        exactArgs(1),
+	DecrCommandID:        exactArgs(1),
+	IncrByCommandID:      exactArgs(2), //nolint:mnd // ignore magic number
+	IncrByFloatCommandID: exactArgs(2), //nolint:mnd // ignore magic number
+
+	HSetCommandID:    {min: 3, max: math.MaxInt, step: 2}, //nolint:mnd // key and field-value pairs
+	HGetCommandID:    exactArgs(2),                        //nolint:mnd // ignore magic number
+	HMGetCommandID:   atLeastArgs(2),                      //nolint:mnd // ignore magic number
+	HDelCommandID:    atLeastArgs(2),                      //nolint:mnd // ignore magic number
+	HLenCommandID:    exactArgs(1),
+	HExistsCommandID: exactArgs(2), //nolint:mnd // ignore magic number
+	HKeysCommandID:   exactArgs(1),
+	HValsCommandID:   exactArgs(1),
+	HGetAllCommandID: exactArgs(1),
+	HIncrByCommandID: exactArgs(3), //nolint:mnd // ignore magic number
+
+	LPushCommandID:  atLeastArgs(2),   //nolint:mnd // ignore magic number
+	RPushCommandID:  atLeastArgs(2),   //nolint:mnd // ignore magic number
+	LPopCommandID:   {min: 1, max: 2}, //nolint:mnd // ignore magic number
+	RPopCommandID:   {min: 1, max: 2}, //nolint:mnd // ignore magic number
+	LRangeCommandID: exactArgs(3),     //nolint:mnd // ignore magic number
+	LLenCommandID:   exactArgs(1),
+	LIndexCommandID: exactArgs(2),   //nolint:mnd // ignore magic number
+	LTrimCommandID:  exactArgs(3),   //nolint:mnd // ignore magic number
+	BLPopCommandID:  atLeastArgs(2), //nolint:mnd // keys and timeout
+	BRPopCommandID:  atLeastArgs(2), //nolint:mnd // keys and timeout
+
+	SAddCommandID:      atLeastArgs(2), //nolint:mnd // ignore magic number
+	SRemCommandID:      atLeastArgs(2), //nolint:mnd // ignore magic number
+	SIsMemberCommandID: exactArgs(2),   //nolint:mnd // ignore magic number
+	SMembersCommandID:  exactArgs(1),
+	SCardCommandID:     exactArgs(1),
+	SInterCommandID:    atLeastArgs(1),
+	SUnionCommandID:    atLeastArgs(1),
+	SDiffCommandID:     atLeastArgs(1),
+
+	ZAddCommandID:          {min: 3, max: math.MaxInt, step: 2}, //nolint:mnd // key and score-member pairs
+	ZRemCommandID:          atLeastArgs(2),                      //nolint:mnd // ignore magic number
+	ZScoreCommandID:        exactArgs(2),                        //nolint:mnd // ignore magic number
+	ZRankCommandID:         exactArgs(2),                        //nolint:mnd // ignore magic number
+	ZRangeCommandID:        {min: 3, max: 8},                    //nolint:mnd // ignore magic number
+	ZRangeByScoreCommandID: {min: 3, max: 7},                    //nolint:mnd // ignore magic number
+	ZIncrByCommandID:       exactArgs(3),                        //nolint:mnd // ignore magic number
+
+	SubscribeCommandID:    atLeastArgs(1),
+	UnsubscribeCommandID:  atLeastArgs(0),
+	PSubscribeCommandID:   atLeastArgs(1),
+	PUnsubscribeCommandID: atLeastArgs(0),
+	PublishCommandID:      exactArgs(2), //nolint:mnd // channel and message
+	NotifyCommandID:       atLeastArgs(1),
+	UnnotifyCommandID:     atLeastArgs(0),
+
+	XAddCommandID:       atLeastArgs(4),   //nolint:mnd // key, ID and field-value pair
+	XRangeCommandID:     {min: 3, max: 5}, //nolint:mnd // ignore magic number
+	XRevRangeCommandID:  {min: 3, max: 5}, //nolint:mnd // ignore magic number
+	XLenCommandID:       exactArgs(1),
+	XTrimCommandID:      {min: 3, max: 4}, //nolint:mnd // ignore magic number
+	XReadCommandID:      atLeastArgs(3),   //nolint:mnd // STREAMS key ID
+	XGroupCommandID:     {min: 4, max: 5}, //nolint:mnd // ignore magic number
+	XReadGroupCommandID: atLeastArgs(6),   //nolint:mnd // GROUP group consumer STREAMS key ID
+	XAckCommandID:       atLeastArgs(3),   //nolint:mnd // key, group and ID
+	XPendingCommandID:   {min: 2, max: 6}, //nolint:mnd // ignore magic number
+
+	SelectCommandID:   exactArgs(1),
+	MoveCommandID:     exactArgs(2), //nolint:mnd // key and database
+	FlushDBCommandID:  exactArgs(0),
+	FlushAllCommandID: exactArgs(0),
+	DBSizeCommandID:   exactArgs(0),
+
+	AuthCommandID: {min: 1, max: 2}, //nolint:mnd // [user] password
+	ACLCommandID:  atLeastArgs(1),
+
+	SaveCommandID:   exactArgs(0),
+	BGSaveCommandID: exactArgs(0),
+
+	ExpireCommandID:    exactArgs(2), //nolint:mnd // ignore magic number
+	PExpireCommandID:   exactArgs(2), //nolint:mnd // ignore magic number
+	ExpireAtCommandID:  exactArgs(2), //nolint:mnd // ignore magic number
+	PExpireAtCommandID: exactArgs(2), //nolint:mnd // ignore magic number
+	TTLCommandID:       exactArgs(1),
+	PTTLCommandID:      exactArgs(1),
+	PersistCommandID:   exactArgs(1),
+
+	InfoCommandID: exactArgs(0),
+
+	ScanCommandID:  {min: 1, max: 5}, //nolint:mnd // ignore magic number
+	RangeCommandID: {min: 2, max: 4}, //nolint:mnd // ignore magic number
+
+	MultiCommandID:   exactArgs(0),
+	ExecCommandID:    exactArgs(0),
+	DiscardCommandID: exactArgs(0),
+	WatchCommandID:   atLeastArgs(1),
+	UnwatchCommandID: exactArgs(0),
+}
+
+// keySpec describes the positions of the keys among the command arguments.
+type keySpec struct {
+	first int
+	// last is the position of the last key, negative values count from the end.
+	last int
+	step int
+	// streams means the keys follow the STREAMS option searched from first,
+	// they are followed by as many IDs.
+	streams bool
+}
+
+var (
+	firstKey = keySpec{first: 0, last: 0, step: 1}
+	allKeys  = keySpec{first: 0, last: -1, step: 1}
+	// pairKeys are the keys of the key-value pairs.
+	pairKeys = keySpec{first: 0, last: -1, step: 2}
+	// blockingKeys are followed by the timeout.
+	blockingKeys = keySpec{first: 0, last: -2, step: 1}
+	secondKey    = keySpec{first: 1, last: 1, step: 1}
+)
+
+var commandIDKeySpecMapping = map[CommandID]keySpec{
+	SetCommandID: firstKey,
+	GetCommandID: firstKey,
+	DelCommandID: allKeys,
+
+	SetNXCommandID:  firstKey,
+	GetSetCommandID: firstKey,
+	CASCommandID:    firstKey,
+	GetDelCommandID: firstKey,
+
+	MSetCommandID: pairKeys,
+	MGetCommandID: allKeys,
+
+	IncrCommandID:        firstKey,
+	DecrCommandID:        firstKey,
+	IncrByCommandID:      firstKey,
+	IncrByFloatCommandID: firstKey,
+
+	HSetCommandID:    firstKey,
+	HGetCommandID:    firstKey,
+	HMGetCommandID:   firstKey,
+	HDelCommandID:    firstKey,
+	HLenCommandID:    firstKey,
+	HExistsCommandID: firstKey,
+	HKeysCommandID:   firstKey,
+	HValsCommandID:   firstKey,
+	HGetAllCommandID: firstKey,
+	HIncrByCommandID: firstKey,
+
+	LPushCommandID:  firstKey,
+	RPushCommandID:  firstKey,
+	LPopCommandID:   firstKey,
+	RPopCommandID:   firstKey,
+	LRangeCommandID: firstKey,
+	LLenCommandID:   firstKey,
+	LIndexCommandID: firstKey,
+	LTrimCommandID:  firstKey,
+	BLPopCommandID:  blockingKeys,
+	BRPopCommandID:  blockingKeys,
+
+	SAddCommandID:      firstKey,
+	SRemCommandID:      firstKey,
+	SIsMemberCommandID: firstKey,
+	SMembersCommandID:  firstKey,
+	SCardCommandID:     firstKey,
+	SInterCommandID:    allKeys,
+	SUnionCommandID:    allKeys,
+	SDiffCommandID:     allKeys,
+
+	ZAddCommandID:          firstKey,
+	ZRemCommandID:          firstKey,
+	ZScoreCommandID:        firstKey,
+	ZRankCommandID:         firstKey,
+	ZRangeCommandID:        firstKey,
+	ZRangeByScoreCommandID: firstKey,
+	ZIncrByCommandID:       firstKey,
+
+	ExpireCommandID:    firstKey,
+	PExpireCommandID:   firstKey,
+	ExpireAtCommandID:  firstKey,
+	PExpireAtCommandID: firstKey,
+	TTLCommandID:       firstKey,
+	PTTLCommandID:      firstKey,
+	PersistCommandID:   firstKey,
+
+	XAddCommandID:       firstKey,
+	XRangeCommandID:     firstKey,
+	XRevRangeCommandID:  firstKey,
+	XLenCommandID:       firstKey,
+	XTrimCommandID:      firstKey,
+	XReadCommandID:      {first: 0, streams: true},
+	XGroupCommandID:     secondKey,
+	XReadGroupCommandID: {first: 3, streams: true}, //nolint:mnd // after GROUP group consumer
+	XAckCommandID:       firstKey,
+	XPendingCommandID:   firstKey,
+
+	MoveCommandID: firstKey,
+
+	WatchCommandID: allKeys,
+}
+
+var (
+	readCategories   = []string{auth.CategoryRead}
+	writeCategories  = []string{auth.CategoryWrite}
+	adminCategories  = []string{auth.CategoryAdmin}
+	pubSubCategories = []string{auth.CategoryPubSub}
+	flushCategories  = []string{auth.CategoryAdmin, auth.CategoryWrite}
+)
+
+// commandIDCategoriesMapping defines the categories of the commands checked by ACL,
+// the connection commands, e.g. AUTH or MULTI, have no categories.
+var commandIDCategoriesMapping = map[CommandID][]string{
+	SetCommandID: writeCategories,
+	GetCommandID: readCategories,
+	DelCommandID: writeCategories,
+
+	SetNXCommandID:  writeCategories,
+	GetSetCommandID: writeCategories,
+	CASCommandID:    writeCategories,
+	GetDelCommandID: writeCategories,
+
+	MSetCommandID: writeCategories,
+	MGetCommandID: readCategories,
+
+	IncrCommandID:        writeCategories,
+	DecrCommandID:        writeCategories,
+	IncrByCommandID:      writeCategories,
+	IncrByFloatCommandID: writeCategories,
+
+	HSetCommandID:    writeCategories,
+	HGetCommandID:    readCategories,
+	HMGetCommandID:   readCategories,
+	HDelCommandID:    writeCategories,
+	HLenCommandID:    readCategories,
+	HExistsCommandID: readCategories,
+	HKeysCommandID:   readCategories,
+	HValsCommandID:   readCategories,
+	HGetAllCommandID: readCategories,
+	HIncrByCommandID: writeCategories,
+
+	LPushCommandID:  writeCategories,
+	RPushCommandID:  writeCategories,
+	LPopCommandID:   writeCategories,
+	RPopCommandID:   writeCategories,
+	LRangeCommandID: readCategories,
+	LLenCommandID:   readCategories,
+	LIndexCommandID: readCategories,
+	LTrimCommandID:  writeCategories,
+	BLPopCommandID:  writeCategories,
+	BRPopCommandID:  writeCategories,
+
+	SAddCommandID:      writeCategories,
+	SRemCommandID:      writeCategories,
+	SIsMemberCommandID: readCategories,
+	SMembersCommandID:  readCategories,
+	SCardCommandID:     readCategories,
+	SInterCommandID:    readCategories,
+	SUnionCommandID:    readCategories,
+	SDiffCommandID:     readCategories,
+
+	ZAddCommandID:          writeCategories,
+	ZRemCommandID:          writeCategories,
+	ZScoreCommandID:        readCategories,
+	ZRankCommandID:         readCategories,
+	ZRangeCommandID:        readCategories,
+	ZRangeByScoreCommandID: readCategories,
+	ZIncrByCommandID:       writeCategories,
+
+	SubscribeCommandID:    pubSubCategories,
+	UnsubscribeCommandID:  pubSubCategories,
+	PSubscribeCommandID:   pubSubCategories,
+	PUnsubscribeCommandID: pubSubCategories,
+	PublishCommandID:      pubSubCategories,
+	NotifyCommandID:       pubSubCategories,
+	UnnotifyCommandID:     pubSubCategories,
+
+	XAddCommandID:       writeCategories,
+	XRangeCommandID:     readCategories,
+	XRevRangeCommandID:  readCategories,
+	XLenCommandID:       readCategories,
+	XTrimCommandID:      writeCategories,
+	XReadCommandID:      readCategories,
+	XGroupCommandID:     writeCategories,
+	XReadGroupCommandID: writeCategories,
+	XAckCommandID:       writeCategories,
+	XPendingCommandID:   readCategories,
+
+	MoveCommandID:     writeCategories,
+	FlushDBCommandID:  flushCategories,
+	FlushAllCommandID: flushCategories,
+	DBSizeCommandID:   readCategories,
+
+	ACLCommandID: adminCategories,
+
+	SaveCommandID:   adminCategories,
+	BGSaveCommandID: adminCategories,
+	InfoCommandID:   adminCategories,
+
+	ExpireCommandID:    writeCategories,
+	PExpireCommandID:   writeCategories,
+	ExpireAtCommandID:  writeCategories,
+	PExpireAtCommandID: writeCategories,
+	TTLCommandID:       readCategories,
+	PTTLCommandID:      readCategories,
+	PersistCommandID:   writeCategories,
+
+	ScanCommandID:  readCategories,
+	RangeCommandID: readCategories,
+
+	WatchCommandID: readCategories,
+}
+
+// allKeysCommands access the whole keyspace, so they require the user
+// to be allowed all the keys. NOTIFY watches the keys by the patterns,
+// DBSIZE and INFO tell the number of the keys.
+var allKeysCommands = map[CommandID]bool{
+	ScanCommandID:     true,
+	RangeCommandID:    true,
+	FlushDBCommandID:  true,
+	FlushAllCommandID: true,
+	NotifyCommandID:   true,
+	DBSizeCommandID:   true,
+	InfoCommandID:     true,
 }
 
 func (c CommandID) String() string {
@@ -41,6 +689,10 @@ type Query struct {
 	args  []string
 }
 
+func NewQuery(cmdID CommandID, args []string) Query {
+	return Query{cmdID: cmdID, args: args}
+}
+
 func (q Query) CommandID() CommandID {
 	return q.cmdID
 }
@@ -48,3 +700,36 @@ func (q Query) CommandID() CommandID {
 func (q Query) Args() []string {
 	return q.args
 }
+
+// Keys returns the keys the query operates on.
+func (q Query) Keys() []string {
+	spec, ok := commandIDKeySpecMapping[q.cmdID]
+	if !ok {
+		return nil
+	}
+	if spec.streams {
+		return streamsKeys(q.args, spec.first)
+	}
+
+	last := spec.last
+	if last < 0 {
+		last += len(q.args)
+	}
+
+	var keys []string
+	for i := spec.first; i <= last && i < len(q.args); i += spec.step {
+		keys = append(keys, q.args[i])
+	}
+	return keys
+}
+
+// streamsKeys returns the first half of the arguments following STREAMS.
+func streamsKeys(args []string, from int) []string {
+	for i := from; i < len(args); i++ {
+		if strings.EqualFold(args[i], streamsOption) {
+			rest := args[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
@@ -3,37 +3,241 @@ package compute
 import (
 	"context"
 	"errors"
+	"fmt"
+	"hash/maphash"
 	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Mort4lis/memdb/internal/db/auth"
 	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/events"
+	"github.com/Mort4lis/memdb/internal/db/storage"
 )
 
 //go:generate mockery --inpackage --testonly --case underscore --name Storage
 type Storage interface {
 	Set(ctx context.Context, key, value string) error
+	SetWithExpiration(ctx context.Context, key, value string, expireAt time.Time) error
 	Get(ctx context.Context, key string) (string, error)
 	Del(ctx context.Context, key string) error
+	MSet(ctx context.Context, pairs []storage.KeyValue) error
+	MGet(ctx context.Context, keys []string) (map[string]string, error)
+	MDel(ctx context.Context, keys []string) (int, error)
+	SetIf(ctx context.Context, key, value string, expireAt time.Time, cond storage.Condition) (storage.SetResult, error)
+	GetDel(ctx context.Context, key string) (string, error)
+	Update(ctx context.Context, key string, fn storage.UpdateFunc) (string, error)
+	View(ctx context.Context, key string, fn storage.ViewFunc) error
+	MView(ctx context.Context, keys []string, fn storage.MViewFunc) error
+	Mutate(ctx context.Context, key string, fn storage.MutateFunc) error
+	Expire(ctx context.Context, key string, expireAt time.Time) (bool, error)
+	Persist(ctx context.Context, key string) (bool, error)
+	ExpireTime(ctx context.Context, key string) (time.Time, error)
+	Stats(ctx context.Context) (storage.Stats, error)
+	Atomic(ctx context.Context, fn func(tx storage.Tx) error) error
+	Load(data map[string]storage.Entry)
+}
+
+// OrderedStorage is implemented by the storage engines keeping the keys in order.
+//
+//go:generate mockery --inpackage --testonly --case underscore --name OrderedStorage
+type OrderedStorage interface {
+	Range(ctx context.Context, start, end string, limit int) ([]storage.KeyValue, error)
+	Scan(ctx context.Context, cursor, pattern string, count int) ([]string, string, error)
+}
+
+// WAL appends the records in the order of the Append calls, the returned
+// function waits until the record is persisted.
+//
+//go:generate mockery --inpackage --testonly --case underscore --name WAL
+type WAL interface {
+	// Append adds the record to the log and returns the function waiting
+	// until it's persisted. The error means the record isn't appended.
+	Append(cmdID int, args []string) (func(ctx context.Context) error, error)
+}
+
+// Authenticator checks the passwords and the permissions of the users.
+//
+//go:generate mockery --inpackage --testonly --case underscore --name Authenticator
+type Authenticator interface {
+	Authenticate(user, password string) error
+	Authorize(user string, access auth.Access) error
+	SetUser(name string, rules []string) error
+	DelUser(names []string) (int, error)
+	List() []string
+}
+
+//go:generate mockery --inpackage --testonly --case underscore --name Snapshotter
+type Snapshotter interface {
+	Save(ctx context.Context) error
+	BackgroundSave() error
+}
+
+type QueryHandlerOption func(h *QueryHandler)
+
+func WithWAL(wal WAL) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.wal = wal
+	}
+}
+
+func WithSnapshotter(s Snapshotter) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.snapshotter = s
+	}
+}
+
+// WithDatabases replaces the storage by the numbered logical databases,
+// the clients select them by SELECT.
+func WithDatabases(dbs ...Storage) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.dbs = dbs
+	}
+}
+
+// WithAuthenticator requires the clients to authenticate by AUTH
+// before running the other commands and checks their permissions.
+func WithAuthenticator(a Authenticator) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.auth = a
+	}
+}
+
+// WithEventBus enables the keyspace notifications of the changes published to the bus.
+func WithEventBus(bus *events.Bus) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.pubsub.bus = bus
+	}
 }
 
 type QueryHandler struct {
 	logger *slog.Logger
-	store  Storage
+	// dbs and ordered are indexed by the database number, the entries
+	// of ordered are nil if the storage doesn't keep the keys in order.
+	dbs         []Storage
+	ordered     []OrderedStorage
+	wal         WAL
+	snapshotter Snapshotter
+	auth        Authenticator
+
+	// mu is held for reading by every mutation for the time of applying
+	// to the storage and appending to the WAL, so Checkpoint observes
+	// the storage state consistent with the WAL.
+	mu sync.RWMutex
+	// keys are locked by the mutations, so the changes of the same key
+	// are appended to the WAL in the order they are applied in.
+	keys      *keyLocks
+	mutations atomic.Uint64
+	versions  *keyVersions
+	// waits keeps the clients blocked by BLPOP and BRPOP.
+	waits *waitQueues
+	// signals keeps the clients blocked by XREAD and XREADGROUP.
+	signals *keySignals
+	// moves serializes MOVE, so the key can't be moved to both
+	// databases at once, see handleMove.
+	moves  sync.Mutex
+	pubsub *pubSub
 }
 
-func NewQueryHandler(logger *slog.Logger, store Storage) *QueryHandler {
-	return &QueryHandler{
-		store:  store,
-		logger: logger.With(slog.String("layer", "compute")),
+func NewQueryHandler(logger *slog.Logger, store Storage, opts ...QueryHandlerOption) *QueryHandler {
+	h := &QueryHandler{
+		dbs:      []Storage{store},
+		logger:   logger.With(slog.String("layer", "compute")),
+		keys:     newKeyLocks(),
+		versions: newKeyVersions(),
+		waits:    newWaitQueues(),
+		signals:  newKeySignals(),
+	}
+	h.pubsub = newPubSub(h.logger)
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.ordered = make([]OrderedStorage, len(h.dbs))
+	for i, db := range h.dbs {
+		h.ordered[i], _ = db.(OrderedStorage)
 	}
+	return h
 }
 
 func (h *QueryHandler) Handle(ctx context.Context, req string) string {
 	query, err := ParseQuery(req)
 	if err != nil {
-		h.logger.Warn("failed to parse query", slog.Any("error", err))
-		return ParseQueryErrorResponse.WithErr(err).String()
+		return h.rejectQuery(ctx, err).String()
+	}
+	return h.HandleQuery(ctx, query).String()
+}
+
+// HandleQuery executes the query or queues it if the session is inside MULTI.
+func (h *QueryHandler) HandleQuery(ctx context.Context, query Query) Response {
+	if query.cmdID != AuthCommandID && !h.authenticated(ctx) {
+		return UnauthenticatedResponse.WithErr(errAuthRequired)
+	}
+	if err := h.authorize(ctx, query); err != nil {
+		return h.denyQuery(ctx, err)
+	}
+	if tx, ok := sessionTx(ctx); ok && tx.multi && !isTxCommand(query.cmdID) {
+		return h.enqueue(tx, query)
+	}
+	return h.execute(ctx, query)
+}
+
+// rejectQuery responds to the query failed to be parsed.
+func (h *QueryHandler) rejectQuery(ctx context.Context, err error) Response {
+	h.logger.Warn("failed to parse query", slog.Any("error", err))
+	if tx, ok := sessionTx(ctx); ok && tx.multi {
+		tx.dirty = true
 	}
+	return ParseQueryErrorResponse.WithErr(err)
+}
+
+type applyCtxKey struct{}
+
+// Apply executes the query without writing it to the WAL.
+// It's used to restore the storage state from the log on startup.
+func (h *QueryHandler) Apply(ctx context.Context, query Query) error {
+	ctx = context.WithValue(ctx, applyCtxKey{}, true)
+	if query.cmdID == SelectCommandID && len(query.args) > 1 {
+		// The query of the non-default database is wrapped by SELECT, see writeWAL.
+		db, inner, err := unwrapSelect(query.args)
+		if err != nil {
+			return err
+		}
+		if db >= len(h.dbs) {
+			return fmt.Errorf("%w: %d", errDBOutOfRange, db)
+		}
+		ctx, query = context.WithValue(ctx, dbCtxKey{}, db), inner
+	}
+
+	resp := h.execute(ctx, query)
+	if resp.kind == InternalErrorResponse.kind {
+		return resp.err
+	}
+	return nil
+}
+
+// Checkpoint calls fn while there are no mutations in progress.
+func (h *QueryHandler) Checkpoint(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fn()
+}
 
+// Mutations returns the number of successfully applied mutations.
+func (h *QueryHandler) Mutations() uint64 {
+	return h.mutations.Load()
+}
+
+// execute runs the query and marks the response with its command.
+func (h *QueryHandler) execute(ctx context.Context, query Query) Response {
+	resp := h.dispatch(ctx, query)
+	resp.cmdID = query.cmdID
+	return resp
+}
+
+func (h *QueryHandler) dispatch(ctx context.Context, query Query) Response {
 	switch query.cmdID {
 	case SetCommandID:
 		return h.handleSet(ctx, query)
@@ -41,46 +245,466 @@ func (h *QueryHandler) Handle(ctx context.Context, req string) string {
 		return h.handleGet(ctx, query)
 	case DelCommandID:
 		return h.handleDel(ctx, query)
+	case MSetCommandID:
+		return h.handleMSet(ctx, query)
+	case MGetCommandID:
+		return h.handleMGet(ctx, query)
+	case SetNXCommandID:
+		return h.handleSetNX(ctx, query)
+	case GetSetCommandID:
+		return h.handleGetSet(ctx, query)
+	case CASCommandID:
+		return h.handleCAS(ctx, query)
+	case GetDelCommandID:
+		return h.handleGetDel(ctx, query)
+	case IncrCommandID, DecrCommandID, IncrByCommandID:
+		return h.handleIncr(ctx, query)
+	case IncrByFloatCommandID:
+		return h.handleIncrByFloat(ctx, query)
+	case HSetCommandID:
+		return h.handleHSet(ctx, query)
+	case HGetCommandID:
+		return h.handleHGet(ctx, query)
+	case HMGetCommandID:
+		return h.handleHMGet(ctx, query)
+	case HDelCommandID:
+		return h.handleHDel(ctx, query)
+	case HLenCommandID:
+		return h.handleHLen(ctx, query)
+	case HExistsCommandID:
+		return h.handleHExists(ctx, query)
+	case HKeysCommandID, HValsCommandID, HGetAllCommandID:
+		return h.handleHGetAll(ctx, query)
+	case HIncrByCommandID:
+		return h.handleHIncrBy(ctx, query)
+	case LPushCommandID, RPushCommandID:
+		return h.handlePush(ctx, query)
+	case LPopCommandID, RPopCommandID:
+		return h.handlePop(ctx, query)
+	case LRangeCommandID:
+		return h.handleLRange(ctx, query)
+	case LLenCommandID:
+		return h.handleLLen(ctx, query)
+	case LIndexCommandID:
+		return h.handleLIndex(ctx, query)
+	case LTrimCommandID:
+		return h.handleLTrim(ctx, query)
+	case BLPopCommandID, BRPopCommandID:
+		return h.handleBlockingPop(ctx, query)
+	case SAddCommandID, SRemCommandID:
+		return h.handleSAdd(ctx, query)
+	case SIsMemberCommandID:
+		return h.handleSIsMember(ctx, query)
+	case SMembersCommandID:
+		return h.handleSMembers(ctx, query)
+	case SCardCommandID:
+		return h.handleSCard(ctx, query)
+	case SInterCommandID, SUnionCommandID, SDiffCommandID:
+		return h.handleSetOp(ctx, query)
+	case ZAddCommandID:
+		return h.handleZAdd(ctx, query)
+	case ZRemCommandID:
+		return h.handleZRem(ctx, query)
+	case ZScoreCommandID:
+		return h.handleZScore(ctx, query)
+	case ZRankCommandID:
+		return h.handleZRank(ctx, query)
+	case ZRangeCommandID, ZRangeByScoreCommandID:
+		return h.handleZRange(ctx, query)
+	case ZIncrByCommandID:
+		return h.handleZIncrBy(ctx, query)
+	case SubscribeCommandID, PSubscribeCommandID:
+		return h.handleSubscribe(ctx, query)
+	case UnsubscribeCommandID, PUnsubscribeCommandID:
+		return h.handleUnsubscribe(ctx, query)
+	case PublishCommandID:
+		return h.handlePublish(query)
+	case NotifyCommandID:
+		return h.handleNotify(ctx, query)
+	case UnnotifyCommandID:
+		return h.handleUnnotify(ctx, query)
+	case XAddCommandID:
+		return h.handleXAdd(ctx, query)
+	case XRangeCommandID, XRevRangeCommandID:
+		return h.handleXRange(ctx, query)
+	case XLenCommandID:
+		return h.handleXLen(ctx, query)
+	case XTrimCommandID:
+		return h.handleXTrim(ctx, query)
+	case XReadCommandID:
+		return h.handleXRead(ctx, query)
+	case XGroupCommandID:
+		return h.handleXGroup(ctx, query)
+	case XReadGroupCommandID:
+		return h.handleXReadGroup(ctx, query)
+	case XAckCommandID:
+		return h.handleXAck(ctx, query)
+	case XPendingCommandID:
+		return h.handleXPending(ctx, query)
+	case SelectCommandID:
+		return h.handleSelect(ctx, query)
+	case MoveCommandID:
+		return h.handleMove(ctx, query)
+	case FlushDBCommandID:
+		return h.handleFlushDB(ctx)
+	case FlushAllCommandID:
+		return h.handleFlushAll(ctx)
+	case DBSizeCommandID:
+		return h.handleDBSize(ctx)
+	case AuthCommandID:
+		return h.handleAuth(ctx, query)
+	case ACLCommandID:
+		return h.handleACL(ctx, query)
+	case SaveCommandID:
+		return h.handleSave(ctx)
+	case BGSaveCommandID:
+		return h.handleBGSave()
+	case ExpireCommandID, PExpireCommandID, ExpireAtCommandID, PExpireAtCommandID:
+		return h.handleExpire(ctx, query)
+	case TTLCommandID, PTTLCommandID:
+		return h.handleTTL(ctx, query)
+	case PersistCommandID:
+		return h.handlePersist(ctx, query)
+	case InfoCommandID:
+		return h.handleInfo(ctx)
+	case ScanCommandID:
+		return h.handleScan(ctx, query)
+	case RangeCommandID:
+		return h.handleRange(ctx, query)
+	case MultiCommandID:
+		return h.handleMulti(ctx)
+	case ExecCommandID:
+		return h.handleExec(ctx, query)
+	case DiscardCommandID:
+		return h.handleDiscard(ctx)
+	case WatchCommandID:
+		return h.handleWatch(ctx, query)
+	case UnwatchCommandID:
+		return h.handleUnwatch(ctx)
 	default:
 		h.logger.Error(
 			"handler is not configured for serving query",
 			slog.String("command", query.cmdID.String()),
 		)
-		return InternalErrorResponse.WithErr(dberrors.ErrInternal).String()
+		return InternalErrorResponse.WithErr(dberrors.ErrInternal)
 	}
 }
 
-func (h *QueryHandler) handleSet(ctx context.Context, query Query) string {
+// mutate applies the query to the storage and then appends it to the WAL,
+// so the query failed to be applied, e.g. for lack of memory, isn't logged.
+// The query must be deterministic, i.e. replaying it from the WAL later
+// must give the same result.
+func (h *QueryHandler) mutate(ctx context.Context, query Query, apply func() error) error {
+	return h.mutateKeys(ctx, query, scopedKeys(h.dbIndex(ctx), query.Keys()), apply)
+}
+
+// mutateKeys is mutate locking the given scoped keys, they must include
+// all the keys the query changes.
+func (h *QueryHandler) mutateKeys(ctx context.Context, query Query, keys []string, apply func() error) error {
+	return h.mutateResolved(ctx, keys, func() (Query, error) {
+		return query, apply()
+	})
+}
+
+// mutateResolved is mutateKeys for the queries depending on the state of
+// the keys, e.g. XADD generating the ID. apply returns the query to log,
+// it's resolved while the keys are locked.
+func (h *QueryHandler) mutateResolved(ctx context.Context, keys []string, apply func() (Query, error)) error {
+	if exec, ok := ctx.Value(execCtxKey{}).(*execution); ok {
+		// EXEC holds the lock and writes all the queries to the WAL at once.
+		query, err := apply()
+		if err != nil {
+			return err
+		}
+		exec.logged = append(exec.logged, query)
+		h.versions.bump(h.dbIndex(ctx), query.Keys())
+		h.mutations.Add(1)
+		return nil
+	}
+
+	h.mu.RLock()
+	unlock := h.keys.lock(keys)
+	query, err := apply()
+	if err != nil {
+		unlock()
+		h.mu.RUnlock()
+		return err
+	}
+	wait, err := h.appendWAL(ctx, query)
+	unlock()
+	h.versions.bump(h.dbIndex(ctx), query.Keys())
+	h.mutations.Add(1)
+	h.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+	return h.waitWAL(ctx, query.cmdID, wait)
+}
+
+// writeWAL writes the query to the WAL and waits until it's persisted.
+func (h *QueryHandler) writeWAL(ctx context.Context, query Query) error {
+	wait, err := h.appendWAL(ctx, query)
+	if err != nil {
+		return err
+	}
+	return h.waitWAL(ctx, query.cmdID, wait)
+}
+
+// appendWAL appends the query to the WAL unless it's being replayed from it
+// and returns the function waiting until the query is persisted.
+// The query of the non-default database is wrapped by SELECT.
+func (h *QueryHandler) appendWAL(ctx context.Context, query Query) (func(ctx context.Context) error, error) {
+	if h.wal == nil || ctx.Value(applyCtxKey{}) != nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	cmdID, args := query.cmdID, query.args
+	if db := h.dbIndex(ctx); db != 0 {
+		cmdID, args = SelectCommandID, wrapSelect(db, query)
+	}
+	wait, err := h.wal.Append(int(cmdID), args)
+	if err != nil {
+		return nil, h.walFailed(query.cmdID, err)
+	}
+	return wait, nil
+}
+
+// waitWAL waits until the appended query is persisted. The query is waited
+// for even if the client is gone: it's already applied, so the error would
+// be reported for the change made.
+func (h *QueryHandler) waitWAL(ctx context.Context, cmdID CommandID, wait func(ctx context.Context) error) error {
+	if err := wait(context.WithoutCancel(ctx)); err != nil {
+		return h.walFailed(cmdID, err)
+	}
+	return nil
+}
+
+// walFailed logs the failure to write the query to the WAL.
+func (h *QueryHandler) walFailed(cmdID CommandID, err error) error {
+	h.logger.Error(
+		"failed to write query to WAL",
+		slog.String("command", cmdID.String()),
+		slog.Any("error", err),
+	)
+	return err
+}
+
+const keyLockStripes = 1024
+
+// keyLocks are the striped locks of the keys scoped by their databases.
+type keyLocks struct {
+	seed  maphash.Seed
+	locks [keyLockStripes]sync.Mutex
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{seed: maphash.MakeSeed()}
+}
+
+// lock locks the stripes of the keys in the index order, so the mutations
+// don't deadlock each other, and returns the function unlocking them.
+func (l *keyLocks) lock(keys []string) func() {
+	indexes := make([]uint64, len(keys))
+	for i, key := range keys {
+		indexes[i] = maphash.String(l.seed, key) % keyLockStripes
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	for _, i := range indexes {
+		l.locks[i].Lock()
+	}
+	return func() {
+		for _, i := range indexes {
+			l.locks[i].Unlock()
+		}
+	}
+}
+
+func scopedKeys(db int, keys []string) []string {
+	scoped := make([]string, len(keys))
+	for i, key := range keys {
+		scoped[i] = scopedKey(db, key)
+	}
+	return scoped
+}
+
+// errResponse responds to the query failed to be applied to the storage.
+func (h *QueryHandler) errResponse(query Query, err error) Response {
+	switch {
+	case errors.Is(err, dberrors.ErrNotFound):
+		return NotFoundResponse.WithErr(err)
+	case errors.Is(err, dberrors.ErrWrongType):
+		return WrongTypeResponse.WithErr(err)
+	case errors.Is(err, dberrors.ErrOutOfMemory):
+		h.logger.Warn("not enough memory to handle query", slog.String("command", query.cmdID.String()))
+		return OutOfMemoryResponse.WithErr(err)
+	default:
+		h.logger.Error(
+			"failed to handle query",
+			slog.String("command", query.cmdID.String()),
+			slog.Any("error", err),
+		)
+		return InternalErrorResponse.WithErr(err)
+	}
+}
+
+// storage returns the transaction if the query is executed by EXEC.
+func (h *QueryHandler) storage(ctx context.Context) storage.Tx {
+	if exec, ok := ctx.Value(execCtxKey{}).(*execution); ok {
+		return exec.tx
+	}
+	return h.dbs[h.dbIndex(ctx)]
+}
+
+func (h *QueryHandler) orderedStorage(ctx context.Context) OrderedStorage {
+	if exec, ok := ctx.Value(execCtxKey{}).(*execution); ok {
+		ordered, _ := exec.tx.(OrderedStorage)
+		return ordered
+	}
+	return h.ordered[h.dbIndex(ctx)]
+}
+
+func (h *QueryHandler) handleSet(ctx context.Context, query Query) Response {
 	args := query.Args()
-	if err := h.store.Set(ctx, args[0], args[1]); err != nil {
+	opts, err := parseSetOptions(args[2:], time.Now())
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	if opts.cond != "" || opts.get {
+		return h.handleConditionalSet(ctx, query, opts)
+	}
+
+	err = h.mutate(ctx, opts.logged(args[0], args[1]), func() error {
+		if opts.expireAt.IsZero() {
+			return h.storage(ctx).Set(ctx, args[0], args[1])
+		}
+		return h.storage(ctx).SetWithExpiration(ctx, args[0], args[1], opts.expireAt)
+	})
+	if errors.Is(err, dberrors.ErrOutOfMemory) {
+		h.logger.Warn("not enough memory to handle SET query", slog.String("key", args[0]))
+		return OutOfMemoryResponse.WithErr(err)
+	}
+	if err != nil {
 		h.logger.Error("failed to handle SET query", slog.Any("error", err))
-		return InternalErrorResponse.WithErr(err).String()
+		return InternalErrorResponse.WithErr(err)
 	}
-	return OKResponse.String()
+	return OKResponse
 }
 
-func (h *QueryHandler) handleGet(ctx context.Context, query Query) string {
+func (h *QueryHandler) handleGet(ctx context.Context, query Query) Response {
 	args := query.Args()
-	res, err := h.store.Get(ctx, args[0])
+	res, err := h.storage(ctx).Get(ctx, args[0])
 	if errors.Is(err, dberrors.ErrNotFound) {
 		h.logger.Warn(
 			"key is not found",
 			slog.String("key", args[0]),
 		)
-		return NotFoundResponse.WithErr(err).String()
+		return NotFoundResponse.WithErr(err)
+	}
+	if errors.Is(err, dberrors.ErrWrongType) {
+		return WrongTypeResponse.WithErr(err)
 	}
 	if err != nil {
 		h.logger.Error("failed to handle GET query", slog.Any("error", err))
-		return InternalErrorResponse.WithErr(err).String()
+		return InternalErrorResponse.WithErr(err)
 	}
-	return OKResponse.WithValue(res).String()
+	return OKResponse.WithValue(res)
 }
 
-func (h *QueryHandler) handleDel(ctx context.Context, query Query) string {
-	args := query.Args()
-	if err := h.store.Del(ctx, args[0]); err != nil {
+// handleDel removes the keys and responds with the number of the existing ones.
+func (h *QueryHandler) handleDel(ctx context.Context, query Query) Response {
+	var n int
+	err := h.mutate(ctx, query, func() error {
+		var err error
+		n, err = h.storage(ctx).MDel(ctx, query.Args())
+		return err
+	})
+	if err != nil {
 		h.logger.Error("failed to handle DEL query", slog.Any("error", err))
-		return InternalErrorResponse.WithErr(err).String()
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// handleMSet stores all the pairs or none of them.
+func (h *QueryHandler) handleMSet(ctx context.Context, query Query) Response {
+	args := query.Args()
+	pairs := make([]storage.KeyValue, 0, len(args)/2) //nolint:mnd // key and value
+	for i := 0; i < len(args); i += 2 {
+		pairs = append(pairs, storage.KeyValue{Key: args[i], Value: args[i+1]})
+	}
+
+	err := h.mutate(ctx, query, func() error {
+		return h.storage(ctx).MSet(ctx, pairs)
+	})
+	if errors.Is(err, dberrors.ErrOutOfMemory) {
+		h.logger.Warn("not enough memory to handle MSET query", slog.Int("pairs", len(pairs)))
+		return OutOfMemoryResponse.WithErr(err)
+	}
+	if err != nil {
+		h.logger.Error("failed to handle MSET query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse
+}
+
+// handleMGet responds with the array of the values in the order of the keys,
+// the missing keys are marked as not found.
+func (h *QueryHandler) handleMGet(ctx context.Context, query Query) Response {
+	keys := query.Args()
+	values, err := h.storage(ctx).MGet(ctx, keys)
+	if err != nil {
+		h.logger.Error("failed to handle MGET query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+
+	elems := make([]Response, len(keys))
+	for i, key := range keys {
+		value, ok := values[key]
+		if !ok {
+			elems[i] = NotFoundResponse
+			continue
+		}
+		elems[i] = OKResponse.WithValue(value)
+	}
+	return OKResponse.WithArray(elems)
+}
+
+func (h *QueryHandler) handleSave(ctx context.Context) Response {
+	if h.snapshotter == nil {
+		return InternalErrorResponse.WithErr(dberrors.ErrSnapshotsDisabled)
+	}
+	if err := h.snapshotter.Save(ctx); err != nil {
+		h.logger.Error("failed to handle SAVE query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse
+}
+
+func (h *QueryHandler) handleBGSave() Response {
+	if h.snapshotter == nil {
+		return InternalErrorResponse.WithErr(dberrors.ErrSnapshotsDisabled)
+	}
+	if err := h.snapshotter.BackgroundSave(); err != nil {
+		h.logger.Error("failed to handle BGSAVE query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithStatus("background saving started")
+}
+
+func (h *QueryHandler) handleInfo(ctx context.Context) Response {
+	stats, err := h.storage(ctx).Stats(ctx)
+	if err != nil {
+		h.logger.Error("failed to handle INFO query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
 	}
-	return OKResponse.String()
+	return OKResponse.WithValues([]string{
+		fmt.Sprintf("keys:%d", stats.Keys),
+		fmt.Sprintf("used_memory:%d", stats.UsedMemory),
+		fmt.Sprintf("max_memory:%d", stats.MaxMemory),
+		fmt.Sprintf("evicted_keys:%d", stats.EvictedKeys),
+		fmt.Sprintf("expired_keys:%d", stats.ExpiredKeys),
+	})
 }
@@ -0,0 +1,133 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+const (
+	setUserSubcommand = "SETUSER"
+	delUserSubcommand = "DELUSER"
+	listSubcommand    = "LIST"
+	whoAmISubcommand  = "WHOAMI"
+)
+
+var (
+	errACLDisabled   = errors.New("ACL requires the users to be configured")
+	errACLArgsNumber = errors.New("invalid the number of arguments for ACL subcommand")
+)
+
+// authorize checks the permissions of the user the client is authenticated as.
+// Like authenticated, it lets the requests without the session through.
+func (h *QueryHandler) authorize(ctx context.Context, query Query) error {
+	if h.auth == nil || query.cmdID == AuthCommandID {
+		return nil
+	}
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return h.auth.Authorize(sess.User(), queryAccess(query))
+}
+
+// queryAccess describes the categories and the keys the query requires.
+func queryAccess(query Query) auth.Access {
+	access := auth.Access{
+		Command:    query.cmdID.String(),
+		Categories: commandIDCategoriesMapping[query.cmdID],
+		Keys:       query.Keys(),
+		AllKeys:    allKeysCommands[query.cmdID],
+	}
+	if query.cmdID == ACLCommandID && strings.EqualFold(query.args[0], whoAmISubcommand) {
+		// Any user may know who it's authenticated as.
+		access.Categories = nil
+	}
+	return access
+}
+
+// denyQuery responds to the query the user has no permissions for.
+// Like the invalid queries, it fails the transaction the query is sent inside.
+func (h *QueryHandler) denyQuery(ctx context.Context, err error) Response {
+	h.logger.Warn("permission denied", slog.Any("error", err))
+	if tx, ok := sessionTx(ctx); ok && tx.multi {
+		tx.dirty = true
+	}
+	return NoPermissionResponse.WithErr(err)
+}
+
+// handleACL handles ACL SETUSER name [rule ...], ACL DELUSER name [name ...],
+// ACL LIST and ACL WHOAMI.
+func (h *QueryHandler) handleACL(ctx context.Context, query Query) Response {
+	args := query.Args()
+	subcommand, args := strings.ToUpper(args[0]), args[1:]
+	if subcommand == whoAmISubcommand {
+		if len(args) != 0 {
+			return ParseQueryErrorResponse.WithErr(errACLArgsNumber)
+		}
+		return h.handleACLWhoAmI(ctx)
+	}
+
+	if h.auth == nil {
+		return NotSupportedResponse.WithErr(errACLDisabled)
+	}
+	switch subcommand {
+	case setUserSubcommand:
+		if len(args) == 0 {
+			return ParseQueryErrorResponse.WithErr(errACLArgsNumber)
+		}
+		return h.handleACLSetUser(args[0], args[1:])
+	case delUserSubcommand:
+		if len(args) == 0 {
+			return ParseQueryErrorResponse.WithErr(errACLArgsNumber)
+		}
+		return h.handleACLDelUser(args)
+	case listSubcommand:
+		if len(args) != 0 {
+			return ParseQueryErrorResponse.WithErr(errACLArgsNumber)
+		}
+		return OKResponse.WithValues(h.auth.List())
+	default:
+		return ParseQueryErrorResponse.WithErr(errUnknownSubcommand)
+	}
+}
+
+func (h *QueryHandler) handleACLSetUser(name string, rules []string) Response {
+	err := h.auth.SetUser(name, rules)
+	if errors.Is(err, auth.ErrInvalidRule) || errors.Is(err, auth.ErrInvalidUserName) {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	if err != nil {
+		h.logger.Error("failed to handle ACL SETUSER query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse
+}
+
+// handleACLDelUser responds with the number of the deleted users.
+func (h *QueryHandler) handleACLDelUser(names []string) Response {
+	n, err := h.auth.DelUser(names)
+	if errors.Is(err, auth.ErrDefaultUser) {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	if err != nil {
+		h.logger.Error("failed to handle ACL DELUSER query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// handleACLWhoAmI responds with the user the client is authenticated as,
+// it's the default user if the authentication is disabled.
+func (h *QueryHandler) handleACLWhoAmI(ctx context.Context) Response {
+	user := auth.DefaultUser
+	if sess, ok := network.SessionFromContext(ctx); ok && sess.User() != "" {
+		user = sess.User()
+	}
+	return OKResponse.WithStatus(user)
+}
@@ -0,0 +1,226 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func TestQueryHandler_Handle_aclPermissions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name  string
+		user  auth.User
+		steps [][2]string // request and result
+	}{
+		{
+			name: "all permissions",
+			user: auth.User{Name: "admin", Categories: []string{auth.CategoryAll}, Keys: []string{"*"}},
+			steps: [][2]string{
+				{"SET key val", "[ok]"},
+				{"GET key", "[ok] val"},
+				{"DBSIZE", "[ok] 1"},
+				{"FLUSHDB", "[ok]"},
+				{"ACL WHOAMI", "[ok] admin"},
+			},
+		},
+		{
+			name: "read only",
+			user: auth.User{Name: "reader", Categories: []string{auth.CategoryRead, auth.CategoryWrite}, Keys: []string{"*"}, ReadOnly: true},
+			steps: [][2]string{
+				{"GET key", "[not_found] key is not found"},
+				{"SET key val", "[no_permission] no permissions to run the 'SET' command"},
+				{"FLUSHDB", "[no_permission] no permissions to run the 'FLUSHDB' command"},
+				{"ACL LIST", "[no_permission] no permissions to run the 'ACL' command"},
+				{"ACL WHOAMI", "[ok] reader"},
+			},
+		},
+		{
+			name: "key patterns",
+			user: auth.User{Name: "app", Categories: []string{auth.CategoryRead, auth.CategoryWrite}, Keys: []string{"app:*"}},
+			steps: [][2]string{
+				{"SET app:1 val", "[ok]"},
+				{"MSET app:2 val app:3 val", "[ok]"},
+				{"SET other val", "[no_permission] no permissions to access the 'other' key"},
+				{"MGET app:1 other", "[no_permission] no permissions to access the 'other' key"},
+				{"SCAN 0", "[no_permission] no permissions to access all the keys by the 'SCAN' command"},
+				{"DBSIZE", "[no_permission] no permissions to access all the keys by the 'DBSIZE' command"},
+				{"FLUSHALL", "[no_permission] no permissions to run the 'FLUSHALL' command"},
+			},
+		},
+		{
+			name: "admin of key patterns",
+			user: auth.User{Name: "operator", Categories: []string{auth.CategoryAll}, Keys: []string{"app:*"}},
+			steps: [][2]string{
+				{"GET app:1", "[not_found] key is not found"},
+				{"INFO", "[no_permission] no permissions to access all the keys by the 'INFO' command"},
+			},
+		},
+		{
+			name: "connection commands",
+			user: auth.User{Name: "nobody"},
+			steps: [][2]string{
+				{"SELECT 1", "[ok]"},
+				{"MULTI", "[ok]"},
+				{"GET key", "[no_permission] no permissions to run the 'GET' command"},
+				{"EXEC", "[aborted] transaction discarded because of previous errors"},
+				{"PUBLISH channel message", "[no_permission] no permissions to run the 'PUBLISH' command"},
+			},
+		},
+		{
+			name: "pubsub",
+			user: auth.User{Name: "subscriber", Categories: []string{auth.CategoryPubSub}, Keys: []string{"app:*"}},
+			steps: [][2]string{
+				{"PUBLISH channel message", "[ok] 0"},
+				{"NOTIFY app:*", "[no_permission] no permissions to access all the keys by the 'NOTIFY' command"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := auth.NewAuthenticator([]auth.User{tc.user})
+			require.NoError(t, err)
+
+			sess := network.NewSession(1, nil)
+			sess.SetUser(tc.user.Name)
+			ctx := network.ContextWithSession(context.Background(), sess)
+
+			h := newDatabasesHandler(logger, 2, WithAuthenticator(a)) //nolint:mnd // SELECT 1
+			for _, step := range tc.steps {
+				assert.Equal(t, step[1], h.Handle(ctx, step[0]), step[0])
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Handle_aclChangedInsideMulti(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	a, err := auth.NewAuthenticator([]auth.User{
+		{Name: "admin", Categories: []string{auth.CategoryAll}, Keys: []string{"*"}},
+		{Name: "app", Categories: []string{auth.CategoryAll}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+	h := NewQueryHandler(logger, storage.NewEngine(), WithAuthenticator(a))
+
+	sessionCtx := func(user string) context.Context {
+		sess := network.NewSession(1, nil)
+		sess.SetUser(user)
+		return network.ContextWithSession(context.Background(), sess)
+	}
+	adminCtx, appCtx := sessionCtx("admin"), sessionCtx("app")
+
+	assert.Equal(t, "[ok]", h.Handle(appCtx, "MULTI"))
+	assert.Equal(t, "[ok] QUEUED", h.Handle(appCtx, "SET key val"))
+	assert.Equal(t, "[ok]", h.Handle(adminCtx, "ACL SETUSER app readonly"))
+	assert.Equal(t, "[no_permission] no permissions to run the 'SET' command", h.Handle(appCtx, "EXEC"))
+	assert.Equal(t, "[not_found] key is not found", h.Handle(adminCtx, "GET key"))
+
+	// The deleted user loses all the permissions.
+	assert.Equal(t, "[ok] 1", h.Handle(adminCtx, "ACL DELUSER app"))
+	assert.Equal(t, "[no_permission] no permissions: user app doesn't exist", h.Handle(appCtx, "GET key"))
+}
+
+func TestQueryHandler_Handle_acl(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name      string
+		mockSetup func(a *MockAuthenticator)
+		steps     [][2]string // request and result
+	}{
+		{
+			name: "set user",
+			mockSetup: func(a *MockAuthenticator) {
+				a.On("SetUser", "alice", []string{">secret", "+@read", "~user:*"}).Return(nil)
+				a.On("SetUser", "alice", []string{"+@unknown"}).
+					Return(fmt.Errorf("%w: unknown category 'unknown'", auth.ErrInvalidRule))
+				a.On("SetUser", "bob", []string{}).Return(errors.New("unexpected"))
+			},
+			steps: [][2]string{
+				{`ACL SETUSER alice ">secret" +@read ~user:*`, "[ok]"},
+				{"ACL SETUSER alice +@unknown", "[parse_query_error] syntax error in ACL rule: unknown category 'unknown'"},
+				{"ACL SETUSER bob", "[internal_error] unexpected"},
+				{"ACL SETUSER", "[parse_query_error] invalid the number of arguments for ACL subcommand"},
+			},
+		},
+		{
+			name: "delete users",
+			mockSetup: func(a *MockAuthenticator) {
+				a.On("DelUser", []string{"alice", "bob"}).Return(2, nil)
+				a.On("DelUser", []string{auth.DefaultUser}).Return(0, auth.ErrDefaultUser)
+			},
+			steps: [][2]string{
+				{"ACL DELUSER alice bob", "[ok] 2"},
+				{"ACL DELUSER default", "[parse_query_error] the 'default' user cannot be removed"},
+				{"ACL DELUSER", "[parse_query_error] invalid the number of arguments for ACL subcommand"},
+			},
+		},
+		{
+			name: "list users",
+			mockSetup: func(a *MockAuthenticator) {
+				a.On("List").Return([]string{"user admin ~* +@all", "user default"})
+			},
+			steps: [][2]string{
+				{"ACL LIST", `[ok] "user admin ~* +@all" "user default"`},
+				{"ACL LIST extra", "[parse_query_error] invalid the number of arguments for ACL subcommand"},
+			},
+		},
+		{
+			name: "who am I",
+			steps: [][2]string{
+				{"ACL WHOAMI", "[ok] admin"},
+				{"ACL WHOAMI extra", "[parse_query_error] invalid the number of arguments for ACL subcommand"},
+			},
+		},
+		{
+			name: "invalid",
+			steps: [][2]string{
+				{"ACL", "[parse_query_error] invalid the number of arguments"},
+				{"ACL UNKNOWN", "[parse_query_error] unknown subcommand"},
+				{"MULTI", "[ok]"},
+				{"ACL LIST", "[parse_query_error] command is not allowed inside MULTI"},
+				{"EXEC", "[aborted] transaction discarded because of previous errors"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewMockAuthenticator(t)
+			a.On("Authorize", "admin", mock.Anything).Return(nil).Maybe()
+			if tc.mockSetup != nil {
+				tc.mockSetup(a)
+			}
+
+			sess := network.NewSession(1, nil)
+			sess.SetUser("admin")
+			ctx := network.ContextWithSession(context.Background(), sess)
+			h := NewQueryHandler(logger, storage.NewEngine(), WithAuthenticator(a))
+			for _, step := range tc.steps {
+				assert.Equal(t, step[1], h.Handle(ctx, step[0]), step[0])
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Handle_aclDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+
+	h := NewQueryHandler(logger, storage.NewEngine())
+	assert.Equal(t, "[ok] default", h.Handle(ctx, "ACL WHOAMI"))
+	assert.Equal(t, "[not_supported] ACL requires the users to be configured", h.Handle(ctx, "ACL LIST"))
+}
@@ -0,0 +1,61 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+var (
+	errAuthRequired  = errors.New("authentication required")
+	errAuthDisabled  = errors.New("AUTH called without any password configured")
+	errAuthNoSession = errors.New("authentication requires a client session")
+)
+
+// authenticated reports whether the client may run the commands. The requests
+// without the session come from the server itself, e.g. replaying the WAL.
+func (h *QueryHandler) authenticated(ctx context.Context) bool {
+	if h.auth == nil {
+		return true
+	}
+	sess, ok := network.SessionFromContext(ctx)
+	return !ok || sess.User() != ""
+}
+
+// handleAuth handles AUTH [user] password, the default user is
+// authenticated if the user is omitted.
+func (h *QueryHandler) handleAuth(ctx context.Context, query Query) Response {
+	if h.auth == nil {
+		return ParseQueryErrorResponse.WithErr(errAuthDisabled)
+	}
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errAuthNoSession)
+	}
+
+	args := query.Args()
+	user, password := auth.DefaultUser, args[0]
+	if len(args) == 2 { //nolint:mnd // user and password
+		user, password = args[0], args[1]
+	}
+
+	err := h.auth.Authenticate(user, password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.logger.Warn(
+			"failed to authenticate client",
+			slog.Uint64("session_id", sess.ID()),
+			slog.String("user", user),
+		)
+		return UnauthenticatedResponse.WithErr(err)
+	}
+	if err != nil {
+		h.logger.Error("failed to handle AUTH query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+
+	sess.SetUser(user)
+	return OKResponse
+}
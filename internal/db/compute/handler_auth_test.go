@@ -0,0 +1,114 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func TestQueryHandler_Handle_auth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name      string
+		mockSetup func(a *MockAuthenticator)
+		steps     [][2]string // request and result
+		wantUser  string
+	}{
+		{
+			name: "default user",
+			mockSetup: func(a *MockAuthenticator) {
+				a.On("Authenticate", auth.DefaultUser, "wrong").Return(auth.ErrInvalidCredentials)
+				a.On("Authenticate", auth.DefaultUser, "secret").Return(nil)
+				a.On("Authorize", auth.DefaultUser, mock.Anything).Return(nil)
+			},
+			steps: [][2]string{
+				{"SET key val", "[unauthenticated] authentication required"},
+				{"GET key", "[unauthenticated] authentication required"},
+				{"AUTH wrong", "[unauthenticated] invalid username-password pair"},
+				{"GET key", "[unauthenticated] authentication required"},
+				{"AUTH secret", "[ok]"},
+				{"SET key val", "[ok]"},
+				{"GET key", "[ok] val"},
+			},
+			wantUser: auth.DefaultUser,
+		},
+		{
+			name: "named user",
+			mockSetup: func(a *MockAuthenticator) {
+				a.On("Authenticate", "admin", "admin secret").Return(nil)
+				a.On("Authorize", "admin", mock.Anything).Return(nil)
+			},
+			steps: [][2]string{
+				{`AUTH admin "admin secret"`, "[ok]"},
+				{"GET key", "[not_found] key is not found"},
+			},
+			wantUser: "admin",
+		},
+		{
+			name: "not allowed inside multi",
+			mockSetup: func(a *MockAuthenticator) {
+				a.On("Authenticate", auth.DefaultUser, "secret").Return(nil)
+				a.On("Authorize", auth.DefaultUser, mock.Anything).Return(nil)
+			},
+			steps: [][2]string{
+				{"AUTH secret", "[ok]"},
+				{"MULTI", "[ok]"},
+				{"AUTH secret", "[parse_query_error] command is not allowed inside MULTI"},
+				{"EXEC", "[aborted] transaction discarded because of previous errors"},
+			},
+			wantUser: auth.DefaultUser,
+		},
+		{
+			name: "invalid number of arguments",
+			steps: [][2]string{
+				{"AUTH", "[parse_query_error] invalid the number of arguments"},
+				{"AUTH user password extra", "[parse_query_error] invalid the number of arguments"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewMockAuthenticator(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(a)
+			}
+
+			sess := network.NewSession(1, nil)
+			ctx := network.ContextWithSession(context.Background(), sess)
+			h := NewQueryHandler(logger, storage.NewEngine(), WithAuthenticator(a))
+			for _, step := range tc.steps {
+				assert.Equal(t, step[1], h.Handle(ctx, step[0]), step[0])
+			}
+			assert.Equal(t, tc.wantUser, sess.User())
+		})
+	}
+}
+
+func TestQueryHandler_Handle_authDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+
+	h := NewQueryHandler(logger, storage.NewEngine())
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SET key val"))
+	assert.Equal(t, "[parse_query_error] AUTH called without any password configured", h.Handle(ctx, "AUTH secret"))
+}
+
+func TestQueryHandler_Apply_auth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+
+	// The queries replayed from the WAL don't require authentication.
+	h := NewQueryHandler(logger, storage.NewEngine(), WithAuthenticator(NewMockAuthenticator(t)))
+	assert.NoError(t, h.Apply(ctx, NewQuery(SetCommandID, []string{"key", "val"})))
+	assert.Equal(t, "[ok] val", h.Handle(ctx, "GET key"))
+}
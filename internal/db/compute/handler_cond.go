@@ -0,0 +1,164 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+const (
+	nxOption  = "NX"
+	xxOption  = "XX"
+	getOption = "GET"
+)
+
+var errNotSet = errors.New("key is not set")
+
+// setOptions are the options of SET query.
+type setOptions struct {
+	// cond is NX or XX, it's empty if the value is set unconditionally.
+	cond string
+	get  bool
+	// expireAt is the absolute deadline, zero time means the key doesn't expire.
+	expireAt time.Time
+}
+
+// parseSetOptions parses the optional [NX|XX] [GET] [EX|PX|EXAT|PXAT time]
+// part of SET query, the options may go in any order.
+func parseSetOptions(args []string, now time.Time) (setOptions, error) {
+	var (
+		opts          setOptions
+		hasExpiration bool
+	)
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case nxOption, xxOption:
+			if opts.cond != "" {
+				return setOptions{}, errSyntax
+			}
+			opts.cond = opt
+		case getOption:
+			if opts.get {
+				return setOptions{}, errSyntax
+			}
+			opts.get = true
+		default:
+			if hasExpiration || i+1 == len(args) {
+				return setOptions{}, errSyntax
+			}
+			expireAt, err := parseSetExpiration(opt, args[i+1], now)
+			if err != nil {
+				return setOptions{}, err
+			}
+			opts.expireAt, hasExpiration = expireAt, true
+			i++
+		}
+	}
+	return opts, nil
+}
+
+// logged returns the query written to the WAL. The relative deadline is logged
+// as the absolute one and GET is dropped as it doesn't change the storage.
+func (o setOptions) logged(key, value string) Query {
+	args := []string{key, value}
+	if o.cond != "" {
+		args = append(args, o.cond)
+	}
+	if !o.expireAt.IsZero() {
+		args = append(args, pxatOption, formatUnixMilli(o.expireAt))
+	}
+	return NewQuery(SetCommandID, args)
+}
+
+func (o setOptions) condition() storage.Condition {
+	switch o.cond {
+	case nxOption:
+		return storage.IfNotExists
+	case xxOption:
+		return storage.IfExists
+	default:
+		return nil
+	}
+}
+
+// handleConditionalSet handles SET with NX, XX or GET options. It responds with
+// the previous value if GET is given, otherwise not found means the key is not set.
+func (h *QueryHandler) handleConditionalSet(ctx context.Context, query Query, opts setOptions) Response {
+	args := query.Args()
+	res, err := h.setIf(ctx, opts.logged(args[0], args[1]), args[0], args[1], opts.expireAt, opts.condition())
+	switch {
+	case err != nil:
+		return h.errResponse(query, err)
+	case opts.get && !res.Existed:
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	case opts.get:
+		return OKResponse.WithValue(res.Old)
+	case !res.Written:
+		return NotFoundResponse.WithErr(errNotSet)
+	default:
+		return OKResponse
+	}
+}
+
+// handleSetNX sets the key if it doesn't exist and responds whether it's set.
+func (h *QueryHandler) handleSetNX(ctx context.Context, query Query) Response {
+	args := query.Args()
+	res, err := h.setIf(ctx, query, args[0], args[1], time.Time{}, storage.IfNotExists)
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(formatBool(res.Written))
+}
+
+// handleGetSet sets the key and responds with its previous value.
+func (h *QueryHandler) handleGetSet(ctx context.Context, query Query) Response {
+	args := query.Args()
+	res, err := h.setIf(ctx, query, args[0], args[1], time.Time{}, nil)
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	if !res.Existed {
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	}
+	return OKResponse.WithValue(res.Old)
+}
+
+// handleCAS sets the key to the new value if it has the expected one and
+// responds whether it's set. Like SET, it removes the deadline of the key.
+func (h *QueryHandler) handleCAS(ctx context.Context, query Query) Response {
+	args := query.Args()
+	res, err := h.setIf(ctx, query, args[0], args[2], time.Time{}, storage.IfEquals(args[1]))
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(formatBool(res.Written))
+}
+
+func (h *QueryHandler) handleGetDel(ctx context.Context, query Query) Response {
+	var value string
+	err := h.mutate(ctx, query, func() error {
+		var err error
+		value, err = h.storage(ctx).GetDel(ctx, query.Args()[0])
+		return err
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(value)
+}
+
+func (h *QueryHandler) setIf(
+	ctx context.Context, logged Query, key, value string, expireAt time.Time, cond storage.Condition,
+) (storage.SetResult, error) {
+	var res storage.SetResult
+	err := h.mutate(ctx, logged, func() error {
+		var err error
+		res, err = h.storage(ctx).SetIf(ctx, key, value, expireAt, cond)
+		return err
+	})
+	return res, err
+}
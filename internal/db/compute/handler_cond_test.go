@@ -0,0 +1,201 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// setIfCall makes the mock check the condition against the given current value.
+func setIfCall(store *MockStorage, key, value string, expireAt any, old string, exists bool) {
+	store.On("SetIf", mock.Anything, key, value, expireAt, mock.Anything).Return(
+		func(_ context.Context, _, _ string, _ time.Time, cond storage.Condition) (storage.SetResult, error) {
+			res := storage.SetResult{Old: old, Existed: exists}
+			res.Written = cond == nil || cond(old, exists)
+			return res, nil
+		},
+	)
+}
+
+func TestQueryHandler_Handle_conditional(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(store *MockStorage, wal *MockWAL)
+		wantResult string
+	}{
+		{
+			name:    "set nx: ok",
+			request: "SET key val nx",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), []string{"key", "val", "NX"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "", false)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "set nx: key exists",
+			request: "SET key val NX",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), []string{"key", "val", "NX"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "old", true)
+			},
+			wantResult: "[not_found] key is not set",
+		},
+		{
+			name:    "set xx: key doesn't exist",
+			request: "SET key val XX",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), []string{"key", "val", "XX"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "", false)
+			},
+			wantResult: "[not_found] key is not set",
+		},
+		{
+			name:    "set xx get: ok",
+			request: "SET key val GET XX PXAT 1700000000000",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), []string{"key", "val", "XX", "PXAT", "1700000000000"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.UnixMilli(1700000000000), "old", true)
+			},
+			wantResult: "[ok] old",
+		},
+		{
+			name:    "set get: key doesn't exist",
+			request: "SET key val GET",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), []string{"key", "val"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "", false)
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:       "set: nx and xx",
+			request:    "SET key val NX XX",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:       "set: several expirations",
+			request:    "SET key val EX 10 PX 10",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:       "set: missing expiration",
+			request:    "SET key val NX EX",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:    "set nx: out of memory",
+			request: "SET key val NX",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("SetIf", mock.Anything, "key", "val", time.Time{}, mock.Anything).Return(storage.SetResult{}, dberrors.ErrOutOfMemory)
+			},
+			wantResult: "[out_of_memory] not enough memory to store the key",
+		},
+		{
+			name:    "setnx: set",
+			request: "SETNX key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetNXCommandID), []string{"key", "val"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "", false)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "setnx: not set",
+			request: "SETNX key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetNXCommandID), []string{"key", "val"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "old", true)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "getset: ok",
+			request: "GETSET key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(GetSetCommandID), []string{"key", "val"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "old", true)
+			},
+			wantResult: "[ok] old",
+		},
+		{
+			name:    "getset: key doesn't exist",
+			request: "GETSET key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(GetSetCommandID), []string{"key", "val"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "val", time.Time{}, "", false)
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:    "cas: swapped",
+			request: "CAS key old new",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(CASCommandID), []string{"key", "old", "new"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "new", time.Time{}, "old", true)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "cas: value changed",
+			request: "CAS key old new",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(CASCommandID), []string{"key", "old", "new"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "new", time.Time{}, "other", true)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "cas: key doesn't exist",
+			request: `CAS key "" new`,
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(CASCommandID), []string{"key", "", "new"}).Return(walWritten(nil), nil)
+				setIfCall(store, "key", "new", time.Time{}, "", false)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "getdel: ok",
+			request: "GETDEL key",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(GetDelCommandID), []string{"key"}).Return(walWritten(nil), nil)
+				store.On("GetDel", mock.Anything, "key").Return("val", nil)
+			},
+			wantResult: "[ok] val",
+		},
+		{
+			name:    "getdel: key doesn't exist",
+			request: "GETDEL key",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("GetDel", mock.Anything, "key").Return("", dberrors.ErrNotFound)
+			},
+			wantResult: "[not_found] key is not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, wal := NewMockStorage(t), NewMockWAL(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(store, wal)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, store, WithWAL(wal)).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+var (
+	errInvalidDBIndex  = errors.New("invalid DB index")
+	errDBOutOfRange    = errors.New("DB index is out of range")
+	errSameDB          = errors.New("source and destination objects are the same")
+	errSelectNoSession = errors.New("SELECT requires a client session")
+	errBadSelectRecord = errors.New("bad SELECT record")
+	// errNotMoved cancels MOVE leaving both databases untouched.
+	errNotMoved = errors.New("key is not moved")
+)
+
+type dbCtxKey struct{}
+
+// dbIndex returns the number of the database the query is executed in:
+// the one of the WAL record being replayed or selected by the client.
+func (h *QueryHandler) dbIndex(ctx context.Context) int {
+	if db, ok := ctx.Value(dbCtxKey{}).(int); ok {
+		return db
+	}
+	if sess, ok := network.SessionFromContext(ctx); ok {
+		return sess.DB()
+	}
+	return 0
+}
+
+// scopedKey makes the key unique across the databases. The keys of the
+// default database are kept as is unless they may clash with the scoped ones.
+func scopedKey(db int, key string) string {
+	if db == 0 && !strings.HasPrefix(key, "\x00") {
+		return key
+	}
+	return "\x00" + strconv.Itoa(db) + "\x00" + key
+}
+
+// wrapSelect encodes the query of the database as the arguments
+// of SELECT record: the database, the command ID and its arguments.
+func wrapSelect(db int, query Query) []string {
+	return append([]string{strconv.Itoa(db), strconv.Itoa(int(query.cmdID))}, query.args...)
+}
+
+func unwrapSelect(args []string) (int, Query, error) {
+	db, err := strconv.Atoi(args[0])
+	if err != nil || db < 0 {
+		return 0, Query{}, errBadSelectRecord
+	}
+	cmdID, err := strconv.Atoi(args[1])
+	if err != nil || CommandID(cmdID) == SelectCommandID {
+		return 0, Query{}, errBadSelectRecord
+	}
+	return db, NewQuery(CommandID(cmdID), args[2:]), nil
+}
+
+func parseDBIndex(arg string, n int) (int, error) {
+	db, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, errInvalidDBIndex
+	}
+	if db < 0 || db >= n {
+		return 0, errDBOutOfRange
+	}
+	return db, nil
+}
+
+// handleSelect handles SELECT db switching the database of the client.
+func (h *QueryHandler) handleSelect(ctx context.Context, query Query) Response {
+	db, err := parseDBIndex(query.Args()[0], len(h.dbs))
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errSelectNoSession)
+	}
+	sess.SelectDB(db)
+	return OKResponse
+}
+
+// handleMove handles MOVE key db. The key is moved only if it doesn't
+// exist in the destination database, the response is 1 if it's moved.
+func (h *QueryHandler) handleMove(ctx context.Context, query Query) Response {
+	args := query.Args()
+	dst, err := parseDBIndex(args[1], len(h.dbs))
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	src := h.dbIndex(ctx)
+	if src == dst {
+		return ParseQueryErrorResponse.WithErr(errSameDB)
+	}
+
+	var moved bool
+	keys := []string{scopedKey(src, args[0]), scopedKey(dst, args[0])}
+	err = h.mutateKeys(ctx, query, keys, func() error {
+		// The concurrent moves of the keys in the opposite directions
+		// would lock the shards of the databases in the different order.
+		// The lock is released before waiting for the WAL.
+		h.moves.Lock()
+		defer h.moves.Unlock()
+
+		moved, err = move(ctx, args[0], h.dbs[src], h.dbs[dst])
+		return err
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+
+	if moved {
+		h.versions.bump(dst, args[:1])
+		h.waits.notify(dst, args[0])
+		h.signals.notify(dst, args[0])
+	}
+	return OKResponse.WithValue(formatBool(moved))
+}
+
+// move moves the key with its deadline from src to dst unless it exists there.
+// The value and the deadline are stored in dst at once, so the key is never
+// observed there without its deadline and is left in src if dst fails.
+func move(ctx context.Context, key string, src, dst Storage) (bool, error) {
+	expireAt, err := src.ExpireTime(ctx, key)
+	if errors.Is(err, dberrors.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = src.Mutate(ctx, key, func(v storage.Value) (storage.Value, error) {
+		if v == nil {
+			// The key has expired meanwhile.
+			return nil, errNotMoved
+		}
+		err := dst.Atomic(ctx, func(tx storage.Tx) error {
+			err := tx.Mutate(ctx, key, func(cur storage.Value) (storage.Value, error) {
+				if cur != nil {
+					return nil, errNotMoved
+				}
+				return v, nil
+			})
+			if err != nil || expireAt.IsZero() {
+				return err
+			}
+			_, err = tx.Expire(ctx, key, expireAt)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if errors.Is(err, errNotMoved) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// handleFlushDB removes all the keys of the selected database.
+func (h *QueryHandler) handleFlushDB(ctx context.Context) Response {
+	if err := h.flush(ctx, NewQuery(FlushDBCommandID, nil), h.dbs[h.dbIndex(ctx)]); err != nil {
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse
+}
+
+// handleFlushAll removes all the keys of all the databases.
+func (h *QueryHandler) handleFlushAll(ctx context.Context) Response {
+	if err := h.flush(ctx, NewQuery(FlushAllCommandID, nil), h.dbs...); err != nil {
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse
+}
+
+// flush empties the databases. The exclusive lock keeps the other
+// mutations from being logged before and applied after it, it's released
+// before waiting for the WAL not to stall the server for the time of fsync.
+func (h *QueryHandler) flush(ctx context.Context, query Query, dbs ...Storage) error {
+	h.mu.Lock()
+	wait, err := h.appendWAL(ctx, query)
+	if err != nil {
+		h.mu.Unlock()
+		return err
+	}
+	for _, db := range dbs {
+		db.Load(nil)
+	}
+	h.mutations.Add(1)
+	h.mu.Unlock()
+
+	return h.waitWAL(ctx, query.cmdID, wait)
+}
+
+// handleDBSize responds with the number of the keys in the selected database.
+func (h *QueryHandler) handleDBSize(ctx context.Context) Response {
+	stats, err := h.storage(ctx).Stats(ctx)
+	if err != nil {
+		h.logger.Error("failed to handle DBSIZE query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(stats.Keys))
+}
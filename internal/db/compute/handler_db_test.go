@@ -0,0 +1,290 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func newDatabasesHandler(logger *slog.Logger, n int, opts ...QueryHandlerOption) *QueryHandler {
+	dbs := make([]Storage, n)
+	for i := range dbs {
+		dbs[i] = storage.NewEngine()
+	}
+	return NewQueryHandler(logger, dbs[0], append(opts, WithDatabases(dbs...))...)
+}
+
+func TestQueryHandler_Handle_databases(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name  string
+		steps [][2]string // request and result
+	}{
+		{
+			name: "select isolates keys",
+			steps: [][2]string{
+				{"SET key zero", "[ok]"},
+				{"SELECT 1", "[ok]"},
+				{"GET key", "[not_found] key is not found"},
+				{"SET key one", "[ok]"},
+				{"DBSIZE", "[ok] 1"},
+				{"SELECT 0", "[ok]"},
+				{"GET key", "[ok] zero"},
+				{"SELECT 2", "[parse_query_error] DB index is out of range"},
+				{"SELECT -1", "[parse_query_error] DB index is out of range"},
+				{"SELECT one", "[parse_query_error] invalid DB index"},
+			},
+		},
+		{
+			name: "move",
+			steps: [][2]string{
+				{"SET key val EX 100", "[ok]"},
+				{"MOVE key 1", "[ok] 1"},
+				{"GET key", "[not_found] key is not found"},
+				{"MOVE key 1", "[ok] 0"},
+				{"SELECT 1", "[ok]"},
+				{"GET key", "[ok] val"},
+				{"TTL key", "[ok] 100"},
+				{"SET other one", "[ok]"},
+				{"SELECT 0", "[ok]"},
+				{"SET other zero", "[ok]"},
+				// The key existing in the destination database isn't overwritten.
+				{"MOVE other 1", "[ok] 0"},
+				{"GET other", "[ok] zero"},
+				{"MOVE other 0", "[parse_query_error] source and destination objects are the same"},
+				{"MOVE other 5", "[parse_query_error] DB index is out of range"},
+			},
+		},
+		{
+			name: "flushdb and flushall",
+			steps: [][2]string{
+				{"MSET a 1 b 2", "[ok]"},
+				{"SELECT 1", "[ok]"},
+				{"SET c 3", "[ok]"},
+				{"FLUSHDB", "[ok]"},
+				{"DBSIZE", "[ok] 0"},
+				{"SELECT 0", "[ok]"},
+				{"DBSIZE", "[ok] 2"},
+				{"SELECT 1", "[ok]"},
+				{"SET c 3", "[ok]"},
+				{"FLUSHALL", "[ok]"},
+				{"DBSIZE", "[ok] 0"},
+				{"SELECT 0", "[ok]"},
+				{"DBSIZE", "[ok] 0"},
+			},
+		},
+		{
+			name: "not allowed inside multi",
+			steps: [][2]string{
+				{"MULTI", "[ok]"},
+				{"SELECT 1", "[parse_query_error] command is not allowed inside MULTI"},
+				{"MOVE key 1", "[parse_query_error] command is not allowed inside MULTI"},
+				{"FLUSHDB", "[parse_query_error] command is not allowed inside MULTI"},
+				{"EXEC", "[aborted] transaction discarded because of previous errors"},
+			},
+		},
+		{
+			name: "exec in selected database",
+			steps: [][2]string{
+				{"SELECT 1", "[ok]"},
+				{"MULTI", "[ok]"},
+				{"SET key val", "[ok] QUEUED"},
+				{"EXEC", "[ok]\n1) [ok]"},
+				{"DBSIZE", "[ok] 1"},
+				{"SELECT 0", "[ok]"},
+				{"DBSIZE", "[ok] 0"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+			h := newDatabasesHandler(logger, 2)
+			for _, step := range tc.steps {
+				assert.Equal(t, step[1], h.Handle(ctx, step[0]), step[0])
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Handle_selectWithoutSession(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	h := newDatabasesHandler(logger, 2)
+	assert.Equal(t, "[internal_error] SELECT requires a client session", h.Handle(context.Background(), "SELECT 1"))
+}
+
+func TestQueryHandler_Handle_moveDestinationError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	dst := NewMockStorage(t)
+	atomicCall(dst)
+	dst.On("Mutate", mock.Anything, "key", mock.Anything).Return(nil)
+	dst.On("Expire", mock.Anything, "key", mock.Anything).Return(false, errUnexpected)
+	src := storage.NewEngine()
+	h := NewQueryHandler(logger, src, WithDatabases(src, dst))
+
+	// The key is left in the source database with its deadline.
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+	require.Equal(t, "[ok]", h.Handle(ctx, "SET key val EX 100"))
+	assert.Equal(t, "[internal_error] unexpected", h.Handle(ctx, "MOVE key 1"))
+	assert.Equal(t, "[ok] val", h.Handle(ctx, "GET key"))
+	assert.Equal(t, "[ok] 100", h.Handle(ctx, "TTL key"))
+}
+
+func TestQueryHandler_Handle_watchOtherDatabase(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	h := newDatabasesHandler(logger, 2)
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+	other := network.ContextWithSession(context.Background(), network.NewSession(2, nil))
+
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SELECT 1"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "WATCH key"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SELECT 0"))
+	// The same key of another database doesn't abort EXEC.
+	assert.Equal(t, "[ok]", h.Handle(other, "SET key zero"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "MULTI"))
+	assert.Equal(t, "[ok] QUEUED", h.Handle(ctx, "GET key"))
+	assert.Equal(t, "[ok]\n1) [ok] zero", h.Handle(ctx, "EXEC"))
+
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SELECT 1"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "WATCH key"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SELECT 0"))
+	assert.Equal(t, "[ok]", h.Handle(other, "SELECT 1"))
+	assert.Equal(t, "[ok]", h.Handle(other, "SET key one"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "MULTI"))
+	assert.Equal(t, "[ok] QUEUED", h.Handle(ctx, "GET key"))
+	assert.Equal(t, "[aborted] watched key has been changed", h.Handle(ctx, "EXEC"))
+}
+
+func TestQueryHandler_Handle_blockingPopDatabase(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	h := newDatabasesHandler(logger, 2)
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+	other := network.ContextWithSession(context.Background(), network.NewSession(2, nil))
+
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SELECT 1"))
+	res := make(chan string)
+	go func() {
+		res <- h.Handle(ctx, "BLPOP list 1")
+	}()
+
+	waitBlocked(t, h, scopedKey(1, "list"), 1)
+
+	// The push to the default database doesn't wake up the client.
+	assert.Equal(t, "[ok] 1", h.Handle(other, "RPUSH list zero"))
+	assert.Equal(t, "[ok] 1", h.Handle(other, "LLEN list"))
+	assert.Equal(t, "[ok]", h.Handle(other, "SELECT 1"))
+	assert.Equal(t, "[ok] 1", h.Handle(other, "RPUSH list one"))
+	assert.Equal(t, "[ok] list one", <-res)
+}
+
+func TestQueryHandler_Handle_databasesWAL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	type record struct {
+		cmdID CommandID
+		args  []string
+	}
+	var logged []record
+	wal := NewMockWAL(t)
+	wal.On("Append", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		logged = append(logged, record{cmdID: CommandID(args.Int(0)), args: args.Get(1).([]string)})
+	}).Return(walWritten(nil), nil)
+
+	h := newDatabasesHandler(logger, 3, WithWAL(wal))
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+	for _, req := range []string{
+		"SET a 1", "SET b 2", "MOVE b 2",
+		"SELECT 1", "SET c 3", "MULTI", "SET d 4", "EXEC", "FLUSHDB",
+		"SELECT 2", "SET e 5",
+	} {
+		require.NotContains(t, h.Handle(ctx, req), "error", req)
+	}
+
+	// The queries of the non-default databases are wrapped by SELECT.
+	setID, execID := strconv.Itoa(int(SetCommandID)), strconv.Itoa(int(ExecCommandID))
+	assert.Equal(t, []record{
+		{cmdID: SetCommandID, args: []string{"a", "1"}},
+		{cmdID: SetCommandID, args: []string{"b", "2"}},
+		{cmdID: MoveCommandID, args: []string{"b", "2"}},
+		{cmdID: SelectCommandID, args: []string{"1", setID, "c", "3"}},
+		{cmdID: SelectCommandID, args: []string{"1", execID, setID, "2", "d", "4"}},
+		{cmdID: SelectCommandID, args: []string{"1", strconv.Itoa(int(FlushDBCommandID))}},
+		{cmdID: SelectCommandID, args: []string{"2", setID, "e", "5"}},
+	}, logged)
+
+	replayed := newDatabasesHandler(logger, 3)
+	for _, rec := range logged {
+		require.NoError(t, replayed.Apply(context.Background(), NewQuery(rec.cmdID, rec.args)))
+	}
+	for db, want := range []string{"[ok] 1", "[ok] 0", "[ok] 2"} {
+		sess := network.NewSession(2, nil)
+		sess.SelectDB(db)
+		assert.Equal(t, want, replayed.Handle(network.ContextWithSession(context.Background(), sess), "DBSIZE"))
+	}
+	assert.Error(t, replayed.Apply(context.Background(), NewQuery(SelectCommandID, []string{"3", "1", "k", "v"})))
+}
+
+func TestQueryHandler_Handle_databasesWALWait(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name  string
+		cmdID CommandID
+		req   string
+		want  string
+	}{
+		{name: "move", cmdID: MoveCommandID, req: "MOVE key 1", want: "[ok] 1"},
+		{name: "flush db", cmdID: FlushDBCommandID, req: "FLUSHDB", want: "[ok]"},
+		{name: "flush all", cmdID: FlushAllCommandID, req: "FLUSHALL", want: "[ok]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			wal := NewMockWAL(t)
+			wal.On("Append", int(SetCommandID), mock.Anything).Return(walWritten(nil), nil)
+			wal.On("Append", int(MoveCommandID), []string{"other", "1"}).Return(walWritten(nil), nil).Maybe()
+			wal.On("Append", int(tc.cmdID), mock.Anything).Return(func(context.Context) error {
+				<-release
+				return nil
+			}, nil).Once()
+
+			h := newDatabasesHandler(logger, 2, WithWAL(wal))
+			ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+			require.Equal(t, "[ok]", h.Handle(ctx, "SET key val"))
+			require.Equal(t, "[ok]", h.Handle(ctx, "SET other val"))
+
+			done := make(chan string)
+			go func() {
+				done <- h.Handle(ctx, tc.req)
+			}()
+
+			// The other clients aren't blocked while the query waits for the WAL.
+			other := network.ContextWithSession(context.Background(), network.NewSession(2, nil))
+			require.Eventually(t, func() bool {
+				return strings.HasPrefix(h.Handle(other, "GET key"), "[not_found]")
+			}, time.Second, time.Millisecond)
+			if tc.cmdID == MoveCommandID {
+				assert.Equal(t, "[ok] 1", h.Handle(other, "MOVE other 1"))
+			}
+			assert.Equal(t, "[ok]", h.Handle(other, "SET key val"))
+
+			close(release)
+			assert.Equal(t, tc.want, <-done)
+		})
+	}
+}
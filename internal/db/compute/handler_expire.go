@@ -0,0 +1,148 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+const (
+	exOption   = "EX"
+	pxOption   = "PX"
+	exatOption = "EXAT"
+	pxatOption = "PXAT"
+)
+
+const (
+	ttlNotFound    = -2
+	ttlNotExpiring = -1
+)
+
+var (
+	errInvalidExpireTime = errors.New("invalid expire time")
+	errSyntax            = errors.New("syntax error")
+)
+
+// parseSetExpiration parses the EX|PX|EXAT|PXAT option of SET query
+// and returns the absolute deadline.
+func parseSetExpiration(opt, arg string, now time.Time) (time.Time, error) {
+	var cmdID CommandID
+	switch strings.ToUpper(opt) {
+	case exOption:
+		cmdID = ExpireCommandID
+	case pxOption:
+		cmdID = PExpireCommandID
+	case exatOption:
+		cmdID = ExpireAtCommandID
+	case pxatOption:
+		cmdID = PExpireAtCommandID
+	default:
+		return time.Time{}, errSyntax
+	}
+
+	expireAt, err := parseExpireTime(cmdID, arg, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !expireAt.After(now) && (cmdID == ExpireCommandID || cmdID == PExpireCommandID) {
+		return time.Time{}, errInvalidExpireTime
+	}
+	return expireAt, nil
+}
+
+// parseExpireTime converts the argument of EXPIRE-like commands to the absolute deadline.
+func parseExpireTime(cmdID CommandID, arg string, now time.Time) (time.Time, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, errInvalidExpireTime
+	}
+
+	switch cmdID {
+	case ExpireCommandID:
+		return now.Add(time.Duration(n) * time.Second), nil
+	case PExpireCommandID:
+		return now.Add(time.Duration(n) * time.Millisecond), nil
+	case ExpireAtCommandID:
+		return time.Unix(n, 0), nil
+	default:
+		return time.UnixMilli(n), nil
+	}
+}
+
+func formatUnixMilli(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func (h *QueryHandler) handleExpire(ctx context.Context, query Query) Response {
+	args := query.Args()
+	expireAt, err := parseExpireTime(query.cmdID, args[1], time.Now())
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	// The relative deadline is logged as the absolute one,
+	// otherwise replaying the WAL would prolong the key life.
+	logged := NewQuery(PExpireAtCommandID, []string{args[0], formatUnixMilli(expireAt)})
+
+	var ok bool
+	err = h.mutate(ctx, logged, func() error {
+		ok, err = h.storage(ctx).Expire(ctx, args[0], expireAt)
+		return err
+	})
+	if err != nil {
+		h.logger.Error("failed to handle EXPIRE query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithValue(formatBool(ok))
+}
+
+func (h *QueryHandler) handleTTL(ctx context.Context, query Query) Response {
+	args := query.Args()
+	expireAt, err := h.storage(ctx).ExpireTime(ctx, args[0])
+	if errors.Is(err, dberrors.ErrNotFound) {
+		return OKResponse.WithValue(strconv.Itoa(ttlNotFound))
+	}
+	if err != nil {
+		h.logger.Error("failed to handle TTL query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	if expireAt.IsZero() {
+		return OKResponse.WithValue(strconv.Itoa(ttlNotExpiring))
+	}
+
+	ttl := max(time.Until(expireAt).Milliseconds(), 0)
+	if query.cmdID == TTLCommandID {
+		ttl = (ttl + 500) / 1000 //nolint:mnd // round milliseconds to seconds
+	}
+	return OKResponse.WithValue(strconv.FormatInt(ttl, 10))
+}
+
+func (h *QueryHandler) handlePersist(ctx context.Context, query Query) Response {
+	args := query.Args()
+
+	var (
+		ok  bool
+		err error
+	)
+	err = h.mutate(ctx, query, func() error {
+		ok, err = h.storage(ctx).Persist(ctx, args[0])
+		return err
+	})
+	if err != nil {
+		h.logger.Error("failed to handle PERSIST query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithValue(formatBool(ok))
+}
@@ -0,0 +1,154 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+func TestQueryHandler_Handle_expiration(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	nearly := func(want time.Time) any {
+		return mock.MatchedBy(func(got time.Time) bool {
+			return got.Sub(want).Abs() < time.Second
+		})
+	}
+	pxat := func(want time.Time) any {
+		return mock.MatchedBy(func(args []string) bool {
+			ms, err := strconv.ParseInt(args[len(args)-1], 10, 64)
+			return err == nil && time.UnixMilli(ms).Sub(want).Abs() < time.Second
+		})
+	}
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(store *MockStorage, wal *MockWAL)
+		wantResult string
+	}{
+		{
+			name:    "set ex: ok",
+			request: "SET key val EX 10",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), pxat(time.Now().Add(10*time.Second))).Return(walWritten(nil), nil)
+				store.On("SetWithExpiration", mock.Anything, "key", "val", nearly(time.Now().Add(10*time.Second))).Return(nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "set px: ok",
+			request: "SET key val px 1500",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), pxat(time.Now().Add(1500*time.Millisecond))).Return(walWritten(nil), nil)
+				store.On("SetWithExpiration", mock.Anything, "key", "val", nearly(time.Now().Add(1500*time.Millisecond))).Return(nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:       "set ex: non positive",
+			request:    "SET key val EX 0",
+			wantResult: "[parse_query_error] invalid expire time",
+		},
+		{
+			name:       "set ex: not a number",
+			request:    "SET key val EX ten",
+			wantResult: "[parse_query_error] invalid expire time",
+		},
+		{
+			name:       "set: unknown option",
+			request:    "SET key val KEEP 10",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:    "expire: ok",
+			request: "EXPIRE key 60",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(PExpireAtCommandID), pxat(time.Now().Add(time.Minute))).Return(walWritten(nil), nil)
+				store.On("Expire", mock.Anything, "key", nearly(time.Now().Add(time.Minute))).Return(true, nil)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "pexpireat: key not found",
+			request: "PEXPIREAT key 1700000000000",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(PExpireAtCommandID), []string{"key", "1700000000000"}).Return(walWritten(nil), nil)
+				store.On("Expire", mock.Anything, "key", time.UnixMilli(1700000000000)).Return(false, nil)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "expire: internal server error",
+			request: "EXPIRE key 60",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("Expire", mock.Anything, "key", mock.Anything).Return(false, errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "ttl: ok",
+			request: "TTL key",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Now().Add(10*time.Second), nil)
+			},
+			wantResult: "[ok] 10",
+		},
+		{
+			name:    "pttl: ok",
+			request: "PTTL key",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Now().Add(-time.Second), nil)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "ttl: no deadline",
+			request: "TTL key",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, nil)
+			},
+			wantResult: "[ok] -1",
+		},
+		{
+			name:    "ttl: key not found",
+			request: "TTL key",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, dberrors.ErrNotFound)
+			},
+			wantResult: "[ok] -2",
+		},
+		{
+			name:    "persist: ok",
+			request: "PERSIST key",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(PersistCommandID), []string{"key"}).Return(walWritten(nil), nil)
+				store.On("Persist", mock.Anything, "key").Return(true, nil)
+			},
+			wantResult: "[ok] 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, wal := NewMockStorage(t), NewMockWAL(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(store, wal)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, store, WithWAL(wal)).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
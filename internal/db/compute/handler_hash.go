@@ -0,0 +1,204 @@
+package compute
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// asHash returns the hash stored by the key, the missing key is an empty hash.
+func asHash(v storage.Value) (*storage.Hash, error) {
+	if v == nil {
+		return storage.NewHash(), nil
+	}
+	hash, ok := v.(*storage.Hash)
+	if !ok {
+		return nil, dberrors.ErrWrongType
+	}
+	return hash, nil
+}
+
+// viewHash calls fn with the hash stored by the key.
+func (h *QueryHandler) viewHash(ctx context.Context, key string, fn func(hash *storage.Hash)) error {
+	return h.storage(ctx).View(ctx, key, func(v storage.Value) error {
+		hash, err := asHash(v)
+		if err != nil {
+			return err
+		}
+		fn(hash)
+		return nil
+	})
+}
+
+// mutateHash applies the query changing the hash stored by the key in place.
+// The key is removed if the hash becomes empty.
+func (h *QueryHandler) mutateHash(ctx context.Context, query Query, fn func(hash *storage.Hash) error) error {
+	return h.mutate(ctx, query, func() error {
+		return h.storage(ctx).Mutate(ctx, query.Args()[0], func(v storage.Value) (storage.Value, error) {
+			hash, err := asHash(v)
+			if err != nil {
+				return nil, err
+			}
+			if err = fn(hash); err != nil {
+				return nil, err
+			}
+			if hash.Len() == 0 {
+				return nil, nil //nolint:nilnil // nil value removes the key
+			}
+			return hash, nil
+		})
+	})
+}
+
+// handleHSet handles HSET key field value [field value ...] and responds
+// with the number of the added fields.
+func (h *QueryHandler) handleHSet(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var added int
+	err := h.mutateHash(ctx, query, func(hash *storage.Hash) error {
+		for i := 1; i < len(args); i += 2 {
+			if hash.Set(args[i], args[i+1]) {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(added))
+}
+
+func (h *QueryHandler) handleHGet(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var (
+		value string
+		ok    bool
+	)
+	err := h.viewHash(ctx, args[0], func(hash *storage.Hash) {
+		value, ok = hash.Get(args[1])
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	if !ok {
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	}
+	return OKResponse.WithValue(value)
+}
+
+// handleHMGet responds with the array of the values in the order of the fields,
+// the missing fields are marked as not found.
+func (h *QueryHandler) handleHMGet(ctx context.Context, query Query) Response {
+	args := query.Args()
+	fields := args[1:]
+	elems := make([]Response, len(fields))
+	err := h.viewHash(ctx, args[0], func(hash *storage.Hash) {
+		for i, field := range fields {
+			value, ok := hash.Get(field)
+			if !ok {
+				elems[i] = NotFoundResponse
+				continue
+			}
+			elems[i] = OKResponse.WithValue(value)
+		}
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithArray(elems)
+}
+
+// handleHDel removes the fields and responds with the number of the existing ones.
+func (h *QueryHandler) handleHDel(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var removed int
+	err := h.mutateHash(ctx, query, func(hash *storage.Hash) error {
+		for _, field := range args[1:] {
+			if hash.Del(field) {
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(removed))
+}
+
+func (h *QueryHandler) handleHLen(ctx context.Context, query Query) Response {
+	var n int
+	err := h.viewHash(ctx, query.Args()[0], func(hash *storage.Hash) {
+		n = hash.Len()
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+func (h *QueryHandler) handleHExists(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var ok bool
+	err := h.viewHash(ctx, args[0], func(hash *storage.Hash) {
+		_, ok = hash.Get(args[1])
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(formatBool(ok))
+}
+
+// handleHGetAll handles HKEYS, HVALS and HGETALL. The fields go in ascending
+// order, HGETALL responds with the field-value pairs.
+func (h *QueryHandler) handleHGetAll(ctx context.Context, query Query) Response {
+	values := []string{}
+	err := h.viewHash(ctx, query.Args()[0], func(hash *storage.Hash) {
+		for _, field := range hash.Fields() {
+			value, _ := hash.Get(field)
+			switch query.cmdID {
+			case HKeysCommandID:
+				values = append(values, field)
+			case HValsCommandID:
+				values = append(values, value)
+			default:
+				values = append(values, field, value)
+			}
+		}
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValues(values)
+}
+
+// handleHIncrBy increments the integer value of the field, the missing field is treated as 0.
+func (h *QueryHandler) handleHIncrBy(ctx context.Context, query Query) Response {
+	args := query.Args()
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(errInvalidIncrement)
+	}
+
+	var result int64
+	err = h.mutateHash(ctx, query, func(hash *storage.Hash) error {
+		var n int64
+		if value, ok := hash.Get(args[1]); ok {
+			var err error
+			if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return dberrors.ErrNotInteger
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return dberrors.ErrOverflow
+		}
+		result = n + delta
+		hash.Set(args[1], strconv.FormatInt(result, 10))
+		return nil
+	})
+	return h.incrResponse(query, strconv.FormatInt(result, 10), err)
+}
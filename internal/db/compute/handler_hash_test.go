@@ -0,0 +1,267 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// newHash returns the hash of the given field-value pairs.
+func newHash(pairs ...string) *storage.Hash {
+	hash := storage.NewHash()
+	for i := 0; i < len(pairs); i += 2 {
+		hash.Set(pairs[i], pairs[i+1])
+	}
+	return hash
+}
+
+// viewCall makes the mock call the view function with the given value.
+func viewCall(store *MockStorage, key string, v storage.Value) {
+	store.On("View", mock.Anything, key, mock.Anything).Return(
+		func(_ context.Context, _ string, fn storage.ViewFunc) error {
+			return fn(v)
+		},
+	)
+}
+
+// mutateCall makes the mock apply the mutate function to the given value
+// and expects it to return the wanted one.
+func mutateCall(t *testing.T, store *MockStorage, key string, v, want storage.Value) {
+	store.On("Mutate", mock.Anything, key, mock.Anything).Return(
+		func(_ context.Context, _ string, fn storage.MutateFunc) error {
+			got, err := fn(v)
+			if err != nil {
+				return err
+			}
+			// The values are compared encoded, since their layout may differ.
+			if want == nil || got == nil {
+				assert.Equal(t, want, got)
+			} else {
+				assert.Equal(t, want.Type(), got.Type())
+				assert.Equal(t, storage.MarshalValue(want), storage.MarshalValue(got))
+			}
+			return nil
+		},
+	)
+}
+
+func TestQueryHandler_Handle_hash(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(t *testing.T, store *MockStorage)
+		wantResult string
+	}{
+		{
+			name:    "hset: new key",
+			request: "HSET key a 1 b 2",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, newHash("a", "1", "b", "2"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "hset: existing field",
+			request: "HSET key a 10 c 3",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "1"), newHash("a", "10", "c", "3"))
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "hset: wrong type",
+			request: "HSET key a 1",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", storage.String("value"), nil)
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+		{
+			name:    "hset: out of memory",
+			request: "HSET key a 1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				store.On("Mutate", mock.Anything, "key", mock.Anything).Return(dberrors.ErrOutOfMemory)
+			},
+			wantResult: "[out_of_memory] not enough memory to store the key",
+		},
+		{
+			name:       "hset: missing value",
+			request:    "HSET key a 1 b",
+			wantResult: "[parse_query_error] invalid the number of arguments",
+		},
+		{
+			name:    "hget: ok",
+			request: "HGET key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("a", "1"))
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "hget: missing field",
+			request: "HGET key b",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("a", "1"))
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:    "hget: missing key",
+			request: "HGET key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", nil)
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:    "hmget: ok",
+			request: "HMGET key a b",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("b", "2"))
+			},
+			wantResult: "[ok]\n1) [not_found]\n2) [ok] 2",
+		},
+		{
+			name:    "hdel: ok",
+			request: "HDEL key a c",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "1", "b", "2"), newHash("b", "2"))
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "hdel: last field",
+			request: "HDEL key a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "1"), nil)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "hdel: missing key",
+			request: "HDEL key a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, nil)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "hlen: ok",
+			request: "HLEN key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("a", "1", "b", "2"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "hexists: ok",
+			request: "HEXISTS key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("a", "1"))
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "hkeys: sorted",
+			request: "HKEYS key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("b", "2", "a", "1"))
+			},
+			wantResult: "[ok] a b",
+		},
+		{
+			name:    "hvals: sorted by fields",
+			request: "HVALS key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("b", "2", "a", "1"))
+			},
+			wantResult: "[ok] 1 2",
+		},
+		{
+			name:    "hgetall: ok",
+			request: "HGETALL key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newHash("b", "two words", "a", "1"))
+			},
+			wantResult: `[ok] a 1 b "two words"`,
+		},
+		{
+			name:    "hgetall: wrong type",
+			request: "HGETALL key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", storage.String("value"))
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+		{
+			name:    "hincrby: missing field",
+			request: "HINCRBY key a 5",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("b", "2"), newHash("a", "5", "b", "2"))
+			},
+			wantResult: "[ok] 5",
+		},
+		{
+			name:    "hincrby: ok",
+			request: "HINCRBY key a -3",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "1"), newHash("a", "-2"))
+			},
+			wantResult: "[ok] -2",
+		},
+		{
+			name:    "hincrby: not an integer",
+			request: "HINCRBY key a 1",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "abc"), nil)
+			},
+			wantResult: "[wrong_type] value is not an integer",
+		},
+		{
+			name:    "hincrby: overflow",
+			request: "HINCRBY key a 1",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "9223372036854775807"), nil)
+			},
+			wantResult: "[out_of_range] increment or decrement would overflow",
+		},
+		{
+			name:       "hincrby: invalid increment",
+			request:    "HINCRBY key a b",
+			wantResult: "[parse_query_error] increment is not an integer",
+		},
+		{
+			name:    "get: hash",
+			request: "GET key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				store.On("Get", mock.Anything, "key").Return("", dberrors.ErrWrongType)
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMockStorage(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(t, store)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, store).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+var (
+	errInvalidIncrement      = errors.New("increment is not an integer")
+	errInvalidFloatIncrement = errors.New("increment is not a valid float")
+)
+
+// handleIncr handles INCR, DECR and INCRBY. The missing key is treated as 0.
+func (h *QueryHandler) handleIncr(ctx context.Context, query Query) Response {
+	args := query.Args()
+
+	var delta int64
+	switch query.cmdID {
+	case IncrCommandID:
+		delta = 1
+	case DecrCommandID:
+		delta = -1
+	default:
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return ParseQueryErrorResponse.WithErr(errInvalidIncrement)
+		}
+		delta = n
+	}
+
+	var value string
+	err := h.mutate(ctx, query, func() error {
+		var err error
+		value, err = h.storage(ctx).Update(ctx, args[0], func(value string, exists bool) (string, error) {
+			var n int64
+			if exists {
+				var err error
+				if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+					return "", dberrors.ErrNotInteger
+				}
+			}
+			if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+				return "", dberrors.ErrOverflow
+			}
+			return strconv.FormatInt(n+delta, 10), nil
+		})
+		return err
+	})
+	return h.incrResponse(query, value, err)
+}
+
+// handleIncrByFloat handles INCRBYFLOAT. The result is stored in the shortest
+// decimal form, so replaying the query from the WAL gives the same value.
+func (h *QueryHandler) handleIncrByFloat(ctx context.Context, query Query) Response {
+	args := query.Args()
+	delta, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || math.IsInf(delta, 0) || math.IsNaN(delta) {
+		return ParseQueryErrorResponse.WithErr(errInvalidFloatIncrement)
+	}
+
+	var value string
+	err = h.mutate(ctx, query, func() error {
+		var err error
+		value, err = h.storage(ctx).Update(ctx, args[0], func(value string, exists bool) (string, error) {
+			var f float64
+			if exists {
+				var err error
+				if f, err = strconv.ParseFloat(value, 64); err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+					return "", dberrors.ErrNotFloat
+				}
+			}
+			f += delta
+			if math.IsInf(f, 0) {
+				return "", dberrors.ErrOverflow
+			}
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		})
+		return err
+	})
+	return h.incrResponse(query, value, err)
+}
+
+func (h *QueryHandler) incrResponse(query Query, value string, err error) Response {
+	switch {
+	case err == nil:
+		return OKResponse.WithValue(value)
+	case errors.Is(err, dberrors.ErrNotInteger), errors.Is(err, dberrors.ErrNotFloat):
+		return WrongTypeResponse.WithErr(err)
+	case errors.Is(err, dberrors.ErrOverflow):
+		return OutOfRangeResponse.WithErr(err)
+	default:
+		return h.errResponse(query, err)
+	}
+}
@@ -0,0 +1,150 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// updateCall makes the mock apply the update function to the given current value.
+func updateCall(store *MockStorage, key, value string, exists bool) {
+	store.On("Update", mock.Anything, key, mock.Anything).Return(
+		func(_ context.Context, _ string, fn storage.UpdateFunc) (string, error) {
+			return fn(value, exists)
+		},
+	)
+}
+
+func TestQueryHandler_Handle_incr(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(store *MockStorage)
+		wantResult string
+	}{
+		{
+			name:    "incr: missing key",
+			request: "INCR key",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "", false)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "decr: ok",
+			request: "DECR key",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "10", true)
+			},
+			wantResult: "[ok] 9",
+		},
+		{
+			name:    "incrby: negative",
+			request: "INCRBY key -15",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "10", true)
+			},
+			wantResult: "[ok] -5",
+		},
+		{
+			name:       "incrby: invalid increment",
+			request:    "INCRBY key 1.5",
+			wantResult: "[parse_query_error] increment is not an integer",
+		},
+		{
+			name:    "incr: not an integer",
+			request: "INCR key",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "1.5", true)
+			},
+			wantResult: "[wrong_type] value is not an integer",
+		},
+		{
+			name:    "incr: overflow",
+			request: "INCR key",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", strconv.FormatInt(1<<63-1, 10), true)
+			},
+			wantResult: "[out_of_range] increment or decrement would overflow",
+		},
+		{
+			name:    "incrby: underflow",
+			request: "INCRBY key -2",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", strconv.FormatInt(-1<<63+1, 10), true)
+			},
+			wantResult: "[out_of_range] increment or decrement would overflow",
+		},
+		{
+			name:    "incr: out of memory",
+			request: "INCR key",
+			mockSetup: func(store *MockStorage) {
+				store.On("Update", mock.Anything, "key", mock.Anything).Return("", dberrors.ErrOutOfMemory)
+			},
+			wantResult: "[out_of_memory] not enough memory to store the key",
+		},
+		{
+			name:    "incrbyfloat: ok",
+			request: "INCRBYFLOAT key 0.1",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "10.5", true)
+			},
+			wantResult: "[ok] 10.6",
+		},
+		{
+			name:    "incrbyfloat: integer value",
+			request: "INCRBYFLOAT key 5.0e3",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "", false)
+			},
+			wantResult: "[ok] 5000",
+		},
+		{
+			name:       "incrbyfloat: invalid increment",
+			request:    "INCRBYFLOAT key inf",
+			wantResult: "[parse_query_error] increment is not a valid float",
+		},
+		{
+			name:    "incrbyfloat: not a float",
+			request: "INCRBYFLOAT key 1",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "abc", true)
+			},
+			wantResult: "[wrong_type] value is not a valid float",
+		},
+		{
+			name:    "incrbyfloat: overflow",
+			request: "INCRBYFLOAT key 1.7e308",
+			mockSetup: func(store *MockStorage) {
+				updateCall(store, "key", "1.7e308", true)
+			},
+			wantResult: "[out_of_range] increment or decrement would overflow",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMockStorage(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(store)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, store).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
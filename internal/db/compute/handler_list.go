@@ -0,0 +1,312 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+var (
+	errInvalidIndex        = errors.New("value is not an integer or out of range")
+	errInvalidCount        = errors.New("value is out of range, must be positive")
+	errInvalidBlockTimeout = errors.New("timeout is not a float or out of range")
+	errNegativeTimeout     = errors.New("timeout is negative")
+	errBlockTimeout        = errors.New("timeout expired")
+)
+
+// asList returns the list stored by the key, the missing key is an empty list.
+func asList(v storage.Value) (*storage.List, error) {
+	if v == nil {
+		return storage.NewList(), nil
+	}
+	list, ok := v.(*storage.List)
+	if !ok {
+		return nil, dberrors.ErrWrongType
+	}
+	return list, nil
+}
+
+// viewList calls fn with the list stored by the key.
+func (h *QueryHandler) viewList(ctx context.Context, key string, fn func(list *storage.List)) error {
+	return h.storage(ctx).View(ctx, key, func(v storage.Value) error {
+		list, err := asList(v)
+		if err != nil {
+			return err
+		}
+		fn(list)
+		return nil
+	})
+}
+
+// mutateList applies the query changing the list stored by the key in place.
+// The key is removed if the list becomes empty.
+func (h *QueryHandler) mutateList(ctx context.Context, query Query, fn func(list *storage.List) error) error {
+	return h.mutate(ctx, query, func() error {
+		return h.storage(ctx).Mutate(ctx, query.Args()[0], func(v storage.Value) (storage.Value, error) {
+			list, err := asList(v)
+			if err != nil {
+				return nil, err
+			}
+			if err = fn(list); err != nil {
+				return nil, err
+			}
+			if list.Len() == 0 {
+				return nil, nil //nolint:nilnil // nil value removes the key
+			}
+			return list, nil
+		})
+	})
+}
+
+// handlePush handles LPUSH and RPUSH, responds with the length of the list
+// and wakes up the clients blocked by the key.
+func (h *QueryHandler) handlePush(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var n int
+	err := h.mutateList(ctx, query, func(list *storage.List) error {
+		if query.cmdID == LPushCommandID {
+			list.PushLeft(args[1:]...)
+		} else {
+			list.PushRight(args[1:]...)
+		}
+		n = list.Len()
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+
+	h.waits.notify(h.dbIndex(ctx), args[0])
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// handlePop handles LPOP and RPOP key [count]. It responds with the array
+// of the elements if the count is given.
+func (h *QueryHandler) handlePop(ctx context.Context, query Query) Response {
+	args := query.Args()
+	count := 1
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return ParseQueryErrorResponse.WithErr(errInvalidCount)
+		}
+		count = n
+	}
+
+	var (
+		elems  []string
+		exists bool
+	)
+	err := h.mutateList(ctx, query, func(list *storage.List) error {
+		exists = list.Len() != 0
+		elems = popElems(list, query.cmdID == LPopCommandID, count)
+		return nil
+	})
+	switch {
+	case err != nil:
+		return h.errResponse(query, err)
+	case !exists:
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	case len(args) > 1:
+		return OKResponse.WithValues(elems)
+	default:
+		return OKResponse.WithValue(elems[0])
+	}
+}
+
+func popElems(list *storage.List, left bool, count int) []string {
+	elems := make([]string, 0, min(count, list.Len()))
+	for range count {
+		var (
+			elem string
+			ok   bool
+		)
+		if left {
+			elem, ok = list.PopLeft()
+		} else {
+			elem, ok = list.PopRight()
+		}
+		if !ok {
+			break
+		}
+		elems = append(elems, elem)
+	}
+	return elems
+}
+
+func (h *QueryHandler) handleLRange(ctx context.Context, query Query) Response {
+	args := query.Args()
+	start, stop, err := parseListRange(args[1], args[2])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	var elems []string
+	err = h.viewList(ctx, args[0], func(list *storage.List) {
+		elems = list.Range(start, stop)
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValues(elems)
+}
+
+func (h *QueryHandler) handleLLen(ctx context.Context, query Query) Response {
+	var n int
+	err := h.viewList(ctx, query.Args()[0], func(list *storage.List) {
+		n = list.Len()
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+func (h *QueryHandler) handleLIndex(ctx context.Context, query Query) Response {
+	args := query.Args()
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(errInvalidIndex)
+	}
+
+	var (
+		elem string
+		ok   bool
+	)
+	err = h.viewList(ctx, args[0], func(list *storage.List) {
+		elem, ok = list.Index(i)
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	if !ok {
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	}
+	return OKResponse.WithValue(elem)
+}
+
+// handleLTrim keeps only the elements from start to stop inclusive.
+func (h *QueryHandler) handleLTrim(ctx context.Context, query Query) Response {
+	args := query.Args()
+	start, stop, err := parseListRange(args[1], args[2])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	err = h.mutateList(ctx, query, func(list *storage.List) error {
+		list.Trim(start, stop)
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse
+}
+
+func parseListRange(startArg, stopArg string) (int, int, error) {
+	start, err := strconv.Atoi(startArg)
+	if err != nil {
+		return 0, 0, errInvalidIndex
+	}
+	stop, err := strconv.Atoi(stopArg)
+	if err != nil {
+		return 0, 0, errInvalidIndex
+	}
+	return start, stop, nil
+}
+
+// handleBlockingPop handles BLPOP and BRPOP key [key ...] timeout. It pops
+// the element from the first non-empty list or blocks until any of the lists
+// gets the elements. The clients blocked by the same key are served in FIFO
+// order. Inside EXEC, the command doesn't block like in Redis.
+func (h *QueryHandler) handleBlockingPop(ctx context.Context, query Query) Response {
+	args := query.Args()
+	keys := args[:len(args)-1]
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	left := query.cmdID == BLPopCommandID
+	if _, ok := ctx.Value(execCtxKey{}).(*execution); ok {
+		return h.popFirst(ctx, query, keys, left)
+	}
+
+	w := h.waits.add(h.dbIndex(ctx), keys)
+	defer h.waits.remove(w)
+
+	var deadline <-chan time.Time
+	if timeout != 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		// The keys the previous clients are blocked by are left to them,
+		// they wake this client up leaving the queues.
+		if resp := h.popFirst(ctx, query, h.waits.turn(w), left); !errors.Is(resp.err, errBlockTimeout) {
+			return resp
+		}
+
+		select {
+		case <-w.ready:
+		case <-deadline:
+			return NotFoundResponse.WithErr(errBlockTimeout)
+		case <-ctx.Done():
+			// The server is shutting down.
+			return AbortedResponse.WithErr(ctx.Err())
+		}
+	}
+}
+
+// popFirst pops the element from the first non-empty list. The pop is
+// written to the WAL as LPOP or RPOP, so replaying it never blocks.
+func (h *QueryHandler) popFirst(ctx context.Context, query Query, keys []string, left bool) Response {
+	cmdID := RPopCommandID
+	if left {
+		cmdID = LPopCommandID
+	}
+
+	for _, key := range keys {
+		// Check the list first, not to write the pops of the empty lists to the WAL.
+		var n int
+		if err := h.viewList(ctx, key, func(list *storage.List) { n = list.Len() }); err != nil {
+			return h.errResponse(query, err)
+		}
+		if n == 0 {
+			continue
+		}
+
+		var elems []string
+		err := h.mutateList(ctx, NewQuery(cmdID, []string{key}), func(list *storage.List) error {
+			elems = popElems(list, left, 1)
+			return nil
+		})
+		if err != nil {
+			return h.errResponse(query, err)
+		}
+		if len(elems) != 0 {
+			return OKResponse.WithValues([]string{key, elems[0]})
+		}
+	}
+	return NotFoundResponse.WithErr(errBlockTimeout)
+}
+
+// parseBlockTimeout parses the timeout in seconds, zero means blocking forever.
+func parseBlockTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, errInvalidBlockTimeout
+	}
+	if seconds < 0 {
+		return 0, errNegativeTimeout
+	}
+	// The tiny timeout mustn't turn into blocking forever.
+	return max(time.Duration(seconds*float64(time.Second)), time.Duration(math.Ceil(seconds))), nil
+}
@@ -0,0 +1,315 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+// newList returns the list of the given elements.
+func newList(elems ...string) *storage.List {
+	list := storage.NewList()
+	list.PushRight(elems...)
+	return list
+}
+
+func TestQueryHandler_Handle_list(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(t *testing.T, store *MockStorage)
+		wantResult string
+	}{
+		{
+			name:    "lpush: new key",
+			request: "LPUSH key a b",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, newList("b", "a"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "rpush: existing key",
+			request: "RPUSH key c",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newList("a", "b"), newList("a", "b", "c"))
+			},
+			wantResult: "[ok] 3",
+		},
+		{
+			name:    "lpush: wrong type",
+			request: "LPUSH key a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "1"), nil)
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+		{
+			name:    "lpop: ok",
+			request: "LPOP key",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newList("a", "b"), newList("b"))
+			},
+			wantResult: "[ok] a",
+		},
+		{
+			name:    "rpop: last element",
+			request: "RPOP key",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newList("a"), nil)
+			},
+			wantResult: "[ok] a",
+		},
+		{
+			name:    "rpop: count",
+			request: "RPOP key 5",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newList("a", "b"), nil)
+			},
+			wantResult: "[ok] b a",
+		},
+		{
+			name:    "lpop: missing key",
+			request: "LPOP key",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, nil)
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:       "lpop: negative count",
+			request:    "LPOP key -1",
+			wantResult: "[parse_query_error] value is out of range, must be positive",
+		},
+		{
+			name:    "lrange: ok",
+			request: "LRANGE key 1 -1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newList("a", "b", "c"))
+			},
+			wantResult: "[ok] b c",
+		},
+		{
+			name:    "lrange: missing key",
+			request: "LRANGE key 0 -1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:       "lrange: invalid index",
+			request:    "LRANGE key a 1",
+			wantResult: "[parse_query_error] value is not an integer or out of range",
+		},
+		{
+			name:    "llen: ok",
+			request: "LLEN key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newList("a", "b"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "llen: wrong type",
+			request: "LLEN key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", storage.String("value"))
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+		{
+			name:    "lindex: negative",
+			request: "LINDEX key -1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newList("a", "b"))
+			},
+			wantResult: "[ok] b",
+		},
+		{
+			name:    "lindex: out of range",
+			request: "LINDEX key 2",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newList("a", "b"))
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:    "ltrim: ok",
+			request: "LTRIM key 0 1",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newList("a", "b", "c"), newList("a", "b"))
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "ltrim: empty range",
+			request: "LTRIM key 5 10",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newList("a", "b", "c"), nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "blpop: first non-empty list",
+			request: "BLPOP k1 k2 0",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				viewCall(store, "k1", nil)
+				viewCall(store, "k2", newList("a", "b"))
+				mutateCall(t, store, "k2", newList("a", "b"), newList("b"))
+			},
+			wantResult: "[ok] k2 a",
+		},
+		{
+			name:       "blpop: negative timeout",
+			request:    "BLPOP key -1",
+			wantResult: "[parse_query_error] timeout is negative",
+		},
+		{
+			name:       "brpop: invalid timeout",
+			request:    "BRPOP key abc",
+			wantResult: "[parse_query_error] timeout is not a float or out of range",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMockStorage(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(t, store)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, store).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
+
+// waitBlocked waits until the number of the clients blocked by the key is n.
+func waitBlocked(t *testing.T, h *QueryHandler, key string, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		h.waits.mu.Lock()
+		defer h.waits.mu.Unlock()
+		return len(h.waits.queues[key]) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestQueryHandler_Handle_blockingPop(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+
+	t.Run("fifo", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+
+		const clients = 3
+		results := make([]chan string, clients)
+		for i := range clients {
+			results[i] = make(chan string, 1)
+			go func() {
+				results[i] <- h.Handle(ctx, "BLPOP key 0")
+			}()
+			waitBlocked(t, h, "key", i+1)
+		}
+
+		assert.Equal(t, "[ok] 1", h.Handle(ctx, "RPUSH key a"))
+		assert.Equal(t, "[ok] key a", <-results[0])
+		assert.Equal(t, "[ok] 2", h.Handle(ctx, "RPUSH key b c"))
+		assert.Equal(t, "[ok] key b", <-results[1])
+		assert.Equal(t, "[ok] key c", <-results[2])
+		waitBlocked(t, h, "key", 0)
+		assert.Equal(t, "[ok] 0", h.Handle(ctx, "LLEN key"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+
+		assert.Equal(t, "[not_found] timeout expired", h.Handle(ctx, "BRPOP k1 k2 0.01"))
+		waitBlocked(t, h, "k1", 0)
+		waitBlocked(t, h, "k2", 0)
+	})
+
+	t.Run("timed out client passes the turn", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "[not_found] timeout expired", h.Handle(ctx, "BLPOP key 0.05"))
+		}()
+		waitBlocked(t, h, "key", 1)
+
+		// The element pushed to the list no one waits for is popped right
+		// away, otherwise the client waits for the previous one to leave.
+		assert.Equal(t, "[ok] 1", h.Handle(ctx, "RPUSH other a"))
+		assert.Equal(t, "[ok] other a", h.Handle(ctx, "BRPOP other key 1"))
+		assert.Equal(t, "[ok] 1", h.Handle(ctx, "RPUSH other b"))
+		assert.Equal(t, "[ok] other b", h.Handle(ctx, "BRPOP key other 1"))
+		wg.Wait()
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+
+		assert.Equal(t, "[ok]", h.Handle(ctx, "SET key value"))
+		assert.Equal(t,
+			"[wrong_type] operation against a key holding the wrong kind of value",
+			h.Handle(ctx, "BLPOP key 0"),
+		)
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+
+		ctx, cancel := context.WithCancel(ctx)
+		result := make(chan string, 1)
+		go func() {
+			result <- h.Handle(ctx, "BLPOP key 0")
+		}()
+		waitBlocked(t, h, "key", 1)
+
+		cancel()
+		assert.Equal(t, "[aborted] context canceled", <-result)
+		waitBlocked(t, h, "key", 0)
+	})
+
+	t.Run("wal and exec", func(t *testing.T) {
+		wal := NewMockWAL(t)
+		wal.On("Append", int(RPushCommandID), []string{"key", "a"}).Return(walWritten(nil), nil)
+		wal.On("Append", int(LPopCommandID), []string{"key"}).Return(walWritten(nil), nil)
+		wal.On("Append", int(ExecCommandID), []string{
+			strconv.Itoa(int(RPushCommandID)), "2", "key", "b",
+			strconv.Itoa(int(RPopCommandID)), "1", "key",
+		}).Return(walWritten(nil), nil)
+
+		h := NewQueryHandler(logger, storage.NewEngine(), WithWAL(wal))
+		assert.Equal(t, "[ok] 1", h.Handle(ctx, "RPUSH key a"))
+		assert.Equal(t, "[ok] key a", h.Handle(ctx, "BLPOP key 0"))
+
+		ctx := network.ContextWithSession(ctx, network.NewSession(1, nil))
+		for _, req := range []string{"MULTI", "BRPOP key 0", "RPUSH key b", "BRPOP key 0"} {
+			h.Handle(ctx, req)
+		}
+		assert.Equal(t,
+			"[ok]\n1) [not_found] timeout expired\n2) [ok] 1\n3) [ok] key b",
+			h.Handle(ctx, "EXEC"),
+		)
+	})
+}
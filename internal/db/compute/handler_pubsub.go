@@ -0,0 +1,99 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+var (
+	errSubscribeNoSession = errors.New("subscriptions require a client session")
+	errNotifyDisabled     = errors.New("keyspace notifications are disabled")
+)
+
+// handleSubscribe handles SUBSCRIBE channel [channel ...] and PSUBSCRIBE
+// pattern [pattern ...]. It responds with the confirmation per channel,
+// the messages are pushed to the session afterwards.
+func (h *QueryHandler) handleSubscribe(ctx context.Context, query Query) Response {
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errSubscribeNoSession)
+	}
+
+	sc := channelScope
+	if query.cmdID == PSubscribeCommandID {
+		sc = patternScope
+	}
+	return confirmationsResponse(h.pubsub.subscribe(sess, encodePush(ctx), query.Args(), sc))
+}
+
+// handleUnsubscribe handles UNSUBSCRIBE [channel ...] and PUNSUBSCRIBE
+// [pattern ...], the client is unsubscribed from everything if no arguments are given.
+func (h *QueryHandler) handleUnsubscribe(ctx context.Context, query Query) Response {
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errSubscribeNoSession)
+	}
+
+	sc := channelScope
+	if query.cmdID == PUnsubscribeCommandID {
+		sc = patternScope
+	}
+	return confirmationsResponse(h.pubsub.unsubscribe(sess, query.Args(), sc))
+}
+
+// handleNotify handles NOTIFY pattern [pattern ...] subscribing the client
+// to the changes of the keys matching the patterns. The changes are pushed
+// to the session as ["event", type, key, timestamp].
+func (h *QueryHandler) handleNotify(ctx context.Context, query Query) Response {
+	if h.pubsub.bus == nil {
+		return NotSupportedResponse.WithErr(errNotifyDisabled)
+	}
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errSubscribeNoSession)
+	}
+	return confirmationsResponse(h.pubsub.subscribe(sess, encodePush(ctx), query.Args(), notifyScope))
+}
+
+// handleUnnotify handles UNNOTIFY [pattern ...], the client is unsubscribed
+// from all the key patterns if no arguments are given.
+func (h *QueryHandler) handleUnnotify(ctx context.Context, query Query) Response {
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errSubscribeNoSession)
+	}
+	return confirmationsResponse(h.pubsub.unsubscribe(sess, query.Args(), notifyScope))
+}
+
+// handlePublish responds with the number of the clients received the message.
+func (h *QueryHandler) handlePublish(query Query) Response {
+	args := query.Args()
+	return OKResponse.WithValue(strconv.Itoa(h.pubsub.publish(args[0], args[1])))
+}
+
+func isPubSubCommand(cmdID CommandID) bool {
+	switch cmdID {
+	case SubscribeCommandID, UnsubscribeCommandID, PSubscribeCommandID, PUnsubscribeCommandID,
+		NotifyCommandID, UnnotifyCommandID:
+		return true
+	default:
+		return false
+	}
+}
+
+func confirmationsResponse(confirmations [][]string) Response {
+	elems := make([]Response, 0, len(confirmations))
+	for _, c := range confirmations {
+		elems = append(elems, OKResponse.WithValues(c))
+	}
+	return OKResponse.WithArray(elems)
+}
+
+// Disconnect releases the state of the disconnected client, it's meant to be
+// the network.SessionHook of the server.
+func (h *QueryHandler) Disconnect(_ context.Context, sess *network.Session) {
+	h.pubsub.drop(sess)
+}
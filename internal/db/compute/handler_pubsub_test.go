@@ -0,0 +1,226 @@
+package compute
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/events"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func TestQueryHandler_Handle_pubSub(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name        string
+		requests    []string
+		wantResults []string
+	}{
+		{
+			name:     "subscribe and unsubscribe all",
+			requests: []string{"SUBSCRIBE b a", "PSUBSCRIBE news.*", "UNSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE"},
+			wantResults: []string{
+				"[ok]\n1) [ok] subscribe b 1\n2) [ok] subscribe a 2",
+				"[ok]\n1) [ok] psubscribe news.* 3",
+				"[ok]\n1) [ok] unsubscribe a 2\n2) [ok] unsubscribe b 1",
+				"[ok]\n1) [ok] unsubscribe 1",
+				"[ok]\n1) [ok] punsubscribe news.* 0",
+			},
+		},
+		{
+			name:     "unsubscribe without subscriptions",
+			requests: []string{"UNSUBSCRIBE a", "PUNSUBSCRIBE"},
+			wantResults: []string{
+				"[ok]\n1) [ok] unsubscribe a 0",
+				"[ok]\n1) [ok] punsubscribe 0",
+			},
+		},
+		{
+			name:     "resubscribe",
+			requests: []string{"SUBSCRIBE a", "SUBSCRIBE a", "PUNSUBSCRIBE a", "UNSUBSCRIBE a"},
+			wantResults: []string{
+				"[ok]\n1) [ok] subscribe a 1",
+				"[ok]\n1) [ok] subscribe a 1",
+				"[ok]\n1) [ok] punsubscribe a 1",
+				"[ok]\n1) [ok] unsubscribe a 0",
+			},
+		},
+		{
+			name:     "notify and unnotify all",
+			requests: []string{"NOTIFY user:* order:*", "SUBSCRIBE a", "UNNOTIFY", "UNNOTIFY", "UNSUBSCRIBE"},
+			wantResults: []string{
+				"[ok]\n1) [ok] notify user:* 1\n2) [ok] notify order:* 2",
+				"[ok]\n1) [ok] subscribe a 3",
+				"[ok]\n1) [ok] unnotify order:* 2\n2) [ok] unnotify user:* 1",
+				"[ok]\n1) [ok] unnotify 1",
+				"[ok]\n1) [ok] unsubscribe a 0",
+			},
+		},
+		{
+			name:        "publish without subscribers",
+			requests:    []string{"PUBLISH a message"},
+			wantResults: []string{"[ok] 0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bus, err := events.NewBus()
+			require.NoError(t, err)
+
+			h := NewQueryHandler(logger, NewMockStorage(t), WithEventBus(bus))
+			sess := network.NewSession(1, nil)
+			ctx := network.ContextWithSession(context.Background(), sess)
+
+			gotResults := make([]string, 0, len(tc.requests))
+			for _, req := range tc.requests {
+				gotResults = append(gotResults, h.Handle(ctx, req))
+			}
+			assert.Equal(t, tc.wantResults, gotResults)
+			assert.False(t, sess.Subscribed())
+		})
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		h := NewQueryHandler(logger, NewMockStorage(t))
+		got := h.Handle(context.Background(), "SUBSCRIBE a")
+		assert.Equal(t, "[internal_error] subscriptions require a client session", got)
+	})
+
+	t.Run("notifications disabled", func(t *testing.T) {
+		h := NewQueryHandler(logger, NewMockStorage(t))
+		ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+		got := h.Handle(ctx, "NOTIFY *")
+		assert.Equal(t, "[not_supported] keyspace notifications are disabled", got)
+	})
+}
+
+func TestQueryHandler_pubSubDelivery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	h := NewQueryHandler(logger, NewMockStorage(t))
+
+	disconnected := make(chan struct{}, 1)
+	srv, err := network.NewTCPServer(
+		logger,
+		network.WithServerListen(":0"),
+		network.WithServerOnDisconnect(func(ctx context.Context, sess *network.Session) {
+			h.Disconnect(ctx, sess)
+			disconnected <- struct{}{}
+		}),
+	)
+	require.NoError(t, err)
+	go srv.ServeHandler(h)
+	defer func() {
+		assert.NoError(t, srv.Shutdown(context.Background()))
+	}()
+
+	addr := fmt.Sprintf(":%d", srv.ListenPort())
+	subscriber, err := network.NewTCPClient(addr)
+	require.NoError(t, err)
+	publisher, err := network.NewTCPClient(addr, network.WithClientReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer publisher.Close()
+
+	messages, err := subscriber.Subscribe("SUBSCRIBE news.tech")
+	require.NoError(t, err)
+	_, err = subscriber.Subscribe("PSUBSCRIBE news.*")
+	require.NoError(t, err)
+
+	receive := func() string {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("message isn't received")
+			return ""
+		}
+	}
+	assert.Equal(t, "[ok]\n1) [ok] subscribe news.tech 1", receive())
+	assert.Equal(t, "[ok]\n1) [ok] psubscribe news.* 2", receive())
+
+	resp, err := publisher.Send(`PUBLISH news.tech "hello world"`)
+	require.NoError(t, err)
+	assert.Equal(t, "[ok] 2", resp)
+
+	got := []string{receive(), receive()}
+	assert.ElementsMatch(t, []string{
+		`[push] message news.tech "hello world"`,
+		`[push] pmessage news.* news.tech "hello world"`,
+	}, got)
+
+	resp, err = publisher.Send("PUBLISH sports score")
+	require.NoError(t, err)
+	assert.Equal(t, "[ok] 0", resp)
+
+	// The subscriptions of the disconnected client are dropped.
+	require.NoError(t, subscriber.Close())
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber isn't disconnected")
+	}
+	resp, err = publisher.Send("PUBLISH news.tech bye")
+	require.NoError(t, err)
+	assert.Equal(t, "[ok] 0", resp)
+}
+
+func TestQueryHandler_notifyDelivery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	bus, err := events.NewBus()
+	require.NoError(t, err)
+	engine := storage.NewEngine(storage.WithEventListener(bus.Publish))
+	defer engine.Close()
+	h := NewQueryHandler(logger, engine, WithEventBus(bus))
+
+	srv, err := network.NewTCPServer(
+		logger,
+		network.WithServerListen(":0"),
+		network.WithServerOnDisconnect(h.Disconnect),
+	)
+	require.NoError(t, err)
+	go srv.ServeHandler(h)
+	defer func() {
+		assert.NoError(t, srv.Shutdown(context.Background()))
+	}()
+
+	addr := fmt.Sprintf(":%d", srv.ListenPort())
+	subscriber, err := network.NewTCPClient(addr)
+	require.NoError(t, err)
+	defer subscriber.Close()
+	client, err := network.NewTCPClient(addr, network.WithClientReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer client.Close()
+
+	messages, err := subscriber.Subscribe("NOTIFY user:*")
+	require.NoError(t, err)
+
+	receive := func() string {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("message isn't received")
+			return ""
+		}
+	}
+	assert.Equal(t, "[ok]\n1) [ok] notify user:* 1", receive())
+
+	for _, req := range []string{"SET order:1 v", "SET user:1 v", "EXPIRE user:1 100", "DEL user:1"} {
+		_, err = client.Send(req)
+		require.NoError(t, err)
+	}
+	for _, want := range []string{"set user:1", "expire user:1", "del user:1"} {
+		assert.Regexp(t, `^\[push\] event `+want+` \d+$`, receive())
+	}
+}
@@ -0,0 +1,130 @@
+package compute
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+const (
+	matchOption = "MATCH"
+	countOption = "COUNT"
+	limitOption = "LIMIT"
+
+	// startCursor starts a new iteration, it's also returned when the iteration is over.
+	startCursor      = "0"
+	defaultScanCount = 10
+)
+
+var (
+	errInvalidCursor = errors.New("invalid cursor")
+	errNotPositive   = errors.New("value is not a positive integer")
+)
+
+// handleScan handles SCAN cursor [MATCH pattern] [COUNT count].
+// The response contains the next cursor followed by the matched keys.
+func (h *QueryHandler) handleScan(ctx context.Context, query Query) Response {
+	ordered := h.orderedStorage(ctx)
+	if ordered == nil {
+		return NotSupportedResponse.WithErr(dberrors.ErrNotSupported)
+	}
+
+	args := query.Args()
+	cursor, err := decodeCursor(args[0])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	pattern, count := "*", defaultScanCount
+	for opts := args[1:]; len(opts) != 0; opts = opts[2:] {
+		if len(opts) < 2 { //nolint:mnd // ignore magic number
+			return ParseQueryErrorResponse.WithErr(errSyntax)
+		}
+
+		switch strings.ToUpper(opts[0]) {
+		case matchOption:
+			pattern = opts[1]
+		case countOption:
+			if count, err = parsePositive(opts[1]); err != nil {
+				return ParseQueryErrorResponse.WithErr(err)
+			}
+		default:
+			return ParseQueryErrorResponse.WithErr(errSyntax)
+		}
+	}
+
+	keys, next, err := ordered.Scan(ctx, cursor, pattern, count)
+	if err != nil {
+		h.logger.Error("failed to handle SCAN query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithValues(append([]string{encodeCursor(next)}, keys...))
+}
+
+// handleRange handles RANGE start end [LIMIT count].
+// The response contains the keys interleaved with their values.
+func (h *QueryHandler) handleRange(ctx context.Context, query Query) Response {
+	ordered := h.orderedStorage(ctx)
+	if ordered == nil {
+		return NotSupportedResponse.WithErr(dberrors.ErrNotSupported)
+	}
+
+	args := query.Args()
+	limit := 0
+	if len(args) > 2 { //nolint:mnd // ignore magic number
+		if len(args) != 4 || !strings.EqualFold(args[2], limitOption) { //nolint:mnd // ignore magic number
+			return ParseQueryErrorResponse.WithErr(errSyntax)
+		}
+
+		var err error
+		if limit, err = parsePositive(args[3]); err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+	}
+
+	kvs, err := ordered.Range(ctx, args[0], args[1], limit)
+	if err != nil {
+		h.logger.Error("failed to handle RANGE query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+
+	values := make([]string, 0, 2*len(kvs)) //nolint:mnd // ignore magic number
+	for _, kv := range kvs {
+		values = append(values, kv.Key, kv.Value)
+	}
+	return OKResponse.WithValues(values)
+}
+
+func parsePositive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, errNotPositive
+	}
+	return n, nil
+}
+
+// encodeCursor encodes the key to continue the iteration from,
+// so it can't be confused with the start cursor.
+func encodeCursor(key string) string {
+	if key == "" {
+		return startCursor
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == startCursor {
+		return "", nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errInvalidCursor
+	}
+	return string(key), nil
+}
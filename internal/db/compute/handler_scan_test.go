@@ -0,0 +1,137 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+type mockOrderedStore struct {
+	*MockStorage
+	*MockOrderedStorage
+}
+
+func TestQueryHandler_Handle_scan(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(store *MockOrderedStorage)
+		wantResult string
+	}{
+		{
+			name:    "scan: start",
+			request: "SCAN 0",
+			mockSetup: func(store *MockOrderedStorage) {
+				store.On("Scan", mock.Anything, "", "*", 10).Return([]string{"a", "b"}, "c", nil)
+			},
+			wantResult: "[ok] Yw a b",
+		},
+		{
+			name:    "scan: continue with options",
+			request: "SCAN Yw match user:* COUNT 2",
+			mockSetup: func(store *MockOrderedStorage) {
+				store.On("Scan", mock.Anything, "c", "user:*", 2).Return([]string{"user:1"}, "", nil)
+			},
+			wantResult: "[ok] 0 user:1",
+		},
+		{
+			name:    "scan: nothing found",
+			request: "SCAN 0 MATCH x*",
+			mockSetup: func(store *MockOrderedStorage) {
+				store.On("Scan", mock.Anything, "", "x*", 10).Return(nil, "", nil)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:       "scan: invalid cursor",
+			request:    "SCAN !",
+			wantResult: "[parse_query_error] invalid cursor",
+		},
+		{
+			name:       "scan: invalid count",
+			request:    "SCAN 0 COUNT 0",
+			wantResult: "[parse_query_error] value is not a positive integer",
+		},
+		{
+			name:       "scan: missing option value",
+			request:    "SCAN 0 MATCH",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:       "scan: unknown option",
+			request:    "SCAN 0 TYPE string",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:    "scan: internal server error",
+			request: "SCAN 0",
+			mockSetup: func(store *MockOrderedStorage) {
+				store.On("Scan", mock.Anything, "", "*", 10).Return(nil, "", errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "range: ok",
+			request: "RANGE a c",
+			mockSetup: func(store *MockOrderedStorage) {
+				store.On("Range", mock.Anything, "a", "c", 0).Return([]storage.KeyValue{
+					{Key: "a", Value: "1"},
+					{Key: "b", Value: "2"},
+				}, nil)
+			},
+			wantResult: "[ok] a 1 b 2",
+		},
+		{
+			name:    "range: limit",
+			request: "RANGE a c limit 1",
+			mockSetup: func(store *MockOrderedStorage) {
+				store.On("Range", mock.Anything, "a", "c", 1).Return([]storage.KeyValue{{Key: "a", Value: "1"}}, nil)
+			},
+			wantResult: "[ok] a 1",
+		},
+		{
+			name:       "range: invalid limit",
+			request:    "RANGE a c LIMIT -1",
+			wantResult: "[parse_query_error] value is not a positive integer",
+		},
+		{
+			name:       "range: unknown option",
+			request:    "RANGE a c COUNT 1",
+			wantResult: "[parse_query_error] syntax error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := mockOrderedStore{MockStorage: NewMockStorage(t), MockOrderedStorage: NewMockOrderedStorage(t)}
+			if tc.mockSetup != nil {
+				tc.mockSetup(store.MockOrderedStorage)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, store).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
+
+func TestQueryHandler_Handle_scanNotSupported(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := NewQueryHandler(logger, NewMockStorage(t))
+
+	for _, request := range []string{"SCAN 0", "RANGE a b"} {
+		gotResult := handler.Handle(context.Background(), request)
+		assert.Equal(t, "[not_supported] command is not supported by the storage engine", gotResult)
+	}
+}
@@ -0,0 +1,158 @@
+package compute
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// asSet returns the set stored by the key, the missing key is an empty set.
+func asSet(v storage.Value) (*storage.Set, error) {
+	if v == nil {
+		return storage.NewSet(), nil
+	}
+	set, ok := v.(*storage.Set)
+	if !ok {
+		return nil, dberrors.ErrWrongType
+	}
+	return set, nil
+}
+
+// viewSet calls fn with the set stored by the key.
+func (h *QueryHandler) viewSet(ctx context.Context, key string, fn func(set *storage.Set)) error {
+	return h.storage(ctx).View(ctx, key, func(v storage.Value) error {
+		set, err := asSet(v)
+		if err != nil {
+			return err
+		}
+		fn(set)
+		return nil
+	})
+}
+
+// mutateSet applies the query changing the set stored by the key in place.
+// The key is removed if the set becomes empty.
+func (h *QueryHandler) mutateSet(ctx context.Context, query Query, fn func(set *storage.Set)) error {
+	return h.mutate(ctx, query, func() error {
+		return h.storage(ctx).Mutate(ctx, query.Args()[0], func(v storage.Value) (storage.Value, error) {
+			set, err := asSet(v)
+			if err != nil {
+				return nil, err
+			}
+			fn(set)
+			if set.Len() == 0 {
+				return nil, nil //nolint:nilnil // nil value removes the key
+			}
+			return set, nil
+		})
+	})
+}
+
+// handleSAdd handles SADD and SREM key member [member ...] and responds
+// with the number of the added or removed members.
+func (h *QueryHandler) handleSAdd(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var n int
+	err := h.mutateSet(ctx, query, func(set *storage.Set) {
+		for _, member := range args[1:] {
+			var changed bool
+			if query.cmdID == SAddCommandID {
+				changed = set.Add(member)
+			} else {
+				changed = set.Remove(member)
+			}
+			if changed {
+				n++
+			}
+		}
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+func (h *QueryHandler) handleSIsMember(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var ok bool
+	err := h.viewSet(ctx, args[0], func(set *storage.Set) {
+		ok = set.Contains(args[1])
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(formatBool(ok))
+}
+
+// handleSMembers responds with the members in ascending order.
+func (h *QueryHandler) handleSMembers(ctx context.Context, query Query) Response {
+	var members []string
+	err := h.viewSet(ctx, query.Args()[0], func(set *storage.Set) {
+		members = set.Members()
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValues(members)
+}
+
+func (h *QueryHandler) handleSCard(ctx context.Context, query Query) Response {
+	var n int
+	err := h.viewSet(ctx, query.Args()[0], func(set *storage.Set) {
+		n = set.Len()
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// handleSetOp handles SINTER, SUNION and SDIFF key [key ...]. The sets are
+// read at once, the members of the result go in ascending order.
+func (h *QueryHandler) handleSetOp(ctx context.Context, query Query) Response {
+	var members []string
+	err := h.storage(ctx).MView(ctx, query.Args(), func(vs []storage.Value) error {
+		sets := make([]*storage.Set, len(vs))
+		for i, v := range vs {
+			set, err := asSet(v)
+			if err != nil {
+				return err
+			}
+			sets[i] = set
+		}
+		members = combineSets(query.cmdID, sets)
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValues(members)
+}
+
+func combineSets(cmdID CommandID, sets []*storage.Set) []string {
+	result := storage.NewSet()
+	switch cmdID {
+	case SUnionCommandID:
+		for _, set := range sets {
+			for _, member := range set.Members() {
+				result.Add(member)
+			}
+		}
+	case SInterCommandID:
+		for _, member := range sets[0].Members() {
+			if !slices.ContainsFunc(sets[1:], func(set *storage.Set) bool { return !set.Contains(member) }) {
+				result.Add(member)
+			}
+		}
+	default:
+		for _, member := range sets[0].Members() {
+			if !slices.ContainsFunc(sets[1:], func(set *storage.Set) bool { return set.Contains(member) }) {
+				result.Add(member)
+			}
+		}
+	}
+	return result.Members()
+}
@@ -0,0 +1,164 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// newSet returns the set of the given members.
+func newSet(members ...string) *storage.Set {
+	set := storage.NewSet()
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// mviewCall makes the mock call the view function with the given values.
+func mviewCall(store *MockStorage, keys []string, vs ...storage.Value) {
+	store.On("MView", mock.Anything, keys, mock.Anything).Return(
+		func(_ context.Context, _ []string, fn storage.MViewFunc) error {
+			return fn(vs)
+		},
+	)
+}
+
+func TestQueryHandler_Handle_set(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(t *testing.T, store *MockStorage)
+		wantResult string
+	}{
+		{
+			name:    "sadd: new key",
+			request: "SADD key a b a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, newSet("a", "b"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "sadd: existing member",
+			request: "SADD key a c",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newSet("a"), newSet("a", "c"))
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "sadd: wrong type",
+			request: "SADD key a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newHash("a", "1"), nil)
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+		{
+			name:       "sadd: missing member",
+			request:    "SADD key",
+			wantResult: "[parse_query_error] invalid the number of arguments",
+		},
+		{
+			name:    "srem: last member",
+			request: "SREM key a b",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newSet("a"), nil)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "sismember: ok",
+			request: "SISMEMBER key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSet("a"))
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "sismember: missing key",
+			request: "SISMEMBER key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", nil)
+			},
+			wantResult: "[ok] 0",
+		},
+		{
+			name:    "smembers: sorted",
+			request: "SMEMBERS key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSet("c", "a", "b"))
+			},
+			wantResult: "[ok] a b c",
+		},
+		{
+			name:    "scard: ok",
+			request: "SCARD key",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSet("a", "b"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "sinter: ok",
+			request: "SINTER k1 k2",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				mviewCall(store, []string{"k1", "k2"}, newSet("a", "b", "c"), newSet("c", "b", "d"))
+			},
+			wantResult: "[ok] b c",
+		},
+		{
+			name:    "sinter: missing key",
+			request: "SINTER k1 k2",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				mviewCall(store, []string{"k1", "k2"}, newSet("a"), nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "sunion: ok",
+			request: "SUNION k1 k2 k3",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				mviewCall(store, []string{"k1", "k2", "k3"}, newSet("c", "a"), nil, newSet("b", "a"))
+			},
+			wantResult: "[ok] a b c",
+		},
+		{
+			name:    "sdiff: ok",
+			request: "SDIFF k1 k2 k3",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				mviewCall(store, []string{"k1", "k2", "k3"}, newSet("a", "b", "c", "d"), newSet("b"), newSet("d"))
+			},
+			wantResult: "[ok] a c",
+		},
+		{
+			name:    "sdiff: wrong type",
+			request: "SDIFF k1 k2",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				mviewCall(store, []string{"k1", "k2"}, newSet("a"), newList("a"))
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMockStorage(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(t, store)
+			}
+
+			gotResult := NewQueryHandler(logger, store).Handle(context.Background(), tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
@@ -0,0 +1,830 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+const (
+	maxLenOption     = "MAXLEN"
+	blockOption      = "BLOCK"
+	streamsOption    = "STREAMS"
+	groupOption      = "GROUP"
+	noAckOption      = "NOACK"
+	mkStreamOption   = "MKSTREAM"
+	timeOption       = "TIME"
+	createSubcommand = "CREATE"
+
+	// The special IDs of the stream commands.
+	minStreamID   = "-"
+	maxStreamID   = "+"
+	lastStreamID  = "$"
+	undeliveredID = ">"
+	autoStreamID  = "*"
+)
+
+var (
+	errInvalidStreamID      = errors.New("invalid stream ID specified as stream command argument")
+	errStreamIDTooSmall     = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+	errZeroStreamID         = errors.New("the ID specified in XADD must be greater than 0-0")
+	errStreamExhausted      = errors.New("the stream has exhausted the last possible ID, unable to add more items")
+	errInvalidMaxLen        = errors.New("MAXLEN must be a non-negative integer")
+	errInvalidStreamTimeout = errors.New("timeout is not an integer or out of range")
+	errUnbalancedStreams    = errors.New("unbalanced list of streams: for each stream key an ID must be specified")
+	errUnknownSubcommand    = errors.New("unknown subcommand")
+	errNoStream             = errors.New("the key doesn't exist, use MKSTREAM to create the stream")
+	errNoGroup              = errors.New("no such key or consumer group")
+	errGroupExists          = errors.New("consumer group name already exists")
+	errNoEntries            = errors.New("no entries")
+)
+
+// asStream returns the stream stored by the key, nil if the key doesn't exist.
+// Unlike the other types, the missing stream differs from the empty one,
+// the latter keeps its last ID and consumer groups.
+func asStream(v storage.Value) (*storage.Stream, error) {
+	if v == nil {
+		return nil, nil //nolint:nilnil // the key doesn't exist
+	}
+	s, ok := v.(*storage.Stream)
+	if !ok {
+		return nil, dberrors.ErrWrongType
+	}
+	return s, nil
+}
+
+// viewStream calls fn with the stream stored by the key, nil if the key doesn't exist.
+func (h *QueryHandler) viewStream(ctx context.Context, key string, fn func(s *storage.Stream) error) error {
+	return h.storage(ctx).View(ctx, key, func(v storage.Value) error {
+		s, err := asStream(v)
+		if err != nil {
+			return err
+		}
+		return fn(s)
+	})
+}
+
+// mutateStream applies the query changing the stream stored by its key, see changeStream.
+func (h *QueryHandler) mutateStream(
+	ctx context.Context,
+	query Query,
+	fn func(s *storage.Stream) (*storage.Stream, error),
+) error {
+	return h.mutate(ctx, query, func() error {
+		return h.changeStream(ctx, query.Keys()[0], fn)
+	})
+}
+
+// changeStream replaces the stream stored by the key with the one returned by
+// fn, nil is passed to fn if the key doesn't exist. The empty stream is kept.
+func (h *QueryHandler) changeStream(
+	ctx context.Context,
+	key string,
+	fn func(s *storage.Stream) (*storage.Stream, error),
+) error {
+	return h.storage(ctx).Mutate(ctx, key, func(v storage.Value) (storage.Value, error) {
+		s, err := asStream(v)
+		if err != nil {
+			return nil, err
+		}
+		if s, err = fn(s); err != nil || s == nil {
+			return nil, err
+		}
+		return s, nil
+	})
+}
+
+// handleXAdd handles XADD key [MAXLEN [=|~] n] ID field value [field value ...]
+// and responds with the ID of the added entry. The ID is generated while the key
+// is locked and written to the WAL instead of "*", so replaying the query adds
+// the same entry.
+func (h *QueryHandler) handleXAdd(ctx context.Context, query Query) Response {
+	args := query.Args()
+	key := args[0]
+	maxLen, rest, err := parseMaxLen(args[1:])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	if len(rest) < 3 || len(rest)%2 == 0 { //nolint:mnd // ID and field-value pairs
+		return ParseQueryErrorResponse.WithErr(errSyntax)
+	}
+
+	var id storage.StreamID
+	err = h.mutateResolved(ctx, scopedKeys(h.dbIndex(ctx), query.Keys()), func() (Query, error) {
+		err := h.changeStream(ctx, key, func(s *storage.Stream) (*storage.Stream, error) {
+			if s == nil {
+				s = storage.NewStream()
+			}
+			var err error
+			if id, err = resolveStreamID(s, rest[0], time.Now()); err != nil {
+				return nil, err
+			}
+			if !s.Add(id, slices.Clone(rest[1:])) {
+				return nil, errStreamIDTooSmall
+			}
+			if maxLen >= 0 {
+				s.Trim(maxLen)
+			}
+			return s, nil
+		})
+		return NewQuery(query.cmdID, slices.Concat(args[:len(args)-len(rest)], []string{id.String()}, rest[1:])), err
+	})
+	if err != nil {
+		return h.streamErrResponse(query, err)
+	}
+
+	h.signals.notify(h.dbIndex(ctx), key)
+	return OKResponse.WithValue(id.String())
+}
+
+// handleXRange handles XRANGE key start end [COUNT n] and XREVRANGE key end start [COUNT n].
+func (h *QueryHandler) handleXRange(ctx context.Context, query Query) Response {
+	args := query.Args()
+	rev := query.cmdID == XRevRangeCommandID
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+
+	start, err := parseRangeID(startArg, false)
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	end, err := parseRangeID(endArg, true)
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	count, err := parseStreamCount(args[3:])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	var entries []storage.StreamEntry
+	err = h.viewStream(ctx, args[0], func(s *storage.Stream) error {
+		if s != nil {
+			entries = s.Range(start, end, count, rev)
+		}
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return entriesResponse(entries)
+}
+
+func (h *QueryHandler) handleXLen(ctx context.Context, query Query) Response {
+	var n int
+	err := h.viewStream(ctx, query.Args()[0], func(s *storage.Stream) error {
+		if s != nil {
+			n = s.Len()
+		}
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// handleXTrim handles XTRIM key MAXLEN [=|~] n and responds with the number
+// of the removed entries. The approximate trimming is exact.
+func (h *QueryHandler) handleXTrim(ctx context.Context, query Query) Response {
+	args := query.Args()
+	maxLen, rest, err := parseMaxLen(args[1:])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+	if maxLen < 0 || len(rest) != 0 {
+		return ParseQueryErrorResponse.WithErr(errSyntax)
+	}
+
+	var n int
+	err = h.mutateStream(ctx, query, func(s *storage.Stream) (*storage.Stream, error) {
+		if s != nil {
+			n = s.Trim(maxLen)
+		}
+		return s, nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// streamReadOptions are the options of XREAD and XREADGROUP.
+type streamReadOptions struct {
+	group    string
+	consumer string
+	count    int
+	block    time.Duration
+	blocking bool
+	noAck    bool
+	keys     []string
+	ids      []string
+	// deliveredAt is given by TIME, it's accepted from the WAL only.
+	deliveredAt time.Time
+}
+
+// parseStreamRead parses [GROUP group consumer] [COUNT n] [BLOCK ms] [NOACK]
+// STREAMS key [key ...] ID [ID ...], the group is given to XREADGROUP only.
+func parseStreamRead(cmdID CommandID, args []string) (streamReadOptions, error) {
+	var opts streamReadOptions
+	i := 0
+	if cmdID == XReadGroupCommandID {
+		if !strings.EqualFold(args[0], groupOption) {
+			return opts, errSyntax
+		}
+		opts.group, opts.consumer = args[1], args[2]
+		i = 3
+	}
+
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case countOption:
+			if i+1 == len(args) {
+				return opts, errSyntax
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return opts, errInvalidCount
+			}
+			opts.count = n
+			i++
+		case blockOption:
+			if i+1 == len(args) {
+				return opts, errSyntax
+			}
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || ms > math.MaxInt64/int64(time.Millisecond) {
+				return opts, errInvalidStreamTimeout
+			}
+			if ms < 0 {
+				return opts, errNegativeTimeout
+			}
+			opts.block, opts.blocking = time.Duration(ms)*time.Millisecond, true
+			i++
+		case noAckOption:
+			if cmdID != XReadGroupCommandID {
+				return opts, errSyntax
+			}
+			opts.noAck = true
+		case timeOption:
+			if cmdID != XReadGroupCommandID || i+1 == len(args) {
+				return opts, errSyntax
+			}
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || ms < 0 {
+				return opts, errSyntax
+			}
+			opts.deliveredAt = time.UnixMilli(ms)
+			i++
+		case streamsOption:
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return opts, errUnbalancedStreams
+			}
+			opts.keys, opts.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return opts, nil
+		default:
+			return opts, errSyntax
+		}
+	}
+	return opts, errSyntax
+}
+
+// handleXRead handles XREAD [COUNT n] [BLOCK ms] STREAMS key [key ...] ID [ID ...]
+// and responds with the entries added after the IDs per stream. "$" is the last
+// ID of the stream at the time of the call.
+func (h *QueryHandler) handleXRead(ctx context.Context, query Query) Response {
+	opts, err := parseStreamRead(query.cmdID, query.Args())
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	after := make([]storage.StreamID, len(opts.keys))
+	for i, key := range opts.keys {
+		if opts.ids[i] != lastStreamID {
+			if after[i], err = parseStreamID(opts.ids[i], 0); err != nil {
+				return ParseQueryErrorResponse.WithErr(err)
+			}
+			continue
+		}
+		err = h.viewStream(ctx, key, func(s *storage.Stream) error {
+			if s != nil {
+				after[i] = s.LastID()
+			}
+			return nil
+		})
+		if err != nil {
+			return h.errResponse(query, err)
+		}
+	}
+
+	return h.waitStreams(ctx, opts, func() (Response, bool) {
+		var results []Response
+		for i, key := range opts.keys {
+			var entries []storage.StreamEntry
+			err := h.viewStream(ctx, key, func(s *storage.Stream) error {
+				if from, ok := after[i].Next(); ok && s != nil {
+					entries = s.Range(from, storage.MaxStreamID, opts.count, false)
+				}
+				return nil
+			})
+			if err != nil {
+				return h.errResponse(query, err), true
+			}
+			if len(entries) != 0 {
+				results = append(results, streamResponse(key, entries))
+			}
+		}
+		return OKResponse.WithArray(results), len(results) != 0
+	})
+}
+
+// handleXGroup handles XGROUP CREATE key group ID|$ [MKSTREAM] creating the
+// consumer group delivering the entries after the ID.
+func (h *QueryHandler) handleXGroup(ctx context.Context, query Query) Response {
+	args := query.Args()
+	if !strings.EqualFold(args[0], createSubcommand) {
+		return ParseQueryErrorResponse.WithErr(errUnknownSubcommand)
+	}
+	key, group, idArg := args[1], args[2], args[3]
+	mkStream := len(args) == 5 //nolint:mnd // the option follows the ID
+	if mkStream && !strings.EqualFold(args[4], mkStreamOption) {
+		return ParseQueryErrorResponse.WithErr(errSyntax)
+	}
+
+	var (
+		id  storage.StreamID
+		err error
+	)
+	if idArg != lastStreamID {
+		if id, err = parseStreamID(idArg, 0); err != nil {
+			return h.streamErrResponse(query, err)
+		}
+	}
+
+	// "$" is resolved while the key is locked and written to the WAL as the ID.
+	err = h.mutateResolved(ctx, scopedKeys(h.dbIndex(ctx), query.Keys()), func() (Query, error) {
+		err := h.changeStream(ctx, key, func(s *storage.Stream) (*storage.Stream, error) {
+			if s == nil {
+				if !mkStream {
+					return nil, errNoStream
+				}
+				s = storage.NewStream()
+			}
+			if idArg == lastStreamID {
+				id = s.LastID()
+			}
+			if !s.CreateGroup(group, id) {
+				return nil, errGroupExists
+			}
+			return s, nil
+		})
+		return NewQuery(query.cmdID, slices.Concat(args[:3], []string{id.String()}, args[4:])), err
+	})
+	if err != nil {
+		return h.streamErrResponse(query, err)
+	}
+	return OKResponse
+}
+
+// handleXReadGroup handles XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms]
+// [NOACK] STREAMS key [key ...] ID [ID ...]. ">" delivers the entries never
+// delivered to the group, the other IDs read the entries pending for the consumer.
+func (h *QueryHandler) handleXReadGroup(ctx context.Context, query Query) Response {
+	args := query.Args()
+	opts, err := parseStreamRead(query.cmdID, args)
+	if err == nil && !opts.deliveredAt.IsZero() && ctx.Value(applyCtxKey{}) == nil {
+		err = errSyntax
+	}
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	after := make([]storage.StreamID, len(opts.keys))
+	for i, id := range opts.ids {
+		if id == undeliveredID {
+			continue
+		}
+		if after[i], err = parseStreamID(id, 0); err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+	}
+
+	// The read is written to the WAL without BLOCK, so replaying it never blocks.
+	logged := NewQuery(query.cmdID, withoutBlock(args, 3)) //nolint:mnd // GROUP group consumer
+	return h.waitStreams(ctx, opts, func() (Response, bool) {
+		return h.readGroup(ctx, logged, opts, after)
+	})
+}
+
+// readGroup reads the streams for the consumer of the group. The new entries
+// are checked first, not to write the reads delivering nothing to the WAL,
+// though they may be delivered to another consumer in the meantime.
+// The delivery time is written to the WAL, so replaying the read gives
+// the pending entries the same time.
+func (h *QueryHandler) readGroup(
+	ctx context.Context,
+	query Query,
+	opts streamReadOptions,
+	after []storage.StreamID,
+) (Response, bool) {
+	results := make([]Response, len(opts.keys))
+	var deliver []int
+	for i, key := range opts.keys {
+		err := h.viewStream(ctx, key, func(s *storage.Stream) error {
+			g, err := streamGroup(s, opts.group)
+			if err != nil {
+				return err
+			}
+			if opts.ids[i] != undeliveredID {
+				results[i] = streamResponse(key, s.ReadPending(g, opts.consumer, after[i], opts.count))
+				return nil
+			}
+			if from, ok := g.LastDelivered().Next(); ok && len(s.Range(from, storage.MaxStreamID, 1, false)) != 0 {
+				deliver = append(deliver, i)
+			}
+			return nil
+		})
+		if err != nil {
+			return h.streamErrResponse(query, err), true
+		}
+	}
+
+	if len(deliver) != 0 {
+		now := opts.deliveredAt
+		if now.IsZero() {
+			// The time is truncated to the precision of the WAL.
+			now = time.UnixMilli(time.Now().UnixMilli())
+			query = NewQuery(query.cmdID, slices.Concat(
+				query.Args()[:3], //nolint:mnd // GROUP group consumer
+				[]string{timeOption, strconv.FormatInt(now.UnixMilli(), 10)},
+				query.Args()[3:],
+			))
+		}
+		err := h.mutate(ctx, query, func() error {
+			for _, i := range deliver {
+				err := h.changeStream(ctx, opts.keys[i], func(s *storage.Stream) (*storage.Stream, error) {
+					g, err := streamGroup(s, opts.group)
+					if err != nil {
+						return nil, err
+					}
+					if entries := s.ReadGroup(g, opts.consumer, opts.count, opts.noAck, now); len(entries) != 0 {
+						results[i] = streamResponse(opts.keys[i], entries)
+					}
+					return s, nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return h.streamErrResponse(query, err), true
+		}
+	}
+
+	// The streams having no new entries are omitted, the history is not.
+	results = slices.DeleteFunc(results, func(r Response) bool { return r.array == nil })
+	return OKResponse.WithArray(results), len(results) != 0
+}
+
+// waitStreams calls read until it gives the entries. If BLOCK is given,
+// the client is blocked between the attempts until the streams are changed.
+func (h *QueryHandler) waitStreams(
+	ctx context.Context,
+	opts streamReadOptions,
+	read func() (Response, bool),
+) Response {
+	_, inExec := ctx.Value(execCtxKey{}).(*execution)
+	if !opts.blocking || inExec {
+		if resp, ok := read(); ok {
+			return resp
+		}
+		return NotFoundResponse.WithErr(errNoEntries)
+	}
+
+	// The client is signaled from now on, so the entries added
+	// after the first attempt aren't missed.
+	db := h.dbIndex(ctx)
+	signal := h.signals.add(db, opts.keys)
+	defer h.signals.remove(db, opts.keys, signal)
+
+	var deadline <-chan time.Time
+	if opts.block != 0 {
+		timer := time.NewTimer(opts.block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		if resp, ok := read(); ok {
+			return resp
+		}
+
+		select {
+		case <-signal:
+		case <-deadline:
+			return NotFoundResponse.WithErr(errBlockTimeout)
+		case <-ctx.Done():
+			// The server is shutting down.
+			return AbortedResponse.WithErr(ctx.Err())
+		}
+	}
+}
+
+// handleXAck handles XACK key group ID [ID ...] and responds with the number
+// of the acknowledged entries.
+func (h *QueryHandler) handleXAck(ctx context.Context, query Query) Response {
+	args := query.Args()
+	ids := make([]storage.StreamID, 0, len(args)-2) //nolint:mnd // key and group
+	for _, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+		ids = append(ids, id)
+	}
+
+	var n int
+	err := h.mutateStream(ctx, query, func(s *storage.Stream) (*storage.Stream, error) {
+		if s == nil {
+			return nil, nil //nolint:nilnil // the key stays missing
+		}
+		if g, ok := s.Group(args[1]); ok {
+			n = s.Ack(g, ids...)
+		}
+		return s, nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(n))
+}
+
+// handleXPending handles XPENDING key group [start end count [consumer]].
+// Without the range it responds with the summary of the pending entries,
+// otherwise with the entries, their consumers, idle times and deliveries.
+func (h *QueryHandler) handleXPending(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var (
+		start, end = storage.StreamID{}, storage.MaxStreamID
+		count      int
+		consumer   string
+	)
+	extended := len(args) > 2 //nolint:mnd // key and group
+	if extended {
+		if len(args) < 5 { //nolint:mnd // start, end and count follow the group
+			return ParseQueryErrorResponse.WithErr(errSyntax)
+		}
+		var err error
+		if start, err = parseRangeID(args[2], false); err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+		if end, err = parseRangeID(args[3], true); err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+		if count, err = strconv.Atoi(args[4]); err != nil || count <= 0 {
+			return ParseQueryErrorResponse.WithErr(errInvalidCount)
+		}
+		if len(args) == 6 { //nolint:mnd // the consumer is the last
+			consumer = args[5]
+		}
+	}
+
+	var pending []storage.PendingEntry
+	err := h.viewStream(ctx, args[0], func(s *storage.Stream) error {
+		g, err := streamGroup(s, args[1])
+		if err != nil {
+			return err
+		}
+		pending = g.Pending()
+		return nil
+	})
+	if err != nil {
+		return h.streamErrResponse(query, err)
+	}
+	if !extended {
+		return pendingSummary(pending)
+	}
+
+	now := time.Now()
+	rs := []Response{}
+	for _, pe := range pending {
+		if len(rs) == count {
+			break
+		}
+		if pe.ID.Compare(start) < 0 || pe.ID.Compare(end) > 0 || (consumer != "" && pe.Consumer != consumer) {
+			continue
+		}
+		idle := max(now.Sub(pe.DeliveredAt).Milliseconds(), 0)
+		rs = append(rs, OKResponse.WithValues([]string{
+			pe.ID.String(), pe.Consumer, strconv.FormatInt(idle, 10), strconv.Itoa(pe.Deliveries),
+		}))
+	}
+	return OKResponse.WithArray(rs)
+}
+
+// pendingSummary responds with the number of the pending entries, the smallest
+// and the greatest of their IDs and the number of the entries per consumer.
+func pendingSummary(pending []storage.PendingEntry) Response {
+	if len(pending) == 0 {
+		return OKResponse.WithArray([]Response{
+			OKResponse.WithValue("0"), NotFoundResponse, NotFoundResponse, NotFoundResponse,
+		})
+	}
+
+	counts := make(map[string]int)
+	for _, pe := range pending {
+		counts[pe.Consumer]++
+	}
+	consumers := make([]Response, 0, len(counts))
+	for _, c := range slices.Sorted(maps.Keys(counts)) {
+		consumers = append(consumers, OKResponse.WithValues([]string{c, strconv.Itoa(counts[c])}))
+	}
+	return OKResponse.WithArray([]Response{
+		OKResponse.WithValue(strconv.Itoa(len(pending))),
+		OKResponse.WithValue(pending[0].ID.String()),
+		OKResponse.WithValue(pending[len(pending)-1].ID.String()),
+		OKResponse.WithArray(consumers),
+	})
+}
+
+// streamErrResponse responds to the query failed because of the stream errors.
+func (h *QueryHandler) streamErrResponse(query Query, err error) Response {
+	switch {
+	case errors.Is(err, errInvalidStreamID):
+		return ParseQueryErrorResponse.WithErr(err)
+	case errors.Is(err, errStreamIDTooSmall), errors.Is(err, errZeroStreamID), errors.Is(err, errStreamExhausted):
+		return OutOfRangeResponse.WithErr(err)
+	case errors.Is(err, errNoStream), errors.Is(err, errNoGroup):
+		return NotFoundResponse.WithErr(err)
+	case errors.Is(err, errGroupExists):
+		return ConflictResponse.WithErr(err)
+	default:
+		return h.errResponse(query, err)
+	}
+}
+
+// streamGroup returns the consumer group of the stream.
+func streamGroup(s *storage.Stream, name string) (*storage.ConsumerGroup, error) {
+	if s == nil {
+		return nil, errNoGroup
+	}
+	g, ok := s.Group(name)
+	if !ok {
+		return nil, errNoGroup
+	}
+	return g, nil
+}
+
+// resolveStreamID returns the ID of the entry added to the stream, "*" and
+// "ms-*" are generated from the current time and the last ID of the stream.
+func resolveStreamID(s *storage.Stream, arg string, now time.Time) (storage.StreamID, error) {
+	var (
+		id storage.StreamID
+		ok = true
+	)
+	msPart, seqPart, _ := strings.Cut(arg, "-")
+	switch {
+	case arg == autoStreamID:
+		id, ok = s.NextID(uint64(now.UnixMilli())) //nolint:gosec // the time is after the epoch
+	case seqPart == autoStreamID:
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return storage.StreamID{}, errInvalidStreamID
+		}
+		if id, ok = s.NextID(ms); ok && id.Ms != ms {
+			// The sequence numbers of the time are exhausted.
+			return storage.StreamID{}, errStreamIDTooSmall
+		}
+	default:
+		var err error
+		if id, err = parseStreamID(arg, 0); err != nil {
+			return storage.StreamID{}, err
+		}
+	}
+
+	switch {
+	case !ok:
+		return storage.StreamID{}, errStreamExhausted
+	case id == storage.StreamID{}:
+		return storage.StreamID{}, errZeroStreamID
+	case id.Compare(s.LastID()) <= 0:
+		return storage.StreamID{}, errStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// parseStreamID parses the ms-seq ID, the missing sequence number is defaultSeq.
+func parseStreamID(arg string, defaultSeq uint64) (storage.StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return storage.StreamID{}, errInvalidStreamID
+	}
+	if !hasSeq {
+		return storage.StreamID{Ms: ms, Seq: defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return storage.StreamID{}, errInvalidStreamID
+	}
+	return storage.StreamID{Ms: ms, Seq: seq}, nil
+}
+
+// parseRangeID parses the bound of the range, "-" and "+" are the smallest and
+// the greatest IDs. The end without the sequence number includes the whole millisecond.
+func parseRangeID(arg string, end bool) (storage.StreamID, error) {
+	switch {
+	case arg == minStreamID:
+		return storage.StreamID{}, nil
+	case arg == maxStreamID:
+		return storage.MaxStreamID, nil
+	case end:
+		return parseStreamID(arg, math.MaxUint64)
+	default:
+		return parseStreamID(arg, 0)
+	}
+}
+
+// parseMaxLen parses the optional MAXLEN [=|~] n, -1 is returned if it's missing.
+func parseMaxLen(args []string) (int, []string, error) {
+	if len(args) == 0 || !strings.EqualFold(args[0], maxLenOption) {
+		return -1, args, nil
+	}
+	args = args[1:]
+	if len(args) != 0 && (args[0] == "=" || args[0] == "~") {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return 0, nil, errSyntax
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, nil, errInvalidMaxLen
+	}
+	return n, args[1:], nil
+}
+
+// parseStreamCount parses the optional COUNT n, zero is returned if it's missing.
+func parseStreamCount(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	if len(args) != 2 || !strings.EqualFold(args[0], countOption) { //nolint:mnd // COUNT n
+		return 0, errSyntax
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return 0, errInvalidCount
+	}
+	return n, nil
+}
+
+// withoutBlock returns the arguments of the stream read without BLOCK,
+// the first skip arguments are kept as they are.
+func withoutBlock(args []string, skip int) []string {
+	logged := slices.Clone(args[:skip])
+	for i := skip; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], streamsOption):
+			return append(logged, args[i:]...)
+		case strings.EqualFold(args[i], blockOption):
+			i++
+		default:
+			logged = append(logged, args[i])
+		}
+	}
+	return logged
+}
+
+// entriesResponse responds with the array of the entries, every entry is
+// the array of its ID and fields. The fields of the entry trimmed from
+// the stream are missing.
+func entriesResponse(entries []storage.StreamEntry) Response {
+	rs := make([]Response, len(entries))
+	for i, entry := range entries {
+		fields := NotFoundResponse
+		if entry.Fields != nil {
+			fields = OKResponse.WithValues(entry.Fields)
+		}
+		rs[i] = OKResponse.WithArray([]Response{OKResponse.WithValue(entry.ID.String()), fields})
+	}
+	return OKResponse.WithArray(rs)
+}
+
+// streamResponse responds with the key of the stream and its entries.
+func streamResponse(key string, entries []storage.StreamEntry) Response {
+	return OKResponse.WithArray([]Response{OKResponse.WithValue(key), entriesResponse(entries)})
+}
@@ -0,0 +1,335 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func TestQueryHandler_Handle_stream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+
+	testCases := []struct {
+		name  string
+		steps [][2]string // request and result
+	}{
+		{
+			name: "xadd and xrange",
+			steps: [][2]string{
+				{"XADD s 1-1 a 1", "[ok] 1-1"},
+				{"XADD s 1-* b 2", "[ok] 1-2"},
+				{"XADD s 2 c 3 d 4", "[ok] 2-0"},
+				{"XLEN s", "[ok] 3"},
+				{"XRANGE s - +", "[ok]\n1) [ok]\n   1) [ok] 1-1\n   2) [ok] a 1\n" +
+					"2) [ok]\n   1) [ok] 1-2\n   2) [ok] b 2\n" +
+					"3) [ok]\n   1) [ok] 2-0\n   2) [ok] c 3 d 4"},
+				{"XRANGE s 1 1 COUNT 1", "[ok]\n1) [ok]\n   1) [ok] 1-1\n   2) [ok] a 1"},
+				{"XREVRANGE s + - COUNT 1", "[ok]\n1) [ok]\n   1) [ok] 2-0\n   2) [ok] c 3 d 4"},
+				{"XRANGE s 3 +", "[ok]"},
+				{"XRANGE missing - +", "[ok]"},
+				{"XLEN missing", "[ok] 0"},
+			},
+		},
+		{
+			name: "xadd: invalid IDs",
+			steps: [][2]string{
+				{"XADD s 0-0 a 1", "[out_of_range] the ID specified in XADD must be greater than 0-0"},
+				{"XADD s 5-5 a 1", "[ok] 5-5"},
+				{"XADD s 5-5 a 1", "[out_of_range] the ID specified in XADD is equal or smaller than the target stream top item"},
+				{"XADD s 4-* a 1", "[out_of_range] the ID specified in XADD is equal or smaller than the target stream top item"},
+				{"XADD s x-1 a 1", "[parse_query_error] invalid stream ID specified as stream command argument"},
+				{"XADD s 6-0 a 1 b", "[parse_query_error] syntax error"},
+				{"XRANGE s x +", "[parse_query_error] invalid stream ID specified as stream command argument"},
+				{"XRANGE s - + COUNT 0", "[parse_query_error] value is out of range, must be positive"},
+			},
+		},
+		{
+			name: "maxlen and xtrim",
+			steps: [][2]string{
+				{"XADD s 1 a 1", "[ok] 1-0"},
+				{"XADD s 2 a 2", "[ok] 2-0"},
+				{"XADD s MAXLEN ~ 2 3 a 3", "[ok] 3-0"},
+				{"XLEN s", "[ok] 2"},
+				{"XTRIM s MAXLEN 0", "[ok] 2"},
+				{"XLEN s", "[ok] 0"},
+				// The empty stream keeps the last ID.
+				{"XADD s 3 a 3", "[out_of_range] the ID specified in XADD is equal or smaller than the target stream top item"},
+				{"XTRIM s MAXLEN -1", "[parse_query_error] MAXLEN must be a non-negative integer"},
+				{"XTRIM missing MAXLEN 1", "[ok] 0"},
+			},
+		},
+		{
+			name: "xread",
+			steps: [][2]string{
+				{"XADD s1 1 a 1", "[ok] 1-0"},
+				{"XADD s1 2 a 2", "[ok] 2-0"},
+				{"XADD s2 1 b 1", "[ok] 1-0"},
+				{"XREAD COUNT 1 STREAMS s1 s2 0 0", "[ok]\n1) [ok]\n   1) [ok] s1\n   2) [ok]\n      1) [ok]\n" +
+					"         1) [ok] 1-0\n         2) [ok] a 1\n" +
+					"2) [ok]\n   1) [ok] s2\n   2) [ok]\n      1) [ok]\n         1) [ok] 1-0\n         2) [ok] b 1"},
+				{"XREAD STREAMS s1 s2 1 1", "[ok]\n1) [ok]\n   1) [ok] s1\n   2) [ok]\n      1) [ok]\n" +
+					"         1) [ok] 2-0\n         2) [ok] a 2"},
+				{"XREAD STREAMS s1 $", "[not_found] no entries"},
+				{"XREAD STREAMS s1 s2 0", "[parse_query_error] unbalanced list of streams: " +
+					"for each stream key an ID must be specified"},
+				{"XREAD NOACK STREAMS s1 0", "[parse_query_error] syntax error"},
+			},
+		},
+		{
+			name: "consumer groups",
+			steps: [][2]string{
+				{"XGROUP CREATE s g $", "[not_found] the key doesn't exist, use MKSTREAM to create the stream"},
+				{"XGROUP CREATE s g $ MKSTREAM", "[ok]"},
+				{"XGROUP CREATE s g 0", "[conflict] consumer group name already exists"},
+				{"XGROUP DESTROY s g 0", "[parse_query_error] unknown subcommand"},
+				{"XADD s 1 a 1", "[ok] 1-0"},
+				{"XADD s 2 a 2", "[ok] 2-0"},
+				{"XREADGROUP GROUP g alice COUNT 1 STREAMS s >", "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]\n" +
+					"      1) [ok]\n         1) [ok] 1-0\n         2) [ok] a 1"},
+				{"XREADGROUP GROUP g bob STREAMS s >", "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]\n" +
+					"      1) [ok]\n         1) [ok] 2-0\n         2) [ok] a 2"},
+				{"XREADGROUP GROUP g bob STREAMS s >", "[not_found] no entries"},
+				// The history of the consumer.
+				{"XREADGROUP GROUP g alice STREAMS s 0", "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]\n" +
+					"      1) [ok]\n         1) [ok] 1-0\n         2) [ok] a 1"},
+				{"XPENDING s g", "[ok]\n1) [ok] 2\n2) [ok] 1-0\n3) [ok] 2-0\n4) [ok]\n   1) [ok] alice 1\n   2) [ok] bob 1"},
+				{"XACK s g 1-0 3-0", "[ok] 1"},
+				{"XACK s missing 2-0", "[ok] 0"},
+				{"XACK missing g 2-0", "[ok] 0"},
+				{"XREADGROUP GROUP g alice STREAMS s 0", "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]"},
+				{"XTRIM s MAXLEN 0", "[ok] 2"},
+				// The fields of the trimmed entry are gone.
+				{"XREADGROUP GROUP g bob STREAMS s 0", "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]\n" +
+					"      1) [ok]\n         1) [ok] 2-0\n         2) [not_found]"},
+				{"XACK s g 2-0", "[ok] 1"},
+				{"XPENDING s g", "[ok]\n1) [ok] 0\n2) [not_found]\n3) [not_found]\n4) [not_found]"},
+				{"XREADGROUP GROUP missing c STREAMS s >", "[not_found] no such key or consumer group"},
+				{"XPENDING missing g", "[not_found] no such key or consumer group"},
+			},
+		},
+		{
+			name: "noack",
+			steps: [][2]string{
+				{"XGROUP CREATE s g 0 MKSTREAM", "[ok]"},
+				{"XADD s 1 a 1", "[ok] 1-0"},
+				{"XREADGROUP GROUP g c NOACK STREAMS s >", "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]\n" +
+					"      1) [ok]\n         1) [ok] 1-0\n         2) [ok] a 1"},
+				{"XPENDING s g - + 10", "[ok]"},
+			},
+		},
+		{
+			name: "wrong type",
+			steps: [][2]string{
+				{"SET s v", "[ok]"},
+				{"XADD s * a 1", "[wrong_type] operation against a key holding the wrong kind of value"},
+				{"XLEN s", "[wrong_type] operation against a key holding the wrong kind of value"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewQueryHandler(logger, storage.NewEngine())
+			for _, step := range tc.steps {
+				assert.Equal(t, step[1], h.Handle(ctx, step[0]), step[0])
+			}
+		})
+	}
+}
+
+func TestQueryHandler_Handle_xpendingExtended(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+	h := NewQueryHandler(logger, storage.NewEngine())
+
+	for _, req := range []string{
+		"XGROUP CREATE s g 0 MKSTREAM",
+		"XADD s 1 a 1",
+		"XADD s 2 a 2",
+		"XREADGROUP GROUP g alice COUNT 1 STREAMS s >",
+		"XREADGROUP GROUP g bob STREAMS s >",
+	} {
+		require.NotContains(t, h.Handle(ctx, req), "error", req)
+	}
+
+	resp := h.HandleQuery(ctx, NewQuery(XPendingCommandID, []string{"s", "g", "-", "+", "10", "bob"}))
+	require.Len(t, resp.array, 1)
+	values := resp.array[0].values
+	require.Len(t, values, 4)
+	assert.Equal(t, []string{"2-0", "bob"}, values[:2])
+	assert.Equal(t, "1", values[3])
+
+	resp = h.HandleQuery(ctx, NewQuery(XPendingCommandID, []string{"s", "g", "2", "+", "10"}))
+	require.Len(t, resp.array, 1)
+	assert.Equal(t, "2-0", resp.array[0].values[0])
+}
+
+// waitSignaled waits until the number of the clients blocked by the stream is n.
+func waitSignaled(t *testing.T, h *QueryHandler, key string, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		h.signals.mu.Lock()
+		defer h.signals.mu.Unlock()
+		return len(h.signals.waiters[key]) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestQueryHandler_Handle_streamBlocking(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+
+	t.Run("xread wakes up all the clients", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+		require.Equal(t, "[ok] 1-0", h.Handle(ctx, "XADD s 1 a 1"))
+
+		const clients = 2
+		results := make(chan string, clients)
+		for range clients {
+			go func() {
+				results <- h.Handle(ctx, "XREAD BLOCK 0 STREAMS s $")
+			}()
+		}
+		waitSignaled(t, h, "s", clients)
+
+		assert.Equal(t, "[ok] 2-0", h.Handle(ctx, "XADD s 2 a 2"))
+		want := "[ok]\n1) [ok]\n   1) [ok] s\n   2) [ok]\n      1) [ok]\n         1) [ok] 2-0\n         2) [ok] a 2"
+		for range clients {
+			assert.Equal(t, want, <-results)
+		}
+		waitSignaled(t, h, "s", 0)
+	})
+
+	t.Run("xreadgroup delivers once", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+		require.Equal(t, "[ok]", h.Handle(ctx, "XGROUP CREATE s g $ MKSTREAM"))
+
+		const clients = 2
+		results := make(chan string, clients)
+		for i := range clients {
+			go func() {
+				results <- h.Handle(ctx, "XREADGROUP GROUP g c"+string(rune('1'+i))+" BLOCK 100 STREAMS s >")
+			}()
+		}
+		waitSignaled(t, h, "s", clients)
+
+		assert.Equal(t, "[ok] 1-0", h.Handle(ctx, "XADD s 1 a 1"))
+		got := []string{<-results, <-results}
+		assert.Contains(t, got, "[not_found] timeout expired")
+		assert.True(t, strings.Contains(got[0], "1-0") || strings.Contains(got[1], "1-0"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+
+		assert.Equal(t, "[not_found] timeout expired", h.Handle(ctx, "XREAD BLOCK 10 STREAMS s 0"))
+		waitSignaled(t, h, "s", 0)
+	})
+
+	t.Run("exec doesn't block", func(t *testing.T) {
+		h := NewQueryHandler(logger, storage.NewEngine())
+		ctx := network.ContextWithSession(ctx, network.NewSession(1, nil))
+
+		assert.Equal(t, "[ok]", h.Handle(ctx, "MULTI"))
+		assert.Equal(t, "[ok] QUEUED", h.Handle(ctx, "XREAD BLOCK 0 STREAMS s 0"))
+		assert.Equal(t, "[ok]\n1) [not_found] no entries", h.Handle(ctx, "EXEC"))
+	})
+}
+
+func TestQueryHandler_Handle_streamWAL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+
+	wal := NewMockWAL(t)
+	var logged []Query
+	wal.On("Append", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		logged = append(logged, NewQuery(CommandID(args.Int(0)), args.Get(1).([]string)))
+	}).Return(walWritten(nil), nil)
+	h := NewQueryHandler(logger, storage.NewEngine(), WithWAL(wal))
+
+	id1 := strings.TrimPrefix(h.Handle(ctx, "XADD s * a 1"), "[ok] ")
+	assert.Equal(t, "[ok]", h.Handle(ctx, "XGROUP CREATE s g $"))
+	assert.Equal(t, "[not_found] no entries", h.Handle(ctx, "XREADGROUP GROUP g c STREAMS s >"))
+	id2 := strings.TrimPrefix(h.Handle(ctx, "XADD s MAXLEN 5 * b 2"), "[ok] ")
+	assert.Contains(t, h.Handle(ctx, "XREADGROUP GROUP g c BLOCK 10 STREAMS s >"), id2)
+
+	// The generated IDs and the delivery time are logged, the reads delivering nothing aren't.
+	deliveredAt := pendingDeliveries(t, h, "s", "g")[0].DeliveredAt
+	args := make([][]string, 0, len(logged))
+	for _, query := range logged {
+		args = append(args, query.Args())
+	}
+	assert.Equal(t, [][]string{
+		{"s", id1, "a", "1"},
+		{"CREATE", "s", "g", id1},
+		{"s", "MAXLEN", "5", id2, "b", "2"},
+		{"GROUP", "g", "c", "TIME", strconv.FormatInt(deliveredAt.UnixMilli(), 10), "STREAMS", "s", ">"},
+	}, args)
+	assert.Equal(t, "[parse_query_error] syntax error", h.Handle(ctx, "XREADGROUP GROUP g c TIME 1 STREAMS s >"))
+
+	// Replaying the log gives the pending entries the same delivery time.
+	replayed := NewQueryHandler(logger, storage.NewEngine())
+	for _, query := range logged {
+		require.NoError(t, replayed.Apply(ctx, query))
+	}
+	assert.Equal(t, pendingDeliveries(t, h, "s", "g"), pendingDeliveries(t, replayed, "s", "g"))
+}
+
+func TestQueryHandler_Handle_streamWALWait(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	wal := NewMockWAL(t)
+	wal.On("Append", int(XAddCommandID), mock.MatchedBy(func(args []string) bool {
+		return args[0] == "slow"
+	})).Return(func(context.Context) error {
+		<-release
+		return nil
+	}, nil)
+	wal.On("Append", int(XAddCommandID), mock.Anything).Return(walWritten(nil), nil)
+	h := NewQueryHandler(logger, storage.NewEngine(), WithWAL(wal))
+
+	slowDone := make(chan string)
+	go func() {
+		slowDone <- h.Handle(ctx, "XADD slow 1-1 a 1")
+	}()
+
+	// The stream waiting for the WAL doesn't hold up the others.
+	require.Eventually(t, func() bool {
+		return h.Handle(ctx, "XLEN slow") == "[ok] 1"
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "[ok] 1-1", h.Handle(ctx, "XADD fast 1-1 a 1"))
+	assert.Equal(t, "[ok] 2-1", h.Handle(ctx, "XADD fast 2-1 a 1"))
+
+	close(release)
+	assert.Equal(t, "[ok] 1-1", <-slowDone)
+}
+
+func pendingDeliveries(t *testing.T, h *QueryHandler, key, group string) []storage.PendingEntry {
+	t.Helper()
+
+	var pending []storage.PendingEntry
+	require.NoError(t, h.viewStream(context.Background(), key, func(s *storage.Stream) error {
+		g, err := streamGroup(s, group)
+		if err != nil {
+			return err
+		}
+		pending = g.Pending()
+		return nil
+	}))
+	require.NotEmpty(t, pending)
+	return pending
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
 )
 
 var errUnexpected = errors.New("unexpected")
@@ -69,15 +70,63 @@ func TestQueryHandler_Handle(t *testing.T) {
 			name:    "del: ok",
 			request: "DEL key",
 			mockSetup: func(store *MockStorage) {
-				store.On("Del", mock.Anything, "key").Return(nil)
+				store.On("MDel", mock.Anything, []string{"key"}).Return(1, nil)
 			},
-			wantResult: "[ok]",
+			wantResult: "[ok] 1",
 		},
 		{
 			name:    "del: internal server error",
 			request: "DEL key",
 			mockSetup: func(store *MockStorage) {
-				store.On("Del", mock.Anything, "key").Return(errUnexpected)
+				store.On("MDel", mock.Anything, []string{"key"}).Return(0, errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "del: multiple keys",
+			request: "DEL k1 k2 k3",
+			mockSetup: func(store *MockStorage) {
+				store.On("MDel", mock.Anything, []string{"k1", "k2", "k3"}).Return(2, nil)
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "mset: ok",
+			request: "MSET k1 v1 k2 \"hello world\"",
+			mockSetup: func(store *MockStorage) {
+				store.On("MSet", mock.Anything, []storage.KeyValue{
+					{Key: "k1", Value: "v1"},
+					{Key: "k2", Value: "hello world"},
+				}).Return(nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:       "mset: missing value",
+			request:    "MSET k1 v1 k2",
+			wantResult: "[parse_query_error] invalid the number of arguments",
+		},
+		{
+			name:    "mset: out of memory",
+			request: "MSET k1 v1",
+			mockSetup: func(store *MockStorage) {
+				store.On("MSet", mock.Anything, []storage.KeyValue{{Key: "k1", Value: "v1"}}).Return(dberrors.ErrOutOfMemory)
+			},
+			wantResult: "[out_of_memory] not enough memory to store the key",
+		},
+		{
+			name:    "mget: ok",
+			request: "MGET k1 k2 k1",
+			mockSetup: func(store *MockStorage) {
+				store.On("MGet", mock.Anything, []string{"k1", "k2", "k1"}).Return(map[string]string{"k1": "hello world"}, nil)
+			},
+			wantResult: "[ok]\n1) [ok] \"hello world\"\n2) [not_found]\n3) [ok] \"hello world\"",
+		},
+		{
+			name:    "mget: internal server error",
+			request: "MGET k1",
+			mockSetup: func(store *MockStorage) {
+				store.On("MGet", mock.Anything, []string{"k1"}).Return(nil, errUnexpected)
 			},
 			wantResult: "[internal_error] unexpected",
 		},
@@ -103,3 +152,265 @@ func TestQueryHandler_Handle(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryHandler_Handle_withWAL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(store *MockStorage, wal *MockWAL)
+		cancelled  bool
+		wantResult string
+	}{
+		{
+			name:    "set: ok",
+			request: "SET key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(SetCommandID), []string{"key", "val"}).Return(walWritten(nil), nil)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "set: wal error",
+			request: "SET key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				wal.On("Append", int(SetCommandID), []string{"key", "val"}).Return(walWritten(errUnexpected), nil)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "set: not applied isn't logged",
+			request: "SET key val",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("Set", mock.Anything, "key", "val").Return(errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "set: written after client is gone",
+			request: "SET key val",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				wal.On("Append", int(SetCommandID), []string{"key", "val"}).Return(func(ctx context.Context) error {
+					return ctx.Err()
+				}, nil)
+			},
+			cancelled:  true,
+			wantResult: "[ok]",
+		},
+		{
+			name:    "del: ok",
+			request: "DEL key",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(DelCommandID), []string{"key"}).Return(walWritten(nil), nil)
+				store.On("MDel", mock.Anything, []string{"key"}).Return(1, nil)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "del: wal error",
+			request: "DEL key",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				store.On("MDel", mock.Anything, []string{"key"}).Return(1, nil)
+				wal.On("Append", int(DelCommandID), []string{"key"}).Return(walWritten(errUnexpected), nil)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "mset: ok",
+			request: "MSET k1 v1 k2 v2",
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				wal.On("Append", int(MSetCommandID), []string{"k1", "v1", "k2", "v2"}).Return(walWritten(nil), nil)
+				store.On("MSet", mock.Anything, []storage.KeyValue{
+					{Key: "k1", Value: "v1"},
+					{Key: "k2", Value: "v2"},
+				}).Return(nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "get: not logged",
+			request: "GET key",
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				store.On("Get", mock.Anything, "key").Return("val", nil)
+			},
+			wantResult: "[ok] val",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, wal := NewMockStorage(t), NewMockWAL(t)
+			tc.mockSetup(store, wal)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			gotResult := NewQueryHandler(logger, store, WithWAL(wal)).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
+
+func walWritten(err error) func(context.Context) error {
+	return func(context.Context) error { return err }
+}
+
+func TestQueryHandler_Apply(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	store, wal := NewMockStorage(t), NewMockWAL(t)
+	store.On("Set", mock.Anything, "key", "val").Return(nil).Once()
+	store.On("MDel", mock.Anything, []string{"key"}).Return(0, errUnexpected).Once()
+
+	h := NewQueryHandler(logger, store, WithWAL(wal))
+	ctx := context.Background()
+
+	assert.NoError(t, h.Apply(ctx, NewQuery(SetCommandID, []string{"key", "val"})))
+	assert.ErrorIs(t, h.Apply(ctx, NewQuery(DelCommandID, []string{"key"})), errUnexpected)
+}
+
+func TestQueryHandler_Handle_snapshots(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(s *MockSnapshotter)
+		wantResult string
+	}{
+		{
+			name:    "save: ok",
+			request: "SAVE",
+			mockSetup: func(s *MockSnapshotter) {
+				s.On("Save", mock.Anything).Return(nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "save: internal server error",
+			request: "SAVE",
+			mockSetup: func(s *MockSnapshotter) {
+				s.On("Save", mock.Anything).Return(errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+		{
+			name:    "bgsave: ok",
+			request: "BGSAVE",
+			mockSetup: func(s *MockSnapshotter) {
+				s.On("BackgroundSave").Return(nil)
+			},
+			wantResult: "[ok] background saving started",
+		},
+		{
+			name:    "bgsave: internal server error",
+			request: "BGSAVE",
+			mockSetup: func(s *MockSnapshotter) {
+				s.On("BackgroundSave").Return(errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewMockSnapshotter(t)
+			tc.mockSetup(s)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			gotResult := NewQueryHandler(logger, NewMockStorage(t), WithSnapshotter(s)).Handle(ctx, tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+
+	t.Run("snapshots disabled", func(t *testing.T) {
+		gotResult := NewQueryHandler(logger, NewMockStorage(t)).Handle(context.Background(), "BGSAVE")
+		assert.Equal(t, "[internal_error] snapshots are disabled", gotResult)
+	})
+}
+
+func TestQueryHandler_Checkpoint(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	store := NewMockStorage(t)
+	h := NewQueryHandler(logger, store)
+
+	applied := make(chan struct{})
+	store.On("Set", mock.Anything, "key", "val").Run(func(mock.Arguments) {
+		close(applied)
+	}).Return(nil)
+
+	h.Checkpoint(func() {
+		go h.Handle(context.Background(), "SET key val")
+
+		select {
+		case <-applied:
+			t.Error("mutation must wait for the checkpoint")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	<-applied
+	assert.Eventually(t, func() bool { return h.Mutations() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestQueryHandler_Handle_memory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(store *MockStorage)
+		wantResult string
+	}{
+		{
+			name:    "set: out of memory",
+			request: "SET key val",
+			mockSetup: func(store *MockStorage) {
+				store.On("Set", mock.Anything, "key", "val").Return(dberrors.ErrOutOfMemory)
+			},
+			wantResult: "[out_of_memory] not enough memory to store the key",
+		},
+		{
+			name:    "info: ok",
+			request: "INFO",
+			mockSetup: func(store *MockStorage) {
+				store.On("Stats", mock.Anything).Return(storage.Stats{
+					Keys:        3,
+					UsedMemory:  1024,
+					MaxMemory:   2048,
+					EvictedKeys: 5,
+					ExpiredKeys: 7,
+				}, nil)
+			},
+			wantResult: "[ok] keys:3 used_memory:1024 max_memory:2048 evicted_keys:5 expired_keys:7",
+		},
+		{
+			name:    "info: internal server error",
+			request: "INFO",
+			mockSetup: func(store *MockStorage) {
+				store.On("Stats", mock.Anything).Return(storage.Stats{}, errUnexpected)
+			},
+			wantResult: "[internal_error] unexpected",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMockStorage(t)
+			tc.mockSetup(store)
+
+			gotResult := NewQueryHandler(logger, store).Handle(context.Background(), tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
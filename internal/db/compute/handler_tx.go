@@ -0,0 +1,343 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+// QueuedResponse is the response to the command queued inside MULTI.
+var QueuedResponse = OKResponse.WithStatus("QUEUED")
+
+var (
+	errNoSession           = errors.New("transactions require a client session")
+	errNestedMulti         = errors.New("MULTI calls can not be nested")
+	errExecWithoutMulti    = errors.New("EXEC without MULTI")
+	errDiscardWithoutMulti = errors.New("DISCARD without MULTI")
+	errWatchInMulti        = errors.New("WATCH inside MULTI is not allowed")
+	errNotAllowedInMulti   = errors.New("command is not allowed inside MULTI")
+	errTxDiscarded         = errors.New("transaction discarded because of previous errors")
+	errWatchedKeyChanged   = errors.New("watched key has been changed")
+	errBadExecRecord       = errors.New("bad EXEC record")
+)
+
+// txState is the transaction state of the session. The requests of the
+// session are handled one by one, so it isn't guarded by a lock.
+type txState struct {
+	multi bool
+	// dirty is set if a command failed to be queued, EXEC is aborted then.
+	dirty bool
+	queue []Query
+	// watches are keyed by the keys scoped by the database, see scopedKey.
+	watches map[string]watch
+}
+
+// watch is the state of the watched key at the moment of WATCH.
+type watch struct {
+	db      int
+	key     string
+	version uint64
+	exists  bool
+}
+
+func (tx *txState) reset() {
+	*tx = txState{}
+}
+
+type txStateKey struct{}
+
+// sessionTx returns the transaction state of the session the request came from.
+func sessionTx(ctx context.Context) (*txState, bool) {
+	sess, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	tx, ok := sess.Value(txStateKey{}).(*txState)
+	if !ok {
+		tx = &txState{}
+		sess.SetValue(txStateKey{}, tx)
+	}
+	return tx, true
+}
+
+func isTxCommand(cmdID CommandID) bool {
+	switch cmdID {
+	case MultiCommandID, ExecCommandID, DiscardCommandID, WatchCommandID, UnwatchCommandID:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *QueryHandler) enqueue(tx *txState, query Query) Response {
+	switch query.cmdID {
+	case SaveCommandID, BGSaveCommandID, FlushDBCommandID, FlushAllCommandID:
+		// Saving and flushing wait for the mutations EXEC holds back.
+		tx.dirty = true
+		return ParseQueryErrorResponse.WithErr(errNotAllowedInMulti)
+	case AuthCommandID, ACLCommandID:
+		// Hashing the passwords is slow, EXEC would hold the lock for long.
+		tx.dirty = true
+		return ParseQueryErrorResponse.WithErr(errNotAllowedInMulti)
+	case SelectCommandID, MoveCommandID:
+		// The queued commands are executed in the database selected by MULTI.
+		tx.dirty = true
+		return ParseQueryErrorResponse.WithErr(errNotAllowedInMulti)
+	default:
+		tx.queue = append(tx.queue, query)
+		return QueuedResponse
+	}
+}
+
+func (h *QueryHandler) handleMulti(ctx context.Context) Response {
+	tx, ok := sessionTx(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errNoSession)
+	}
+	if tx.multi {
+		return ParseQueryErrorResponse.WithErr(errNestedMulti)
+	}
+
+	tx.multi = true
+	return OKResponse
+}
+
+func (h *QueryHandler) handleDiscard(ctx context.Context) Response {
+	tx, ok := sessionTx(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errNoSession)
+	}
+	if !tx.multi {
+		return ParseQueryErrorResponse.WithErr(errDiscardWithoutMulti)
+	}
+
+	tx.reset()
+	return OKResponse
+}
+
+// handleWatch handles WATCH key [key ...]. EXEC is aborted if any of
+// the keys is changed or expired after the command.
+func (h *QueryHandler) handleWatch(ctx context.Context, query Query) Response {
+	tx, ok := sessionTx(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errNoSession)
+	}
+	if tx.multi {
+		return ParseQueryErrorResponse.WithErr(errWatchInMulti)
+	}
+
+	if tx.watches == nil {
+		tx.watches = make(map[string]watch)
+	}
+	db := h.dbIndex(ctx)
+	for _, key := range query.Keys() {
+		if _, ok = tx.watches[scopedKey(db, key)]; ok {
+			continue
+		}
+
+		// The version is read first: the mutations bump it after
+		// applying, so a concurrent change can't go unnoticed.
+		w := watch{db: db, key: key, version: h.versions.get(db, key)}
+		_, err := h.dbs[db].ExpireTime(ctx, key)
+		if err != nil && !errors.Is(err, dberrors.ErrNotFound) {
+			h.logger.Error("failed to handle WATCH query", slog.Any("error", err))
+			return InternalErrorResponse.WithErr(err)
+		}
+		w.exists = err == nil
+		tx.watches[scopedKey(db, key)] = w
+	}
+	return OKResponse
+}
+
+func (h *QueryHandler) handleUnwatch(ctx context.Context) Response {
+	tx, ok := sessionTx(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errNoSession)
+	}
+
+	tx.watches = nil
+	return OKResponse
+}
+
+// handleExec executes the queued commands atomically. The EXEC query
+// having arguments comes from the WAL and contains the commands itself.
+func (h *QueryHandler) handleExec(ctx context.Context, query Query) Response {
+	if len(query.args) != 0 {
+		queries, err := decodeExecArgs(query.args)
+		if err != nil {
+			return InternalErrorResponse.WithErr(err)
+		}
+		return h.exec(ctx, queries, nil)
+	}
+
+	tx, ok := sessionTx(ctx)
+	if !ok {
+		return InternalErrorResponse.WithErr(errNoSession)
+	}
+	if !tx.multi {
+		return ParseQueryErrorResponse.WithErr(errExecWithoutMulti)
+	}
+
+	defer tx.reset()
+	if tx.dirty {
+		return AbortedResponse.WithErr(errTxDiscarded)
+	}
+	// The permissions may have been changed since the commands were queued.
+	for _, q := range tx.queue {
+		if err := h.authorize(ctx, q); err != nil {
+			return NoPermissionResponse.WithErr(err)
+		}
+	}
+	return h.exec(ctx, tx.queue, tx.watches)
+}
+
+type execCtxKey struct{}
+
+// execution collects the mutations made by EXEC to write them to the WAL.
+type execution struct {
+	tx     storage.Tx
+	logged []Query
+}
+
+// exec applies the queries and appends them to the WAL while the exclusive
+// lock is held, and then waits until they are persisted after releasing it.
+func (h *QueryHandler) exec(ctx context.Context, queries []Query, watches map[string]watch) Response {
+	h.mu.Lock()
+	responses, wait, err := h.execLocked(ctx, queries, watches)
+	h.mu.Unlock()
+
+	if errors.Is(err, errWatchedKeyChanged) {
+		return AbortedResponse.WithErr(err)
+	}
+	if err == nil {
+		err = h.waitWAL(ctx, ExecCommandID, wait)
+	}
+	if err != nil {
+		h.logger.Error("failed to handle EXEC query", slog.Any("error", err))
+		return InternalErrorResponse.WithErr(err)
+	}
+	return OKResponse.WithArray(responses)
+}
+
+// execLocked applies the queries atomically and returns their responses with
+// the function waiting until they are persisted. The exclusive lock guarantees
+// the mutations started before have bumped the versions of their keys.
+func (h *QueryHandler) execLocked(
+	ctx context.Context,
+	queries []Query,
+	watches map[string]watch,
+) ([]Response, func(ctx context.Context) error, error) {
+	var (
+		db        = h.dbIndex(ctx)
+		responses = make([]Response, 0, len(queries))
+		wait      func(ctx context.Context) error
+	)
+	err := h.dbs[db].Atomic(ctx, func(tx storage.Tx) error {
+		for _, w := range watches {
+			if h.versions.get(w.db, w.key) != w.version {
+				return errWatchedKeyChanged
+			}
+			if !w.exists {
+				continue
+			}
+			// The keys of the other databases aren't locked by the transaction,
+			// but they can't be changed either while the exclusive lock is held.
+			view := tx
+			if w.db != db {
+				view = h.dbs[w.db]
+			}
+			if _, err := view.ExpireTime(ctx, w.key); errors.Is(err, dberrors.ErrNotFound) {
+				return errWatchedKeyChanged
+			} else if err != nil {
+				return err
+			}
+		}
+
+		exec := &execution{tx: tx}
+		execCtx := context.WithValue(ctx, execCtxKey{}, exec)
+		for _, query := range queries {
+			responses = append(responses, h.execute(execCtx, query))
+		}
+		// Atomic rolls the changes back if they fail to be appended,
+		// so the storage doesn't diverge from the WAL.
+		var err error
+		wait, err = h.appendExec(ctx, exec.logged)
+		return err
+	})
+	return responses, wait, err
+}
+
+func (h *QueryHandler) appendExec(ctx context.Context, queries []Query) (func(ctx context.Context) error, error) {
+	if len(queries) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+	return h.appendWAL(ctx, NewQuery(ExecCommandID, encodeExecArgs(queries)))
+}
+
+// encodeExecArgs encodes the queries as the sequence of the command ID
+// and the number of arguments followed by the arguments themselves.
+func encodeExecArgs(queries []Query) []string {
+	var args []string
+	for _, query := range queries {
+		args = append(args, strconv.Itoa(int(query.cmdID)), strconv.Itoa(len(query.args)))
+		args = append(args, query.args...)
+	}
+	return args
+}
+
+func decodeExecArgs(args []string) ([]Query, error) {
+	var queries []Query
+	for len(args) != 0 {
+		if len(args) < 2 { //nolint:mnd // command ID and the number of arguments
+			return nil, errBadExecRecord
+		}
+
+		cmdID, err := strconv.Atoi(args[0])
+		if err != nil || isTxCommand(CommandID(cmdID)) {
+			return nil, errBadExecRecord
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > len(args)-2 {
+			return nil, errBadExecRecord
+		}
+
+		queries = append(queries, NewQuery(CommandID(cmdID), args[2:2+n]))
+		args = args[2+n:]
+	}
+	return queries, nil
+}
+
+const keyVersionStripes = 4096
+
+// keyVersions counts the changes of the keys for WATCH. The keys share
+// the counters, so a change of another key may abort EXEC occasionally.
+type keyVersions struct {
+	seed     maphash.Seed
+	counters [keyVersionStripes]atomic.Uint64
+}
+
+func newKeyVersions() *keyVersions {
+	return &keyVersions{seed: maphash.MakeSeed()}
+}
+
+func (v *keyVersions) get(db int, key string) uint64 {
+	return v.counter(scopedKey(db, key)).Load()
+}
+
+func (v *keyVersions) bump(db int, keys []string) {
+	for _, key := range keys {
+		v.counter(scopedKey(db, key)).Add(1)
+	}
+}
+
+func (v *keyVersions) counter(key string) *atomic.Uint64 {
+	return &v.counters[maphash.String(v.seed, key)%keyVersionStripes]
+}
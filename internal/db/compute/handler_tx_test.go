@@ -0,0 +1,279 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func atomicCall(store *MockStorage) *mock.Call {
+	return store.On("Atomic", mock.Anything, mock.Anything).Return(
+		func(_ context.Context, fn func(tx storage.Tx) error) error {
+			return fn(store)
+		},
+	)
+}
+
+func TestQueryHandler_Handle_transactions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name        string
+		requests    []string
+		mockSetup   func(store *MockStorage, wal *MockWAL)
+		wantResults []string
+	}{
+		{
+			name:     "exec: ok",
+			requests: []string{"MULTI", "SET key val", "GET key", "DEL other", "EXEC"},
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				atomicCall(store)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				store.On("Get", mock.Anything, "key").Return("val", nil)
+				store.On("MDel", mock.Anything, []string{"other"}).Return(1, nil)
+				wal.On("Append", int(ExecCommandID), []string{
+					"1", "2", "key", "val",
+					"3", "1", "other",
+				}).Return(walWritten(nil), nil)
+			},
+			wantResults: []string{"[ok]", "[ok] QUEUED", "[ok] QUEUED", "[ok] QUEUED", "[ok]\n1) [ok]\n2) [ok] val\n3) [ok] 1"},
+		},
+		{
+			name:     "exec: nested array",
+			requests: []string{"MULTI", "MGET k1 k2", "EXEC"},
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				atomicCall(store)
+				store.On("MGet", mock.Anything, []string{"k1", "k2"}).Return(map[string]string{"k1": "v1"}, nil)
+			},
+			wantResults: []string{"[ok]", "[ok] QUEUED", "[ok]\n1) [ok]\n   1) [ok] v1\n   2) [not_found]"},
+		},
+		{
+			name:     "exec: command error doesn't stop others",
+			requests: []string{"MULTI", "GET key", "SET key val", "EXEC"},
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				atomicCall(store)
+				store.On("Get", mock.Anything, "key").Return("", dberrors.ErrNotFound)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				wal.On("Append", int(ExecCommandID), []string{"1", "2", "key", "val"}).Return(walWritten(nil), nil)
+			},
+			wantResults: []string{"[ok]", "[ok] QUEUED", "[ok] QUEUED", "[ok]\n1) [not_found] key is not found\n2) [ok]"},
+		},
+		{
+			name:     "exec: wal error",
+			requests: []string{"MULTI", "SET key val", "EXEC"},
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				atomicCall(store)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				wal.On("Append", int(ExecCommandID), mock.Anything).Return(walWritten(errUnexpected), nil)
+			},
+			wantResults: []string{"[ok]", "[ok] QUEUED", "[internal_error] unexpected"},
+		},
+		{
+			name:        "exec: parse error discards transaction",
+			requests:    []string{"MULTI", "SET key", "SET key val", "EXEC", "EXEC"},
+			wantResults: []string{"[ok]", "[parse_query_error] invalid the number of arguments", "[ok] QUEUED", "[aborted] transaction discarded because of previous errors", "[parse_query_error] EXEC without MULTI"},
+		},
+		{
+			name:        "exec: save is not allowed",
+			requests:    []string{"MULTI", "SAVE", "EXEC"},
+			wantResults: []string{"[ok]", "[parse_query_error] command is not allowed inside MULTI", "[aborted] transaction discarded because of previous errors"},
+		},
+		{
+			name:        "exec: without multi",
+			requests:    []string{"EXEC"},
+			wantResults: []string{"[parse_query_error] EXEC without MULTI"},
+		},
+		{
+			name:        "multi: nested",
+			requests:    []string{"MULTI", "MULTI"},
+			wantResults: []string{"[ok]", "[parse_query_error] MULTI calls can not be nested"},
+		},
+		{
+			name:        "discard: ok",
+			requests:    []string{"MULTI", "SET key val", "DISCARD", "DISCARD"},
+			wantResults: []string{"[ok]", "[ok] QUEUED", "[ok]", "[parse_query_error] DISCARD without MULTI"},
+		},
+		{
+			name:     "watch: unchanged",
+			requests: []string{"WATCH key", "MULTI", "SET key val", "EXEC"},
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				atomicCall(store)
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, nil)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				wal.On("Append", int(ExecCommandID), mock.Anything).Return(walWritten(nil), nil)
+			},
+			wantResults: []string{"[ok]", "[ok]", "[ok] QUEUED", "[ok]\n1) [ok]"},
+		},
+		{
+			name:     "watch: changed",
+			requests: []string{"WATCH key", "SET key other", "MULTI", "SET key val", "EXEC"},
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				atomicCall(store)
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, dberrors.ErrNotFound)
+				store.On("Set", mock.Anything, "key", "other").Return(nil)
+				wal.On("Append", int(SetCommandID), []string{"key", "other"}).Return(walWritten(nil), nil)
+			},
+			wantResults: []string{"[ok]", "[ok]", "[ok]", "[ok] QUEUED", "[aborted] watched key has been changed"},
+		},
+		{
+			name:     "watch: expired",
+			requests: []string{"WATCH key", "MULTI", "SET key val", "EXEC"},
+			mockSetup: func(store *MockStorage, _ *MockWAL) {
+				atomicCall(store)
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, nil).Once()
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, dberrors.ErrNotFound).Once()
+			},
+			wantResults: []string{"[ok]", "[ok]", "[ok] QUEUED", "[aborted] watched key has been changed"},
+		},
+		{
+			name:     "unwatch: ok",
+			requests: []string{"WATCH key", "SET key other", "UNWATCH", "MULTI", "EXEC"},
+			mockSetup: func(store *MockStorage, wal *MockWAL) {
+				atomicCall(store)
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, dberrors.ErrNotFound)
+				store.On("Set", mock.Anything, "key", "other").Return(nil)
+				wal.On("Append", int(SetCommandID), []string{"key", "other"}).Return(walWritten(nil), nil)
+			},
+			wantResults: []string{"[ok]", "[ok]", "[ok]", "[ok]", "[ok]"},
+		},
+		{
+			name:        "watch: inside multi",
+			requests:    []string{"MULTI", "WATCH key"},
+			wantResults: []string{"[ok]", "[parse_query_error] WATCH inside MULTI is not allowed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, wal := NewMockStorage(t), NewMockWAL(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(store, wal)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			ctx = network.ContextWithSession(ctx, network.NewSession(1, nil))
+
+			h := NewQueryHandler(logger, store, WithWAL(wal))
+			gotResults := make([]string, 0, len(tc.requests))
+			for _, req := range tc.requests {
+				gotResults = append(gotResults, h.Handle(ctx, req))
+			}
+			assert.Equal(t, tc.wantResults, gotResults)
+		})
+	}
+}
+
+func TestQueryHandler_Handle_transactionsWithoutSession(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	h := NewQueryHandler(logger, NewMockStorage(t))
+	assert.Equal(t, "[internal_error] transactions require a client session", h.Handle(context.Background(), "MULTI"))
+}
+
+func TestQueryHandler_Apply_exec(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	store, wal := NewMockStorage(t), NewMockWAL(t)
+	atomicCall(store)
+	store.On("Set", mock.Anything, "key", "val").Return(nil).Once()
+	store.On("MDel", mock.Anything, []string{"other"}).Return(1, nil).Once()
+
+	h := NewQueryHandler(logger, store, WithWAL(wal))
+	query := NewQuery(ExecCommandID, encodeExecArgs([]Query{
+		NewQuery(SetCommandID, []string{"key", "val"}),
+		NewQuery(DelCommandID, []string{"other"}),
+	}))
+	require.NoError(t, h.Apply(context.Background(), query))
+	assert.Equal(t, uint64(2), h.Mutations())
+
+	query = NewQuery(ExecCommandID, []string{"1", "5", "key"})
+	assert.ErrorIs(t, h.Apply(context.Background(), query), errBadExecRecord)
+}
+
+func TestQueryHandler_Handle_execWALError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+
+	wal := NewMockWAL(t)
+	wal.On("Append", int(SetCommandID), []string{"key", "old"}).Return(walWritten(nil), nil)
+	wal.On("Append", int(ExecCommandID), mock.Anything).Return(nil, errUnexpected)
+	h := NewQueryHandler(logger, storage.NewEngine(), WithWAL(wal))
+
+	assert.Equal(t, "[ok]", h.Handle(ctx, "SET key old"))
+	assert.Equal(t, "[ok]", h.Handle(ctx, "MULTI"))
+	assert.Equal(t, "[ok] QUEUED", h.Handle(ctx, "SET key new"))
+	assert.Equal(t, "[ok] QUEUED", h.Handle(ctx, "SET other val"))
+	assert.Equal(t, "[internal_error] unexpected", h.Handle(ctx, "EXEC"))
+
+	// The changes failed to be appended are rolled back.
+	assert.Equal(t, "[ok] old", h.Handle(ctx, "GET key"))
+	assert.Equal(t, "[not_found] key is not found", h.Handle(ctx, "GET other"))
+}
+
+func TestQueryHandler_Handle_execWALWait(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+
+	release := make(chan struct{})
+	wal := NewMockWAL(t)
+	wal.On("Append", int(ExecCommandID), mock.Anything).Return(func(context.Context) error {
+		<-release
+		return nil
+	}, nil)
+	wal.On("Append", int(SetCommandID), []string{"other", "val"}).Return(walWritten(nil), nil)
+	h := NewQueryHandler(logger, storage.NewEngine(), WithWAL(wal))
+
+	assert.Equal(t, "[ok]", h.Handle(ctx, "MULTI"))
+	assert.Equal(t, "[ok] QUEUED", h.Handle(ctx, "SET key val"))
+	execDone := make(chan string)
+	go func() {
+		execDone <- h.Handle(ctx, "EXEC")
+	}()
+
+	// The other clients aren't blocked while EXEC waits for the WAL.
+	other := network.ContextWithSession(context.Background(), network.NewSession(2, nil))
+	require.Eventually(t, func() bool {
+		return h.Handle(other, "GET key") == "[ok] val"
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "[ok]", h.Handle(other, "SET other val"))
+
+	close(release)
+	assert.Equal(t, "[ok]\n1) [ok]", <-execDone)
+}
+
+func TestQuery_Keys(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "first key", query: NewQuery(SetCommandID, []string{"key", "val"}), want: []string{"key"}},
+		{name: "all keys", query: NewQuery(WatchCommandID, []string{"k1", "k2", "k3"}), want: []string{"k1", "k2", "k3"}},
+		{name: "pair keys", query: NewQuery(MSetCommandID, []string{"k1", "v1", "k2", "v2"}), want: []string{"k1", "k2"}},
+		{name: "blocking keys", query: NewQuery(BLPopCommandID, []string{"k1", "k2", "0"}), want: []string{"k1", "k2"}},
+		{
+			name:  "stream keys",
+			query: NewQuery(XReadGroupCommandID, []string{"GROUP", "g", "c", "COUNT", "1", "streams", "k1", "k2", ">", ">"}),
+			want:  []string{"k1", "k2"},
+		},
+		{name: "second key", query: NewQuery(XGroupCommandID, []string{"CREATE", "key", "g", "$"}), want: []string{"key"}},
+		{name: "no keys", query: NewQuery(InfoCommandID, nil), want: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.query.Keys())
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+const (
+	byScoreOption    = "BYSCORE"
+	withScoresOption = "WITHSCORES"
+
+	exclusiveBoundPrefix = "("
+)
+
+var (
+	errInvalidScore      = errors.New("score is not a valid float")
+	errInvalidScoreBound = errors.New("min or max is not a float")
+	errNaNScore          = errors.New("resulting score is not a number (NaN)")
+)
+
+// asSortedSet returns the sorted set stored by the key, the missing key is an empty sorted set.
+func asSortedSet(v storage.Value) (*storage.SortedSet, error) {
+	if v == nil {
+		return storage.NewSortedSet(), nil
+	}
+	z, ok := v.(*storage.SortedSet)
+	if !ok {
+		return nil, dberrors.ErrWrongType
+	}
+	return z, nil
+}
+
+// viewSortedSet calls fn with the sorted set stored by the key.
+func (h *QueryHandler) viewSortedSet(ctx context.Context, key string, fn func(z *storage.SortedSet)) error {
+	return h.storage(ctx).View(ctx, key, func(v storage.Value) error {
+		z, err := asSortedSet(v)
+		if err != nil {
+			return err
+		}
+		fn(z)
+		return nil
+	})
+}
+
+// mutateSortedSet applies the query changing the sorted set stored by the key
+// in place. The key is removed if the sorted set becomes empty.
+func (h *QueryHandler) mutateSortedSet(
+	ctx context.Context,
+	query Query,
+	fn func(z *storage.SortedSet) error,
+) error {
+	return h.mutate(ctx, query, func() error {
+		return h.storage(ctx).Mutate(ctx, query.Args()[0], func(v storage.Value) (storage.Value, error) {
+			z, err := asSortedSet(v)
+			if err != nil {
+				return nil, err
+			}
+			if err = fn(z); err != nil {
+				return nil, err
+			}
+			if z.Len() == 0 {
+				return nil, nil //nolint:nilnil // nil value removes the key
+			}
+			return z, nil
+		})
+	})
+}
+
+// handleZAdd handles ZADD key score member [score member ...] and responds
+// with the number of the added members, the scores of the existing ones are updated.
+func (h *QueryHandler) handleZAdd(ctx context.Context, query Query) Response {
+	args := query.Args()
+	scores := make([]float64, 0, len(args)/2) //nolint:mnd // score-member pairs
+	for i := 1; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+		scores = append(scores, score)
+	}
+
+	var added int
+	err := h.mutateSortedSet(ctx, query, func(z *storage.SortedSet) error {
+		for i, score := range scores {
+			if z.Add(args[2*i+2], score) {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(added))
+}
+
+// handleZRem removes the members and responds with the number of the existing ones.
+func (h *QueryHandler) handleZRem(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var removed int
+	err := h.mutateSortedSet(ctx, query, func(z *storage.SortedSet) error {
+		for _, member := range args[1:] {
+			if z.Remove(member) {
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValue(strconv.Itoa(removed))
+}
+
+func (h *QueryHandler) handleZScore(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var (
+		score float64
+		ok    bool
+	)
+	err := h.viewSortedSet(ctx, args[0], func(z *storage.SortedSet) {
+		score, ok = z.Score(args[1])
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	if !ok {
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	}
+	return OKResponse.WithValue(formatScore(score))
+}
+
+// handleZRank responds with the 0-based rank of the member in ascending order of the scores.
+func (h *QueryHandler) handleZRank(ctx context.Context, query Query) Response {
+	args := query.Args()
+	var (
+		rank int
+		ok   bool
+	)
+	err := h.viewSortedSet(ctx, args[0], func(z *storage.SortedSet) {
+		rank, ok = z.Rank(args[1])
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	if !ok {
+		return NotFoundResponse.WithErr(dberrors.ErrNotFound)
+	}
+	return OKResponse.WithValue(strconv.Itoa(rank))
+}
+
+// zrangeOptions are the options of ZRANGE and ZRANGEBYSCORE.
+type zrangeOptions struct {
+	byScore    bool
+	withScores bool
+	limited    bool
+	offset     int
+	count      int
+}
+
+// handleZRange handles ZRANGE key start stop [BYSCORE] [WITHSCORES] [LIMIT offset count]
+// and ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]. The response
+// contains the members interleaved with their scores if WITHSCORES is given.
+func (h *QueryHandler) handleZRange(ctx context.Context, query Query) Response {
+	args := query.Args()
+	opts, err := parseZRangeOptions(query.cmdID, args[3:])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	var rangeFn func(z *storage.SortedSet) []storage.ScoredMember
+	if opts.byScore {
+		minScore, maxScore, err := parseScoreRange(args[1], args[2])
+		if err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+		rangeFn = func(z *storage.SortedSet) []storage.ScoredMember {
+			if opts.offset < 0 {
+				return nil
+			}
+			return z.RangeByScore(minScore, maxScore, opts.offset, opts.count)
+		}
+	} else {
+		start, stop, err := parseListRange(args[1], args[2])
+		if err != nil {
+			return ParseQueryErrorResponse.WithErr(err)
+		}
+		rangeFn = func(z *storage.SortedSet) []storage.ScoredMember {
+			return z.Range(start, stop)
+		}
+	}
+
+	values := []string{}
+	err = h.viewSortedSet(ctx, args[0], func(z *storage.SortedSet) {
+		for _, m := range rangeFn(z) {
+			values = append(values, m.Member)
+			if opts.withScores {
+				values = append(values, formatScore(m.Score))
+			}
+		}
+	})
+	if err != nil {
+		return h.errResponse(query, err)
+	}
+	return OKResponse.WithValues(values)
+}
+
+func parseZRangeOptions(cmdID CommandID, args []string) (zrangeOptions, error) {
+	opts := zrangeOptions{byScore: cmdID == ZRangeByScoreCommandID, count: -1}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case byScoreOption:
+			if cmdID != ZRangeCommandID {
+				return zrangeOptions{}, errSyntax
+			}
+			opts.byScore = true
+		case withScoresOption:
+			opts.withScores = true
+		case limitOption:
+			if i+2 >= len(args) {
+				return zrangeOptions{}, errSyntax
+			}
+			offset, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return zrangeOptions{}, errInvalidIndex
+			}
+			count, err := strconv.Atoi(args[i+2])
+			if err != nil {
+				return zrangeOptions{}, errInvalidIndex
+			}
+			opts.limited, opts.offset, opts.count = true, offset, count
+			i += 2
+		default:
+			return zrangeOptions{}, errSyntax
+		}
+	}
+	if opts.limited && !opts.byScore {
+		// Like in Redis, LIMIT is only supported by the score ranges.
+		return zrangeOptions{}, errSyntax
+	}
+	return opts, nil
+}
+
+// handleZIncrBy handles ZINCRBY key increment member, the missing member is
+// added with the increment as its score.
+func (h *QueryHandler) handleZIncrBy(ctx context.Context, query Query) Response {
+	args := query.Args()
+	delta, err := parseScore(args[1])
+	if err != nil {
+		return ParseQueryErrorResponse.WithErr(err)
+	}
+
+	var score float64
+	err = h.mutateSortedSet(ctx, query, func(z *storage.SortedSet) error {
+		score, _ = z.Score(args[2])
+		score += delta
+		if math.IsNaN(score) {
+			// E.g. +inf plus -inf.
+			return errNaNScore
+		}
+		z.Add(args[2], score)
+		return nil
+	})
+	if errors.Is(err, errNaNScore) {
+		return OutOfRangeResponse.WithErr(err)
+	}
+	return h.incrResponse(query, formatScore(score), err)
+}
+
+// parseScore parses the score, the infinities are allowed, NaN isn't.
+func parseScore(arg string) (float64, error) {
+	score, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errInvalidScore
+	}
+	return score, nil
+}
+
+// parseScoreRange parses the score bounds, the "(" prefix makes the bound exclusive.
+func parseScoreRange(minArg, maxArg string) (storage.ScoreBound, storage.ScoreBound, error) {
+	minScore, err := parseScoreBound(minArg)
+	if err != nil {
+		return storage.ScoreBound{}, storage.ScoreBound{}, err
+	}
+	maxScore, err := parseScoreBound(maxArg)
+	if err != nil {
+		return storage.ScoreBound{}, storage.ScoreBound{}, err
+	}
+	return minScore, maxScore, nil
+}
+
+func parseScoreBound(arg string) (storage.ScoreBound, error) {
+	var bound storage.ScoreBound
+	if rest, ok := strings.CutPrefix(arg, exclusiveBoundPrefix); ok {
+		arg, bound.Exclusive = rest, true
+	}
+	score, err := parseScore(arg)
+	if err != nil {
+		return storage.ScoreBound{}, errInvalidScoreBound
+	}
+	bound.Score = score
+	return bound, nil
+}
+
+// formatScore formats the score in the shortest form, the infinities are "inf" and "-inf".
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(score, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,221 @@
+package compute
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// newSortedSet returns the sorted set of the given members with the scores 1, 2, 3 and so on.
+func newSortedSet(members ...string) *storage.SortedSet {
+	z := storage.NewSortedSet()
+	for i, member := range members {
+		z.Add(member, float64(i+1))
+	}
+	return z
+}
+
+func TestQueryHandler_Handle_sortedSet(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	withScore := func(z *storage.SortedSet, member string, score float64) *storage.SortedSet {
+		z.Add(member, score)
+		return z
+	}
+
+	testCases := []struct {
+		name       string
+		request    string
+		mockSetup  func(t *testing.T, store *MockStorage)
+		wantResult string
+	}{
+		{
+			name:    "zadd: new key",
+			request: "ZADD key 1 a 2 b",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, newSortedSet("a", "b"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "zadd: score update",
+			request: "ZADD key 3 a -inf c",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				want := withScore(withScore(newSortedSet("a", "b"), "a", 3), "c", math.Inf(-1))
+				mutateCall(t, store, "key", newSortedSet("a", "b"), want)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:       "zadd: invalid score",
+			request:    "ZADD key 1 a nan b",
+			wantResult: "[parse_query_error] score is not a valid float",
+		},
+		{
+			name:       "zadd: missing member",
+			request:    "ZADD key 1 a 2",
+			wantResult: "[parse_query_error] invalid the number of arguments",
+		},
+		{
+			name:    "zadd: wrong type",
+			request: "ZADD key 1 a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newSet("a"), nil)
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+		{
+			name:    "zrem: last member",
+			request: "ZREM key a b",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newSortedSet("a"), nil)
+			},
+			wantResult: "[ok] 1",
+		},
+		{
+			name:    "zscore: ok",
+			request: "ZSCORE key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", withScore(storage.NewSortedSet(), "a", 1.5))
+			},
+			wantResult: "[ok] 1.5",
+		},
+		{
+			name:    "zscore: infinity",
+			request: "ZSCORE key a",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", withScore(storage.NewSortedSet(), "a", math.Inf(1)))
+			},
+			wantResult: "[ok] inf",
+		},
+		{
+			name:    "zscore: missing member",
+			request: "ZSCORE key b",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a"))
+			},
+			wantResult: "[not_found] key is not found",
+		},
+		{
+			name:    "zrank: ok",
+			request: "ZRANK key c",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a", "b", "c"))
+			},
+			wantResult: "[ok] 2",
+		},
+		{
+			name:    "zrange: ranks",
+			request: "ZRANGE key 1 -1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a", "b", "c"))
+			},
+			wantResult: "[ok] b c",
+		},
+		{
+			name:    "zrange: withscores",
+			request: "ZRANGE key 0 0 withscores",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a", "b", "c"))
+			},
+			wantResult: "[ok] a 1",
+		},
+		{
+			name:    "zrange: byscore with limit",
+			request: "ZRANGE key (1 +inf BYSCORE LIMIT 1 1 WITHSCORES",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a", "b", "c", "d"))
+			},
+			wantResult: "[ok] c 3",
+		},
+		{
+			name:       "zrange: limit without byscore",
+			request:    "ZRANGE key 0 -1 LIMIT 0 1",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:    "zrange: missing key",
+			request: "ZRANGE key 0 -1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", nil)
+			},
+			wantResult: "[ok]",
+		},
+		{
+			name:    "zrangebyscore: inclusive",
+			request: "ZRANGEBYSCORE key 2 3",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a", "b", "c", "d"))
+			},
+			wantResult: "[ok] b c",
+		},
+		{
+			name:    "zrangebyscore: exclusive with limit",
+			request: "ZRANGEBYSCORE key -inf (4 WITHSCORES LIMIT 1 -1",
+			mockSetup: func(_ *testing.T, store *MockStorage) {
+				viewCall(store, "key", newSortedSet("a", "b", "c", "d"))
+			},
+			wantResult: "[ok] b 2 c 3",
+		},
+		{
+			name:       "zrangebyscore: invalid bound",
+			request:    "ZRANGEBYSCORE key (abc 3",
+			wantResult: "[parse_query_error] min or max is not a float",
+		},
+		{
+			name:       "zrangebyscore: byscore option",
+			request:    "ZRANGEBYSCORE key 1 3 BYSCORE",
+			wantResult: "[parse_query_error] syntax error",
+		},
+		{
+			name:    "zincrby: new member",
+			request: "ZINCRBY key 2.5 a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", nil, withScore(storage.NewSortedSet(), "a", 2.5))
+			},
+			wantResult: "[ok] 2.5",
+		},
+		{
+			name:    "zincrby: existing member",
+			request: "ZINCRBY key -3 b",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", newSortedSet("a", "b"), withScore(newSortedSet("a", "b"), "b", -1))
+			},
+			wantResult: "[ok] -1",
+		},
+		{
+			name:    "zincrby: nan",
+			request: "ZINCRBY key -inf a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", withScore(storage.NewSortedSet(), "a", math.Inf(1)), nil)
+			},
+			wantResult: "[out_of_range] resulting score is not a number (NaN)",
+		},
+		{
+			name:    "zincrby: wrong type",
+			request: "ZINCRBY key 1 a",
+			mockSetup: func(t *testing.T, store *MockStorage) {
+				mutateCall(t, store, "key", storage.String("value"), nil)
+			},
+			wantResult: "[wrong_type] operation against a key holding the wrong kind of value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMockStorage(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(t, store)
+			}
+
+			gotResult := NewQueryHandler(logger, store).Handle(context.Background(), tc.request)
+			assert.Equal(t, tc.wantResult, gotResult)
+		})
+	}
+}
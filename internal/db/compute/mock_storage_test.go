@@ -6,6 +6,10 @@ import (
 	context "context"
 
 	mock "github.com/stretchr/testify/mock"
+
+	storage "github.com/Mort4lis/memdb/internal/db/storage"
+
+	time "time"
 )
 
 // MockStorage is an autogenerated mock type for the Storage type
@@ -13,6 +17,24 @@ type MockStorage struct {
 	mock.Mock
 }
 
+// Atomic provides a mock function with given fields: ctx, fn
+func (_m *MockStorage) Atomic(ctx context.Context, fn func(tx storage.Tx) error) error {
+	ret := _m.Called(ctx, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Atomic")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(tx storage.Tx) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Del provides a mock function with given fields: ctx, key
 func (_m *MockStorage) Del(ctx context.Context, key string) error {
 	ret := _m.Called(ctx, key)
@@ -31,6 +53,62 @@ func (_m *MockStorage) Del(ctx context.Context, key string) error {
 	return r0
 }
 
+// Expire provides a mock function with given fields: ctx, key, expireAt
+func (_m *MockStorage) Expire(ctx context.Context, key string, expireAt time.Time) (bool, error) {
+	ret := _m.Called(ctx, key, expireAt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Expire")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) (bool, error)); ok {
+		return rf(ctx, key, expireAt)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) bool); ok {
+		r0 = rf(ctx, key, expireAt)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, key, expireAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExpireTime provides a mock function with given fields: ctx, key
+func (_m *MockStorage) ExpireTime(ctx context.Context, key string) (time.Time, error) {
+	ret := _m.Called(ctx, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExpireTime")
+	}
+
+	var r0 time.Time
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (time.Time, error)); ok {
+		return rf(ctx, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) time.Time); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Get provides a mock function with given fields: ctx, key
 func (_m *MockStorage) Get(ctx context.Context, key string) (string, error) {
 	ret := _m.Called(ctx, key)
@@ -59,6 +137,179 @@ func (_m *MockStorage) Get(ctx context.Context, key string) (string, error) {
 	return r0, r1
 }
 
+// GetDel provides a mock function with given fields: ctx, key
+func (_m *MockStorage) GetDel(ctx context.Context, key string) (string, error) {
+	ret := _m.Called(ctx, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDel")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return rf(ctx, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Load provides a mock function with given fields: data
+func (_m *MockStorage) Load(data map[string]storage.Entry) {
+	_m.Called(data)
+}
+
+// MDel provides a mock function with given fields: ctx, keys
+func (_m *MockStorage) MDel(ctx context.Context, keys []string) (int, error) {
+	ret := _m.Called(ctx, keys)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MDel")
+	}
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) (int, error)); ok {
+		return rf(ctx, keys)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string) int); ok {
+		r0 = rf(ctx, keys)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, keys)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MGet provides a mock function with given fields: ctx, keys
+func (_m *MockStorage) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+	ret := _m.Called(ctx, keys)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MGet")
+	}
+
+	var r0 map[string]string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string) (map[string]string, error)); ok {
+		return rf(ctx, keys)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []string) map[string]string); ok {
+		r0 = rf(ctx, keys)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, keys)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MSet provides a mock function with given fields: ctx, pairs
+func (_m *MockStorage) MSet(ctx context.Context, pairs []storage.KeyValue) error {
+	ret := _m.Called(ctx, pairs)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MSet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []storage.KeyValue) error); ok {
+		r0 = rf(ctx, pairs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MView provides a mock function with given fields: ctx, keys, fn
+func (_m *MockStorage) MView(ctx context.Context, keys []string, fn storage.MViewFunc) error {
+	ret := _m.Called(ctx, keys, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MView")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []string, storage.MViewFunc) error); ok {
+		r0 = rf(ctx, keys, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Mutate provides a mock function with given fields: ctx, key, fn
+func (_m *MockStorage) Mutate(ctx context.Context, key string, fn storage.MutateFunc) error {
+	ret := _m.Called(ctx, key, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Mutate")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.MutateFunc) error); ok {
+		r0 = rf(ctx, key, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Persist provides a mock function with given fields: ctx, key
+func (_m *MockStorage) Persist(ctx context.Context, key string) (bool, error) {
+	ret := _m.Called(ctx, key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Persist")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (bool, error)); ok {
+		return rf(ctx, key)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Set provides a mock function with given fields: ctx, key, value
 func (_m *MockStorage) Set(ctx context.Context, key string, value string) error {
 	ret := _m.Called(ctx, key, value)
@@ -77,6 +328,126 @@ func (_m *MockStorage) Set(ctx context.Context, key string, value string) error
 	return r0
 }
 
+// SetIf provides a mock function with given fields: ctx, key, value, expireAt, cond
+func (_m *MockStorage) SetIf(ctx context.Context, key string, value string, expireAt time.Time, cond storage.Condition) (storage.SetResult, error) {
+	ret := _m.Called(ctx, key, value, expireAt, cond)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetIf")
+	}
+
+	var r0 storage.SetResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time, storage.Condition) (storage.SetResult, error)); ok {
+		return rf(ctx, key, value, expireAt, cond)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time, storage.Condition) storage.SetResult); ok {
+		r0 = rf(ctx, key, value, expireAt, cond)
+	} else {
+		r0 = ret.Get(0).(storage.SetResult)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time, storage.Condition) error); ok {
+		r1 = rf(ctx, key, value, expireAt, cond)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetWithExpiration provides a mock function with given fields: ctx, key, value, expireAt
+func (_m *MockStorage) SetWithExpiration(ctx context.Context, key string, value string, expireAt time.Time) error {
+	ret := _m.Called(ctx, key, value, expireAt)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetWithExpiration")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, key, value, expireAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Stats provides a mock function with given fields: ctx
+func (_m *MockStorage) Stats(ctx context.Context) (storage.Stats, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stats")
+	}
+
+	var r0 storage.Stats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (storage.Stats, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) storage.Stats); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(storage.Stats)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Update provides a mock function with given fields: ctx, key, fn
+func (_m *MockStorage) Update(ctx context.Context, key string, fn storage.UpdateFunc) (string, error) {
+	ret := _m.Called(ctx, key, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Update")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.UpdateFunc) (string, error)); ok {
+		return rf(ctx, key, fn)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.UpdateFunc) string); ok {
+		r0 = rf(ctx, key, fn)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, storage.UpdateFunc) error); ok {
+		r1 = rf(ctx, key, fn)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// View provides a mock function with given fields: ctx, key, fn
+func (_m *MockStorage) View(ctx context.Context, key string, fn storage.ViewFunc) error {
+	ret := _m.Called(ctx, key, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for View")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, storage.ViewFunc) error); ok {
+		r0 = rf(ctx, key, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewMockStorage creates a new instance of MockStorage. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockStorage(t interface {
@@ -3,23 +3,30 @@ package compute
 import (
 	"errors"
 	"fmt"
-	"strings"
 )
 
+// ParseQuery parses the query split into the arguments by Tokenize.
 func ParseQuery(rawQuery string) (Query, error) {
+	queryParts, err := Tokenize(rawQuery)
+	if err != nil {
+		return Query{}, err
+	}
+	return ParseArgs(queryParts)
+}
+
+// ParseArgs makes the query of the command name followed by its arguments.
+func ParseArgs(queryParts []string) (Query, error) {
 	query := Query{}
-	queryParts := strings.Split(rawQuery, " ")
 	if len(queryParts) == 0 {
 		return query, errors.New("empty query")
 	}
 
 	cmdID, ok := nameCommandIDMapping[(queryParts[0])]
 	if !ok {
-		return query, fmt.Errorf("unsupport command %s", queryParts[0])
+		return query, fmt.Errorf("unsupport command %s", Quote(queryParts[0]))
 	}
 
-	numArgs := commandIDArgNumbersMapping[cmdID]
-	if len(queryParts[1:]) != numArgs {
+	if !commandIDArgNumbersMapping[cmdID].valid(len(queryParts[1:])) {
 		return query, errors.New("invalid the number of arguments")
 	}
 
@@ -30,6 +30,66 @@ func TestParseQuery(t *testing.T) {
 				args:  []string{"test-key"},
 			},
 		},
+		{
+			name:  "Successful SET with expiration",
+			input: "SET test-key test-val EX 10",
+			wantResult: Query{
+				cmdID: SetCommandID,
+				args:  []string{"test-key", "test-val", "EX", "10"},
+			},
+		},
+		{
+			name:  "SET with quoted value",
+			input: `SET  test-key "hello\nworld \x00"`,
+			wantResult: Query{
+				cmdID: SetCommandID,
+				args:  []string{"test-key", "hello\nworld \x00"},
+			},
+		},
+		{
+			name:    "SET with unbalanced quotes",
+			input:   `SET test-key "test-val`,
+			wantErr: true,
+		},
+		{
+			name:    "Empty query",
+			input:   "  ",
+			wantErr: true,
+		},
+		{
+			name:    "SET with too many arguments",
+			input:   "SET test-key test-val NX GET EX 10 KEEPTTL",
+			wantErr: true,
+		},
+		{
+			name:  "Successful SET with options",
+			input: "SET test-key test-val NX GET EX 10",
+			wantResult: Query{
+				cmdID: SetCommandID,
+				args:  []string{"test-key", "test-val", "NX", "GET", "EX", "10"},
+			},
+		},
+		{
+			name:  "Successful CAS",
+			input: "CAS test-key old new",
+			wantResult: Query{
+				cmdID: CASCommandID,
+				args:  []string{"test-key", "old", "new"},
+			},
+		},
+		{
+			name:    "GET without arguments",
+			input:   "GET",
+			wantErr: true,
+		},
+		{
+			name:  "Successful EXPIRE",
+			input: "EXPIRE test-key 10",
+			wantResult: Query{
+				cmdID: ExpireCommandID,
+				args:  []string{"test-key", "10"},
+			},
+		},
 		{
 			name:  "Successful DEL",
 			input: "DEL test-key",
@@ -38,6 +98,120 @@ func TestParseQuery(t *testing.T) {
 				args:  []string{"test-key"},
 			},
 		},
+		{
+			name:  "Successful DEL of several keys",
+			input: "DEL k1 k2 k3",
+			wantResult: Query{
+				cmdID: DelCommandID,
+				args:  []string{"k1", "k2", "k3"},
+			},
+		},
+		{
+			name:  "Successful MSET",
+			input: "MSET k1 v1 k2 v2",
+			wantResult: Query{
+				cmdID: MSetCommandID,
+				args:  []string{"k1", "v1", "k2", "v2"},
+			},
+		},
+		{
+			name:    "MSET with odd number of arguments",
+			input:   "MSET k1 v1 k2",
+			wantErr: true,
+		},
+		{
+			name:  "Successful HSET",
+			input: "HSET key f1 v1 f2 v2",
+			wantResult: Query{
+				cmdID: HSetCommandID,
+				args:  []string{"key", "f1", "v1", "f2", "v2"},
+			},
+		},
+		{
+			name:    "HSET without value",
+			input:   "HSET key f1",
+			wantErr: true,
+		},
+		{
+			name:  "Successful BLPOP",
+			input: "BLPOP k1 k2 0.5",
+			wantResult: Query{
+				cmdID: BLPopCommandID,
+				args:  []string{"k1", "k2", "0.5"},
+			},
+		},
+		{
+			name:    "BLPOP without timeout",
+			input:   "BLPOP k1",
+			wantErr: true,
+		},
+		{
+			name:  "Successful ZADD",
+			input: "ZADD key 1 a 2.5 b",
+			wantResult: Query{
+				cmdID: ZAddCommandID,
+				args:  []string{"key", "1", "a", "2.5", "b"},
+			},
+		},
+		{
+			name:    "ZADD without member",
+			input:   "ZADD key 1 a 2",
+			wantErr: true,
+		},
+		{
+			name:    "SINTER without keys",
+			input:   "SINTER",
+			wantErr: true,
+		},
+		{
+			name:  "Successful UNSUBSCRIBE without channels",
+			input: "UNSUBSCRIBE",
+			wantResult: Query{
+				cmdID: UnsubscribeCommandID,
+				args:  []string{},
+			},
+		},
+		{
+			name:    "PUBLISH without message",
+			input:   "PUBLISH channel",
+			wantErr: true,
+		},
+		{
+			name:    "NOTIFY without patterns",
+			input:   "NOTIFY",
+			wantErr: true,
+		},
+		{
+			name:  "Successful XREADGROUP",
+			input: "XREADGROUP GROUP g c BLOCK 0 STREAMS s >",
+			wantResult: Query{
+				cmdID: XReadGroupCommandID,
+				args:  []string{"GROUP", "g", "c", "BLOCK", "0", "STREAMS", "s", ">"},
+			},
+		},
+		{
+			name:  "Successful MOVE",
+			input: "MOVE key 1",
+			wantResult: Query{
+				cmdID: MoveCommandID,
+				args:  []string{"key", "1"},
+			},
+		},
+		{
+			name:    "SELECT without database",
+			input:   "SELECT",
+			wantErr: true,
+		},
+		{
+			name:    "XADD without fields",
+			input:   "XADD s *",
+			wantErr: true,
+		},
+		{
+			name:    "MGET without arguments",
+			input:   "MGET",
+			wantErr: true,
+		},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
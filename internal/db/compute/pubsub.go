@@ -0,0 +1,335 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/Mort4lis/memdb/internal/db/events"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+	"github.com/Mort4lis/memdb/internal/pkg/glob"
+)
+
+// The kinds of the pub/sub messages, the message pushed to the subscriber
+// is ["message", channel, payload] or ["pmessage", pattern, channel, payload],
+// the keyspace notification is ["event", type, key, unix time in milliseconds],
+// the confirmation of (un)subscribing is [kind, channel, subscriptions].
+const (
+	messageKind      = "message"
+	pmessageKind     = "pmessage"
+	eventKind        = "event"
+	subscribeKind    = "subscribe"
+	unsubscribeKind  = "unsubscribe"
+	psubscribeKind   = "psubscribe"
+	punsubscribeKind = "punsubscribe"
+	notifyKind       = "notify"
+	unnotifyKind     = "unnotify"
+)
+
+// scope is the kind of the names the client subscribes to.
+type scope int
+
+const (
+	channelScope scope = iota
+	patternScope
+	// notifyScope holds the key patterns of the keyspace notifications.
+	notifyScope
+)
+
+// pushEncoder encodes the message pushed to the subscriber in its protocol.
+type pushEncoder func(values []string) []byte
+
+type pushEncoderKey struct{}
+
+// encodePush returns the encoder of the protocol the request came in,
+// the messages are encoded like the responses of the memdb protocol by default.
+func encodePush(ctx context.Context) pushEncoder {
+	if enc, ok := ctx.Value(pushEncoderKey{}).(pushEncoder); ok {
+		return enc
+	}
+	return func(values []string) []byte {
+		return []byte(PushResponse.WithValues(values).String())
+	}
+}
+
+// subscriber is the client subscribed to the channels or the patterns.
+type subscriber struct {
+	sess     *network.Session
+	encode   pushEncoder
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	keys     map[string]struct{}
+	// events is the subscription to the keyspace notifications, it's nil
+	// if the client isn't subscribed to any key pattern.
+	events *events.Subscription
+}
+
+func (s *subscriber) subscriptions() int {
+	return len(s.channels) + len(s.patterns) + len(s.keys)
+}
+
+func (s *subscriber) names(sc scope) map[string]struct{} {
+	switch sc {
+	case patternScope:
+		return s.patterns
+	case notifyScope:
+		return s.keys
+	default:
+		return s.channels
+	}
+}
+
+// pubSub delivers the published messages and the keyspace notifications to
+// the subscribers. The messages are pushed to the sessions without waiting
+// for them to be written, the clients not keeping up are disconnected by
+// the network layer.
+type pubSub struct {
+	logger *slog.Logger
+	// bus is the source of the keyspace notifications, nil if they are disabled.
+	bus *events.Bus
+
+	mu          sync.RWMutex
+	channels    map[string]map[*subscriber]struct{}
+	patterns    map[string]map[*subscriber]struct{}
+	subscribers map[*network.Session]*subscriber
+}
+
+func newPubSub(logger *slog.Logger) *pubSub {
+	return &pubSub{
+		logger:      logger,
+		channels:    make(map[string]map[*subscriber]struct{}),
+		patterns:    make(map[string]map[*subscriber]struct{}),
+		subscribers: make(map[*network.Session]*subscriber),
+	}
+}
+
+// index returns the subscribers by the names of the scope, the keyspace
+// notifications are matched by the bus instead.
+func (p *pubSub) index(sc scope) map[string]map[*subscriber]struct{} {
+	switch sc {
+	case patternScope:
+		return p.patterns
+	case notifyScope:
+		return nil
+	default:
+		return p.channels
+	}
+}
+
+// subscribe subscribes the session to the names of the scope and returns
+// the confirmations.
+func (p *pubSub) subscribe(sess *network.Session, enc pushEncoder, names []string, sc scope) [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sub, ok := p.subscribers[sess]
+	if !ok {
+		sub = &subscriber{
+			sess:     sess,
+			encode:   enc,
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+			keys:     make(map[string]struct{}),
+		}
+		p.subscribers[sess] = sub
+		sess.SetSubscribed(true)
+	}
+
+	kind, own, index := subscribeKinds[sc], sub.names(sc), p.index(sc)
+	confirmations := make([][]string, 0, len(names))
+	for _, name := range names {
+		own[name] = struct{}{}
+		if index != nil {
+			if index[name] == nil {
+				index[name] = make(map[*subscriber]struct{})
+			}
+			index[name][sub] = struct{}{}
+		}
+		confirmations = append(confirmations, confirmation(kind, name, sub.subscriptions()))
+	}
+	if sc == notifyScope {
+		p.watchLocked(sub)
+	}
+	return confirmations
+}
+
+// unsubscribe unsubscribes the session from the names of the scope, from all
+// of them if no names are given, and returns the confirmations.
+func (p *pubSub) unsubscribe(sess *network.Session, names []string, sc scope) [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	kind := unsubscribeKinds[sc]
+	sub, ok := p.subscribers[sess]
+	if !ok {
+		return unsubscribed(kind, names, 0)
+	}
+
+	own := sub.names(sc)
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(own))
+		if len(names) == 0 {
+			return unsubscribed(kind, nil, sub.subscriptions())
+		}
+	}
+
+	confirmations := make([][]string, 0, len(names))
+	for _, name := range names {
+		p.removeLocked(sub, name, sc)
+		confirmations = append(confirmations, confirmation(kind, name, sub.subscriptions()))
+	}
+	if sc == notifyScope {
+		p.watchLocked(sub)
+	}
+	if sub.subscriptions() == 0 {
+		delete(p.subscribers, sess)
+		sess.SetSubscribed(false)
+	}
+	return confirmations
+}
+
+// drop removes all the subscriptions of the session, e.g. once it's disconnected.
+func (p *pubSub) drop(sess *network.Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sub, ok := p.subscribers[sess]
+	if !ok {
+		return
+	}
+	for _, sc := range []scope{channelScope, patternScope, notifyScope} {
+		for name := range sub.names(sc) {
+			p.removeLocked(sub, name, sc)
+		}
+	}
+	p.watchLocked(sub)
+	delete(p.subscribers, sess)
+}
+
+func (p *pubSub) removeLocked(sub *subscriber, name string, sc scope) {
+	delete(sub.names(sc), name)
+	if index := p.index(sc); index != nil {
+		delete(index[name], sub)
+		if len(index[name]) == 0 {
+			delete(index, name)
+		}
+	}
+}
+
+// watchLocked brings the subscription to the keyspace notifications in line
+// with the key patterns of the subscriber.
+func (p *pubSub) watchLocked(sub *subscriber) {
+	patterns := slices.Collect(maps.Keys(sub.keys))
+	switch {
+	case len(patterns) == 0:
+		if sub.events != nil {
+			sub.events.Close()
+			sub.events = nil
+		}
+	case sub.events == nil:
+		sub.events = p.bus.Subscribe(patterns)
+		go p.forward(sub, sub.events)
+	default:
+		sub.events.SetPatterns(patterns)
+	}
+}
+
+// forward pushes the keyspace notifications to the subscriber until the
+// subscription is closed.
+func (p *pubSub) forward(sub *subscriber, es *events.Subscription) {
+	for ev := range es.Events() {
+		if ev.DB != sub.sess.DB() {
+			// The client is notified of the changes of the selected database only.
+			continue
+		}
+		if err := sub.sess.Push(sub.encode(notification(ev))); err != nil {
+			// The client is gone or being disconnected for falling behind.
+			p.drop(sub.sess)
+			return
+		}
+	}
+	if errors.Is(es.Err(), events.ErrSlowConsumer) {
+		p.logger.Warn(
+			"keyspace notifications buffer is full, disconnecting slow client",
+			slog.Uint64("session_id", sub.sess.ID()),
+		)
+		if err := sub.sess.Close(); err != nil {
+			p.logger.Error("failed to disconnect client", slog.Any("error", err))
+		}
+	}
+}
+
+// publish pushes the message to the subscribers of the channel and of the
+// patterns matching it. It returns the number of the delivered messages.
+func (p *pubSub) publish(channel, payload string) int {
+	var (
+		delivered int
+		failed    []*network.Session
+	)
+
+	p.mu.RLock()
+	push := func(sub *subscriber, values []string) {
+		if err := sub.sess.Push(sub.encode(values)); err != nil {
+			// The client is gone or being disconnected for falling behind.
+			failed = append(failed, sub.sess)
+			return
+		}
+		delivered++
+	}
+	for sub := range p.channels[channel] {
+		push(sub, []string{messageKind, channel, payload})
+	}
+	for pattern, subs := range p.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			push(sub, []string{pmessageKind, pattern, channel, payload})
+		}
+	}
+	p.mu.RUnlock()
+
+	for _, sess := range failed {
+		p.drop(sess)
+	}
+	return delivered
+}
+
+var (
+	subscribeKinds = map[scope]string{
+		channelScope: subscribeKind,
+		patternScope: psubscribeKind,
+		notifyScope:  notifyKind,
+	}
+	unsubscribeKinds = map[scope]string{
+		channelScope: unsubscribeKind,
+		patternScope: punsubscribeKind,
+		notifyScope:  unnotifyKind,
+	}
+)
+
+func notification(ev storage.Event) []string {
+	return []string{eventKind, string(ev.Type), ev.Key, strconv.FormatInt(ev.Time.UnixMilli(), 10)}
+}
+
+func confirmation(kind, name string, subscriptions int) []string {
+	return []string{kind, name, strconv.Itoa(subscriptions)}
+}
+
+// unsubscribed returns the confirmations of unsubscribing from the channels
+// the client isn't subscribed to. The channel is omitted if no names are given.
+func unsubscribed(kind string, names []string, subscriptions int) [][]string {
+	if len(names) == 0 {
+		return [][]string{{kind, strconv.Itoa(subscriptions)}}
+	}
+	confirmations := make([][]string, 0, len(names))
+	for _, name := range names {
+		confirmations = append(confirmations, confirmation(kind, name, subscriptions))
+	}
+	return confirmations
+}
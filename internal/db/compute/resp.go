@@ -0,0 +1,386 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/network"
+	"github.com/Mort4lis/memdb/internal/network/resp"
+)
+
+const (
+	HelloCommandName = "HELLO"
+
+	respServerName = "memdb"
+)
+
+var (
+	errUnsupportedVersion = errors.New("unsupported protocol version")
+	errSubscribedContext  = errors.New("only (P)SUBSCRIBE / (P)UNSUBSCRIBE are allowed in this context")
+)
+
+// respReplyType defines how the value of the response is encoded in RESP.
+type respReplyType int
+
+const (
+	// statusReply is OK or the status message as the simple string.
+	statusReply respReplyType = iota
+	bulkReply
+	// infoReply is the bulk string of the values separated by CRLF.
+	infoReply
+	integerReply
+	// scanReply is the cursor followed by the array of keys.
+	scanReply
+	// mapReply is the map of the pairs of values.
+	mapReply
+	// pubSubReply is the sequence of the confirmations of (un)subscribing.
+	pubSubReply
+	// pendingReply is the summary of the pending entries or the array of them.
+	pendingReply
+	// aclReply is the integer value, otherwise it's encoded as statusReply.
+	aclReply
+)
+
+var commandIDRESPReplyMapping = map[CommandID]respReplyType{
+	GetCommandID: bulkReply,
+	DelCommandID: integerReply,
+
+	SetNXCommandID:  integerReply,
+	GetSetCommandID: bulkReply,
+	CASCommandID:    integerReply,
+	GetDelCommandID: bulkReply,
+
+	InfoCommandID: infoReply,
+
+	ExpireCommandID:    integerReply,
+	PExpireCommandID:   integerReply,
+	ExpireAtCommandID:  integerReply,
+	PExpireAtCommandID: integerReply,
+	TTLCommandID:       integerReply,
+	PTTLCommandID:      integerReply,
+	PersistCommandID:   integerReply,
+
+	IncrCommandID:        integerReply,
+	DecrCommandID:        integerReply,
+	IncrByCommandID:      integerReply,
+	IncrByFloatCommandID: bulkReply,
+
+	HSetCommandID:    integerReply,
+	HGetCommandID:    bulkReply,
+	HDelCommandID:    integerReply,
+	HLenCommandID:    integerReply,
+	HExistsCommandID: integerReply,
+	HGetAllCommandID: mapReply,
+	HIncrByCommandID: integerReply,
+
+	LPushCommandID:  integerReply,
+	RPushCommandID:  integerReply,
+	LPopCommandID:   bulkReply,
+	RPopCommandID:   bulkReply,
+	LLenCommandID:   integerReply,
+	LIndexCommandID: bulkReply,
+
+	SAddCommandID:      integerReply,
+	SRemCommandID:      integerReply,
+	SIsMemberCommandID: integerReply,
+	SCardCommandID:     integerReply,
+
+	ZAddCommandID:    integerReply,
+	ZRemCommandID:    integerReply,
+	ZScoreCommandID:  bulkReply,
+	ZRankCommandID:   integerReply,
+	ZIncrByCommandID: bulkReply,
+
+	SubscribeCommandID:    pubSubReply,
+	UnsubscribeCommandID:  pubSubReply,
+	PSubscribeCommandID:   pubSubReply,
+	PUnsubscribeCommandID: pubSubReply,
+	PublishCommandID:      integerReply,
+	NotifyCommandID:       pubSubReply,
+	UnnotifyCommandID:     pubSubReply,
+
+	XAddCommandID:     bulkReply,
+	XLenCommandID:     integerReply,
+	XTrimCommandID:    integerReply,
+	XAckCommandID:     integerReply,
+	XPendingCommandID: pendingReply,
+
+	MoveCommandID:   integerReply,
+	DBSizeCommandID: integerReply,
+
+	ACLCommandID: aclReply,
+
+	ScanCommandID:  scanReply,
+	RangeCommandID: mapReply,
+}
+
+// respErrorCodes maps the response kinds to the error codes, ERR is used by default.
+var respErrorCodes = map[string]string{
+	OutOfMemoryResponse.kind:     "OOM",
+	AbortedResponse.kind:         "EXECABORT",
+	UnauthenticatedResponse.kind: "NOAUTH",
+	NoPermissionResponse.kind:    "NOPERM",
+}
+
+// RESPHandler serves the clients speaking RESP, e.g. redis-cli. It receives
+// the commands encoded by resp.AppendCommand and returns the encoded replies.
+type RESPHandler struct {
+	h *QueryHandler
+}
+
+func NewRESPHandler(h *QueryHandler) *RESPHandler {
+	return &RESPHandler{h: h}
+}
+
+func (r *RESPHandler) Handle(ctx context.Context, req string) string {
+	w := resp.NewWriter(respVersion(ctx))
+
+	args, err := resp.ParseCommand([]byte(req))
+	if err != nil {
+		w.Error("ERR", err.Error())
+		return string(w.Bytes())
+	}
+
+	if len(args) != 0 {
+		// Unlike the memdb protocol, the command names are case-insensitive.
+		args[0] = strings.ToUpper(args[0])
+		if args[0] == HelloCommandName {
+			return string(r.hello(ctx, args[1:]))
+		}
+	}
+
+	query, err := ParseArgs(args)
+	if err != nil {
+		encodeRESP(w, r.h.rejectQuery(ctx, err))
+		return string(w.Bytes())
+	}
+	if subscribed(ctx) && respVersion(ctx) == resp.Version2 && !isPubSubCommand(query.cmdID) {
+		// The replies can't be told apart from the pushed messages in RESP2.
+		w.Error("ERR", errSubscribedContext.Error())
+		return string(w.Bytes())
+	}
+
+	ctx = context.WithValue(ctx, pushEncoderKey{}, pushEncoder(func(values []string) []byte {
+		w := resp.NewWriter(respVersion(ctx))
+		encodeRESPPubSub(w, values)
+		return w.Bytes()
+	}))
+	encodeRESP(w, r.h.HandleQuery(ctx, query))
+	return string(w.Bytes())
+}
+
+type respVersionKey struct{}
+
+func respVersion(ctx context.Context) int {
+	if sess, ok := network.SessionFromContext(ctx); ok {
+		if version, ok := sess.Value(respVersionKey{}).(int); ok {
+			return version
+		}
+	}
+	return resp.Version2
+}
+
+// hello handles HELLO [protover] switching the protocol version of the session.
+// The reply describing the server is encoded with the new version.
+func (r *RESPHandler) hello(ctx context.Context, args []string) []byte {
+	version := respVersion(ctx)
+	if len(args) > 1 {
+		w := resp.NewWriter(version)
+		w.Error("ERR", errSyntax.Error())
+		return w.Bytes()
+	}
+	if len(args) == 1 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || (v != resp.Version2 && v != resp.Version3) {
+			w := resp.NewWriter(version)
+			w.Error("NOPROTO", errUnsupportedVersion.Error())
+			return w.Bytes()
+		}
+		version = v
+	}
+
+	var id uint64
+	if sess, ok := network.SessionFromContext(ctx); ok {
+		sess.SetValue(respVersionKey{}, version)
+		id = sess.ID()
+	}
+
+	w := resp.NewWriter(version)
+	w.Map(4) //nolint:mnd // the number of fields below
+	w.BulkString("server")
+	w.BulkString(respServerName)
+	w.BulkString("proto")
+	w.Integer(int64(version))
+	w.BulkString("id")
+	w.Integer(int64(id)) //nolint:gosec // IDs don't overflow int64
+	w.BulkString("mode")
+	w.BulkString("standalone")
+	return w.Bytes()
+}
+
+func encodeRESP(w *resp.Writer, r Response) {
+	if r.err != nil || r.kind == NotFoundResponse.kind {
+		encodeRESPError(w, r)
+		return
+	}
+	if commandIDRESPReplyMapping[r.cmdID] == pubSubReply {
+		// Every confirmation is the message of its own like in Redis.
+		for _, elem := range r.array {
+			encodeRESPPubSub(w, elem.values)
+		}
+		return
+	}
+	if commandIDRESPReplyMapping[r.cmdID] == pendingReply {
+		encodeRESPPending(w, r.array)
+		return
+	}
+	if r.array != nil {
+		w.Array(len(r.array))
+		for _, elem := range r.array {
+			encodeRESP(w, elem)
+		}
+		return
+	}
+
+	switch commandIDRESPReplyMapping[r.cmdID] {
+	case bulkReply:
+		if r.values != nil {
+			// E.g. LPOP with the count.
+			encodeRESPArray(w, r.values)
+			return
+		}
+		w.BulkString(r.value)
+	case infoReply:
+		w.BulkString(strings.Join(r.values, "\r\n"))
+	case integerReply:
+		encodeRESPInteger(w, r.value)
+	case scanReply:
+		w.Array(2) //nolint:mnd // cursor and keys
+		w.BulkString(r.values[0])
+		encodeRESPArray(w, r.values[1:])
+	case mapReply:
+		w.Map(len(r.values) / 2) //nolint:mnd // keys and values
+		for _, v := range r.values {
+			w.BulkString(v)
+		}
+	case aclReply:
+		if r.hasValue {
+			// E.g. the number of the users deleted by ACL DELUSER.
+			encodeRESPInteger(w, r.value)
+			return
+		}
+		fallthrough
+	case statusReply:
+		switch {
+		case r.values != nil:
+			encodeRESPArray(w, r.values)
+		case r.hasValue:
+			w.BulkString(r.value)
+		case r.status != "":
+			w.SimpleString(r.status)
+		default:
+			w.SimpleString("OK")
+		}
+	}
+}
+
+func encodeRESPInteger(w *resp.Writer, value string) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		w.Error("ERR", err.Error())
+		return
+	}
+	w.Integer(n)
+}
+
+func encodeRESPError(w *resp.Writer, r Response) {
+	switch {
+	case errors.Is(r.err, errWatchedKeyChanged), errors.Is(r.err, errBlockTimeout), errors.Is(r.err, errNoEntries):
+		w.NullArray()
+	case errors.Is(r.err, auth.ErrInvalidCredentials):
+		w.Error("WRONGPASS", r.err.Error())
+	case errors.Is(r.err, errNoGroup):
+		w.Error("NOGROUP", r.err.Error())
+	case errors.Is(r.err, errGroupExists):
+		w.Error("BUSYGROUP", r.err.Error())
+	case errors.Is(r.err, errNoStream):
+		w.Error("ERR", r.err.Error())
+	case r.kind == NotFoundResponse.kind:
+		w.Null()
+	case errors.Is(r.err, dberrors.ErrWrongType):
+		w.Error("WRONGTYPE", r.err.Error())
+	default:
+		code, ok := respErrorCodes[r.kind]
+		if !ok {
+			code = "ERR"
+		}
+		w.Error(code, r.err.Error())
+	}
+}
+
+// encodeRESPPubSub writes the pub/sub message, the keyspace notification or
+// the confirmation of (un)subscribing, the latter ends with the number of
+// the subscriptions.
+func encodeRESPPubSub(w *resp.Writer, values []string) {
+	kind := values[0]
+	if kind == messageKind || kind == pmessageKind || kind == eventKind {
+		w.Push(len(values))
+		for _, v := range values {
+			w.BulkString(v)
+		}
+		return
+	}
+
+	w.Push(3) //nolint:mnd // kind, channel and number of subscriptions
+	w.BulkString(kind)
+	if len(values) == 2 { //nolint:mnd // the channel is omitted
+		w.Null()
+	} else {
+		w.BulkString(values[1])
+	}
+	n, _ := strconv.ParseInt(values[len(values)-1], 10, 64)
+	w.Integer(n)
+}
+
+// encodeRESPPending writes the summary starting with the number of the pending
+// entries or the entries ending with their idle times and deliveries.
+func encodeRESPPending(w *resp.Writer, array []Response) {
+	w.Array(len(array))
+	if len(array) != 0 && array[0].hasValue {
+		n, _ := strconv.ParseInt(array[0].value, 10, 64)
+		w.Integer(n)
+		for _, elem := range array[1:] {
+			encodeRESP(w, elem)
+		}
+		return
+	}
+
+	for _, elem := range array {
+		w.Array(len(elem.values))
+		for i, v := range elem.values {
+			if i < 2 { //nolint:mnd // ID and consumer
+				w.BulkString(v)
+				continue
+			}
+			n, _ := strconv.ParseInt(v, 10, 64)
+			w.Integer(n)
+		}
+	}
+}
+
+func encodeRESPArray(w *resp.Writer, values []string) {
+	w.Array(len(values))
+	for _, v := range values {
+		w.BulkString(v)
+	}
+}
+
+// subscribed reports whether the client of the session waits for the pushed messages.
+func subscribed(ctx context.Context) bool {
+	sess, ok := network.SessionFromContext(ctx)
+	return ok && sess.Subscribed()
+}
@@ -0,0 +1,411 @@
+package compute
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+// respCommand encodes the command the way the Redis clients do.
+func respCommand(args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+func TestRESPHandler_Handle(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	testCases := []struct {
+		name        string
+		requests    []string
+		mockSetup   func(store *MockStorage, ordered *MockOrderedStorage)
+		wantReplies []string
+	}{
+		{
+			name:     "get: ok",
+			requests: []string{respCommand("get", "key")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Get", mock.Anything, "key").Return("hello world", nil)
+			},
+			wantReplies: []string{"$11\r\nhello world\r\n"},
+		},
+		{
+			name:     "get: not found",
+			requests: []string{respCommand("GET", "key"), respCommand("HELLO", "3"), respCommand("GET", "key")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Get", mock.Anything, "key").Return("", dberrors.ErrNotFound)
+			},
+			wantReplies: []string{
+				"$-1\r\n",
+				"%4\r\n$6\r\nserver\r\n$5\r\nmemdb\r\n$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:1\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n",
+				"_\r\n",
+			},
+		},
+		{
+			name:     "set: value with spaces",
+			requests: []string{respCommand("SET", "key", "hello world")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Set", mock.Anything, "key", "hello world").Return(nil)
+			},
+			wantReplies: []string{"+OK\r\n"},
+		},
+		{
+			name:     "set: out of memory",
+			requests: []string{respCommand("SET", "key", "val")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Set", mock.Anything, "key", "val").Return(dberrors.ErrOutOfMemory)
+			},
+			wantReplies: []string{"-OOM not enough memory to store the key\r\n"},
+		},
+		{
+			name:     "get: internal error",
+			requests: []string{respCommand("GET", "key")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Get", mock.Anything, "key").Return("", errUnexpected)
+			},
+			wantReplies: []string{"-ERR unexpected\r\n"},
+		},
+		{
+			name:     "ttl: integer",
+			requests: []string{respCommand("TTL", "key")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, nil)
+			},
+			wantReplies: []string{":-1\r\n"},
+		},
+		{
+			name:     "mget: array with nulls",
+			requests: []string{respCommand("MGET", "k1", "k2"), respCommand("HELLO", "3"), respCommand("MGET", "k1", "k2")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("MGet", mock.Anything, []string{"k1", "k2"}).Return(map[string]string{"k2": "v2"}, nil)
+			},
+			wantReplies: []string{
+				"*2\r\n$-1\r\n$2\r\nv2\r\n",
+				"%4\r\n$6\r\nserver\r\n$5\r\nmemdb\r\n$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:1\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n",
+				"*2\r\n_\r\n$2\r\nv2\r\n",
+			},
+		},
+		{
+			name:     "del: integer",
+			requests: []string{respCommand("DEL", "k1", "k2")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("MDel", mock.Anything, []string{"k1", "k2"}).Return(1, nil)
+			},
+			wantReplies: []string{":1\r\n"},
+		},
+		{
+			name:     "incr: integer and error",
+			requests: []string{respCommand("INCR", "key"), respCommand("INCR", "other")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				updateCall(store, "key", "41", true)
+				updateCall(store, "other", "abc", true)
+			},
+			wantReplies: []string{":42\r\n", "-ERR value is not an integer\r\n"},
+		},
+		{
+			name: "hash: integer, map and wrong type",
+			requests: []string{
+				respCommand("HSET", "key", "a", "1"),
+				respCommand("HGETALL", "key"),
+				respCommand("HELLO", "3"),
+				respCommand("HGETALL", "key"),
+				respCommand("HKEYS", "key"),
+				respCommand("HGET", "str", "a"),
+			},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Mutate", mock.Anything, "key", mock.Anything).Return(
+					func(_ context.Context, _ string, fn storage.MutateFunc) error {
+						_, err := fn(nil)
+						return err
+					},
+				)
+				viewCall(store, "key", newHash("a", "1"))
+				viewCall(store, "str", storage.String("value"))
+			},
+			wantReplies: []string{
+				":1\r\n",
+				"*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+				"%4\r\n$6\r\nserver\r\n$5\r\nmemdb\r\n$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:1\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n",
+				"%1\r\n$1\r\na\r\n$1\r\n1\r\n",
+				"*1\r\n$1\r\na\r\n",
+				"-WRONGTYPE operation against a key holding the wrong kind of value\r\n",
+			},
+		},
+		{
+			name: "list: integer, arrays and null array",
+			requests: []string{
+				respCommand("RPUSH", "key", "a"),
+				respCommand("LPOP", "key", "2"),
+				respCommand("LINDEX", "key", "0"),
+				respCommand("BLPOP", "other", "0.001"),
+			},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Mutate", mock.Anything, "key", mock.Anything).Return(
+					func(_ context.Context, _ string, fn storage.MutateFunc) error {
+						_, err := fn(newList("a", "b"))
+						return err
+					},
+				)
+				viewCall(store, "key", newList("a"))
+				viewCall(store, "other", nil)
+			},
+			wantReplies: []string{
+				":3\r\n",
+				"*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+				"$1\r\na\r\n",
+				"*-1\r\n",
+			},
+		},
+		{
+			name: "sorted set: integer, bulk, arrays and null",
+			requests: []string{
+				respCommand("ZADD", "key", "1", "a"),
+				respCommand("ZSCORE", "key", "b"),
+				respCommand("ZRANK", "key", "b"),
+				respCommand("ZRANGE", "key", "0", "-1", "WITHSCORES"),
+				respCommand("ZRANGEBYSCORE", "key", "5", "+inf"),
+				respCommand("SMEMBERS", "other"),
+			},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Mutate", mock.Anything, "key", mock.Anything).Return(
+					func(_ context.Context, _ string, fn storage.MutateFunc) error {
+						_, err := fn(nil)
+						return err
+					},
+				)
+				viewCall(store, "key", newSortedSet("a", "b"))
+				viewCall(store, "other", nil)
+			},
+			wantReplies: []string{
+				":1\r\n",
+				"$1\r\n2\r\n",
+				":1\r\n",
+				"*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+				"*0\r\n",
+				"*0\r\n",
+			},
+		},
+		{
+			name: "databases: select, dbsize and errors",
+			requests: []string{
+				respCommand("SELECT", "0"),
+				respCommand("DBSIZE"),
+				respCommand("SELECT", "1"),
+				respCommand("MOVE", "key", "0"),
+				respCommand("FLUSHDB"),
+			},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				store.On("Stats", mock.Anything).Return(storage.Stats{Keys: 3}, nil)
+				store.On("Load", map[string]storage.Entry(nil)).Return()
+			},
+			wantReplies: []string{
+				"+OK\r\n",
+				":3\r\n",
+				"-ERR DB index is out of range\r\n",
+				"-ERR source and destination objects are the same\r\n",
+				"+OK\r\n",
+			},
+		},
+		{
+			name: "stream: entries, pending summary and errors",
+			requests: []string{
+				respCommand("XRANGE", "key", "-", "+"),
+				respCommand("XPENDING", "key", "g"),
+				respCommand("XREAD", "STREAMS", "key", "1"),
+				respCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "other", ">"),
+				respCommand("XADD", "key", "2", "b", "2"),
+			},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				s := storage.NewStream()
+				s.Add(storage.StreamID{Ms: 1}, []string{"a", "1"})
+				s.CreateGroup("g", storage.StreamID{})
+				g, _ := s.Group("g")
+				s.ReadGroup(g, "c", 0, false, time.Now())
+
+				viewCall(store, "key", s)
+				viewCall(store, "other", nil)
+				store.On("Mutate", mock.Anything, "key", mock.Anything).Return(
+					func(_ context.Context, _ string, fn storage.MutateFunc) error {
+						_, err := fn(s)
+						return err
+					},
+				)
+			},
+			wantReplies: []string{
+				"*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+				"*4\r\n:1\r\n$3\r\n1-0\r\n$3\r\n1-0\r\n*1\r\n*2\r\n$1\r\nc\r\n$1\r\n1\r\n",
+				"*-1\r\n",
+				"-NOGROUP no such key or consumer group\r\n",
+				"$3\r\n2-0\r\n",
+			},
+		},
+		{
+			name: "pub/sub: confirmations and subscribed context",
+			requests: []string{
+				respCommand("UNSUBSCRIBE"),
+				respCommand("SUBSCRIBE", "a", "b"),
+				respCommand("GET", "key"),
+				respCommand("PUNSUBSCRIBE", "p*"),
+				respCommand("HELLO", "3"),
+				respCommand("UNSUBSCRIBE"),
+				respCommand("PUBLISH", "a", "message"),
+			},
+			wantReplies: []string{
+				"*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n",
+				"*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n",
+				"-ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE are allowed in this context\r\n",
+				"*3\r\n$12\r\npunsubscribe\r\n$2\r\np*\r\n:2\r\n",
+				"%4\r\n$6\r\nserver\r\n$5\r\nmemdb\r\n$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:1\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n",
+				">3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:1\r\n>3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:0\r\n",
+				":0\r\n",
+			},
+		},
+		{
+			name:     "set nx get: null and bulk",
+			requests: []string{respCommand("SET", "key", "val", "NX"), respCommand("SET", "key", "val", "GET"), respCommand("SETNX", "key", "val")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				setIfCall(store, "key", "val", time.Time{}, "old", true)
+			},
+			wantReplies: []string{"$-1\r\n", "$3\r\nold\r\n", ":0\r\n"},
+		},
+		{
+			name:        "parse error",
+			requests:    []string{respCommand("GET"), respCommand("UNKNOWN")},
+			wantReplies: []string{"-ERR invalid the number of arguments\r\n", "-ERR unsupport command UNKNOWN\r\n"},
+		},
+		{
+			name:     "scan: cursor and keys",
+			requests: []string{respCommand("SCAN", "0")},
+			mockSetup: func(_ *MockStorage, ordered *MockOrderedStorage) {
+				ordered.On("Scan", mock.Anything, "", "*", defaultScanCount).Return([]string{"a", "b"}, "", nil)
+			},
+			wantReplies: []string{"*2\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		},
+		{
+			name:     "range: map",
+			requests: []string{respCommand("RANGE", "a", "c"), respCommand("HELLO", "3"), respCommand("RANGE", "a", "c")},
+			mockSetup: func(_ *MockStorage, ordered *MockOrderedStorage) {
+				ordered.On("Range", mock.Anything, "a", "c", 0).Return([]storage.KeyValue{
+					{Key: "a", Value: "1"},
+					{Key: "b", Value: "2"},
+				}, nil)
+			},
+			wantReplies: []string{
+				"*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+				"%4\r\n$6\r\nserver\r\n$5\r\nmemdb\r\n$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:1\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n",
+				"%2\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+			},
+		},
+		{
+			name:     "exec: nested replies",
+			requests: []string{respCommand("MULTI"), respCommand("SET", "key", "val"), respCommand("GET", "key"), respCommand("EXEC")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				atomicCall(store)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+				store.On("Get", mock.Anything, "key").Return("val", nil)
+			},
+			wantReplies: []string{"+OK\r\n", "+QUEUED\r\n", "+QUEUED\r\n", "*2\r\n+OK\r\n$3\r\nval\r\n"},
+		},
+		{
+			name:        "exec: discarded",
+			requests:    []string{respCommand("MULTI"), respCommand("GET"), respCommand("EXEC")},
+			wantReplies: []string{"+OK\r\n", "-ERR invalid the number of arguments\r\n", "-EXECABORT transaction discarded because of previous errors\r\n"},
+		},
+		{
+			name:     "exec: watched key changed",
+			requests: []string{respCommand("WATCH", "key"), respCommand("SET", "key", "val"), respCommand("MULTI"), respCommand("EXEC")},
+			mockSetup: func(store *MockStorage, _ *MockOrderedStorage) {
+				atomicCall(store)
+				store.On("ExpireTime", mock.Anything, "key").Return(time.Time{}, dberrors.ErrNotFound)
+				store.On("Set", mock.Anything, "key", "val").Return(nil)
+			},
+			wantReplies: []string{"+OK\r\n", "+OK\r\n", "+OK\r\n", "*-1\r\n"},
+		},
+		{
+			name:        "hello: unsupported version",
+			requests:    []string{respCommand("HELLO", "4")},
+			wantReplies: []string{"-NOPROTO unsupported protocol version\r\n"},
+		},
+		{
+			name:        "inline command",
+			requests:    []string{"PING\r\n"},
+			wantReplies: []string{"-ERR unsupport command PING\r\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, ordered := NewMockStorage(t), NewMockOrderedStorage(t)
+			if tc.mockSetup != nil {
+				tc.mockSetup(store, ordered)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			ctx = network.ContextWithSession(ctx, network.NewSession(1, nil))
+
+			h := NewQueryHandler(logger, store)
+			h.ordered = []OrderedStorage{ordered}
+
+			r := NewRESPHandler(h)
+			gotReplies := make([]string, 0, len(tc.requests))
+			for _, req := range tc.requests {
+				gotReplies = append(gotReplies, r.Handle(ctx, req))
+			}
+			assert.Equal(t, tc.wantReplies, gotReplies)
+		})
+	}
+}
+
+func TestRESPHandler_Handle_auth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	ctx := network.ContextWithSession(context.Background(), network.NewSession(1, nil))
+
+	a := NewMockAuthenticator(t)
+	a.On("Authenticate", "admin", "wrong").Return(auth.ErrInvalidCredentials)
+	a.On("Authenticate", "admin", "secret").Return(nil)
+
+	r := NewRESPHandler(NewQueryHandler(logger, NewMockStorage(t), WithAuthenticator(a)))
+	assert.Equal(t, "-NOAUTH authentication required\r\n", r.Handle(ctx, respCommand("get", "key")))
+	assert.Equal(t, "-WRONGPASS invalid username-password pair\r\n", r.Handle(ctx, respCommand("auth", "admin", "wrong")))
+	assert.Equal(t, "+OK\r\n", r.Handle(ctx, respCommand("auth", "admin", "secret")))
+}
+
+func TestRESPHandler_Handle_acl(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sess := network.NewSession(1, nil)
+	sess.SetUser("admin")
+	ctx := network.ContextWithSession(context.Background(), sess)
+
+	a := NewMockAuthenticator(t)
+	a.On("Authorize", "admin", mock.MatchedBy(func(access auth.Access) bool {
+		return access.Command == ACLCommandName
+	})).Return(nil)
+	a.On("Authorize", "admin", mock.Anything).Return(fmt.Errorf("%w to access the 'key' key", auth.ErrNoPermission))
+	a.On("SetUser", "alice", []string{">secret", "+@read"}).Return(nil)
+	a.On("DelUser", []string{"alice", "bob"}).Return(1, nil)
+	a.On("List").Return([]string{"user admin ~* +@all", "user bob +@read"})
+
+	r := NewRESPHandler(NewQueryHandler(logger, NewMockStorage(t), WithAuthenticator(a)))
+	assert.Equal(t, "+OK\r\n", r.Handle(ctx, respCommand("acl", "setuser", "alice", ">secret", "+@read")))
+	assert.Equal(t, ":1\r\n", r.Handle(ctx, respCommand("acl", "deluser", "alice", "bob")))
+	assert.Equal(t, "*2\r\n$19\r\nuser admin ~* +@all\r\n$15\r\nuser bob +@read\r\n", r.Handle(ctx, respCommand("acl", "list")))
+	assert.Equal(t, "+admin\r\n", r.Handle(ctx, respCommand("acl", "whoami")))
+	assert.Equal(t, "-NOPERM no permissions to access the 'key' key\r\n", r.Handle(ctx, respCommand("get", "key")))
+}
@@ -2,16 +2,45 @@ package compute
 
 import (
 	"fmt"
+	"strings"
 )
 
 type Response struct {
-	kind  string
-	value string
+	// cmdID is the command the response is given to, it's zero for
+	// the responses not produced by the commands, e.g. parse errors.
+	cmdID    CommandID
+	kind     string
+	value    string
+	hasValue bool
+	// status is the message printed verbatim unlike the values.
+	status string
+	values []string
+	// array contains the elements of the array-shaped response, e.g.
+	// the responses of the commands executed by EXEC or the MGET values.
+	array []Response
 	err   error
 }
 
 func (r Response) WithValue(v string) Response {
-	return Response{kind: r.kind, value: v}
+	return Response{kind: r.kind, value: v, hasValue: true}
+}
+
+// WithStatus returns the response containing the human-readable message.
+func (r Response) WithStatus(msg string) Response {
+	return Response{kind: r.kind, status: msg}
+}
+
+// WithValues returns the response containing the array of values.
+func (r Response) WithValues(vs []string) Response {
+	return Response{kind: r.kind, values: vs}
+}
+
+// WithArray returns the response containing the array of responses.
+func (r Response) WithArray(rs []Response) Response {
+	if rs == nil {
+		rs = []Response{}
+	}
+	return Response{kind: r.kind, array: rs}
 }
 
 func (r Response) WithErr(err error) Response {
@@ -22,8 +51,28 @@ func (r Response) String() string {
 	if r.err != nil {
 		return fmt.Sprintf("[%s] %v", r.kind, r.err)
 	}
-	if r.value != "" {
-		return fmt.Sprintf("[%s] %s", r.kind, r.value)
+	if len(r.array) != 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "[%s]", r.kind)
+		for i, resp := range r.array {
+			// The elements being arrays themselves are indented.
+			fmt.Fprintf(&b, "\n%d) %s", i+1, strings.ReplaceAll(resp.String(), "\n", "\n   "))
+		}
+		return b.String()
+	}
+	// The values are quoted, so they are read back by Tokenize as they are.
+	if len(r.values) != 0 {
+		quoted := make([]string, len(r.values))
+		for i, v := range r.values {
+			quoted[i] = Quote(v)
+		}
+		return fmt.Sprintf("[%s] %s", r.kind, strings.Join(quoted, " "))
+	}
+	if r.hasValue {
+		return fmt.Sprintf("[%s] %s", r.kind, Quote(r.value))
+	}
+	if r.status != "" {
+		return fmt.Sprintf("[%s] %s", r.kind, r.status)
 	}
 	return fmt.Sprintf("[%s]", r.kind)
 }
@@ -34,4 +83,20 @@ var (
 	NotFoundResponse        = Response{kind: "not_found"}
 	ParseQueryErrorResponse = Response{kind: "parse_query_error"}
 	InternalErrorResponse   = Response{kind: "internal_error"}
+	OutOfMemoryResponse     = Response{kind: "out_of_memory"}
+	NotSupportedResponse    = Response{kind: "not_supported"}
+	AbortedResponse         = Response{kind: "aborted"}
+	WrongTypeResponse       = Response{kind: "wrong_type"}
+	OutOfRangeResponse      = Response{kind: "out_of_range"}
+	// ConflictResponse means the object being created already exists.
+	ConflictResponse = Response{kind: "conflict"}
+	// UnauthenticatedResponse rejects the commands of the client
+	// not authenticated by AUTH and the wrong credentials.
+	UnauthenticatedResponse = Response{kind: "unauthenticated"}
+	// NoPermissionResponse rejects the commands the user isn't allowed by ACL.
+	NoPermissionResponse = Response{kind: "no_permission"}
+
+	// PushResponse is the message pushed to the subscriber, it's told
+	// apart from the responses by its kind.
+	PushResponse = Response{kind: "push"}
 )
@@ -0,0 +1,175 @@
+package compute
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errUnbalancedQuotes = errors.New("unbalanced quotes")
+	errInvalidEscape    = errors.New("invalid escape sequence")
+)
+
+// Tokenize splits the query into the arguments separated by whitespace.
+// The arguments may be quoted to contain whitespace or arbitrary bytes:
+// double-quoted ones support the escapes \n, \r, \t, \a, \b, \\, \" and
+// \xHH, single-quoted ones support only \'. The closing quote must be
+// followed by whitespace or the end of the query.
+func Tokenize(query string) ([]string, error) {
+	var (
+		args []string
+		arg  strings.Builder
+	)
+	for i := 0; ; {
+		for i < len(query) && isSpace(query[i]) {
+			i++
+		}
+		if i == len(query) {
+			return args, nil
+		}
+
+		arg.Reset()
+		var err error
+		switch query[i] {
+		case '"':
+			i, err = readDoubleQuoted(query, i+1, &arg)
+		case '\'':
+			i, err = readSingleQuoted(query, i+1, &arg)
+		default:
+			for i < len(query) && !isSpace(query[i]) {
+				if query[i] == '"' || query[i] == '\'' {
+					return nil, errUnbalancedQuotes
+				}
+				arg.WriteByte(query[i])
+				i++
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i < len(query) && !isSpace(query[i]) {
+			return nil, errUnbalancedQuotes
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// readDoubleQuoted reads the argument starting after the opening quote
+// and returns the position after the closing one.
+func readDoubleQuoted(query string, i int, arg *strings.Builder) (int, error) {
+	for ; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '"':
+			return i + 1, nil
+		case c != '\\':
+			arg.WriteByte(c)
+		case i+1 == len(query):
+			return 0, errUnbalancedQuotes
+		default:
+			i++
+			switch query[i] {
+			case 'n':
+				arg.WriteByte('\n')
+			case 'r':
+				arg.WriteByte('\r')
+			case 't':
+				arg.WriteByte('\t')
+			case 'a':
+				arg.WriteByte('\a')
+			case 'b':
+				arg.WriteByte('\b')
+			case 'x':
+				if i+2 >= len(query) || !isHex(query[i+1]) || !isHex(query[i+2]) {
+					return 0, errInvalidEscape
+				}
+				arg.WriteByte(unhex(query[i+1])<<4 | unhex(query[i+2])) //nolint:mnd // high nibble
+				i += 2
+			default:
+				// \\, \" and any other escaped character stand for themselves.
+				arg.WriteByte(query[i])
+			}
+		}
+	}
+	return 0, errUnbalancedQuotes
+}
+
+func readSingleQuoted(query string, i int, arg *strings.Builder) (int, error) {
+	for ; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			return i + 1, nil
+		case c == '\\' && i+1 < len(query) && query[i+1] == '\'':
+			arg.WriteByte('\'')
+			i++
+		default:
+			arg.WriteByte(c)
+		}
+	}
+	return 0, errUnbalancedQuotes
+}
+
+// Quote returns the value as is if Tokenize reads it as the single argument,
+// otherwise it returns the value double-quoted with the unsafe bytes escaped.
+func Quote(value string) string {
+	if value != "" && !strings.ContainsFunc(value, needsQuoting) {
+		return value
+	}
+
+	const hexDigits = "0123456789abcdef"
+
+	var b strings.Builder
+	b.Grow(len(value) + 2) //nolint:mnd // quotes
+	b.WriteByte('"')
+	for i := range len(value) {
+		switch c := value[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				b.WriteString(`\x`)
+				b.WriteByte(hexDigits[c>>4])
+				b.WriteByte(hexDigits[c&0xf]) //nolint:mnd // low nibble
+				continue
+			}
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func needsQuoting(r rune) bool {
+	return r <= ' ' || r > '~' || r == '"' || r == '\'' || r == '\\'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c <= '9':
+		return c - '0'
+	case c <= 'F':
+		return c - 'A' + 10 //nolint:mnd // hex digit
+	default:
+		return c - 'a' + 10 //nolint:mnd // hex digit
+	}
+}
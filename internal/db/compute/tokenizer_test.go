@@ -0,0 +1,121 @@
+package compute
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{name: "plain", input: "SET key value", want: []string{"SET", "key", "value"}},
+		{name: "collapsed whitespace", input: "  SET \t key   value\r\n", want: []string{"SET", "key", "value"}},
+		{name: "empty", input: "   ", want: nil},
+		{name: "double quoted", input: `SET key "hello world"`, want: []string{"SET", "key", "hello world"}},
+		{name: "empty quoted", input: `SET key ""`, want: []string{"SET", "key", ""}},
+		{name: "escapes", input: `"a\nb\r\t\a\b\\\"\x00\xfF\q"`, want: []string{"a\nb\r\t\a\b\\\"\x00\xffq"}},
+		{name: "single quoted", input: `'it\'s "raw" \n'`, want: []string{`it's "raw" \n`}},
+		{name: "unbalanced double quotes", input: `SET key "value`, wantErr: errUnbalancedQuotes},
+		{name: "unbalanced single quotes", input: `SET key 'value`, wantErr: errUnbalancedQuotes},
+		{name: "quote inside argument", input: `SET key va"lue"`, wantErr: errUnbalancedQuotes},
+		{name: "text after closing quote", input: `SET key "va"lue`, wantErr: errUnbalancedQuotes},
+		{name: "trailing backslash", input: `SET key "value\`, wantErr: errUnbalancedQuotes},
+		{name: "invalid hex escape", input: `SET key "\xZZ"`, wantErr: errInvalidEscape},
+		{name: "truncated hex escape", input: `SET key "\x1"`, wantErr: errInvalidEscape},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Tokenize(tc.input)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{input: "value", want: "value"},
+		{input: "", want: `""`},
+		{input: "hello world", want: `"hello world"`},
+		{input: "a\nb\x00\xff\"\\'", want: `"a\nb\x00\xff\"\\'"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.want, Quote(tc.input))
+		})
+	}
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, seed := range []string{"", "value", "hello world", "a\nb", "\x00\xff", `"'\`} {
+		f.Add(seed, "other")
+	}
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		got, err := Tokenize("SET " + Quote(a) + " " + Quote(b))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"SET", a, b}, got)
+	})
+}
+
+func FuzzTokenize(f *testing.F) {
+	for _, seed := range []string{"SET key value", `SET key "a\x00 b"`, `'it\'s'`, `"unbalanced`} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, query string) {
+		args, err := Tokenize(query)
+		if err != nil {
+			return
+		}
+
+		// The parsed arguments are encoded and parsed back unchanged.
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = Quote(arg)
+		}
+		got, err := Tokenize(strings.Join(quoted, " "))
+		require.NoError(t, err)
+		assert.Equal(t, args, got)
+	})
+}
+
+func FuzzResponse(f *testing.F) {
+	for _, seed := range []string{"", "value", "hello world", "a\r\nb", "\x00\xff"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		for _, resp := range []Response{
+			OKResponse.WithValue(value),
+			OKResponse.WithValues([]string{value, "next", value}),
+		} {
+			encoded, ok := strings.CutPrefix(resp.String(), "[ok] ")
+			require.True(t, ok)
+
+			got, err := Tokenize(encoded)
+			require.NoError(t, err)
+			if resp.hasValue {
+				assert.Equal(t, []string{value}, got)
+			} else {
+				assert.Equal(t, resp.values, got)
+			}
+		}
+	})
+}
@@ -1,34 +1,227 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
+	"gopkg.in/yaml.v3"
+
+	"github.com/Mort4lis/memdb/internal/db/auth"
+	"github.com/Mort4lis/memdb/internal/db/events"
+	"github.com/Mort4lis/memdb/internal/db/snapshot"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/db/wal"
 	"github.com/Mort4lis/memdb/internal/network"
+	"github.com/Mort4lis/memdb/internal/network/resp"
 )
 
 type Config struct {
-	Engine  Engine  `yaml:"engine"`
-	Network Network `yaml:"network"`
-	Logging Logging `yaml:"logging"`
+	Engine        Engine        `yaml:"engine"`
+	WAL           WAL           `yaml:"wal"`
+	Snapshot      Snapshot      `yaml:"snapshot"`
+	Notifications Notifications `yaml:"notifications"`
+	Auth          Auth          `yaml:"auth"`
+	Network       Network       `yaml:"network"`
+	Logging       Logging       `yaml:"logging"`
 }
 
 type Engine struct {
-	Type string `env-default:"in_memory" yaml:"type"`
+	Type                 string        `env-default:"in_memory"  yaml:"type"`
+	ExpirationInterval   time.Duration `env-default:"100ms"      yaml:"expiration_interval"`
+	ExpirationSampleSize int           `env-default:"20"         yaml:"expiration_sample_size"`
+	MaxMemory            int64         `env-default:"0"          yaml:"max_memory"`
+	EvictionPolicy       string        `env-default:"noeviction" yaml:"eviction_policy"`
+	EvictionSampleSize   int           `env-default:"5"          yaml:"eviction_sample_size"`
+	Databases            int           `env-default:"16"         yaml:"databases"`
+
+	// Sections holds the engine specific configuration sub-sections keyed by the engine type.
+	Sections map[string]yaml.Node `yaml:",inline"`
+}
+
+// Decode unmarshals the configuration sub-section of the selected engine into v.
+func (c Engine) Decode(v any) error {
+	node, ok := c.Sections[c.Type]
+	if !ok {
+		return nil
+	}
+	if err := node.Decode(v); err != nil {
+		return fmt.Errorf("decode %s engine config: %w", c.Type, err)
+	}
+	return nil
+}
+
+func (c Engine) Options() ([]storage.EngineOption, error) {
+	if c.ExpirationInterval <= 0 {
+		return nil, fmt.Errorf("invalid expiration interval: %s", c.ExpirationInterval)
+	}
+	policy, err := storage.EvictionPolicyByName(c.EvictionPolicy)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // ignore
+	}
+	return []storage.EngineOption{
+		storage.WithExpirationInterval(c.ExpirationInterval),
+		storage.WithExpirationSampleSize(c.ExpirationSampleSize),
+		storage.WithMaxMemory(c.MaxMemory),
+		storage.WithEvictionPolicy(policy),
+		storage.WithEvictionSampleSize(c.EvictionSampleSize),
+	}, nil
+}
+
+type WAL struct {
+	Enabled           bool          `env-default:"false"      yaml:"enabled"`
+	DataDirectory     string        `env-default:"./data/wal" yaml:"data_directory"`
+	MaxSegmentSize    int64         `env-default:"10485760"   yaml:"max_segment_size"`
+	FlushMode         string        `env-default:"batch"      yaml:"flush_mode"`
+	FlushBatchTimeout time.Duration `env-default:"10ms"       yaml:"flush_batch_timeout"`
+	FlushBatchSize    int           `env-default:"65536"      yaml:"flush_batch_size"`
+}
+
+func (c WAL) Options() []wal.Option {
+	return []wal.Option{
+		wal.WithDataDirectory(c.DataDirectory),
+		wal.WithMaxSegmentSize(c.MaxSegmentSize),
+		wal.WithFlushMode(c.FlushMode),
+		wal.WithFlushBatchTimeout(c.FlushBatchTimeout),
+		wal.WithFlushBatchSize(c.FlushBatchSize),
+	}
+}
+
+type Snapshot struct {
+	Enabled            bool          `env-default:"false"           yaml:"enabled"`
+	DataDirectory      string        `env-default:"./data/snapshot" yaml:"data_directory"`
+	Interval           time.Duration `env-default:"5m"              yaml:"interval"`
+	MutationsThreshold uint64        `env-default:"10000"           yaml:"mutations_threshold"`
+	Retain             int           `env-default:"2"               yaml:"retain"`
+}
+
+func (c Snapshot) Options() []snapshot.Option {
+	return []snapshot.Option{
+		snapshot.WithDataDirectory(c.DataDirectory),
+		snapshot.WithInterval(c.Interval),
+		snapshot.WithMutationsThreshold(c.MutationsThreshold),
+		snapshot.WithRetain(c.Retain),
+	}
+}
+
+// Notifications configures the delivery of the keyspace notifications
+// to the clients subscribed by NOTIFY.
+type Notifications struct {
+	BufferSize         int    `env-default:"1024" yaml:"buffer_size"`
+	SlowConsumerPolicy string `env-default:"drop" yaml:"slow_consumer_policy"`
+}
+
+func (c Notifications) Options() []events.Option {
+	return []events.Option{
+		events.WithBufferSize(c.BufferSize),
+		events.WithSlowConsumerPolicy(c.SlowConsumerPolicy),
+	}
 }
 
+// Auth configures the users the clients authenticate as by AUTH,
+// the authentication isn't required if there are no users.
+type Auth struct {
+	Users []User `yaml:"users"`
+	// ACLFile keeps the users changed by ACL SETUSER and ACL DELUSER,
+	// it's loaded instead of the users above if it exists.
+	ACLFile string `yaml:"acl_file"`
+}
+
+type User struct {
+	Name string `yaml:"name"`
+	// PasswordHash is made by "memdb -hash-password".
+	PasswordHash string `yaml:"password_hash"`
+	// Categories of the commands the user may run, all of them if omitted.
+	Categories []string `yaml:"categories"`
+	// Keys are the glob patterns of the keys the user may access, all of them if omitted.
+	Keys     []string `yaml:"keys"`
+	ReadOnly bool     `yaml:"read_only"`
+}
+
+func (c Auth) Enabled() bool {
+	return len(c.Users) != 0 || c.ACLFile != ""
+}
+
+func (c Auth) AuthUsers() []auth.User {
+	users := make([]auth.User, len(c.Users))
+	for i, u := range c.Users {
+		users[i] = auth.User{
+			Name:         u.Name,
+			PasswordHash: u.PasswordHash,
+			Categories:   u.Categories,
+			Keys:         u.Keys,
+			ReadOnly:     u.ReadOnly,
+		}
+		if u.Categories == nil {
+			users[i].Categories = []string{auth.CategoryAll}
+		}
+		if u.Keys == nil {
+			users[i].Keys = []string{"*"}
+		}
+	}
+	return users
+}
+
+func (c Auth) Options() []auth.Option {
+	var opts []auth.Option
+	if c.ACLFile != "" {
+		opts = append(opts, auth.WithACLFile(c.ACLFile))
+	}
+	return opts
+}
+
+// Wire protocols served by the listeners.
+const (
+	MemdbProtocol = "memdb"
+	RESPProtocol  = "resp"
+)
+
 type Network struct {
-	Addr           string        `env-default:":7991"  yaml:"addr"`
-	MaxConnections int           `env-default:"100"    yaml:"max_connections"`
-	MaxMessageSize int           `env-default:"4096"   yaml:"max_message_size"`
-	IdleTimeout    time.Duration `yaml:"idle_timeout"`
-	WriteTimeout   time.Duration `yaml:"write_timeout"`
+	Addr            string        `env-default:":7991"   yaml:"addr"`
+	Protocol        string        `env-default:"memdb"   yaml:"protocol"`
+	MaxConnections  int           `env-default:"100"     yaml:"max_connections"`
+	MaxMessageSize  int           `env-default:"4096"    yaml:"max_message_size"`
+	MaxOutputBuffer int           `env-default:"1048576" yaml:"max_output_buffer"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+
+	// Listeners are served besides the main one sharing its settings.
+	Listeners []Listener `yaml:"listeners"`
+}
+
+type Listener struct {
+	Addr     string `yaml:"addr"`
+	Protocol string `yaml:"protocol"`
 }
 
-func (c Network) ServerOptions() []network.TCPServerOption {
+// AllListeners returns the main listener followed by the additional ones.
+func (c Network) AllListeners() []Listener {
+	listeners := []Listener{{Addr: c.Addr, Protocol: c.Protocol}}
+	for _, l := range c.Listeners {
+		if l.Protocol == "" {
+			l.Protocol = MemdbProtocol
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+func (c Network) ServerOptions(l Listener) ([]network.TCPServerOption, error) {
+	var newCodec network.NewCodecFunc
+	switch l.Protocol {
+	case MemdbProtocol:
+		newCodec = network.NewFramedCodec
+	case RESPProtocol:
+		newCodec = resp.NewCodec
+	default:
+		return nil, fmt.Errorf("unknown protocol %q of listener %s", l.Protocol, l.Addr)
+	}
+
 	opts := []network.TCPServerOption{
-		network.WithServerListen(c.Addr),
+		network.WithServerListen(l.Addr),
+		network.WithServerCodec(newCodec),
 		network.WithServerMaxConnections(c.MaxConnections),
 		network.WithServerMaxMessageSize(c.MaxMessageSize),
+		network.WithServerMaxOutputBuffer(c.MaxOutputBuffer),
 	}
 	if c.IdleTimeout != 0 {
 		opts = append(opts, network.WithServerIdleTimeout(c.IdleTimeout))
@@ -36,7 +229,7 @@ func (c Network) ServerOptions() []network.TCPServerOption {
 	if c.WriteTimeout != 0 {
 		opts = append(opts, network.WithServerWriteTimeout(c.WriteTimeout))
 	}
-	return opts
+	return opts, nil
 }
 
 type Logging struct {
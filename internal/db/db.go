@@ -11,10 +11,15 @@ import (
 
 	"github.com/ilyakaznacheev/cleanenv"
 
+	"github.com/Mort4lis/memdb/internal/db/auth"
 	"github.com/Mort4lis/memdb/internal/db/compute"
 	"github.com/Mort4lis/memdb/internal/db/config"
+	"github.com/Mort4lis/memdb/internal/db/events"
 	"github.com/Mort4lis/memdb/internal/db/logging"
+	"github.com/Mort4lis/memdb/internal/db/snapshot"
 	"github.com/Mort4lis/memdb/internal/db/storage"
+	_ "github.com/Mort4lis/memdb/internal/db/storage/lsm" // register lsm storage engine
+	"github.com/Mort4lis/memdb/internal/db/wal"
 	"github.com/Mort4lis/memdb/internal/network"
 )
 
@@ -31,29 +36,256 @@ func Run(confPath string) error {
 		return fmt.Errorf("create logger: %v", err)
 	}
 
-	engine := storage.NewEngine()
-	handler := compute.NewQueryHandler(logger, engine)
-	server, err := network.NewTCPServer(logger, conf.Network.ServerOptions()...)
+	inst, err := open(logger, conf)
 	if err != nil {
-		return fmt.Errorf("create tcp server: %v", err)
+		return err
 	}
+	defer inst.close()
 
-	go func() {
-		logger.Info("Start to listen tcp server", slog.String("addr", conf.Network.Addr))
-		server.ServeHandler(handler)
+	var servers []*network.TCPServer
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		for _, server := range servers {
+			if shutdownErr := server.Shutdown(ctx); shutdownErr != nil {
+				logger.Error("Failed to shutdown tcp server", slog.Any("error", shutdownErr))
+			}
+		}
 	}()
 
+	for _, l := range conf.Network.AllListeners() {
+		server, serverErr := newServer(logger, conf.Network, l, network.WithServerOnDisconnect(inst.handler.Disconnect))
+		if serverErr != nil {
+			return serverErr
+		}
+		servers = append(servers, server)
+
+		var h network.TCPHandler = inst.handler
+		if l.Protocol == config.RESPProtocol {
+			h = compute.NewRESPHandler(inst.handler)
+		}
+		go func() {
+			logger.Info(
+				"Start to listen tcp server",
+				slog.String("addr", l.Addr),
+				slog.String("protocol", l.Protocol),
+			)
+			server.ServeHandler(h)
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	sig := <-quit
 	logger.Info("Caught signal. Shutting down...", slog.String("signal", sig.String()))
+	return nil
+}
+
+// instance is the storage restored from the disk and the handler serving it.
+type instance struct {
+	logger    *slog.Logger
+	handler   *compute.QueryHandler
+	dbs       *storage.Databases
+	walog     *wal.WAL
+	snapshots *snapshot.Manager
+}
+
+// open creates the storage and restores its data from the latest snapshot
+// and the WAL. The storage engines keeping the data on disk recover it on
+// their own, the snapshot and the WAL would apply the changes once again.
+func open(logger *slog.Logger, conf config.Config) (_ *instance, err error) {
+	engineOpts, err := conf.Engine.Options()
+	if err != nil {
+		return nil, fmt.Errorf("configure storage engine: %v", err)
+	}
+
+	bus, err := events.NewBus(conf.Notifications.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("configure notifications: %v", err)
+	}
+	engineOpts = append(engineOpts, storage.WithEventListener(bus.Publish))
+
+	var handlerOpts []compute.QueryHandlerOption
+	if conf.Auth.Enabled() {
+		authenticator, authErr := auth.NewAuthenticator(conf.Auth.AuthUsers(), conf.Auth.Options()...)
+		if authErr != nil {
+			return nil, fmt.Errorf("configure authentication: %v", authErr)
+		}
+		handlerOpts = append(handlerOpts, compute.WithAuthenticator(authenticator))
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-	defer cancel()
+	inst := &instance{logger: logger}
+	defer func() {
+		if err != nil {
+			inst.close()
+		}
+	}()
+
+	inst.dbs, err = storage.OpenDatabases(logger, conf.Engine.Type, conf.Engine.Databases, conf.Engine.Decode, engineOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create storage engine: %v", err)
+	}
+	durable := inst.dbs.Durable()
+	if durable {
+		logger.Info("Storage engine recovers data on its own, snapshot and WAL aren't restored")
+	}
+
+	handlerOpts = append(handlerOpts, compute.WithEventBus(bus), withDatabases(inst.dbs))
+	if conf.WAL.Enabled {
+		inst.walog, err = wal.Open(logger, conf.WAL.Options()...)
+		if err != nil {
+			return nil, fmt.Errorf("open wal: %v", err)
+		}
+		handlerOpts = append(handlerOpts, compute.WithWAL(inst.walog))
+	}
+
+	var (
+		source  = &snapshotSource{dbs: inst.dbs, walog: inst.walog}
+		fromLSN uint64
+	)
+	if conf.Snapshot.Enabled {
+		var snap snapshot.Snapshot
+		inst.snapshots, snap, err = loadSnapshot(logger, conf.Snapshot, source, inst.walog)
+		if err != nil {
+			return nil, err
+		}
+		if snap.Data != nil && !durable {
+			inst.dbs.Load(snap.Data)
+		}
+		fromLSN = snap.LSN
+		handlerOpts = append(handlerOpts, compute.WithSnapshotter(inst.snapshots))
+	}
+
+	inst.handler = compute.NewQueryHandler(logger, inst.dbs.DB(0), handlerOpts...)
+	source.handler = inst.handler
+
+	if inst.walog != nil && !durable {
+		if err = replayWAL(logger, inst.walog, inst.handler, fromLSN); err != nil {
+			return nil, err
+		}
+	}
+	if inst.snapshots != nil {
+		inst.snapshots.Start()
+	}
+	return inst, nil
+}
 
-	if err = server.Shutdown(ctx); err != nil {
-		logger.Error("Failed to shutdown tcp server", slog.Any("error", err))
+// close takes the final snapshot and closes the WAL and the storage.
+func (inst *instance) close() {
+	if inst.snapshots != nil {
+		if err := inst.snapshots.Close(); err != nil {
+			inst.logger.Error("Failed to close snapshot manager", slog.Any("error", err))
+		}
+	}
+	if inst.walog != nil {
+		if err := inst.walog.Close(); err != nil {
+			inst.logger.Error("Failed to close WAL", slog.Any("error", err))
+		}
+	}
+	if inst.dbs != nil {
+		if err := inst.dbs.Close(); err != nil {
+			inst.logger.Error("Failed to close storage engine", slog.Any("error", err))
+		}
 	}
+}
+
+func newServer(
+	logger *slog.Logger,
+	conf config.Network,
+	l config.Listener,
+	extra ...network.TCPServerOption,
+) (*network.TCPServer, error) {
+	opts, err := conf.ServerOptions(l)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // ignore
+	}
+	opts = append(opts, extra...)
+
+	server, err := network.NewTCPServer(logger, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create tcp server: %v", err)
+	}
+	return server, nil
+}
+
+func loadSnapshot(
+	logger *slog.Logger,
+	conf config.Snapshot,
+	source snapshot.Source,
+	walog *wal.WAL,
+) (*snapshot.Manager, snapshot.Snapshot, error) {
+	var compactor snapshot.Compactor
+	if walog != nil {
+		compactor = walog
+	}
+
+	snapshots, err := snapshot.NewManager(logger, source, compactor, conf.Options()...)
+	if err != nil {
+		return nil, snapshot.Snapshot{}, fmt.Errorf("create snapshot manager: %v", err)
+	}
+
+	snap, err := snapshots.LoadLatest()
+	if err != nil {
+		return nil, snapshot.Snapshot{}, fmt.Errorf("load snapshot: %v", err)
+	}
+	if walog != nil {
+		walog.AdvanceLSN(snap.LSN)
+	}
+	return snapshots, snap, nil
+}
+
+func replayWAL(logger *slog.Logger, walog *wal.WAL, handler *compute.QueryHandler, fromLSN uint64) error {
+	var (
+		count int
+		ctx   = context.Background()
+	)
+	err := walog.Replay(fromLSN, func(rec wal.Record) error {
+		count++
+		return handler.Apply(ctx, compute.NewQuery(compute.CommandID(rec.CommandID), rec.Args))
+	})
+	if err != nil {
+		return fmt.Errorf("replay wal: %v", err)
+	}
+
+	logger.Info("Restored data from WAL", slog.Int("records", count))
 	return nil
 }
+
+// withDatabases passes the logical databases to the handler.
+func withDatabases(dbs *storage.Databases) compute.QueryHandlerOption {
+	stores := make([]compute.Storage, dbs.Len())
+	for i := range stores {
+		stores[i] = dbs.DB(i)
+	}
+	return compute.WithDatabases(stores...)
+}
+
+// snapshotSource glues together the handler, which guarantees there are
+// no mutations in progress, the WAL and the logical databases.
+type snapshotSource struct {
+	handler *compute.QueryHandler
+	walog   *wal.WAL
+	dbs     *storage.Databases
+}
+
+// Checkpoint captures the data consistent with the LSN while there are no
+// mutations in progress and copies it after the mutations are resumed.
+func (s *snapshotSource) Checkpoint() (uint64, []map[string]storage.Entry) {
+	var (
+		lsn    uint64
+		export func() []map[string]storage.Entry
+	)
+	s.handler.Checkpoint(func() {
+		if s.walog != nil {
+			lsn = s.walog.LastLSN()
+		}
+		export = s.dbs.Snapshot()
+	})
+	return lsn, export()
+}
+
+func (s *snapshotSource) Mutations() uint64 {
+	return s.handler.Mutations()
+}
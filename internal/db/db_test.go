@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/config"
+)
+
+func TestOpen_restart(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	for _, engine := range []string{"in_memory", "lsm"} {
+		for _, snapshots := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s snapshots %t", engine, snapshots), func(t *testing.T) {
+				dir := t.TempDir()
+				confPath := filepath.Join(dir, "config.yaml")
+				require.NoError(t, os.WriteFile(confPath, []byte(fmt.Sprintf(`
+engine:
+  type: %[1]q
+  databases: 2
+  lsm:
+    data_directory: %[2]q
+wal:
+  enabled: true
+  data_directory: %[3]q
+  flush_mode: "sync"
+snapshot:
+  enabled: %[4]t
+  data_directory: %[5]q
+`, engine, filepath.Join(dir, "lsm"), filepath.Join(dir, "wal"), snapshots, filepath.Join(dir, "snapshot"))), 0o600))
+
+				var conf config.Config
+				require.NoError(t, cleanenv.ReadConfig(confPath, &conf))
+
+				ctx := context.Background()
+				items := make([]string, 0, 3)
+				for i := range 3 {
+					inst, err := open(logger, conf)
+					require.NoError(t, err)
+
+					items = append(items, fmt.Sprintf("item-%d", i))
+					assert.Equal(t, fmt.Sprintf("[ok] %d", i+1), inst.handler.Handle(ctx, "INCR counter"))
+					assert.Equal(t, fmt.Sprintf("[ok] %d", i+1), inst.handler.Handle(ctx, "RPUSH list "+items[i]))
+					assert.Equal(t, "[ok] "+strings.Join(items, " "), inst.handler.Handle(ctx, "LRANGE list 0 -1"))
+					inst.close()
+				}
+			})
+		}
+	}
+}
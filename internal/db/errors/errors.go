@@ -7,4 +7,14 @@ import (
 var (
 	ErrNotFound = errors.New("key is not found")
 	ErrInternal = errors.New("internal server error")
+
+	ErrOutOfMemory = errors.New("not enough memory to store the key")
+
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrNotFloat   = errors.New("value is not a valid float")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+	ErrWrongType  = errors.New("operation against a key holding the wrong kind of value")
+
+	ErrSnapshotsDisabled = errors.New("snapshots are disabled")
+	ErrNotSupported      = errors.New("command is not supported by the storage engine")
 )
@@ -0,0 +1,198 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/pkg/glob"
+)
+
+// The policies applied to the subscriber once its buffer is full.
+const (
+	// DropPolicy drops the events the subscriber has no room for.
+	DropPolicy = "drop"
+	// DisconnectPolicy closes the subscription with ErrSlowConsumer.
+	DisconnectPolicy = "disconnect"
+)
+
+var ErrSlowConsumer = errors.New("subscriber doesn't keep up with the events")
+
+type Config struct {
+	bufferSize int
+	policy     string
+}
+
+type Option func(c *Config)
+
+// WithBufferSize sets the number of the events buffered per subscriber.
+func WithBufferSize(n int) Option {
+	return func(c *Config) {
+		c.bufferSize = n
+	}
+}
+
+func WithSlowConsumerPolicy(policy string) Option {
+	return func(c *Config) {
+		c.policy = policy
+	}
+}
+
+const (
+	defaultBufferSize = 1024
+	defaultPolicy     = DropPolicy
+)
+
+// Bus delivers the changes of the keys made by the storage engine to the
+// subscribers. Publishing never blocks the engine: every subscriber has
+// the buffer of its own, the slow ones lose the events or are closed.
+type Bus struct {
+	conf Config
+
+	// mu serializes the changes of subs, Publish reads it without locking.
+	mu   sync.Mutex
+	subs atomic.Pointer[[]*Subscription]
+}
+
+func NewBus(opts ...Option) (*Bus, error) {
+	conf := Config{
+		bufferSize: defaultBufferSize,
+		policy:     defaultPolicy,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	switch conf.policy {
+	case DropPolicy, DisconnectPolicy:
+	default:
+		return nil, fmt.Errorf("unsupported slow consumer policy: %s", conf.policy)
+	}
+	if conf.bufferSize <= 0 {
+		return nil, fmt.Errorf("invalid buffer size: %d", conf.bufferSize)
+	}
+	return &Bus{conf: conf}, nil
+}
+
+// Publish delivers the event to the subscribers of the matching patterns,
+// it's meant to be the storage.EventListener of the engine.
+func (b *Bus) Publish(ev storage.Event) {
+	subs := b.subs.Load()
+	if subs == nil {
+		return
+	}
+	for _, sub := range *subs {
+		sub.deliver(ev, b.conf.policy)
+	}
+}
+
+// Subscribe creates the subscription receiving the events of the keys
+// matching the patterns, see Subscription.SetPatterns.
+func (b *Bus) Subscribe(patterns []string) *Subscription {
+	sub := &Subscription{
+		bus:      b,
+		patterns: slices.Clone(patterns),
+		ch:       make(chan storage.Event, b.conf.bufferSize),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var subs []*Subscription
+	if old := b.subs.Load(); old != nil {
+		subs = slices.Clone(*old)
+	}
+	subs = append(subs, sub)
+	b.subs.Store(&subs)
+	return sub
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	old := b.subs.Load()
+	if old == nil {
+		return
+	}
+	subs := slices.DeleteFunc(slices.Clone(*old), func(s *Subscription) bool { return s == sub })
+	b.subs.Store(&subs)
+}
+
+// Subscription is the stream of the events of the keys matching its patterns.
+type Subscription struct {
+	bus *Bus
+
+	mu       sync.Mutex
+	patterns []string
+	ch       chan storage.Event
+	closed   bool
+	err      error
+}
+
+// Events returns the channel of the events, it's closed once the subscription is.
+func (s *Subscription) Events() <-chan storage.Event {
+	return s.ch
+}
+
+// Err returns ErrSlowConsumer if the subscription is closed by the bus.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// SetPatterns replaces the glob patterns the keys are matched against.
+func (s *Subscription) SetPatterns(patterns []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.patterns = slices.Clone(patterns)
+}
+
+// Close stops the delivery of the events and closes the channel.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked(nil)
+}
+
+func (s *Subscription) deliver(ev storage.Event, policy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || !s.matchLocked(ev.Key) {
+		return
+	}
+	select {
+	case s.ch <- ev:
+		return
+	default:
+	}
+
+	if policy == DisconnectPolicy {
+		s.closeLocked(ErrSlowConsumer)
+		s.bus.unsubscribe(s)
+	}
+}
+
+func (s *Subscription) matchLocked(key string) bool {
+	for _, pattern := range s.patterns {
+		if glob.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed, s.err = true, err
+	close(s.ch)
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+func TestNewBus(t *testing.T) {
+	_, err := NewBus(WithSlowConsumerPolicy("block"))
+	require.Error(t, err)
+
+	_, err = NewBus(WithBufferSize(0))
+	require.Error(t, err)
+}
+
+func TestBus_Publish(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policy   string
+		patterns []string
+		keys     []string
+		wantKeys []string
+		wantErr  error
+	}{
+		{
+			name:     "matching patterns",
+			policy:   DropPolicy,
+			patterns: []string{"user:*", "session"},
+			keys:     []string{"user:1", "order:1", "session"},
+			wantKeys: []string{"user:1", "session"},
+		},
+		{
+			name:     "drop on full buffer",
+			policy:   DropPolicy,
+			patterns: []string{"*"},
+			keys:     []string{"k1", "k2", "k3"},
+			wantKeys: []string{"k1", "k2"},
+		},
+		{
+			name:     "disconnect on full buffer",
+			policy:   DisconnectPolicy,
+			patterns: []string{"*"},
+			keys:     []string{"k1", "k2", "k3", "k4"},
+			wantKeys: []string{"k1", "k2"},
+			wantErr:  ErrSlowConsumer,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			bus, err := NewBus(WithBufferSize(2), WithSlowConsumerPolicy(testCase.policy))
+			require.NoError(t, err)
+
+			sub := bus.Subscribe(testCase.patterns)
+			for _, key := range testCase.keys {
+				bus.Publish(storage.Event{Type: storage.EventSet, Key: key, Time: time.Now()})
+			}
+			if testCase.wantErr == nil {
+				sub.Close()
+			}
+
+			var keys []string
+			for ev := range sub.Events() {
+				keys = append(keys, ev.Key)
+			}
+			assert.Equal(t, testCase.wantKeys, keys)
+			assert.ErrorIs(t, sub.Err(), testCase.wantErr)
+			assert.Empty(t, *bus.subs.Load(), "subscription must be removed")
+		})
+	}
+}
+
+func TestSubscription_SetPatterns(t *testing.T) {
+	bus, err := NewBus()
+	require.NoError(t, err)
+
+	sub := bus.Subscribe([]string{"a"})
+	sub.SetPatterns([]string{"b"})
+	bus.Publish(storage.Event{Type: storage.EventDel, Key: "a"})
+	bus.Publish(storage.Event{Type: storage.EventDel, Key: "b"})
+	sub.Close()
+	sub.Close()
+
+	ev, ok := <-sub.Events()
+	require.True(t, ok)
+	assert.Equal(t, "b", ev.Key)
+	_, ok = <-sub.Events()
+	assert.False(t, ok)
+	assert.NoError(t, sub.Err())
+}
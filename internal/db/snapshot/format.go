@@ -0,0 +1,277 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+const (
+	magic = "MEMDBSNP"
+
+	// formatVersionV1 stores only keys and values.
+	formatVersionV1 = 1
+	// formatVersionV2 adds the key deadline after the value.
+	formatVersionV2 = 2
+	// formatVersionV3 adds the value type before the value.
+	formatVersionV3 = 3
+	// formatVersionV4 stores the entries of every logical database.
+	formatVersionV4 = 4
+
+	formatVersion = formatVersionV4
+)
+
+var ErrCorrupted = errors.New("snapshot is corrupted")
+
+type Snapshot struct {
+	LSN uint64
+	// Data holds the entries of the logical databases by their numbers.
+	Data []map[string]storage.Entry
+}
+
+// The snapshot file has the following layout:
+//
+//	| magic (8 bytes) | version (2 bytes) | LSN (8 bytes) | number of databases (uvarint) |
+//	| number of entries (uvarint) | key length (uvarint) | key | type (1 byte) |
+//	| value length (uvarint) | value | deadline (varint) | ... next database ... |
+//	| crc32 of all preceding bytes (4 bytes) |
+//
+// The value is encoded by storage.MarshalValue. The deadline is unix time
+// in nanoseconds, zero means the key never expires. The versions before
+// V4 store the entries of the database 0 only.
+func encode(w io.Writer, snap Snapshot) error {
+	hash := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, hash))
+
+	var header [len(magic) + 10]byte
+	copy(header[:], magic)
+	binary.LittleEndian.PutUint16(header[len(magic):], formatVersion)
+	binary.LittleEndian.PutUint64(header[len(magic)+2:], snap.LSN)
+	if _, err := bw.Write(header[:]); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	buf := make([]byte, 0, binary.MaxVarintLen64)
+	buf = binary.AppendUvarint(buf, uint64(len(snap.Data)))
+	if _, err := bw.Write(buf); err != nil {
+		return fmt.Errorf("write databases count: %w", err)
+	}
+	for _, data := range snap.Data {
+		if err := encodeEntries(bw, data); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, hash.Sum32()); err != nil {
+		return fmt.Errorf("write checksum: %w", err)
+	}
+	return nil
+}
+
+func encodeEntries(bw *bufio.Writer, data map[string]storage.Entry) error {
+	buf := make([]byte, 0, binary.MaxVarintLen64)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	if _, err := bw.Write(buf); err != nil {
+		return fmt.Errorf("write entries count: %w", err)
+	}
+
+	for key, ent := range data {
+		if err := writeString(bw, key); err != nil {
+			return fmt.Errorf("write key: %w", err)
+		}
+		if err := bw.WriteByte(byte(ent.Value.Type())); err != nil {
+			return fmt.Errorf("write value type: %w", err)
+		}
+		if err := writeString(bw, storage.MarshalValue(ent.Value)); err != nil {
+			return fmt.Errorf("write value: %w", err)
+		}
+
+		var expireAt int64
+		if !ent.ExpireAt.IsZero() {
+			expireAt = ent.ExpireAt.UnixNano()
+		}
+		buf = binary.AppendVarint(buf[:0], expireAt)
+		if _, err := bw.Write(buf); err != nil {
+			return fmt.Errorf("write deadline: %w", err)
+		}
+	}
+	return nil
+}
+
+func writeString(w *bufio.Writer, s string) error {
+	buf := make([]byte, 0, binary.MaxVarintLen64)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	if _, err := w.Write(buf); err != nil {
+		return err //nolint:wrapcheck // ignore
+	}
+	_, err := w.WriteString(s)
+	return err //nolint:wrapcheck // ignore
+}
+
+func decode(data []byte) (Snapshot, error) {
+	var snap Snapshot
+
+	const minSize = len(magic) + 10 + 1 + 4
+	if len(data) < minSize {
+		return snap, fmt.Errorf("%w: too short", ErrCorrupted)
+	}
+
+	body, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return snap, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+	if !bytes.Equal(body[:len(magic)], []byte(magic)) {
+		return snap, fmt.Errorf("%w: bad magic", ErrCorrupted)
+	}
+	version := binary.LittleEndian.Uint16(body[len(magic):])
+	if version < formatVersionV1 || version > formatVersionV4 {
+		return snap, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	snap.LSN = binary.LittleEndian.Uint64(body[len(magic)+2:])
+
+	r := bytes.NewReader(body[len(magic)+10:])
+	dbs := uint64(1)
+	if version >= formatVersionV4 {
+		var err error
+		if dbs, err = binary.ReadUvarint(r); err != nil {
+			return snap, fmt.Errorf("%w: read databases count", ErrCorrupted)
+		}
+	}
+
+	snap.Data = make([]map[string]storage.Entry, 0, min(dbs, uint64(len(body))))
+	for range dbs {
+		data, err := decodeEntries(r, version)
+		if err != nil {
+			return snap, err
+		}
+		snap.Data = append(snap.Data, data)
+	}
+	if r.Len() != 0 {
+		return snap, fmt.Errorf("%w: %d trailing bytes", ErrCorrupted, r.Len())
+	}
+	return snap, nil
+}
+
+func decodeEntries(r *bytes.Reader, version uint16) (map[string]storage.Entry, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read entries count", ErrCorrupted)
+	}
+
+	data := make(map[string]storage.Entry, min(count, uint64(r.Len())))
+	for range count {
+		key, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var ent storage.Entry
+		if ent.Value, err = readValue(r, version); err != nil {
+			return nil, err
+		}
+		if version >= formatVersionV2 {
+			expireAt, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: read deadline", ErrCorrupted)
+			}
+			if expireAt != 0 {
+				ent.ExpireAt = time.Unix(0, expireAt)
+			}
+		}
+		data[key] = ent
+	}
+	return data, nil
+}
+
+func readValue(r *bytes.Reader, version uint16) (storage.Value, error) {
+	typ := storage.StringType
+	if version >= formatVersionV3 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: read value type", ErrCorrupted)
+		}
+		typ = storage.Type(b)
+	}
+
+	data, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	v, err := storage.UnmarshalValue(typ, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+	return v, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil || size > uint64(r.Len()) {
+		return "", fmt.Errorf("%w: read string", ErrCorrupted)
+	}
+	buf := make([]byte, size)
+	_, _ = r.Read(buf)
+	return string(buf), nil
+}
+
+// writeFile atomically writes the snapshot: the data goes to a temporary
+// file first which is renamed to the target path only after fsync.
+func writeFile(path string, snap Snapshot) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = encode(tmp, snap); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("sync temporary file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename temporary file: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func readFile(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("read file: %w", err)
+	}
+	return decode(data)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open directory: %w", err)
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("sync directory: %w", err)
+	}
+	return nil
+}
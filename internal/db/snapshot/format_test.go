@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	hash := storage.NewHash()
+	hash.Set("name", "John")
+	hash.Set("email", "")
+
+	want := Snapshot{
+		LSN: 42,
+		Data: []map[string]storage.Entry{
+			{
+				"key":      {Value: storage.String("value")},
+				"session":  {Value: storage.String("token"), ExpireAt: time.Unix(0, time.Now().UnixNano())},
+				"":         {Value: storage.String("")},
+				"multi\n":  {Value: storage.String("line\nvalue \x00")},
+				"counter1": {Value: storage.String("1")},
+				"user:1":   {Value: hash},
+			},
+			{},
+			{"key": {Value: storage.String("other database")}},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, encode(&buf, want))
+
+	got, err := decode(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, want.LSN, got.LSN)
+	require.Len(t, got.Data, len(want.Data))
+	for db, data := range want.Data {
+		require.Len(t, got.Data[db], len(data))
+		for key, ent := range data {
+			assert.Equal(t, ent.Value, got.Data[db][key].Value)
+			assert.True(t, ent.ExpireAt.Equal(got.Data[db][key].ExpireAt))
+		}
+	}
+}
+
+func TestDecode_versionV1(t *testing.T) {
+	body := []byte(magic)
+	body = binary.LittleEndian.AppendUint16(body, formatVersionV1)
+	body = binary.LittleEndian.AppendUint64(body, 7)
+	body = binary.AppendUvarint(body, 1)
+	body = binary.AppendUvarint(body, 3)
+	body = append(body, "key"...)
+	body = binary.AppendUvarint(body, 5)
+	body = append(body, "value"...)
+	data := binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+
+	got, err := decode(data)
+	require.NoError(t, err)
+	assert.Equal(t, Snapshot{LSN: 7, Data: []map[string]storage.Entry{{"key": {Value: storage.String("value")}}}}, got)
+}
+
+func TestDecode_corrupted(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, encode(&buf, Snapshot{LSN: 1, Data: []map[string]storage.Entry{{"key": {Value: storage.String("value")}}}}))
+	data := buf.Bytes()
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated", data: data[:len(data)-5]},
+		{name: "flipped byte", data: func() []byte {
+			cp := bytes.Clone(data)
+			cp[len(cp)-6] ^= 0xff
+			return cp
+		}()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decode(tc.data)
+			require.ErrorIs(t, err, ErrCorrupted)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+const (
+	fileNamePrefix = "snapshot-"
+	fileNameExt    = ".snap"
+)
+
+var ErrInProgress = errors.New("snapshot is already in progress")
+
+// Source provides a consistent view of the database for the snapshot.
+type Source interface {
+	// Checkpoint returns a copy of the data of the logical databases
+	// together with the LSN of the last WAL record applied to it.
+	Checkpoint() (lsn uint64, data []map[string]storage.Entry)
+	// Mutations returns the total number of mutations since startup.
+	Mutations() uint64
+}
+
+// Compactor removes WAL records which are already covered by snapshots.
+type Compactor interface {
+	Compact(lsn uint64) error
+}
+
+type Config struct {
+	dataDir            string
+	interval           time.Duration
+	mutationsThreshold uint64
+	retain             int
+}
+
+type Option func(c *Config)
+
+func WithDataDirectory(dir string) Option {
+	return func(c *Config) {
+		c.dataDir = dir
+	}
+}
+
+func WithInterval(d time.Duration) Option {
+	return func(c *Config) {
+		c.interval = d
+	}
+}
+
+func WithMutationsThreshold(n uint64) Option {
+	return func(c *Config) {
+		c.mutationsThreshold = n
+	}
+}
+
+func WithRetain(n int) Option {
+	return func(c *Config) {
+		c.retain = n
+	}
+}
+
+const (
+	defaultDataDir = "./data/snapshot"
+	defaultRetain  = 2
+	checkInterval  = time.Second
+)
+
+type Manager struct {
+	logger    *slog.Logger
+	conf      Config
+	source    Source
+	compactor Compactor
+
+	// saveMu serializes snapshot creation.
+	saveMu        sync.Mutex
+	lastSave      time.Time
+	lastMutations uint64
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+	once    sync.Once
+}
+
+func NewManager(logger *slog.Logger, source Source, compactor Compactor, opts ...Option) (*Manager, error) {
+	conf := Config{
+		dataDir: defaultDataDir,
+		retain:  defaultRetain,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if conf.retain < 1 {
+		conf.retain = 1
+	}
+
+	if err := os.MkdirAll(conf.dataDir, 0o750); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	return &Manager{
+		logger:    logger.With(slog.String("component", "snapshot")),
+		conf:      conf,
+		source:    source,
+		compactor: compactor,
+		lastSave:  time.Now(),
+		closeCh:   make(chan struct{}),
+	}, nil
+}
+
+// LoadLatest returns the newest snapshot which can be read successfully.
+// A zero snapshot is returned if there are no snapshots at all.
+func (m *Manager) LoadLatest() (Snapshot, error) {
+	paths, err := m.list()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		snap, err := readFile(paths[i])
+		if err != nil {
+			m.logger.Warn(
+				"skip invalid snapshot",
+				slog.String("path", paths[i]),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		m.logger.Info(
+			"Loaded snapshot",
+			slog.String("path", paths[i]),
+			slog.Uint64("lsn", snap.LSN),
+			slog.Int("keys", countKeys(snap.Data)),
+		)
+		return snap, nil
+	}
+	return Snapshot{}, nil
+}
+
+// Start runs the scheduler which triggers snapshots until Close is called.
+func (m *Manager) Start() {
+	if m.conf.interval == 0 && m.conf.mutationsThreshold == 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.schedule()
+	}()
+}
+
+func (m *Manager) schedule() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		if !m.shouldSave() {
+			continue
+		}
+		if err := m.Save(context.Background()); err != nil {
+			m.logger.Error("failed to save snapshot", slog.Any("error", err))
+		}
+	}
+}
+
+func (m *Manager) shouldSave() bool {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	changes := m.source.Mutations() - m.lastMutations
+	if changes == 0 {
+		return false
+	}
+	if m.conf.mutationsThreshold != 0 && changes >= m.conf.mutationsThreshold {
+		return true
+	}
+	return m.conf.interval != 0 && time.Since(m.lastSave) >= m.conf.interval
+}
+
+// Save synchronously takes the snapshot.
+func (m *Manager) Save(ctx context.Context) error {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.save()
+}
+
+// BackgroundSave takes the snapshot in a separate goroutine.
+func (m *Manager) BackgroundSave() error {
+	if !m.saveMu.TryLock() {
+		return ErrInProgress
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer func() {
+			m.saveMu.Unlock()
+			m.wg.Done()
+		}()
+
+		if err := m.save(); err != nil {
+			m.logger.Error("failed to save snapshot in background", slog.Any("error", err))
+		}
+	}()
+	return nil
+}
+
+func (m *Manager) save() error {
+	start := time.Now()
+	mutations := m.source.Mutations()
+	lsn, data := m.source.Checkpoint()
+
+	path := filepath.Join(m.conf.dataDir, fmt.Sprintf("%s%020d%s", fileNamePrefix, start.UnixNano(), fileNameExt))
+	if err := writeFile(path, Snapshot{LSN: lsn, Data: data}); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	m.lastSave = start
+	m.lastMutations = mutations
+	m.logger.Info(
+		"Saved snapshot",
+		slog.String("path", path),
+		slog.Uint64("lsn", lsn),
+		slog.Int("keys", countKeys(data)),
+		slog.Duration("duration", time.Since(start)),
+	)
+
+	return m.cleanup()
+}
+
+// cleanup removes old snapshots and WAL records covered by the oldest
+// retained snapshot, so it's still possible to fall back to it.
+func (m *Manager) cleanup() error {
+	paths, err := m.list()
+	if err != nil {
+		return err
+	}
+
+	if len(paths) > m.conf.retain {
+		for _, path := range paths[:len(paths)-m.conf.retain] {
+			if err = os.Remove(path); err != nil {
+				return fmt.Errorf("remove old snapshot: %w", err)
+			}
+		}
+		paths = paths[len(paths)-m.conf.retain:]
+	}
+
+	if m.compactor == nil {
+		return nil
+	}
+
+	oldest, err := readFile(paths[0])
+	if err != nil {
+		return fmt.Errorf("read oldest snapshot: %w", err)
+	}
+	if err = m.compactor.Compact(oldest.LSN); err != nil {
+		return fmt.Errorf("compact wal: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) list() ([]string, error) {
+	entries, err := os.ReadDir(m.conf.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("read directory %s: %w", m.conf.dataDir, err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, fileNamePrefix) || !strings.HasSuffix(name, fileNameExt) {
+			continue
+		}
+		paths = append(paths, filepath.Join(m.conf.dataDir, name))
+	}
+
+	// File names contain zero-padded timestamps, so the lexicographical
+	// order is the chronological one.
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// Close stops the scheduler, waits for the background snapshot
+// and takes the final one if there are unsaved changes.
+func (m *Manager) Close() error {
+	m.once.Do(func() {
+		close(m.closeCh)
+	})
+	m.wg.Wait()
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	if m.source.Mutations() == m.lastMutations {
+		return nil
+	}
+	return m.save()
+}
+
+func countKeys(data []map[string]storage.Entry) int {
+	var n int
+	for _, dbData := range data {
+		n += len(dbData)
+	}
+	return n
+}
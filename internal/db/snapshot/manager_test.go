@@ -0,0 +1,167 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+type fakeSource struct {
+	mu        sync.Mutex
+	lsn       uint64
+	data      map[string]storage.Entry
+	mutations atomic.Uint64
+}
+
+func (s *fakeSource) set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lsn++
+	s.data[key] = storage.Entry{Value: storage.String(value)}
+	s.mutations.Add(1)
+}
+
+func (s *fakeSource) Checkpoint() (uint64, []map[string]storage.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lsn, []map[string]storage.Entry{maps.Clone(s.data)}
+}
+
+func (s *fakeSource) Mutations() uint64 {
+	return s.mutations.Load()
+}
+
+type fakeCompactor struct {
+	lsn atomic.Uint64
+}
+
+func (c *fakeCompactor) Compact(lsn uint64) error {
+	c.lsn.Store(lsn)
+	return nil
+}
+
+func TestManager_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	source := &fakeSource{data: map[string]storage.Entry{}}
+	compactor := &fakeCompactor{}
+
+	m, err := NewManager(logger, source, compactor, WithDataDirectory(dir), WithRetain(2))
+	require.NoError(t, err)
+
+	snap, err := m.LoadLatest()
+	require.NoError(t, err)
+	assert.Equal(t, Snapshot{}, snap)
+
+	for i := range 3 {
+		source.set(fmt.Sprintf("key-%d", i), fmt.Sprintf("value %d\n", i))
+		require.NoError(t, m.Save(context.Background()))
+	}
+
+	paths, err := m.list()
+	require.NoError(t, err)
+	assert.Len(t, paths, 2)
+	assert.Equal(t, uint64(2), compactor.lsn.Load())
+
+	snap, err = m.LoadLatest()
+	require.NoError(t, err)
+	lsn, data := source.Checkpoint()
+	assert.Equal(t, Snapshot{LSN: lsn, Data: data}, snap)
+}
+
+func TestManager_LoadLatest_fallbackOnCorruption(t *testing.T) {
+	dir := t.TempDir()
+	source := &fakeSource{data: map[string]storage.Entry{}}
+
+	m, err := NewManager(logger, source, nil, WithDataDirectory(dir))
+	require.NoError(t, err)
+
+	source.set("key", "old")
+	require.NoError(t, m.Save(context.Background()))
+	source.set("key", "new")
+	require.NoError(t, m.Save(context.Background()))
+
+	paths, err := m.list()
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+
+	data, err := os.ReadFile(paths[1])
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(paths[1], data, 0o640))
+
+	snap, err := m.LoadLatest()
+	require.NoError(t, err)
+	assert.Equal(t, Snapshot{LSN: 1, Data: []map[string]storage.Entry{{"key": {Value: storage.String("old")}}}}, snap)
+}
+
+func TestManager_BackgroundSave(t *testing.T) {
+	source := &fakeSource{data: map[string]storage.Entry{"key": {Value: storage.String("value")}}}
+
+	m, err := NewManager(logger, source, nil, WithDataDirectory(t.TempDir()))
+	require.NoError(t, err)
+
+	m.saveMu.Lock()
+	require.ErrorIs(t, m.BackgroundSave(), ErrInProgress)
+	m.saveMu.Unlock()
+
+	require.NoError(t, m.BackgroundSave())
+	require.NoError(t, m.Close())
+
+	snap, err := m.LoadLatest()
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]storage.Entry{{"key": {Value: storage.String("value")}}}, snap.Data)
+}
+
+func TestManager_Start_mutationsThreshold(t *testing.T) {
+	source := &fakeSource{data: map[string]storage.Entry{}}
+
+	m, err := NewManager(logger, source, nil, WithDataDirectory(t.TempDir()), WithMutationsThreshold(2))
+	require.NoError(t, err)
+
+	m.Start()
+	defer m.Close()
+
+	source.set("k1", "v1")
+	source.set("k2", "v2")
+
+	require.Eventually(t, func() bool {
+		paths, err := m.list()
+		return err == nil && len(paths) == 1
+	}, 3*checkInterval, 50*time.Millisecond)
+}
+
+func TestManager_Close_savesUnsavedChanges(t *testing.T) {
+	dir := t.TempDir()
+	source := &fakeSource{data: map[string]storage.Entry{}}
+
+	m, err := NewManager(logger, source, nil, WithDataDirectory(dir))
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+
+	paths, err := m.list()
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+
+	m, err = NewManager(logger, source, nil, WithDataDirectory(dir))
+	require.NoError(t, err)
+	source.set("key", "value")
+	require.NoError(t, m.Close())
+
+	paths, err = m.list()
+	require.NoError(t, err)
+	assert.Len(t, paths, 1)
+}
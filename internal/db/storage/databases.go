@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// Databases are the numbered logical databases. Every database is the
+// storage engine of its own, so the keys of different databases never
+// collide and a database is flushed without touching the others.
+type Databases struct {
+	dbs []Backend
+}
+
+// OpenDatabases creates n databases on the storage engine registered by the
+// name, see New. The memory limit is shared by the databases, so the keys
+// of any of them may be evicted to make room for the others.
+func OpenDatabases(
+	logger *slog.Logger, name string, n int, decode func(v any) error, opts ...EngineOption,
+) (*Databases, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of databases: %d", n)
+	}
+
+	mem := newMemoryBudget(newEngineConfig(opts).maxMemory)
+	d := &Databases{dbs: make([]Backend, 0, n)}
+	for i := range n {
+		dbOpts := append(slices.Clone(opts), withMemoryBudget(mem), WithDatabase(i))
+		backend, err := New(logger, name, decode, dbOpts...)
+		if err != nil {
+			_ = d.Close()
+			return nil, fmt.Errorf("open database %d: %w", i, err)
+		}
+		d.dbs = append(d.dbs, backend)
+	}
+	return d, nil
+}
+
+func (d *Databases) Len() int {
+	return len(d.dbs)
+}
+
+// DB returns the database by its number.
+func (d *Databases) DB(i int) Backend {
+	return d.dbs[i]
+}
+
+// Durable reports whether the databases recover the data on their own,
+// see Durable.
+func (d *Databases) Durable() bool {
+	durable, ok := d.dbs[0].(Durable)
+	return ok && durable.Durable()
+}
+
+// Dump returns a copy of the data of every database by its number.
+func (d *Databases) Dump() []map[string]Entry {
+	data := make([]map[string]Entry, len(d.dbs))
+	for i, db := range d.dbs {
+		data[i] = db.Dump()
+	}
+	return data
+}
+
+// Snapshot captures the data of every database, see Backend.Snapshot.
+// The returned function copies the data by the database number.
+func (d *Databases) Snapshot() func() []map[string]Entry {
+	exports := make([]func() map[string]Entry, len(d.dbs))
+	for i, db := range d.dbs {
+		exports[i] = db.Snapshot()
+	}
+	return func() []map[string]Entry {
+		data := make([]map[string]Entry, len(exports))
+		for i, export := range exports {
+			data[i] = export()
+		}
+		return data
+	}
+}
+
+// Load replaces the data of every database, the databases missing in
+// the data are emptied and the data of the unknown ones is ignored.
+func (d *Databases) Load(data []map[string]Entry) {
+	for i, db := range d.dbs {
+		var dbData map[string]Entry
+		if i < len(data) {
+			dbData = data[i]
+		}
+		db.Load(dbData)
+	}
+}
+
+// Close closes all the databases.
+func (d *Databases) Close() error {
+	var errs []error
+	for _, db := range d.dbs {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
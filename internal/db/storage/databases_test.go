@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+func TestOpenDatabases(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	dbs, err := OpenDatabases(logger, InMemoryEngineName, 2, nil,
+		WithMaxMemory(1000),
+		WithEventListener(func(ev Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, fmt.Sprintf("%s %d %s", ev.Type, ev.DB, ev.Key))
+		}),
+	)
+	require.NoError(t, err)
+	defer dbs.Close()
+	require.Equal(t, 2, dbs.Len())
+
+	ctx := context.Background()
+	require.NoError(t, dbs.DB(0).Set(ctx, "key", "zero"))
+	require.NoError(t, dbs.DB(1).Set(ctx, "key", "one"))
+
+	for i, want := range []string{"zero", "one"} {
+		value, getErr := dbs.DB(i).Get(ctx, "key")
+		require.NoError(t, getErr)
+		assert.Equal(t, want, value)
+
+		stats, statsErr := dbs.DB(i).Stats(ctx)
+		require.NoError(t, statsErr)
+		// The memory is shared by the databases.
+		assert.Equal(t, int64(1000), stats.MaxMemory)
+		assert.Equal(t, int64(2*(len("key")+entryOverhead)+len("zero")+len("one")), stats.UsedMemory)
+	}
+
+	mu.Lock()
+	assert.Equal(t, []string{"set 0 key", "set 1 key"}, events)
+	mu.Unlock()
+}
+
+func TestOpenDatabases_sharedMemory(t *testing.T) {
+	policy, err := EvictionPolicyByName(AllKeysLRUPolicy)
+	require.NoError(t, err)
+
+	dbs, err := OpenDatabases(logger, InMemoryEngineName, 2, nil, WithMaxMemory(int64(2*keySize)), WithEvictionPolicy(policy))
+	require.NoError(t, err)
+	defer dbs.Close()
+
+	ctx := context.Background()
+	require.NoError(t, dbs.DB(0).Set(ctx, "key-0", "value"))
+	require.NoError(t, dbs.DB(1).Set(ctx, "key-1", "value"))
+	// The least recently used key of the other database is evicted.
+	require.NoError(t, dbs.DB(1).Set(ctx, "key-2", "value"))
+
+	_, err = dbs.DB(0).Get(ctx, "key-0")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+	for _, key := range []string{"key-1", "key-2"} {
+		_, err = dbs.DB(1).Get(ctx, key)
+		require.NoError(t, err)
+	}
+
+	stats, err := dbs.DB(0).Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{UsedMemory: int64(2 * keySize), MaxMemory: int64(2 * keySize), EvictedKeys: 1}, stats)
+}
+
+func TestOpenDatabases_invalid(t *testing.T) {
+	_, err := OpenDatabases(logger, InMemoryEngineName, 0, nil)
+	require.Error(t, err)
+
+	_, err = OpenDatabases(logger, "unknown", 2, nil)
+	require.Error(t, err)
+}
+
+func TestDatabases_DumpLoad(t *testing.T) {
+	dbs, err := OpenDatabases(logger, InMemoryEngineName, 3, nil)
+	require.NoError(t, err)
+	defer dbs.Close()
+
+	ctx := context.Background()
+	require.NoError(t, dbs.DB(0).Set(ctx, "a", "1"))
+	require.NoError(t, dbs.DB(2).Set(ctx, "b", "2"))
+
+	data := dbs.Dump()
+	require.Len(t, data, 3)
+	assert.Len(t, data[0], 1)
+	assert.Empty(t, data[1])
+	assert.Len(t, data[2], 1)
+
+	require.NoError(t, dbs.DB(1).Set(ctx, "c", "3"))
+	// The databases missing in the data are emptied.
+	dbs.Load(data[:2])
+
+	_, err = dbs.DB(0).Get(ctx, "a")
+	require.NoError(t, err)
+	for i, key := range []string{"c", "b"} {
+		_, err = dbs.DB(i+1).Get(ctx, key)
+		require.ErrorIs(t, err, dberrors.ErrNotFound)
+	}
+}
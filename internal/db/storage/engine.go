@@ -1,46 +1,185 @@
 package storage
 
 import (
-	"context"
-	"sync"
-
-	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
 )
 
-type Engine struct {
-	mu   sync.RWMutex
-	data map[string]string
+type Entry struct {
+	Value    Value
+	ExpireAt time.Time
+}
+
+// entryOverhead approximates the memory used by the map bucket slot,
+// the entry header and the bookkeeping for the key besides its content.
+const entryOverhead = 96
+
+type entry struct {
+	value Value
+	// expireAt is unix time in nanoseconds, zero means the key never expires.
+	expireAt int64
+
+	// lastAccess and frequency are updated under the read lock
+	// by lookups, so they are atomic.
+	lastAccess atomic.Int64
+	frequency  atomic.Uint32
+}
+
+func newEntry(value Value, expireAt, now int64) *entry {
+	ent := &entry{value: value, expireAt: expireAt}
+	ent.lastAccess.Store(now)
+	ent.frequency.Store(lfuInitValue)
+	return ent
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+func (e *entry) touch(now int64) {
+	last := e.lastAccess.Swap(now)
+	freq := lfuDecay(uint8(e.frequency.Load()), time.Duration(now-last)) //nolint:gosec // frequency fits in uint8
+	e.frequency.Store(uint32(lfuIncrement(freq)))
+}
+
+func entrySize(key string, ent *entry) int64 {
+	return int64(len(key)+entryOverhead) + ent.value.Size()
 }
 
-func NewEngine() *Engine {
-	return &Engine{
-		data: make(map[string]string),
+type Stats struct {
+	Keys        int
+	UsedMemory  int64
+	MaxMemory   int64
+	EvictedKeys uint64
+	ExpiredKeys uint64
+}
+
+type EngineConfig struct {
+	expirationInterval   time.Duration
+	expirationSampleSize int
+	maxMemory            int64
+	evictionPolicy       EvictionPolicy
+	evictionSampleSize   int
+	eventListener        EventListener
+	database             int
+	// memory is shared by the engines of the databases, see OpenDatabases.
+	memory *memoryBudget
+}
+
+type EngineOption func(c *EngineConfig)
+
+// WithExpirationInterval sets how often the expired keys are reclaimed,
+// the non-positive interval leaves the default one.
+func WithExpirationInterval(d time.Duration) EngineOption {
+	return func(c *EngineConfig) {
+		if d > 0 {
+			c.expirationInterval = d
+		}
 	}
 }
 
-func (e *Engine) Set(_ context.Context, key, value string) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+func WithExpirationSampleSize(n int) EngineOption {
+	return func(c *EngineConfig) {
+		c.expirationSampleSize = n
+	}
+}
 
-	e.data[key] = value
-	return nil
+func WithMaxMemory(n int64) EngineOption {
+	return func(c *EngineConfig) {
+		c.maxMemory = n
+	}
 }
 
-func (e *Engine) Get(_ context.Context, key string) (string, error) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+func WithEvictionPolicy(p EvictionPolicy) EngineOption {
+	return func(c *EngineConfig) {
+		c.evictionPolicy = p
+	}
+}
 
-	value, ok := e.data[key]
-	if !ok {
-		return "", dberrors.ErrNotFound
+func WithEvictionSampleSize(n int) EngineOption {
+	return func(c *EngineConfig) {
+		c.evictionSampleSize = n
 	}
-	return value, nil
 }
 
-func (e *Engine) Del(_ context.Context, key string) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+// WithDatabase sets the number of the logical database the engine stores,
+// see OpenDatabases.
+func WithDatabase(db int) EngineOption {
+	return func(c *EngineConfig) {
+		c.database = db
+	}
+}
 
-	delete(e.data, key)
-	return nil
+// withMemoryBudget makes the engine share the memory limit with the other ones.
+func withMemoryBudget(b *memoryBudget) EngineOption {
+	return func(c *EngineConfig) {
+		c.memory = b
+	}
+}
+
+// DatabaseOf returns the number of the logical database set by the options.
+func DatabaseOf(opts ...EngineOption) int {
+	return newEngineConfig(opts).database
+}
+
+// MaxMemoryOf returns the memory limit set by the options, zero means no limit.
+func MaxMemoryOf(opts ...EngineOption) int64 {
+	return newEngineConfig(opts).maxMemory
+}
+
+// EventListenerOf returns the listener set by the options, if any.
+func EventListenerOf(opts ...EngineOption) EventListener {
+	return newEngineConfig(opts).eventListener
+}
+
+const (
+	defaultExpirationInterval   = 100 * time.Millisecond
+	defaultExpirationSampleSize = 20
+	defaultEvictionSampleSize   = 5
+)
+
+const InMemoryEngineName = "in_memory"
+
+func init() {
+	Register(InMemoryEngineName, func(_ *slog.Logger, _ func(v any) error, opts ...EngineOption) (Backend, error) {
+		return NewEngine(opts...), nil
+	})
+}
+
+// Engine keeps all the keys in the single map guarded by the single lock.
+type Engine struct {
+	*keyspace
+}
+
+func NewEngine(opts ...EngineOption) *Engine {
+	return &Engine{keyspace: newKeyspace(newEngineConfig(opts), 1, false)}
+}
+
+func newEngineConfig(opts []EngineOption) EngineConfig {
+	conf := EngineConfig{
+		expirationInterval:   defaultExpirationInterval,
+		expirationSampleSize: defaultExpirationSampleSize,
+		evictionPolicy:       evictionPolicies[NoEvictionPolicy],
+		evictionSampleSize:   defaultEvictionSampleSize,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return conf
+}
+
+func (e *entry) export() Entry {
+	ent := Entry{Value: e.value.Clone()}
+	if e.expireAt != 0 {
+		ent.ExpireAt = time.Unix(0, e.expireAt)
+	}
+	return ent
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
 }
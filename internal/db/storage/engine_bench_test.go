@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+type benchEngine interface {
+	Set(ctx context.Context, key, value string) error
+	Get(ctx context.Context, key string) (string, error)
+	io.Closer
+}
+
+// BenchmarkEngines compares the single lock engine with the sharded one
+// under different read/write ratios. Run it with several GOMAXPROCS values:
+//
+//	go test -run=^$ -bench=Engines -cpu=1,2,4,8 ./internal/db/storage
+func BenchmarkEngines(b *testing.B) {
+	const numKeys = 10000
+
+	engines := []struct {
+		name string
+		new  func() benchEngine
+	}{
+		{name: "single", new: func() benchEngine { return NewEngine() }},
+		{name: "sharded-16", new: func() benchEngine { return NewShardedEngine(16) }},
+		{name: "sharded-64", new: func() benchEngine { return NewShardedEngine(64) }},
+	}
+	readPercents := []int{0, 50, 90, 99}
+
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	for _, engine := range engines {
+		for _, readPercent := range readPercents {
+			b.Run(fmt.Sprintf("%s/reads=%d%%", engine.name, readPercent), func(b *testing.B) {
+				e := engine.new()
+				defer e.Close()
+
+				ctx := context.Background()
+				for _, key := range keys {
+					if err := e.Set(ctx, key, "value"); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rnd := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())) //nolint:gosec // ignore
+					for pb.Next() {
+						key := keys[rnd.IntN(numKeys)]
+						if rnd.IntN(100) < readPercent {
+							_, _ = e.Get(ctx, key)
+						} else {
+							_ = e.Set(ctx, key, "value")
+						}
+					}
+				})
+			})
+		}
+	}
+}
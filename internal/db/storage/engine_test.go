@@ -0,0 +1,541 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+func TestEngine_SetGetDel(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	ctx := context.Background()
+
+	_, err := e.Get(ctx, "key")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+	require.NoError(t, e.Set(ctx, "key", "value"))
+	value, err := e.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	require.NoError(t, e.Del(ctx, "key"))
+	_, err = e.Get(ctx, "key")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+}
+
+func TestEngine_lazyExpiration(t *testing.T) {
+	e := NewEngine(WithExpirationInterval(time.Hour))
+	defer e.Close()
+
+	now := time.Now()
+	e.setNow(func() time.Time { return now })
+
+	ctx := context.Background()
+	require.NoError(t, e.SetWithExpiration(ctx, "key", "value", now.Add(time.Second)))
+
+	expireAt, err := e.ExpireTime(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, expireAt.Equal(now.Add(time.Second)))
+
+	now = now.Add(time.Second)
+
+	_, err = e.Get(ctx, "key")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+	_, err = e.ExpireTime(ctx, "key")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+	ok, err := e.Expire(ctx, "key", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok, "expired key must not be revived")
+}
+
+func TestEngine_ExpirePersist(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	ctx := context.Background()
+
+	ok, err := e.Expire(ctx, "missing", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, e.Set(ctx, "key", "value"))
+
+	ok, err = e.Persist(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, ok, "key without deadline")
+
+	expireAt := time.Now().Add(time.Hour)
+	ok, err = e.Expire(ctx, "key", expireAt)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = e.Persist(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	gotExpireAt, err := e.ExpireTime(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, gotExpireAt.IsZero())
+
+	require.NoError(t, e.Set(ctx, "key", "value"))
+	_, err = e.Expire(ctx, "key", expireAt)
+	require.NoError(t, err)
+	require.NoError(t, e.Set(ctx, "key", "new value"))
+	gotExpireAt, err = e.ExpireTime(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, gotExpireAt.IsZero(), "SET must reset the deadline")
+
+	ok, err = e.Expire(ctx, "key", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = e.Get(ctx, "key")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+}
+
+func TestEngine_activeExpiration(t *testing.T) {
+	e := NewEngine(WithExpirationInterval(time.Millisecond), WithExpirationSampleSize(5))
+	defer e.Close()
+
+	ctx := context.Background()
+	expireAt := time.Now().Add(20 * time.Millisecond)
+	for i := range 100 {
+		require.NoError(t, e.SetWithExpiration(ctx, fmt.Sprintf("key-%d", i), "value", expireAt))
+	}
+	require.NoError(t, e.Set(ctx, "persistent", "value"))
+
+	require.Eventually(t, func() bool {
+		s := e.shards[0]
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return len(s.data) == 1 && len(s.expires) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestWithExpirationInterval_invalid(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		e := NewEngine(WithExpirationInterval(d))
+		assert.Equal(t, defaultExpirationInterval, e.conf.expirationInterval)
+		require.NoError(t, e.Close())
+	}
+}
+
+func TestEngine_DumpLoad(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	ctx := context.Background()
+	expireAt := time.Now().Add(time.Hour)
+	require.NoError(t, e.Set(ctx, "k1", "v1"))
+	require.NoError(t, e.SetWithExpiration(ctx, "k2", "v2", expireAt))
+
+	data := e.Dump()
+	assert.Equal(t, map[string]Entry{
+		"k1": {Value: String("v1")},
+		"k2": {Value: String("v2"), ExpireAt: time.Unix(0, expireAt.UnixNano())},
+	}, data)
+
+	restored := NewEngine()
+	defer restored.Close()
+
+	restored.Load(data)
+	assert.Equal(t, data, restored.Dump())
+
+	gotExpireAt, err := restored.ExpireTime(ctx, "k2")
+	require.NoError(t, err)
+	assert.True(t, gotExpireAt.Equal(expireAt))
+}
+
+func (k *keyspace) setNow(now func() time.Time) {
+	for _, s := range k.shards {
+		s.mu.Lock()
+		s.now = now
+		s.mu.Unlock()
+	}
+}
+
+func TestEngine_Atomic(t *testing.T) {
+	ctx := context.Background()
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			require.NoError(t, e.Set(ctx, "a", "1"))
+			err := e.Atomic(ctx, func(tx Tx) error {
+				value, err := tx.Get(ctx, "a")
+				if err != nil {
+					return err
+				}
+				if err = tx.Set(ctx, "b", value); err != nil {
+					return err
+				}
+				return tx.Del(ctx, "a")
+			})
+			require.NoError(t, err)
+
+			_, err = e.Get(ctx, "a")
+			require.ErrorIs(t, err, dberrors.ErrNotFound)
+			value, err := e.Get(ctx, "b")
+			require.NoError(t, err)
+			assert.Equal(t, "1", value)
+		})
+	}
+}
+
+func TestEngine_Atomic_rollback(t *testing.T) {
+	ctx := context.Background()
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			require.NoError(t, e.Set(ctx, "a", "1"))
+			require.NoError(t, e.Mutate(ctx, "list", func(Value) (Value, error) {
+				l := NewList()
+				l.PushRight("x")
+				return l, nil
+			}))
+
+			err := e.Atomic(ctx, func(tx Tx) error {
+				if err := tx.Set(ctx, "b", "2"); err != nil {
+					return err
+				}
+				if err := tx.Del(ctx, "a"); err != nil {
+					return err
+				}
+				if err := tx.Mutate(ctx, "list", func(current Value) (Value, error) {
+					current.(*List).PushRight("y")
+					return current, nil
+				}); err != nil {
+					return err
+				}
+				return errTest
+			})
+			require.ErrorIs(t, err, errTest)
+
+			value, err := e.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, "1", value)
+			_, err = e.Get(ctx, "b")
+			require.ErrorIs(t, err, dberrors.ErrNotFound)
+			require.NoError(t, e.View(ctx, "list", func(current Value) error {
+				assert.Equal(t, []string{"x"}, current.(*List).Range(0, -1))
+				return nil
+			}))
+		})
+	}
+}
+
+func TestEngine_batch(t *testing.T) {
+	ctx := context.Background()
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			require.NoError(t, e.MSet(ctx, []KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "a", Value: "3"}}))
+
+			values, err := e.MGet(ctx, []string{"a", "b", "c"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"a": "3", "b": "2"}, values)
+
+			n, err := e.MDel(ctx, []string{"a", "c", "a"})
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			values, err = e.MGet(ctx, []string{"a", "b"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"b": "2"}, values)
+		})
+	}
+}
+
+func TestEngine_MSet_outOfMemory(t *testing.T) {
+	ctx := context.Background()
+
+	e := NewShardedEngine(4, WithMaxMemory(4096))
+	defer e.Close()
+
+	require.NoError(t, e.Set(ctx, "a", "1"))
+	pairs := []KeyValue{{Key: "a", Value: "2"}, {Key: "b", Value: "2"}, {Key: "c", Value: strings.Repeat("x", 4096)}}
+	require.ErrorIs(t, e.MSet(ctx, pairs), dberrors.ErrOutOfMemory)
+
+	// The pairs stored before the failed one are rolled back.
+	values, err := e.MGet(ctx, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, values)
+}
+
+func TestEngine_Update(t *testing.T) {
+	ctx := context.Background()
+
+	incr := func(value string, exists bool) (string, error) {
+		n := 0
+		if exists {
+			var err error
+			if n, err = strconv.Atoi(value); err != nil {
+				return "", err
+			}
+		}
+		return strconv.Itoa(n + 1), nil
+	}
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			const workers, increments = 8, 100
+
+			var wg sync.WaitGroup
+			for range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range increments {
+						_, err := e.Update(ctx, "counter", incr)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			value, err := e.Get(ctx, "counter")
+			require.NoError(t, err)
+			assert.Equal(t, strconv.Itoa(workers*increments), value)
+
+			// The deadline is kept and nothing is changed if fn fails.
+			expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+			require.NoError(t, e.SetWithExpiration(ctx, "key", "1", expireAt))
+			value, err = e.Update(ctx, "key", incr)
+			require.NoError(t, err)
+			assert.Equal(t, "2", value)
+
+			require.NoError(t, e.Set(ctx, "other", "abc"))
+			_, err = e.Update(ctx, "other", incr)
+			require.ErrorIs(t, err, strconv.ErrSyntax)
+
+			got, err := e.ExpireTime(ctx, "key")
+			require.NoError(t, err)
+			assert.True(t, got.Equal(expireAt))
+			value, err = e.Get(ctx, "other")
+			require.NoError(t, err)
+			assert.Equal(t, "abc", value)
+		})
+	}
+}
+
+func TestEngine_SetIf(t *testing.T) {
+	ctx := context.Background()
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			res, err := e.SetIf(ctx, "key", "1", time.Time{}, IfExists)
+			require.NoError(t, err)
+			assert.Equal(t, SetResult{}, res)
+
+			res, err = e.SetIf(ctx, "key", "1", time.Time{}, IfNotExists)
+			require.NoError(t, err)
+			assert.Equal(t, SetResult{Written: true}, res)
+
+			res, err = e.SetIf(ctx, "key", "2", time.Time{}, IfNotExists)
+			require.NoError(t, err)
+			assert.Equal(t, SetResult{Old: "1", Existed: true}, res)
+
+			res, err = e.SetIf(ctx, "key", "3", time.Time{}, IfEquals("2"))
+			require.NoError(t, err)
+			assert.Equal(t, SetResult{Old: "1", Existed: true}, res)
+
+			expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+			res, err = e.SetIf(ctx, "key", "3", expireAt, IfEquals("1"))
+			require.NoError(t, err)
+			assert.Equal(t, SetResult{Old: "1", Existed: true, Written: true}, res)
+
+			got, err := e.ExpireTime(ctx, "key")
+			require.NoError(t, err)
+			assert.True(t, got.Equal(expireAt))
+
+			value, err := e.GetDel(ctx, "key")
+			require.NoError(t, err)
+			assert.Equal(t, "3", value)
+			_, err = e.GetDel(ctx, "key")
+			require.ErrorIs(t, err, dberrors.ErrNotFound)
+		})
+	}
+}
+
+func TestEngine_Mutate(t *testing.T) {
+	ctx := context.Background()
+
+	hset := func(field, value string) MutateFunc {
+		return func(v Value) (Value, error) {
+			hash, ok := v.(*Hash)
+			if v == nil {
+				hash, ok = NewHash(), true
+			}
+			if !ok {
+				return nil, dberrors.ErrWrongType
+			}
+			hash.Set(field, value)
+			return hash, nil
+		}
+	}
+	fields := func(e Backend, key string) map[string]string {
+		t.Helper()
+
+		got := make(map[string]string)
+		require.NoError(t, e.View(ctx, key, func(v Value) error {
+			if v == nil {
+				return dberrors.ErrNotFound
+			}
+			hash := v.(*Hash)
+			for _, field := range hash.Fields() {
+				got[field], _ = hash.Get(field)
+			}
+			return nil
+		}))
+		return got
+	}
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+			require.NoError(t, e.Mutate(ctx, "hash", hset("a", "1")))
+			_, err := e.Expire(ctx, "hash", expireAt)
+			require.NoError(t, err)
+			require.NoError(t, e.Mutate(ctx, "hash", hset("b", "2")))
+			assert.Equal(t, map[string]string{"a": "1", "b": "2"}, fields(e, "hash"))
+
+			// The deadline is kept and the hash isn't readable as a string.
+			got, err := e.ExpireTime(ctx, "hash")
+			require.NoError(t, err)
+			assert.True(t, got.Equal(expireAt))
+			_, err = e.Get(ctx, "hash")
+			require.ErrorIs(t, err, dberrors.ErrWrongType)
+			_, err = e.Update(ctx, "hash", func(string, bool) (string, error) { return "", nil })
+			require.ErrorIs(t, err, dberrors.ErrWrongType)
+
+			require.NoError(t, e.Set(ctx, "str", "value"))
+			require.ErrorIs(t, e.Mutate(ctx, "str", hset("a", "1")), dberrors.ErrWrongType)
+
+			require.NoError(t, e.MView(ctx, []string{"hash", "missing", "str"}, func(vs []Value) error {
+				require.Len(t, vs, 3)
+				assert.Equal(t, HashType, vs[0].Type())
+				assert.Nil(t, vs[1])
+				assert.Equal(t, String("value"), vs[2])
+				return nil
+			}))
+
+			// Nil value removes the key.
+			require.NoError(t, e.Mutate(ctx, "hash", func(Value) (Value, error) { return nil, nil }))
+			_, err = e.ExpireTime(ctx, "hash")
+			require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+			require.NoError(t, e.Mutate(ctx, "hash", hset("c", "3")))
+			e.Load(e.Dump())
+			assert.Equal(t, map[string]string{"c": "3"}, fields(e, "hash"))
+
+			stats, err := e.Stats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 2, stats.Keys)
+		})
+	}
+}
+
+func TestEngine_events(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	p, err := EvictionPolicyByName(AllKeysLRUPolicy)
+	require.NoError(t, err)
+
+	e := NewEngine(
+		WithExpirationInterval(time.Hour),
+		WithMaxMemory(int64(2*(len("key-0")+len("value")+entryOverhead))),
+		WithEvictionPolicy(p),
+		WithEventListener(func(ev Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, string(ev.Type)+" "+ev.Key)
+		}),
+	)
+	defer e.Close()
+
+	now := time.Now()
+	e.setNow(func() time.Time { return now })
+
+	ctx := context.Background()
+	require.NoError(t, e.Set(ctx, "key-0", "value"))
+	require.NoError(t, e.Del(ctx, "key-0"))
+	require.NoError(t, e.Del(ctx, "key-0"))
+	require.NoError(t, e.SetWithExpiration(ctx, "key-1", "value", now.Add(time.Second)))
+	_, err = e.Persist(ctx, "key-1")
+	require.NoError(t, err)
+	_, err = e.Expire(ctx, "key-1", now.Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, e.Mutate(ctx, "key-2", func(Value) (Value, error) { return String("value"), nil }))
+
+	now = now.Add(time.Second)
+	e.shards[0].expireSample()
+
+	// key-2 was accessed earlier than key-3, so it's the victim.
+	require.NoError(t, e.Set(ctx, "key-3", "value"))
+	require.NoError(t, e.Set(ctx, "key-4", "value"))
+
+	_, err = e.GetDel(ctx, "key-4")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"set key-0",
+		"del key-0",
+		"set key-1",
+		"persist key-1",
+		"expire key-1",
+		"set key-2",
+		"expired key-1",
+		"set key-3",
+		"evicted key-2",
+		"set key-4",
+		"del key-4",
+	}, events)
+}
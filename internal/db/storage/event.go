@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"time"
+)
+
+// EventType is the kind of the change made to the key.
+type EventType string
+
+const (
+	// EventSet is emitted when the value of the key is written or changed.
+	EventSet EventType = "set"
+	// EventDel is emitted when the key is removed by the client.
+	EventDel     EventType = "del"
+	EventExpire  EventType = "expire"
+	EventPersist EventType = "persist"
+	// EventExpired is emitted when the key is reclaimed after its deadline.
+	EventExpired EventType = "expired"
+	// EventEvicted is emitted when the key is removed to free memory.
+	EventEvicted EventType = "evicted"
+)
+
+// Event describes the change of the key.
+type Event struct {
+	Type EventType
+	// DB is the number of the logical database of the key.
+	DB   int
+	Key  string
+	Time time.Time
+}
+
+// EventListener is called by the engine for every change of the keys.
+// It's called while the key is locked, so the events of the same key are
+// observed in order, and must not block.
+type EventListener func(ev Event)
+
+func WithEventListener(l EventListener) EngineOption {
+	return func(c *EngineConfig) {
+		c.eventListener = l
+	}
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	NoEvictionPolicy     = "noeviction"
+	AllKeysLRUPolicy     = "allkeys-lru"
+	AllKeysLFUPolicy     = "allkeys-lfu"
+	AllKeysRandomPolicy  = "allkeys-random"
+	VolatileLRUPolicy    = "volatile-lru"
+	VolatileLFUPolicy    = "volatile-lfu"
+	VolatileRandomPolicy = "volatile-random"
+	VolatileTTLPolicy    = "volatile-ttl"
+)
+
+type EvictionCandidate struct {
+	Key        string
+	LastAccess time.Time
+	Frequency  uint8
+	ExpireAt   time.Time
+}
+
+// EvictionPolicy chooses the key to evict from a random sample of keys
+// when the memory limit is reached.
+type EvictionPolicy interface {
+	// Volatile reports whether the sample must be taken only
+	// from the keys having a deadline.
+	Volatile() bool
+	// Victim returns the index of the candidate to evict
+	// or -1 if none of them can be evicted.
+	Victim(candidates []EvictionCandidate) int
+}
+
+type EvictionPolicyFunc func(candidates []EvictionCandidate) int
+
+type evictionPolicy struct {
+	volatile bool
+	victim   EvictionPolicyFunc
+}
+
+func NewEvictionPolicy(volatile bool, fn EvictionPolicyFunc) EvictionPolicy {
+	return evictionPolicy{volatile: volatile, victim: fn}
+}
+
+func (p evictionPolicy) Volatile() bool {
+	return p.volatile
+}
+
+func (p evictionPolicy) Victim(candidates []EvictionCandidate) int {
+	return p.victim(candidates)
+}
+
+var evictionPolicies = map[string]EvictionPolicy{
+	NoEvictionPolicy:     NewEvictionPolicy(false, noVictim),
+	AllKeysLRUPolicy:     NewEvictionPolicy(false, lruVictim),
+	AllKeysLFUPolicy:     NewEvictionPolicy(false, lfuVictim),
+	AllKeysRandomPolicy:  NewEvictionPolicy(false, randomVictim),
+	VolatileLRUPolicy:    NewEvictionPolicy(true, lruVictim),
+	VolatileLFUPolicy:    NewEvictionPolicy(true, lfuVictim),
+	VolatileRandomPolicy: NewEvictionPolicy(true, randomVictim),
+	VolatileTTLPolicy:    NewEvictionPolicy(true, ttlVictim),
+}
+
+func EvictionPolicyByName(name string) (EvictionPolicy, error) {
+	p, ok := evictionPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported eviction policy: %s", name)
+	}
+	return p, nil
+}
+
+func noVictim([]EvictionCandidate) int {
+	return -1
+}
+
+func randomVictim(candidates []EvictionCandidate) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+	return rand.IntN(len(candidates)) //nolint:gosec // weak random is enough here
+}
+
+func lruVictim(candidates []EvictionCandidate) int {
+	return minCandidate(candidates, func(a, b EvictionCandidate) bool {
+		return a.LastAccess.Before(b.LastAccess)
+	})
+}
+
+func lfuVictim(candidates []EvictionCandidate) int {
+	return minCandidate(candidates, func(a, b EvictionCandidate) bool {
+		if a.Frequency != b.Frequency {
+			return a.Frequency < b.Frequency
+		}
+		return a.LastAccess.Before(b.LastAccess)
+	})
+}
+
+func ttlVictim(candidates []EvictionCandidate) int {
+	return minCandidate(candidates, func(a, b EvictionCandidate) bool {
+		return a.ExpireAt.Before(b.ExpireAt)
+	})
+}
+
+func minCandidate(candidates []EvictionCandidate, less func(a, b EvictionCandidate) bool) int {
+	idx := -1
+	for i := range candidates {
+		if idx == -1 || less(candidates[i], candidates[idx]) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// The access frequency is kept in a logarithmic 8 bit counter the same way
+// as Redis does: the more the counter is, the less the probability to
+// increment it. The counter is decremented by one for every minute the key
+// hasn't been accessed, so keys which were popular long ago can be evicted.
+const (
+	lfuInitValue   = 5
+	lfuLogFactor   = 10
+	lfuDecayPeriod = time.Minute
+)
+
+func lfuIncrement(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(max(int(counter)-lfuInitValue, 0))
+	if rand.Float64() < 1/(base*lfuLogFactor+1) { //nolint:gosec // weak random is enough here
+		counter++
+	}
+	return counter
+}
+
+func lfuDecay(counter uint8, idle time.Duration) uint8 {
+	periods := idle / lfuDecayPeriod
+	if periods >= time.Duration(counter) {
+		return 0
+	}
+	return counter - uint8(periods) //nolint:gosec // periods is less than counter
+}
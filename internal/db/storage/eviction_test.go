@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+// keySize is the accounted size of the keys used in the tests below.
+const keySize = len("key-0") + len("value") + entryOverhead
+
+func newLimitedEngine(t *testing.T, policy string, keys int) *Engine {
+	t.Helper()
+
+	p, err := EvictionPolicyByName(policy)
+	require.NoError(t, err)
+
+	e := NewEngine(
+		WithMaxMemory(int64(keys*keySize)),
+		WithEvictionPolicy(p),
+		// Sample all keys to make the tests deterministic.
+		WithEvictionSampleSize(keys),
+	)
+	t.Cleanup(func() { _ = e.Close() })
+	return e
+}
+
+func TestEngine_noEviction(t *testing.T) {
+	e := newLimitedEngine(t, NoEvictionPolicy, 2)
+	ctx := context.Background()
+
+	require.NoError(t, e.Set(ctx, "key-0", "value"))
+	require.NoError(t, e.Set(ctx, "key-1", "value"))
+	require.ErrorIs(t, e.Set(ctx, "key-2", "value"), dberrors.ErrOutOfMemory)
+
+	// Overwriting with the value of the same size doesn't need more memory.
+	require.NoError(t, e.Set(ctx, "key-1", "other"))
+	require.ErrorIs(t, e.Set(ctx, "key-1", "longer value"), dberrors.ErrOutOfMemory)
+
+	require.NoError(t, e.Del(ctx, "key-0"))
+	require.NoError(t, e.Set(ctx, "key-2", "value"))
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Keys: 2, UsedMemory: int64(2 * keySize), MaxMemory: int64(2 * keySize)}, stats)
+}
+
+func TestEngine_evictionPolicies(t *testing.T) {
+	testCases := []struct {
+		name        string
+		policy      string
+		setup       func(t *testing.T, e *Engine)
+		wantEvicted string
+	}{
+		{
+			name:   "allkeys-lru",
+			policy: AllKeysLRUPolicy,
+			setup: func(t *testing.T, e *Engine) {
+				now := time.Now()
+				for i := range 3 {
+					e.setNow(func() time.Time { return now.Add(time.Duration(i) * time.Second) })
+					require.NoError(t, e.Set(context.Background(), fmt.Sprintf("key-%d", i), "value"))
+				}
+				e.setNow(func() time.Time { return now.Add(time.Hour) })
+				_, err := e.Get(context.Background(), "key-0")
+				require.NoError(t, err)
+			},
+			wantEvicted: "key-1",
+		},
+		{
+			name:   "allkeys-lfu",
+			policy: AllKeysLFUPolicy,
+			setup: func(t *testing.T, e *Engine) {
+				for i := range 3 {
+					require.NoError(t, e.Set(context.Background(), fmt.Sprintf("key-%d", i), "value"))
+				}
+				for _, key := range []string{"key-0", "key-2"} {
+					ent := e.shards[0].data[key]
+					ent.frequency.Store(100)
+				}
+			},
+			wantEvicted: "key-1",
+		},
+		{
+			name:   "volatile-ttl",
+			policy: VolatileTTLPolicy,
+			setup: func(t *testing.T, e *Engine) {
+				ctx := context.Background()
+				require.NoError(t, e.Set(ctx, "key-0", "value"))
+				require.NoError(t, e.SetWithExpiration(ctx, "key-1", "value", time.Now().Add(time.Hour)))
+				require.NoError(t, e.SetWithExpiration(ctx, "key-2", "value", time.Now().Add(time.Minute)))
+			},
+			wantEvicted: "key-2",
+		},
+		{
+			name:   "volatile-random",
+			policy: VolatileRandomPolicy,
+			setup: func(t *testing.T, e *Engine) {
+				ctx := context.Background()
+				require.NoError(t, e.Set(ctx, "key-0", "value"))
+				require.NoError(t, e.Set(ctx, "key-1", "value"))
+				require.NoError(t, e.SetWithExpiration(ctx, "key-2", "value", time.Now().Add(time.Hour)))
+			},
+			wantEvicted: "key-2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newLimitedEngine(t, tc.policy, 3)
+			tc.setup(t, e)
+
+			ctx := context.Background()
+			require.NoError(t, e.Set(ctx, "key-3", "value"))
+
+			_, err := e.Get(ctx, tc.wantEvicted)
+			require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+			stats, err := e.Stats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 3, stats.Keys)
+			assert.Equal(t, uint64(1), stats.EvictedKeys)
+		})
+	}
+}
+
+func TestEngine_allKeysRandomEviction(t *testing.T) {
+	e := newLimitedEngine(t, AllKeysRandomPolicy, 10)
+	ctx := context.Background()
+
+	for i := range 100 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key-%d", i%10), "value"))
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("new-%d", i%10), "value"))
+	}
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, stats.UsedMemory, stats.MaxMemory)
+	assert.Positive(t, stats.EvictedKeys)
+}
+
+func TestEngine_evictionValueTooLarge(t *testing.T) {
+	e := newLimitedEngine(t, AllKeysLRUPolicy, 2)
+	ctx := context.Background()
+
+	require.NoError(t, e.Set(ctx, "key-0", "value"))
+	require.ErrorIs(t, e.Set(ctx, "key-1", strings.Repeat("v", 3*keySize)), dberrors.ErrOutOfMemory)
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Keys, "nothing is evicted if the value can't fit anyway")
+}
+
+func TestEvictionPolicyByName(t *testing.T) {
+	_, err := EvictionPolicyByName("unknown")
+	require.Error(t, err)
+}
+
+func TestLFUCounter(t *testing.T) {
+	var counter uint8 = lfuInitValue
+	for range 1000 {
+		counter = lfuIncrement(counter)
+	}
+	assert.Greater(t, counter, uint8(lfuInitValue))
+	assert.Less(t, counter, uint8(255), "counter must grow logarithmically")
+
+	assert.Equal(t, counter-2, lfuDecay(counter, 2*lfuDecayPeriod))
+	assert.Equal(t, uint8(0), lfuDecay(counter, time.Duration(counter)*lfuDecayPeriod))
+}
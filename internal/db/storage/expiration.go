@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"time"
+)
+
+// expirationLoop periodically reclaims expired keys using the same
+// approach as Redis: it checks a random sample of keys with a deadline
+// and repeats immediately if more than a quarter of them were expired.
+func (k *keyspace) expirationLoop() {
+	defer close(k.doneCh)
+
+	ticker := time.NewTicker(k.conf.expirationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		for _, s := range k.shards {
+			for s.expireSample() > k.conf.expirationSampleSize/4 {
+				select {
+				case <-k.closeCh:
+					return
+				default:
+				}
+			}
+		}
+	}
+}
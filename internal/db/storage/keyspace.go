@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"context"
+	"hash/maphash"
+	"slices"
+	"sync"
+	"time"
+)
+
+// keyspace distributes keys among the shards and implements
+// the storage interface on top of them.
+type keyspace struct {
+	conf   EngineConfig
+	seed   maphash.Seed
+	shards []*shard
+	mem    *memoryBudget
+
+	// snapMu is held from taking the snapshot until it's exported.
+	snapMu sync.Mutex
+
+	closeCh chan struct{}
+	doneCh  chan struct{}
+	once    sync.Once
+}
+
+// newKeyspace creates the keyspace. Ordered shards additionally
+// keep the keys sorted to serve range queries.
+func newKeyspace(conf EngineConfig, numShards int, ordered bool) *keyspace {
+	numShards = max(numShards, 1)
+
+	mem := conf.memory
+	if mem == nil {
+		mem = newMemoryBudget(conf.maxMemory)
+	}
+	k := &keyspace{
+		conf:    conf,
+		mem:     mem,
+		seed:    maphash.MakeSeed(),
+		shards:  make([]*shard, numShards),
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	for i := range k.shards {
+		k.shards[i] = newShard(&k.conf, mem)
+		if ordered {
+			k.shards[i].index = newSkipList()
+		}
+	}
+	mem.register(k.shards...)
+
+	go k.expirationLoop()
+	return k
+}
+
+func (k *keyspace) shardFor(key string) *shard {
+	return k.shards[k.shardIndex(key)]
+}
+
+func (k *keyspace) shardIndex(key string) int {
+	if len(k.shards) == 1 {
+		return 0
+	}
+	return int(maphash.String(k.seed, key) % uint64(len(k.shards))) //nolint:gosec // the index fits in int
+}
+
+// lockShards locks the shards of the keys in the index order, so the batches
+// don't deadlock each other, and returns the function unlocking them.
+func (k *keyspace) lockShards(keys []string, exclusive bool) func() {
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		indexes[i] = k.shardIndex(key)
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	for _, i := range indexes {
+		if exclusive {
+			k.shards[i].mu.Lock()
+		} else {
+			k.shards[i].mu.RLock()
+		}
+	}
+	return func() {
+		for _, i := range indexes {
+			if exclusive {
+				k.shards[i].mu.Unlock()
+			} else {
+				k.shards[i].mu.RUnlock()
+			}
+		}
+	}
+}
+
+func (k *keyspace) Set(_ context.Context, key, value string) error {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(key, value)
+}
+
+func (k *keyspace) SetWithExpiration(_ context.Context, key, value string, expireAt time.Time) error {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setWithExpiration(key, value, expireAt)
+}
+
+func (k *keyspace) Get(_ context.Context, key string) (string, error) {
+	s := k.shardFor(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.get(key)
+}
+
+func (k *keyspace) Del(_ context.Context, key string) error {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.del(key)
+	return nil
+}
+
+// SetIf checks the condition and stores the value under the shard lock.
+func (k *keyspace) SetIf(_ context.Context, key, value string, expireAt time.Time, cond Condition) (SetResult, error) {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setIf(key, value, expireAt, cond)
+}
+
+func (k *keyspace) GetDel(_ context.Context, key string) (string, error) {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getDel(key)
+}
+
+// View calls fn with the value of the key under the shard read lock.
+func (k *keyspace) View(_ context.Context, key string, fn ViewFunc) error {
+	s := k.shardFor(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.view(key, fn)
+}
+
+func (k *keyspace) MView(_ context.Context, keys []string, fn MViewFunc) error {
+	defer k.lockShards(keys, false)()
+
+	return k.mview(keys, fn)
+}
+
+// Mutate calls fn and stores the value it returns under the shard lock.
+func (k *keyspace) Mutate(_ context.Context, key string, fn MutateFunc) error {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.mutate(key, fn)
+}
+
+// Update calls fn and stores the value it returns under the shard lock.
+func (k *keyspace) Update(_ context.Context, key string, fn UpdateFunc) (string, error) {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(key, fn)
+}
+
+// MSet stores the pairs under the single lock acquisition of their shards.
+func (k *keyspace) MSet(_ context.Context, pairs []KeyValue) error {
+	keys := make([]string, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.Key
+	}
+	defer k.lockShards(keys, true)()
+
+	return k.mset(pairs)
+}
+
+func (k *keyspace) MGet(_ context.Context, keys []string) (map[string]string, error) {
+	defer k.lockShards(keys, false)()
+
+	return k.mget(keys), nil
+}
+
+func (k *keyspace) MDel(_ context.Context, keys []string) (int, error) {
+	defer k.lockShards(keys, true)()
+
+	return k.mdel(keys), nil
+}
+
+// mview calls fn with the values of the keys while their shards are locked.
+func (k *keyspace) mview(keys []string, fn MViewFunc) error {
+	vs := make([]Value, len(keys))
+	for i, key := range keys {
+		if ent, ok := k.shardFor(key).lookup(key); ok {
+			vs[i] = ent.value
+		}
+	}
+	return fn(vs)
+}
+
+// mset stores the pairs while their shards are locked. If a pair doesn't fit
+// into memory, the keys stored before it get their previous values back,
+// but the keys evicted to make room for them are lost. The restored keys
+// are reported as changed once again.
+func (k *keyspace) mset(pairs []KeyValue) error {
+	olds := make([]*entry, 0, len(pairs))
+	for i, p := range pairs {
+		s := k.shardFor(p.Key)
+		old := s.data[p.Key]
+		if err := s.set(p.Key, p.Value); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				prev := k.shardFor(pairs[j].Key)
+				prev.restore(pairs[j].Key, olds[j])
+				if olds[j] == nil {
+					prev.emit(EventDel, pairs[j].Key)
+				} else {
+					prev.emit(EventSet, pairs[j].Key)
+				}
+			}
+			return err
+		}
+		olds = append(olds, old)
+	}
+	return nil
+}
+
+// mget returns the values of the existing keys, the keys of other types are skipped.
+func (k *keyspace) mget(keys []string) map[string]string {
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if value, err := k.shardFor(key).get(key); err == nil {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (k *keyspace) mdel(keys []string) int {
+	var n int
+	for _, key := range keys {
+		s := k.shardFor(key)
+		if _, ok := s.lookup(key); ok {
+			n++
+		}
+		s.del(key)
+	}
+	return n
+}
+
+// Expire sets the deadline of the key. The key is removed immediately
+// if the deadline is in the past. It returns false if the key doesn't exist.
+func (k *keyspace) Expire(_ context.Context, key string, expireAt time.Time) (bool, error) {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.expire(key, expireAt), nil
+}
+
+// Persist removes the deadline of the key. It returns false
+// if the key doesn't exist or doesn't have a deadline.
+func (k *keyspace) Persist(_ context.Context, key string) (bool, error) {
+	s := k.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.persist(key), nil
+}
+
+// ExpireTime returns the deadline of the key, zero time means the key
+// never expires. dberrors.ErrNotFound is returned if the key doesn't exist.
+func (k *keyspace) ExpireTime(_ context.Context, key string) (time.Time, error) {
+	s := k.shardFor(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.expireTime(key)
+}
+
+func (k *keyspace) Stats(_ context.Context) (Stats, error) {
+	stats := make([]Stats, len(k.shards))
+	for i, s := range k.shards {
+		s.mu.RLock()
+		stats[i] = s.stats()
+		s.mu.RUnlock()
+	}
+	return k.totalStats(stats), nil
+}
+
+// totalStats sums the stats of the shards. The memory is reported
+// for the whole budget, which may be shared with the other databases.
+func (k *keyspace) totalStats(stats []Stats) Stats {
+	var total Stats
+	for _, stats := range stats {
+		total.Keys += stats.Keys
+		total.EvictedKeys += stats.EvictedKeys
+		total.ExpiredKeys += stats.ExpiredKeys
+	}
+	total.UsedMemory = k.mem.used.Load()
+	total.MaxMemory = k.mem.max
+	return total
+}
+
+// Atomic calls fn with the exclusive access to all the shards,
+// so the operations made through tx are applied atomically.
+// The keys changed through tx are restored if fn fails.
+func (k *keyspace) Atomic(_ context.Context, fn func(tx Tx) error) error {
+	k.lockAll()
+	defer k.unlockAll()
+
+	tx := newTxn(k)
+	if err := fn(&tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	return nil
+}
+
+func (k *keyspace) lockAll() {
+	for _, s := range k.shards {
+		s.mu.Lock()
+	}
+}
+
+func (k *keyspace) unlockAll() {
+	for _, s := range k.shards {
+		s.mu.Unlock()
+	}
+}
+
+// Dump returns a copy of all stored data.
+func (k *keyspace) Dump() map[string]Entry {
+	data := make(map[string]Entry)
+	for _, s := range k.shards {
+		s.dump(data)
+	}
+	return data
+}
+
+// Load replaces all stored data with the given one.
+func (k *keyspace) Load(data map[string]Entry) {
+	for _, s := range k.shards {
+		s.reset()
+	}
+	for key, ent := range data {
+		k.shardFor(key).load(key, ent)
+	}
+}
+
+// Close stops the background expiration.
+func (k *keyspace) Close() error {
+	k.once.Do(func() {
+		close(k.closeCh)
+	})
+	<-k.doneCh
+	return nil
+}
@@ -0,0 +1,63 @@
+package lsm
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+const (
+	minBloomHashes = 1
+	maxBloomHashes = 30
+)
+
+// bloomFilter is a set of bits followed by a byte holding the number of
+// hash functions. It uses double hashing to derive them from a single hash.
+type bloomFilter []byte
+
+func newBloomFilter(hashes []uint32, bitsPerKey int) bloomFilter {
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	k = min(max(k, minBloomHashes), maxBloomHashes)
+
+	nbits := max(len(hashes)*bitsPerKey, 64) //nolint:mnd // too small filters have a high false positive rate
+	nbytes := (nbits + 7) / 8                //nolint:mnd // bits in byte
+	nbits = nbytes * 8                       //nolint:mnd // bits in byte
+
+	filter := make(bloomFilter, nbytes+1)
+	filter[nbytes] = byte(k)
+	for _, h := range hashes {
+		delta := h>>17 | h<<15
+		for range k {
+			pos := h % uint32(nbits) //nolint:gosec // nbits fits in uint32
+			filter[pos/8] |= 1 << (pos % 8)
+			h += delta
+		}
+	}
+	return filter
+}
+
+// mayContain reports whether the key may be in the set.
+// False positives are possible, false negatives are not.
+func (f bloomFilter) mayContain(key string) bool {
+	if len(f) < 2 { //nolint:mnd // at least one byte of bits and the number of hashes
+		return true
+	}
+
+	nbits := uint32(len(f)-1) * 8 //nolint:gosec,mnd // bits in byte
+	k := f[len(f)-1]
+	h := bloomHash(key)
+	delta := h>>17 | h<<15
+	for range k {
+		pos := h % nbits
+		if f[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
+func bloomHash(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,160 @@
+package lsm
+
+import (
+	"log/slog"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+// compact merges the tables until there is nothing to compact.
+func (e *Engine) compact() error {
+	for {
+		select {
+		case <-e.closeCh:
+			return nil
+		default:
+		}
+
+		done, err := e.compactOnce()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// compactOnce merges the run of adjacent tables of similar size
+// (size-tiered compaction). It reports whether there was nothing to merge.
+func (e *Engine) compactOnce() (bool, error) {
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
+
+	// Only the compaction removes tables and new ones are appended
+	// to the end, so the picked run keeps its position.
+	e.mu.Lock()
+	tables := slices.Clone(e.tables)
+	start, end, ok := pickCompaction(tables, e.conf.compactionThreshold, e.conf.memtableSize)
+	if !ok {
+		e.mu.Unlock()
+		return true, nil
+	}
+	num := e.allocFileNum()
+	e.mu.Unlock()
+
+	begin := time.Now()
+	run := tables[start:end]
+	its := make([]iterator, 0, len(run))
+	for i := len(run) - 1; i >= 0; i-- {
+		its = append(its, run[i].iterator())
+	}
+
+	it := &compactionIterator{
+		it:     newMergeIterator(its),
+		now:    e.now().UnixNano(),
+		bottom: start == 0,
+	}
+	it.skip()
+
+	t, err := writeTable(e.conf.dataDir, num, it, e.conf.blockSize, e.conf.bloomBitsPerKey)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	merged := slices.Clone(e.tables[:start])
+	if t != nil {
+		merged = append(merged, t)
+	}
+	merged = append(merged, e.tables[end:]...)
+
+	m := e.manifest
+	m.Tables = make([]uint64, 0, len(merged))
+	for _, mt := range merged {
+		m.Tables = append(m.Tables, mt.num)
+	}
+	if err = writeManifest(e.conf.dataDir, m); err != nil {
+		e.mu.Unlock()
+		if t != nil {
+			t.obsolete.Store(true)
+			_ = t.unref()
+		}
+		return false, err
+	}
+	e.manifest = m
+	e.tables = merged
+	e.mu.Unlock()
+
+	for _, old := range run {
+		old.obsolete.Store(true)
+		if err = old.unref(); err != nil {
+			e.logger.Error("failed to release table", slog.Any("error", err))
+		}
+	}
+
+	e.logger.Debug(
+		"Compacted tables",
+		slog.Int("tables", len(run)),
+		slog.Uint64("table", num),
+		slog.Duration("duration", time.Since(begin)),
+	)
+	return false, nil
+}
+
+// pickCompaction returns the bounds of the first run of at least threshold
+// adjacent tables belonging to the same size tier. Tiers grow by the factor
+// of four starting from the memtable size.
+func pickCompaction(tables []*table, threshold int, base int64) (start, end int, ok bool) {
+	tier := func(t *table) int {
+		return bits.Len64(uint64(t.size/max(base, 1))) / 2 //nolint:gosec,mnd // size is not negative, log4
+	}
+
+	for start = 0; start < len(tables); start = end {
+		end = start + 1
+		for end < len(tables) && tier(tables[end]) == tier(tables[start]) {
+			end++
+		}
+		if end-start >= threshold {
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// compactionIterator drops the records which are not needed anymore.
+// Deleted and expired keys are dropped only if the output is the bottom
+// table, otherwise they could resurrect the older records of the same key.
+type compactionIterator struct {
+	it     iterator
+	now    int64
+	bottom bool
+}
+
+func (c *compactionIterator) valid() bool {
+	return c.it.valid()
+}
+
+func (c *compactionIterator) key() string {
+	return c.it.key()
+}
+
+func (c *compactionIterator) record() record {
+	if rec := c.it.record(); rec.live(c.now) {
+		return rec
+	}
+	return record{tombstone: true}
+}
+
+func (c *compactionIterator) next() {
+	c.it.next()
+	c.skip()
+}
+
+func (c *compactionIterator) err() error {
+	return c.it.err()
+}
+
+func (c *compactionIterator) skip() {
+	for c.bottom && c.it.valid() && !c.it.record().live(c.now) {
+		c.it.next()
+	}
+}
@@ -0,0 +1,145 @@
+package lsm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/db/wal"
+)
+
+const crashDirEnv = "MEMDB_LSM_CRASH_DIR"
+
+// TestCrashWriter is run in the child process by TestEngine_crash. It writes
+// keys in the endless loop and reports every acknowledged write to stdout.
+func TestCrashWriter(t *testing.T) {
+	dir := os.Getenv(crashDirEnv)
+	if dir == "" {
+		t.Skip("it's run by TestEngine_crash only")
+	}
+
+	e, err := Open(logger, crashOptions(dir)...)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	start := crashStartIndex(t, e)
+	for i := start; ; i++ {
+		if err = e.Set(ctx, crashKey(i), crashValue(i)); err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 0 {
+			if err = e.Del(ctx, crashKey(i-1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fmt.Printf("acked %d\n", i) //nolint:forbidigo // the parent process reads it
+	}
+}
+
+// TestEngine_crash kills the writing process several times and checks
+// that all the acknowledged writes survive the restart.
+func TestEngine_crash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip crash test in short mode")
+	}
+
+	dir := t.TempDir()
+	lastAcked := -1
+	for round := range 5 {
+		acked := runCrashWriter(t, dir, 200+round*300)
+		require.Greater(t, acked, lastAcked)
+		lastAcked = acked
+
+		e, err := Open(logger, crashOptions(dir)...)
+		require.NoError(t, err)
+		verifyCrashData(t, e, lastAcked)
+		require.NoError(t, e.Close())
+	}
+}
+
+func runCrashWriter(t *testing.T, dir string, killAfter int) int {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashWriter$", "-test.v") //nolint:gosec // it's the test binary
+	cmd.Env = append(os.Environ(), crashDirEnv+"="+dir)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	acked, count := -1, 0
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), "acked ")
+		if !ok {
+			continue
+		}
+		if acked, err = strconv.Atoi(line); err != nil {
+			t.Fatal(err)
+		}
+		if count++; count == killAfter {
+			require.NoError(t, cmd.Process.Signal(syscall.SIGKILL))
+			break
+		}
+	}
+	_ = cmd.Wait()
+	require.Positive(t, count, "writer hasn't acknowledged anything")
+	return acked
+}
+
+func verifyCrashData(t *testing.T, e *Engine, lastAcked int) {
+	t.Helper()
+
+	ctx := context.Background()
+	for i := range lastAcked + 1 {
+		value, err := e.Get(ctx, crashKey(i))
+		// Every key before the multiple of three is deleted right after it.
+		if (i+1)%3 == 0 && i+1 <= lastAcked {
+			assert.Error(t, err, crashKey(i))
+			continue
+		}
+		if assert.NoError(t, err, crashKey(i)) {
+			assert.Equal(t, crashValue(i), value)
+		}
+	}
+}
+
+// crashStartIndex returns the index of the last key written before the crash.
+// It's written again, since the crash could happen before deleting the previous key.
+func crashStartIndex(t *testing.T, e *Engine) int {
+	t.Helper()
+
+	start := 0
+	for key := range e.Dump() {
+		i, err := strconv.Atoi(strings.TrimPrefix(key, "key-"))
+		require.NoError(t, err)
+		start = max(start, i)
+	}
+	return start
+}
+
+func crashOptions(dir string) []Option {
+	return []Option{
+		WithDataDirectory(dir),
+		WithMemtableSize(2 << 10),
+		WithBlockSize(256),
+		WithCompactionThreshold(2),
+		WithFlushMode(wal.SyncFlushMode),
+	}
+}
+
+func crashKey(i int) string {
+	return fmt.Sprintf("key-%06d", i)
+}
+
+func crashValue(i int) string {
+	return strings.Repeat(strconv.Itoa(i), 4)
+}
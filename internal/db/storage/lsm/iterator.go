@@ -0,0 +1,107 @@
+package lsm
+
+import (
+	"container/heap"
+)
+
+// iterator walks over the records in ascending key order.
+type iterator interface {
+	valid() bool
+	key() string
+	record() record
+	next()
+	err() error
+}
+
+// mergeIterator merges several iterators. If the same key is present in
+// many of them, the record from the iterator going first wins, so the
+// iterators must be ordered from the newest data to the oldest one.
+type mergeIterator struct {
+	heap    iteratorHeap
+	curKey  string
+	curRec  record
+	isValid bool
+	curErr  error
+}
+
+func newMergeIterator(its []iterator) *mergeIterator {
+	m := &mergeIterator{}
+	for i, it := range its {
+		if it.valid() {
+			m.heap = append(m.heap, heapItem{it: it, priority: i})
+		} else if err := it.err(); err != nil {
+			m.curErr = err
+		}
+	}
+	heap.Init(&m.heap)
+	m.next()
+	return m
+}
+
+func (m *mergeIterator) valid() bool {
+	return m.isValid && m.curErr == nil
+}
+
+func (m *mergeIterator) key() string {
+	return m.curKey
+}
+
+func (m *mergeIterator) record() record {
+	return m.curRec
+}
+
+func (m *mergeIterator) err() error {
+	return m.curErr
+}
+
+func (m *mergeIterator) next() {
+	if len(m.heap) == 0 {
+		m.isValid = false
+		return
+	}
+
+	top := m.heap[0].it
+	m.curKey, m.curRec, m.isValid = top.key(), top.record(), true
+
+	// Skip the shadowed records of the same key in the older iterators.
+	for len(m.heap) != 0 && m.heap[0].it.key() == m.curKey {
+		it := m.heap[0].it
+		it.next()
+		if it.valid() {
+			heap.Fix(&m.heap, 0)
+			continue
+		}
+		if err := it.err(); err != nil {
+			m.curErr = err
+		}
+		heap.Pop(&m.heap)
+	}
+}
+
+type heapItem struct {
+	it       iterator
+	priority int
+}
+
+type iteratorHeap []heapItem
+
+func (h iteratorHeap) Len() int { return len(h) }
+
+func (h iteratorHeap) Less(i, j int) bool {
+	ki, kj := h[i].it.key(), h[j].it.key()
+	if ki != kj {
+		return ki < kj
+	}
+	return h[i].priority < h[j].priority
+}
+
+func (h iteratorHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *iteratorHeap) Push(x any) { *h = append(*h, x.(heapItem)) } //nolint:forcetypeassert // always heapItem
+
+func (h *iteratorHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,1013 @@
+// Package lsm implements the disk-backed storage engine based on
+// the log-structured merge tree. Writes go to the WAL and the in-memory
+// memtable, which is flushed to an immutable sorted table file when it's
+// full. Tables of similar size are merged in background.
+package lsm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/db/wal"
+)
+
+const EngineName = "lsm"
+
+// The disk-backed engine has no memory limit, so it fails if max_memory is set,
+// and it reclaims the expired keys lazily, so it reports no expired events.
+// The logical databases other than 0 are kept in the subdirectories.
+func init() {
+	storage.Register(EngineName, func(
+		logger *slog.Logger, decode func(v any) error, opts ...storage.EngineOption,
+	) (storage.Backend, error) {
+		if storage.MaxMemoryOf(opts...) != 0 {
+			return nil, ErrMaxMemory
+		}
+
+		var conf FileConfig
+		if err := decode(&conf); err != nil {
+			return nil, err
+		}
+		db := storage.DatabaseOf(opts...)
+		if db != 0 {
+			conf.DataDirectory = filepath.Join(cmp.Or(conf.DataDirectory, defaultDataDir), "db"+strconv.Itoa(db))
+		}
+
+		engineOpts := append(conf.Options(), WithDatabase(db))
+		if l := storage.EventListenerOf(opts...); l != nil {
+			engineOpts = append(engineOpts, WithEventListener(l))
+		}
+		return Open(logger, engineOpts...)
+	})
+}
+
+var (
+	ErrClosed    = errors.New("engine is closed")
+	ErrMaxMemory = errors.New("max_memory is not supported by the lsm engine")
+)
+
+// FileConfig is the lsm sub-section of the engine configuration.
+// Zero values are replaced with the defaults.
+type FileConfig struct {
+	DataDirectory       string `yaml:"data_directory"`
+	MemtableSize        int64  `yaml:"memtable_size"`
+	BlockSize           int    `yaml:"block_size"`
+	BloomBitsPerKey     int    `yaml:"bloom_bits_per_key"`
+	CompactionThreshold int    `yaml:"compaction_threshold"`
+	FlushMode           string `yaml:"flush_mode"`
+}
+
+func (c FileConfig) Options() []Option {
+	var opts []Option
+	if c.DataDirectory != "" {
+		opts = append(opts, WithDataDirectory(c.DataDirectory))
+	}
+	if c.MemtableSize != 0 {
+		opts = append(opts, WithMemtableSize(c.MemtableSize))
+	}
+	if c.BlockSize != 0 {
+		opts = append(opts, WithBlockSize(c.BlockSize))
+	}
+	if c.BloomBitsPerKey != 0 {
+		opts = append(opts, WithBloomBitsPerKey(c.BloomBitsPerKey))
+	}
+	if c.CompactionThreshold != 0 {
+		opts = append(opts, WithCompactionThreshold(c.CompactionThreshold))
+	}
+	if c.FlushMode != "" {
+		opts = append(opts, WithFlushMode(c.FlushMode))
+	}
+	return opts
+}
+
+type Config struct {
+	dataDir             string
+	memtableSize        int64
+	blockSize           int
+	bloomBitsPerKey     int
+	compactionThreshold int
+	flushMode           string
+	eventListener       storage.EventListener
+	database            int
+}
+
+type Option func(c *Config)
+
+func WithDataDirectory(dir string) Option {
+	return func(c *Config) {
+		c.dataDir = dir
+	}
+}
+
+// WithMemtableSize sets the size of the memtable in bytes
+// after which it's flushed to the table file.
+func WithMemtableSize(n int64) Option {
+	return func(c *Config) {
+		c.memtableSize = n
+	}
+}
+
+func WithBlockSize(n int) Option {
+	return func(c *Config) {
+		c.blockSize = n
+	}
+}
+
+func WithBloomBitsPerKey(n int) Option {
+	return func(c *Config) {
+		c.bloomBitsPerKey = n
+	}
+}
+
+// WithCompactionThreshold sets the number of tables of similar size
+// which are merged together.
+func WithCompactionThreshold(n int) Option {
+	return func(c *Config) {
+		c.compactionThreshold = n
+	}
+}
+
+// WithFlushMode sets the WAL flush mode, see wal.WithFlushMode.
+func WithFlushMode(mode string) Option {
+	return func(c *Config) {
+		c.flushMode = mode
+	}
+}
+
+// WithEventListener makes the engine report the changes of the keys,
+// see storage.EventListener.
+func WithEventListener(l storage.EventListener) Option {
+	return func(c *Config) {
+		c.eventListener = l
+	}
+}
+
+// WithDatabase sets the number of the logical database reported by the events.
+func WithDatabase(db int) Option {
+	return func(c *Config) {
+		c.database = db
+	}
+}
+
+const (
+	defaultDataDir             = "./data/lsm"
+	defaultMemtableSize        = 4 << 20
+	defaultBlockSize           = 4 << 10
+	defaultBloomBitsPerKey     = 10
+	defaultCompactionThreshold = 4
+	defaultFlushMode           = wal.BatchFlushMode
+
+	walDirName = "wal"
+)
+
+const (
+	putOp = iota + 1
+	deleteOp
+	// batchOp contains several put and delete operations applied atomically.
+	batchOp
+	// typedPutOp stores the value of other types than strings.
+	typedPutOp
+)
+
+type Engine struct {
+	logger *slog.Logger
+	conf   Config
+	now    func() time.Time
+	wal    *wal.WAL
+
+	mu sync.RWMutex
+	// flushed is signaled when the immutable memtable is flushed.
+	flushed  *sync.Cond
+	mem      *memtable
+	imm      *memtable
+	immLSN   uint64
+	tables   []*table
+	manifest manifest
+	bgErr    error
+	closed   bool
+
+	// compactMu prevents the tables from being replaced
+	// by Load in the middle of the compaction.
+	compactMu sync.Mutex
+
+	workCh    chan struct{}
+	closeCh   chan struct{}
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func Open(logger *slog.Logger, opts ...Option) (*Engine, error) {
+	conf := Config{
+		dataDir:             defaultDataDir,
+		memtableSize:        defaultMemtableSize,
+		blockSize:           defaultBlockSize,
+		bloomBitsPerKey:     defaultBloomBitsPerKey,
+		compactionThreshold: defaultCompactionThreshold,
+		flushMode:           defaultFlushMode,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	conf.compactionThreshold = max(conf.compactionThreshold, 2) //nolint:mnd // at least two tables are merged
+
+	if err := os.MkdirAll(conf.dataDir, 0o750); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	e := &Engine{
+		logger:  logger.With(slog.String("component", "lsm")),
+		conf:    conf,
+		now:     time.Now,
+		mem:     newMemtable(),
+		workCh:  make(chan struct{}, 1),
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	e.flushed = sync.NewCond(&e.mu)
+
+	if err := e.recover(); err != nil {
+		e.releaseTables()
+		return nil, err
+	}
+
+	go e.backgroundLoop()
+	e.scheduleWork()
+	return e, nil
+}
+
+// recover opens the tables listed in the manifest, removes the files left
+// by interrupted flushes and compactions and replays the WAL to the memtable.
+func (e *Engine) recover() error {
+	m, err := readManifest(e.conf.dataDir)
+	if err != nil {
+		return err
+	}
+	e.manifest = m
+
+	live := make(map[string]struct{}, len(m.Tables))
+	for _, num := range m.Tables {
+		t, err := openTable(e.conf.dataDir, num)
+		if err != nil {
+			return err
+		}
+		e.tables = append(e.tables, t)
+		live[filepath.Base(t.path)] = struct{}{}
+	}
+
+	entries, err := os.ReadDir(e.conf.dataDir)
+	if err != nil {
+		return fmt.Errorf("read data directory: %w", err)
+	}
+	for _, ent := range entries {
+		name := ent.Name()
+		if _, ok := live[name]; ok || !(strings.HasSuffix(name, tableFileExt) || strings.HasSuffix(name, ".tmp")) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(e.conf.dataDir, name)); err != nil {
+			return fmt.Errorf("remove stale file: %w", err)
+		}
+	}
+
+	e.wal, err = wal.Open(
+		e.logger,
+		wal.WithDataDirectory(filepath.Join(e.conf.dataDir, walDirName)),
+		wal.WithFlushMode(e.conf.flushMode),
+	)
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	e.wal.AdvanceLSN(m.FlushedLSN)
+
+	var count int
+	err = e.wal.Replay(m.FlushedLSN, func(walRec wal.Record) error {
+		writes, decodeErr := decodeWALRecord(walRec)
+		if decodeErr != nil {
+			return decodeErr
+		}
+		for _, w := range writes {
+			e.mem.put(w.key, w.rec)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		_ = e.wal.Close()
+		return fmt.Errorf("replay wal: %w", err)
+	}
+
+	e.logger.Info(
+		"Opened storage",
+		slog.Int("tables", len(e.tables)),
+		slog.Int("wal_records", count),
+	)
+	return nil
+}
+
+type write struct {
+	key string
+	rec record
+}
+
+func encodeWALRecord(key string, rec record) (int, []string) {
+	if rec.tombstone {
+		return deleteOp, []string{key}
+	}
+	if rec.typ != storage.StringType {
+		return typedPutOp, []string{key, strconv.Itoa(int(rec.typ)), rec.value, strconv.FormatInt(rec.expireAt, 10)}
+	}
+	return putOp, []string{key, rec.value, strconv.FormatInt(rec.expireAt, 10)}
+}
+
+// encodeWALBatch encodes the writes as the sequence of operations, each of
+// them is the operation code followed by its arguments.
+func encodeWALBatch(writes []write) (int, []string) {
+	var args []string
+	for _, w := range writes {
+		op, opArgs := encodeWALRecord(w.key, w.rec)
+		args = append(args, strconv.Itoa(op))
+		args = append(args, opArgs...)
+	}
+	return batchOp, args
+}
+
+func decodeWALRecord(rec wal.Record) ([]write, error) {
+	if rec.CommandID != batchOp {
+		w, n, err := decodeWALOp(rec.CommandID, rec.Args)
+		if err != nil || n != len(rec.Args) {
+			return nil, fmt.Errorf("%w: bad wal record %d", ErrCorrupted, rec.LSN)
+		}
+		return []write{w}, nil
+	}
+
+	var writes []write
+	for args := rec.Args; len(args) != 0; {
+		op, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad wal record %d", ErrCorrupted, rec.LSN)
+		}
+
+		w, n, err := decodeWALOp(op, args[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad wal record %d", ErrCorrupted, rec.LSN)
+		}
+		writes = append(writes, w)
+		args = args[1+n:]
+	}
+	return writes, nil
+}
+
+var errBadOp = errors.New("bad operation")
+
+// decodeWALOp decodes the operation from the beginning of args
+// and returns the number of consumed arguments.
+func decodeWALOp(op int, args []string) (write, int, error) {
+	switch {
+	case op == deleteOp && len(args) >= 1:
+		return write{key: args[0], rec: record{tombstone: true}}, 1, nil
+	case op == putOp && len(args) >= 3: //nolint:mnd // key, value and expiration time
+		expireAt, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return write{}, 0, errBadOp
+		}
+		return write{key: args[0], rec: record{value: args[1], expireAt: expireAt}}, 3, nil //nolint:mnd // see above
+	case op == typedPutOp && len(args) >= 4: //nolint:mnd // key, type, value and expiration time
+		typ, err := strconv.ParseUint(args[1], 10, 8)
+		if err != nil {
+			return write{}, 0, errBadOp
+		}
+		expireAt, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return write{}, 0, errBadOp
+		}
+		rec := record{value: args[2], typ: storage.Type(typ), expireAt: expireAt}
+		return write{key: args[0], rec: rec}, 4, nil //nolint:mnd // see above
+	default:
+		return write{}, 0, errBadOp
+	}
+}
+
+func (e *Engine) Set(ctx context.Context, key, value string) error {
+	return e.write(ctx, key, record{value: value})
+}
+
+func (e *Engine) SetWithExpiration(ctx context.Context, key, value string, expireAt time.Time) error {
+	if !expireAt.After(e.now()) {
+		return e.Del(ctx, key)
+	}
+	return e.write(ctx, key, record{value: value, expireAt: expireAt.UnixNano()})
+}
+
+func (e *Engine) Get(_ context.Context, key string) (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rec, err := e.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	return rec.stringValue()
+}
+
+// Del writes the tombstone of the live key only.
+func (e *Engine) Del(ctx context.Context, key string) error {
+	_, err := e.update(ctx, key, storage.EventDel, func(record) (record, bool) {
+		return record{tombstone: true}, true
+	})
+	return err
+}
+
+// SetIf checks the condition and stores the value under the engine lock.
+func (e *Engine) SetIf(
+	ctx context.Context, key, value string, expireAt time.Time, cond storage.Condition,
+) (storage.SetResult, error) {
+	var res storage.SetResult
+	err := e.Atomic(ctx, func(tx storage.Tx) error {
+		var err error
+		res, err = tx.SetIf(ctx, key, value, expireAt, cond)
+		return err
+	})
+	return res, err
+}
+
+func (e *Engine) GetDel(ctx context.Context, key string) (string, error) {
+	var value string
+	err := e.Atomic(ctx, func(tx storage.Tx) error {
+		var err error
+		value, err = tx.GetDel(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+// MSet stores the pairs as the single WAL record.
+func (e *Engine) MSet(ctx context.Context, pairs []storage.KeyValue) error {
+	return e.Atomic(ctx, func(tx storage.Tx) error {
+		return tx.MSet(ctx, pairs)
+	})
+}
+
+func (e *Engine) MGet(_ context.Context, keys []string) (map[string]string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		rec, err := e.lookup(key)
+		if errors.Is(err, dberrors.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.typ == storage.StringType {
+			values[key] = rec.value
+		}
+	}
+	return values, nil
+}
+
+// MDel removes the keys as the single WAL record.
+func (e *Engine) MDel(ctx context.Context, keys []string) (int, error) {
+	var n int
+	err := e.Atomic(ctx, func(tx storage.Tx) error {
+		var err error
+		n, err = tx.MDel(ctx, keys)
+		return err
+	})
+	return n, err
+}
+
+// View calls fn with the value of the key under the engine read lock.
+func (e *Engine) View(_ context.Context, key string, fn storage.ViewFunc) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, err := lookupValue(e.lookup, key)
+	if err != nil {
+		return err
+	}
+	return fn(v)
+}
+
+// MView calls fn with the values of the keys under the engine read lock.
+func (e *Engine) MView(_ context.Context, keys []string, fn storage.MViewFunc) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	vs, err := lookupValues(e.lookup, keys)
+	if err != nil {
+		return err
+	}
+	return fn(vs)
+}
+
+// lookupValue decodes the value of the key, it's nil if the key doesn't exist.
+func lookupValue(lookup func(key string) (record, error), key string) (storage.Value, error) {
+	rec, err := lookup(key)
+	if errors.Is(err, dberrors.ErrNotFound) {
+		return nil, nil //nolint:nilnil // nil value means the key doesn't exist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec.decode()
+}
+
+func lookupValues(lookup func(key string) (record, error), keys []string) ([]storage.Value, error) {
+	vs := make([]storage.Value, len(keys))
+	for i, key := range keys {
+		var err error
+		if vs[i], err = lookupValue(lookup, key); err != nil {
+			return nil, err
+		}
+	}
+	return vs, nil
+}
+
+// Mutate calls fn and stores the value it returns under the engine lock.
+func (e *Engine) Mutate(ctx context.Context, key string, fn storage.MutateFunc) error {
+	return e.Atomic(ctx, func(tx storage.Tx) error {
+		return tx.Mutate(ctx, key, fn)
+	})
+}
+
+// Update calls fn and stores the value it returns under the engine lock.
+func (e *Engine) Update(ctx context.Context, key string, fn storage.UpdateFunc) (string, error) {
+	var value string
+	err := e.Atomic(ctx, func(tx storage.Tx) error {
+		var err error
+		value, err = tx.Update(ctx, key, fn)
+		return err
+	})
+	return value, err
+}
+
+// Expire sets the deadline of the key. The key is removed immediately
+// if the deadline is in the past. It returns false if the key doesn't exist.
+func (e *Engine) Expire(ctx context.Context, key string, expireAt time.Time) (bool, error) {
+	return e.update(ctx, key, storage.EventExpire, func(rec record) (record, bool) {
+		if !expireAt.After(e.now()) {
+			return record{tombstone: true}, true
+		}
+		rec.expireAt = expireAt.UnixNano()
+		return rec, true
+	})
+}
+
+// Persist removes the deadline of the key. It returns false
+// if the key doesn't exist or doesn't have a deadline.
+func (e *Engine) Persist(ctx context.Context, key string) (bool, error) {
+	return e.update(ctx, key, storage.EventPersist, func(rec record) (record, bool) {
+		if rec.expireAt == 0 {
+			return rec, false
+		}
+		rec.expireAt = 0
+		return rec, true
+	})
+}
+
+// ExpireTime returns the deadline of the key, zero time means the key
+// never expires. dberrors.ErrNotFound is returned if the key doesn't exist.
+func (e *Engine) ExpireTime(_ context.Context, key string) (time.Time, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rec, err := e.lookup(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rec.expireAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, rec.expireAt), nil
+}
+
+// Stats counts the live keys by scanning all the data, so it's expensive
+// on large data sets. UsedMemory is the size of the memtables.
+func (e *Engine) Stats(_ context.Context) (storage.Stats, error) {
+	var stats storage.Stats
+	err := e.scan(func(string, record) {
+		stats.Keys++
+	})
+	if err != nil {
+		return storage.Stats{}, err
+	}
+
+	e.mu.RLock()
+	stats.UsedMemory = e.mem.size
+	if e.imm != nil {
+		stats.UsedMemory += e.imm.size
+	}
+	e.mu.RUnlock()
+	return stats, nil
+}
+
+// Durable reports that the engine recovers the data from its own files.
+func (e *Engine) Durable() bool {
+	return true
+}
+
+// Dump returns a copy of all stored data.
+func (e *Engine) Dump() map[string]storage.Entry {
+	return e.Snapshot()()
+}
+
+// Snapshot captures the memtables and references the tables, the returned
+// function decodes the data without holding the lock.
+func (e *Engine) Snapshot() func() map[string]storage.Entry {
+	e.mu.RLock()
+	its, tables := e.sources()
+	e.mu.RUnlock()
+
+	return func() map[string]storage.Entry {
+		defer e.release(tables)
+		return e.dumpIterators(its)
+	}
+}
+
+func (e *Engine) dumpIterators(its []iterator) map[string]storage.Entry {
+	data := make(map[string]storage.Entry)
+	err := e.scanIterators(its, func(key string, rec record) {
+		v, err := rec.decode()
+		if err != nil {
+			e.logger.Error("failed to decode value", slog.String("key", key), slog.Any("error", err))
+			return
+		}
+		ent := storage.Entry{Value: v}
+		if rec.expireAt != 0 {
+			ent.ExpireAt = time.Unix(0, rec.expireAt)
+		}
+		data[key] = ent
+	})
+	if err != nil {
+		e.logger.Error("failed to dump data", slog.Any("error", err))
+	}
+	return data
+}
+
+// Load replaces all stored data with the given one.
+func (e *Engine) Load(data map[string]storage.Entry) {
+	if err := e.load(data); err != nil {
+		e.logger.Error("failed to load data", slog.Any("error", err))
+	}
+}
+
+func (e *Engine) load(data map[string]storage.Entry) error {
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
+
+	e.mu.Lock()
+	for e.imm != nil && e.bgErr == nil && !e.closed {
+		e.flushed.Wait()
+	}
+	if err := e.writable(); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+
+	m := e.manifest
+	m.Tables = nil
+	m.FlushedLSN = e.wal.LastLSN()
+	if err := writeManifest(e.conf.dataDir, m); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	e.manifest = m
+	old := e.tables
+	e.tables = nil
+	e.mem = newMemtable()
+
+	var wait func(ctx context.Context) error
+	for key, ent := range data {
+		rec := record{value: storage.MarshalValue(ent.Value), typ: ent.Value.Type()}
+		if !ent.ExpireAt.IsZero() {
+			rec.expireAt = ent.ExpireAt.UnixNano()
+		}
+
+		var err error
+		if wait, err = e.writeLocked(key, rec); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+	}
+	e.mu.Unlock()
+
+	for _, t := range old {
+		t.obsolete.Store(true)
+		if err := t.unref(); err != nil {
+			e.logger.Error("failed to release table", slog.Any("error", err))
+		}
+	}
+	if wait != nil {
+		return wait(context.Background())
+	}
+	return nil
+}
+
+// Close stops the background work and closes the files. The memtable
+// isn't flushed, it's restored from the WAL on the next start.
+func (e *Engine) Close() error {
+	e.closeOnce.Do(func() {
+		e.mu.Lock()
+		e.closed = true
+		e.flushed.Broadcast()
+		e.mu.Unlock()
+
+		close(e.closeCh)
+	})
+	<-e.doneCh
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	err := e.wal.Close()
+	e.releaseTables()
+	return err
+}
+
+func (e *Engine) releaseTables() {
+	for _, t := range e.tables {
+		if err := t.unref(); err != nil {
+			e.logger.Error("failed to release table", slog.Any("error", err))
+		}
+	}
+	e.tables = nil
+}
+
+// lookup returns the live record of the key. The lock must be held.
+func (e *Engine) lookup(key string) (record, error) {
+	rec, ok := e.mem.get(key)
+	if !ok && e.imm != nil {
+		rec, ok = e.imm.get(key)
+	}
+	for i := len(e.tables) - 1; !ok && i >= 0; i-- {
+		var err error
+		if rec, ok, err = e.tables[i].get(key); err != nil {
+			return record{}, err
+		}
+	}
+
+	if !ok || !rec.live(e.now().UnixNano()) {
+		return record{}, dberrors.ErrNotFound
+	}
+	return rec, nil
+}
+
+// update atomically replaces the live record of the key with the one
+// returned by fn if it reports the record is changed. The change is reported
+// by the event of the given type or by the del event if the key is removed.
+func (e *Engine) update(
+	ctx context.Context, key string, typ storage.EventType, fn func(rec record) (record, bool),
+) (bool, error) {
+	e.mu.Lock()
+	rec, err := e.lookup(key)
+	if errors.Is(err, dberrors.ErrNotFound) {
+		e.mu.Unlock()
+		return false, nil
+	}
+	if err != nil {
+		e.mu.Unlock()
+		return false, err
+	}
+
+	rec, changed := fn(rec)
+	if !changed {
+		e.mu.Unlock()
+		return false, nil
+	}
+
+	wait, err := e.writeLocked(key, rec)
+	if err != nil {
+		e.mu.Unlock()
+		return false, err
+	}
+	if rec.tombstone {
+		typ = storage.EventDel
+	}
+	e.emit(typ, key)
+	e.mu.Unlock()
+	return true, wait(ctx)
+}
+
+// write appends the value record to the WAL and the memtable. It returns
+// after releasing the lock when the WAL record is persisted.
+func (e *Engine) write(ctx context.Context, key string, rec record) error {
+	e.mu.Lock()
+	wait, err := e.writeLocked(key, rec)
+	if err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	e.emit(storage.EventSet, key)
+	e.mu.Unlock()
+	return wait(ctx)
+}
+
+func (e *Engine) writeLocked(key string, rec record) (func(ctx context.Context) error, error) {
+	if err := e.makeRoomForWrite(); err != nil {
+		return nil, err
+	}
+
+	cmdID, args := encodeWALRecord(key, rec)
+	wait, err := e.wal.Append(cmdID, args)
+	if err != nil {
+		return nil, err
+	}
+	e.mem.put(key, rec)
+	return wait, nil
+}
+
+// emit notifies the listener about the change of the key. It's called
+// while the lock is held, so the events are observed in order.
+func (e *Engine) emit(typ storage.EventType, key string) {
+	if l := e.conf.eventListener; l != nil {
+		l(storage.Event{Type: typ, DB: e.conf.database, Key: key, Time: e.now()})
+	}
+}
+
+// makeRoomForWrite turns the full memtable into the immutable one to be
+// flushed in background, waiting for the previous one to be flushed first.
+func (e *Engine) makeRoomForWrite() error {
+	for {
+		if err := e.writable(); err != nil {
+			return err
+		}
+		if e.mem.size < e.conf.memtableSize {
+			return nil
+		}
+		if e.rotate() {
+			return nil
+		}
+		e.flushed.Wait()
+	}
+}
+
+// rotate turns the memtable into the immutable one to be flushed
+// in background. It reports false if the previous one isn't flushed yet.
+func (e *Engine) rotate() bool {
+	if e.imm != nil {
+		return false
+	}
+	e.imm, e.immLSN = e.mem, e.wal.LastLSN()
+	e.mem = newMemtable()
+	e.scheduleWork()
+	return true
+}
+
+func (e *Engine) writable() error {
+	if e.closed {
+		return ErrClosed
+	}
+	if e.bgErr != nil {
+		return fmt.Errorf("background error: %w", e.bgErr)
+	}
+	return nil
+}
+
+// scan calls fn for every live record in ascending key order.
+// It doesn't block writes while reading the tables.
+func (e *Engine) scan(fn func(key string, rec record)) error {
+	e.mu.RLock()
+	its, tables := e.sources()
+	e.mu.RUnlock()
+
+	defer e.release(tables)
+	return e.scanIterators(its, fn)
+}
+
+// sources returns the iterators over all the data from the newest to
+// the oldest and the tables referenced by them. The tables must be
+// released after use. The lock must be held.
+func (e *Engine) sources() ([]iterator, []*table) {
+	its := []iterator{e.mem.iterator()}
+	if e.imm != nil {
+		its = append(its, e.imm.iterator())
+	}
+
+	tables := slices.Clone(e.tables)
+	for i := len(tables) - 1; i >= 0; i-- {
+		tables[i].ref()
+		its = append(its, tables[i].iterator())
+	}
+	return its, tables
+}
+
+func (e *Engine) release(tables []*table) {
+	for _, t := range tables {
+		if err := t.unref(); err != nil {
+			e.logger.Error("failed to release table", slog.Any("error", err))
+		}
+	}
+}
+
+func (e *Engine) scanIterators(its []iterator, fn func(key string, rec record)) error {
+	now := e.now().UnixNano()
+	it := newMergeIterator(its)
+	for ; it.valid(); it.next() {
+		if rec := it.record(); rec.live(now) {
+			fn(it.key(), rec)
+		}
+	}
+	return it.err()
+}
+
+func (e *Engine) scheduleWork() {
+	select {
+	case e.workCh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) backgroundLoop() {
+	defer close(e.doneCh)
+
+	for {
+		select {
+		case <-e.closeCh:
+			return
+		case <-e.workCh:
+		}
+
+		if err := e.flush(); err != nil {
+			e.logger.Error("failed to flush memtable", slog.Any("error", err))
+
+			e.mu.Lock()
+			e.bgErr = err
+			e.flushed.Broadcast()
+			e.mu.Unlock()
+			continue
+		}
+		if err := e.compact(); err != nil {
+			e.logger.Error("failed to compact tables", slog.Any("error", err))
+		}
+	}
+}
+
+// flush writes the immutable memtable to the new table.
+func (e *Engine) flush() error {
+	e.mu.Lock()
+	imm, lsn := e.imm, e.immLSN
+	if imm == nil {
+		e.mu.Unlock()
+		return nil
+	}
+	num := e.allocFileNum()
+	e.mu.Unlock()
+
+	start := time.Now()
+	t, err := writeTable(e.conf.dataDir, num, imm.iterator(), e.conf.blockSize, e.conf.bloomBitsPerKey)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	m := e.manifest
+	m.FlushedLSN = lsn
+	m.Tables = slices.Clone(m.Tables)
+	if t != nil {
+		m.Tables = append(m.Tables, t.num)
+	}
+	if err = writeManifest(e.conf.dataDir, m); err != nil {
+		e.mu.Unlock()
+		if t != nil {
+			t.obsolete.Store(true)
+			_ = t.unref()
+		}
+		return err
+	}
+
+	e.manifest = m
+	if t != nil {
+		e.tables = append(e.tables, t)
+	}
+	e.imm = nil
+	e.flushed.Broadcast()
+	e.mu.Unlock()
+
+	e.logger.Debug(
+		"Flushed memtable",
+		slog.Uint64("table", num),
+		slog.Uint64("lsn", lsn),
+		slog.Duration("duration", time.Since(start)),
+	)
+	return e.wal.Compact(lsn)
+}
+
+// allocFileNum returns the number of the new table file. The lock must be held.
+func (e *Engine) allocFileNum() uint64 {
+	num := e.manifest.NextFileNum
+	e.manifest.NextFileNum++
+	return num
+}
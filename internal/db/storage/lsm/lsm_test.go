@@ -0,0 +1,540 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+	"github.com/Mort4lis/memdb/internal/db/wal"
+)
+
+var errUnexpected = errors.New("unexpected")
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+func openEngine(t *testing.T, dir string, opts ...Option) *Engine {
+	t.Helper()
+
+	opts = append([]Option{
+		WithDataDirectory(dir),
+		WithMemtableSize(1 << 10),
+		WithBlockSize(128),
+		WithFlushMode(wal.SyncFlushMode),
+	}, opts...)
+
+	e, err := Open(logger, opts...)
+	require.NoError(t, err)
+	return e
+}
+
+func TestEngine(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	e := openEngine(t, dir)
+	for i := range 500 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%d", i)))
+	}
+	for i := 0; i < 500; i += 5 {
+		require.NoError(t, e.Del(ctx, fmt.Sprintf("key-%03d", i)))
+	}
+	require.NoError(t, e.Set(ctx, "key-001", "overwritten"))
+
+	check := func(e *Engine) {
+		t.Helper()
+
+		for i := range 500 {
+			key := fmt.Sprintf("key-%03d", i)
+			value, err := e.Get(ctx, key)
+			switch {
+			case i%5 == 0:
+				require.ErrorIs(t, err, dberrors.ErrNotFound, key)
+			case i == 1:
+				require.NoError(t, err)
+				require.Equal(t, "overwritten", value)
+			default:
+				require.NoError(t, err, key)
+				require.Equal(t, fmt.Sprintf("value-%d", i), value)
+			}
+		}
+
+		stats, err := e.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 400, stats.Keys)
+		assert.Len(t, e.Dump(), 400)
+	}
+
+	check(e)
+	e.mu.RLock()
+	assert.NotEmpty(t, e.tables, "memtable must be flushed")
+	e.mu.RUnlock()
+	require.NoError(t, e.Close())
+
+	e = openEngine(t, dir)
+	defer e.Close()
+	check(e)
+}
+
+func TestEngine_expiration(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	e := openEngine(t, t.TempDir())
+	defer e.Close()
+	e.now = func() time.Time { return now }
+
+	require.NoError(t, e.SetWithExpiration(ctx, "key", "value", now.Add(time.Minute)))
+	require.NoError(t, e.SetWithExpiration(ctx, "past", "value", now.Add(-time.Minute)))
+	require.NoError(t, e.Set(ctx, "persistent", "value"))
+
+	expireAt, err := e.ExpireTime(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute).UnixNano(), expireAt.UnixNano())
+
+	_, err = e.Get(ctx, "past")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+	ok, err := e.Expire(ctx, "persistent", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = e.Persist(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = e.Persist(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = e.Expire(ctx, "missing", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Hour)
+	_, err = e.Get(ctx, "persistent")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+	value, err := e.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestEngine_compaction(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	e := openEngine(t, dir, WithCompactionThreshold(2))
+
+	const numKeys = 2000
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < numKeys; i += 4 {
+				assert.NoError(t, e.Set(ctx, fmt.Sprintf("key-%04d", i), "value"))
+				if i%2 == 0 {
+					assert.NoError(t, e.Del(ctx, fmt.Sprintf("key-%04d", i)))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Force the flush of the last memtable to let the compaction reach the bottom.
+	e.mu.Lock()
+	for e.imm != nil {
+		e.flushed.Wait()
+	}
+	e.imm, e.immLSN = e.mem, e.wal.LastLSN()
+	e.mem = newMemtable()
+	e.scheduleWork()
+	e.mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return e.imm == nil && len(e.tables) < 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, numKeys/2, stats.Keys)
+	require.NoError(t, e.Close())
+
+	// Only the live tables must remain on the disk.
+	m, err := readManifest(dir)
+	require.NoError(t, err)
+	files, err := filepath.Glob(filepath.Join(dir, "*"+tableFileExt))
+	require.NoError(t, err)
+	assert.Len(t, files, len(m.Tables))
+
+	e = openEngine(t, dir)
+	defer e.Close()
+	for i := range numKeys {
+		_, err = e.Get(ctx, fmt.Sprintf("key-%04d", i))
+		if i%2 == 0 {
+			require.ErrorIs(t, err, dberrors.ErrNotFound)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestEngine_Load(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	e := openEngine(t, dir)
+	for i := range 200 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("old-%d", i), "value"))
+	}
+
+	expireAt := time.Unix(0, time.Now().Add(time.Hour).UnixNano())
+	data := map[string]storage.Entry{
+		"a": {Value: storage.String("1")},
+		"b": {Value: storage.String("2"), ExpireAt: expireAt},
+	}
+	e.Load(data)
+	assert.Equal(t, data, e.Dump())
+	require.NoError(t, e.Close())
+
+	e = openEngine(t, dir)
+	defer e.Close()
+	assert.Equal(t, data, e.Dump())
+}
+
+func TestEngine_Snapshot(t *testing.T) {
+	ctx := context.Background()
+
+	e := openEngine(t, t.TempDir())
+	defer e.Close()
+	for i := range 200 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key-%d", i), "old"))
+	}
+	want := e.Dump()
+
+	export := e.Snapshot()
+	for i := range 200 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key-%d", i), "new"))
+	}
+	require.NoError(t, e.Del(ctx, "key-0"))
+	assert.Equal(t, want, export())
+}
+
+func TestEngine_registry(t *testing.T) {
+	dir := t.TempDir()
+
+	backend, err := storage.New(logger, EngineName, func(v any) error {
+		conf := v.(*FileConfig)
+		conf.DataDirectory = dir
+		conf.FlushMode = wal.NoneFlushMode
+		return nil
+	})
+	require.NoError(t, err)
+	defer backend.Close()
+
+	require.NoError(t, backend.Set(context.Background(), "key", "value"))
+	_, err = os.Stat(filepath.Join(dir, walDirName))
+	require.NoError(t, err)
+
+	// The logical database other than 0 is kept in the subdirectory.
+	other, err := storage.New(logger, EngineName, func(v any) error {
+		conf := v.(*FileConfig)
+		conf.DataDirectory = dir
+		conf.FlushMode = wal.NoneFlushMode
+		return nil
+	}, storage.WithDatabase(2))
+	require.NoError(t, err)
+	defer other.Close()
+
+	require.NoError(t, other.Set(context.Background(), "key", "value"))
+	_, err = os.Stat(filepath.Join(dir, "db2", walDirName))
+	require.NoError(t, err)
+}
+
+func TestEngine_registryMaxMemory(t *testing.T) {
+	_, err := storage.New(logger, EngineName, func(any) error { return nil }, storage.WithMaxMemory(1024))
+	require.ErrorIs(t, err, ErrMaxMemory)
+}
+
+func TestEngine_events(t *testing.T) {
+	ctx := context.Background()
+	var events []string
+	e := openEngine(t, t.TempDir(), WithDatabase(3), WithEventListener(func(ev storage.Event) {
+		events = append(events, fmt.Sprintf("%s %d %s", ev.Type, ev.DB, ev.Key))
+	}))
+	defer e.Close()
+
+	require.NoError(t, e.Set(ctx, "a", "1"))
+	require.NoError(t, e.Del(ctx, "missing"))
+	_, err := e.Expire(ctx, "a", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = e.Persist(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, e.MSet(ctx, []storage.KeyValue{{Key: "b", Value: "2"}, {Key: "c", Value: "3"}}))
+	_, err = e.MDel(ctx, []string{"a", "missing"})
+	require.NoError(t, err)
+	require.Error(t, e.Atomic(ctx, func(tx storage.Tx) error {
+		if err := tx.Set(ctx, "d", "4"); err != nil {
+			return err
+		}
+		return errUnexpected
+	}))
+	require.NoError(t, e.Del(ctx, "b"))
+
+	// The removal of the missing keys and the failed transactions aren't reported.
+	assert.Equal(t, []string{
+		"set 3 a", "expire 3 a", "persist 3 a", "set 3 b", "set 3 c", "del 3 a", "del 3 b",
+	}, events)
+}
+
+func TestEngine_staleFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"000042.sst", "MANIFEST.123.tmp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("garbage"), 0o600))
+	}
+
+	e := openEngine(t, dir)
+	defer e.Close()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, ent := range entries {
+		assert.False(t, strings.HasSuffix(ent.Name(), tableFileExt) || strings.HasSuffix(ent.Name(), ".tmp"), ent.Name())
+	}
+}
+
+func TestEngine_Atomic(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	e := openEngine(t, dir)
+	require.NoError(t, e.Set(ctx, "a", "1"))
+	require.NoError(t, e.Set(ctx, "b", "2"))
+
+	err := e.Atomic(ctx, func(tx storage.Tx) error {
+		if err := tx.Set(ctx, "a", "10"); err != nil {
+			return err
+		}
+		if err := tx.Del(ctx, "b"); err != nil {
+			return err
+		}
+
+		// The transaction observes its own writes.
+		value, err := tx.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "10", value)
+		_, err = tx.Get(ctx, "b")
+		require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+		stats, err := tx.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, stats.Keys)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Nothing is written if the transaction fails.
+	err = e.Atomic(ctx, func(tx storage.Tx) error {
+		require.NoError(t, tx.Set(ctx, "c", "3"))
+		return errUnexpected
+	})
+	require.ErrorIs(t, err, errUnexpected)
+
+	check := func(e *Engine) {
+		t.Helper()
+
+		value, err := e.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "10", value)
+		_, err = e.Get(ctx, "b")
+		require.ErrorIs(t, err, dberrors.ErrNotFound)
+		_, err = e.Get(ctx, "c")
+		require.ErrorIs(t, err, dberrors.ErrNotFound)
+	}
+	check(e)
+	require.NoError(t, e.Close())
+
+	// The batch is restored from the WAL.
+	e = openEngine(t, dir)
+	defer e.Close()
+	check(e)
+}
+
+func TestEngine_batch(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	e := openEngine(t, dir)
+	require.NoError(t, e.Set(ctx, "c", "3"))
+	require.NoError(t, e.MSet(ctx, []storage.KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}))
+	n, err := e.MDel(ctx, []string{"b", "c", "d"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	check := func(e *Engine) {
+		t.Helper()
+
+		values, err := e.MGet(ctx, []string{"a", "b", "c"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1"}, values)
+	}
+	check(e)
+	require.NoError(t, e.Close())
+
+	// The batches are restored from the WAL.
+	e = openEngine(t, dir)
+	defer e.Close()
+	check(e)
+}
+
+func TestEngine_Update(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	appendX := func(value string, _ bool) (string, error) {
+		return value + "x", nil
+	}
+
+	e := openEngine(t, dir)
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	require.NoError(t, e.SetWithExpiration(ctx, "a", "1", expireAt))
+	value, err := e.Update(ctx, "a", appendX)
+	require.NoError(t, err)
+	assert.Equal(t, "1x", value)
+	value, err = e.Update(ctx, "b", appendX)
+	require.NoError(t, err)
+	assert.Equal(t, "x", value)
+
+	_, err = e.Update(ctx, "b", func(string, bool) (string, error) {
+		return "", errUnexpected
+	})
+	require.ErrorIs(t, err, errUnexpected)
+
+	check := func(e *Engine) {
+		t.Helper()
+
+		values, err := e.MGet(ctx, []string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1x", "b": "x"}, values)
+		got, err := e.ExpireTime(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, got.Equal(expireAt))
+	}
+	check(e)
+	require.NoError(t, e.Close())
+
+	e = openEngine(t, dir)
+	defer e.Close()
+	check(e)
+}
+
+func TestEngine_SetIf(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	e := openEngine(t, dir)
+	res, err := e.SetIf(ctx, "a", "1", time.Time{}, storage.IfNotExists)
+	require.NoError(t, err)
+	assert.Equal(t, storage.SetResult{Written: true}, res)
+	res, err = e.SetIf(ctx, "a", "2", time.Time{}, storage.IfEquals("0"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.SetResult{Old: "1", Existed: true}, res)
+
+	require.NoError(t, e.Set(ctx, "b", "2"))
+	value, err := e.GetDel(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+	_, err = e.GetDel(ctx, "c")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+	check := func(e *Engine) {
+		t.Helper()
+
+		values, err := e.MGet(ctx, []string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "1"}, values)
+	}
+	check(e)
+	require.NoError(t, e.Close())
+
+	e = openEngine(t, dir)
+	defer e.Close()
+	check(e)
+}
+
+func TestEngine_Mutate(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// The hash is larger than the memtable, so it gets to the tables too.
+	const numFields = 100
+	e := openEngine(t, dir)
+	for i := range numFields {
+		require.NoError(t, e.Mutate(ctx, "hash", func(v storage.Value) (storage.Value, error) {
+			hash, ok := v.(*storage.Hash)
+			if !ok {
+				hash = storage.NewHash()
+			}
+			hash.Set(fmt.Sprintf("field-%03d", i), "value")
+			return hash, nil
+		}))
+	}
+	require.NoError(t, e.Mutate(ctx, "removed", func(storage.Value) (storage.Value, error) {
+		return storage.NewHash(), nil
+	}))
+	require.NoError(t, e.Mutate(ctx, "removed", func(storage.Value) (storage.Value, error) {
+		return nil, nil
+	}))
+	require.NoError(t, e.Set(ctx, "str", "value"))
+
+	check := func(e *Engine) {
+		t.Helper()
+
+		require.NoError(t, e.View(ctx, "hash", func(v storage.Value) error {
+			hash, ok := v.(*storage.Hash)
+			require.True(t, ok)
+			assert.Equal(t, numFields, hash.Len())
+			return nil
+		}))
+		require.NoError(t, e.View(ctx, "removed", func(v storage.Value) error {
+			assert.Nil(t, v)
+			return nil
+		}))
+		require.NoError(t, e.MView(ctx, []string{"hash", "removed", "str"}, func(vs []storage.Value) error {
+			require.Len(t, vs, 3)
+			assert.Equal(t, storage.HashType, vs[0].Type())
+			assert.Nil(t, vs[1])
+			assert.Equal(t, storage.String("value"), vs[2])
+			return nil
+		}))
+		_, err := e.Get(ctx, "hash")
+		require.ErrorIs(t, err, dberrors.ErrWrongType)
+		values, err := e.MGet(ctx, []string{"hash", "str"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"str": "value"}, values)
+
+		data := e.Dump()
+		assert.Equal(t, storage.HashType, data["hash"].Value.Type())
+		assert.Equal(t, storage.String("value"), data["str"].Value)
+	}
+	check(e)
+	require.NoError(t, e.Close())
+
+	e = openEngine(t, dir)
+	defer e.Close()
+	check(e)
+}
@@ -0,0 +1,84 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const manifestFileName = "MANIFEST"
+
+// manifest describes the persistent state of the engine.
+type manifest struct {
+	// FlushedLSN is the LSN of the last WAL record persisted in the tables,
+	// the log is replayed starting from the next one on startup.
+	FlushedLSN  uint64 `json:"flushed_lsn"`
+	NextFileNum uint64 `json:"next_file_num"`
+	// Tables contains the file numbers of the live tables from the oldest to the newest.
+	Tables []uint64 `json:"tables"`
+}
+
+func readManifest(dir string) (manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest{NextFileNum: 1}, nil
+	}
+	if err != nil {
+		return manifest{}, fmt.Errorf("read manifest: %w", err)
+	}
+
+	var m manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return manifest{}, fmt.Errorf("%w: decode manifest: %w", ErrCorrupted, err)
+	}
+	return m, nil
+}
+
+// writeManifest atomically replaces the manifest file.
+func writeManifest(dir string, m manifest) (err error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, manifestFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("write temporary file: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("sync temporary file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, manifestFileName)); err != nil {
+		return fmt.Errorf("rename temporary file: %w", err)
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open directory: %w", err)
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("sync directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package lsm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// recordOverhead approximates the memory used by the map slot
+// and the record header besides the key and value content.
+const recordOverhead = 64
+
+type record struct {
+	// value of other types than strings is encoded by storage.MarshalValue.
+	value string
+	typ   storage.Type
+	// expireAt is unix time in nanoseconds, zero means the key never expires.
+	expireAt  int64
+	tombstone bool
+}
+
+func (r record) live(now int64) bool {
+	return !r.tombstone && (r.expireAt == 0 || r.expireAt > now)
+}
+
+func (r record) stringValue() (string, error) {
+	if r.typ != storage.StringType {
+		return "", dberrors.ErrWrongType
+	}
+	return r.value, nil
+}
+
+func (r record) decode() (storage.Value, error) {
+	v, err := storage.UnmarshalValue(r.typ, r.value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+	return v, nil
+}
+
+func recordSize(key string, rec record) int64 {
+	return int64(len(key) + len(rec.value) + recordOverhead)
+}
+
+// memtable buffers the recent writes in memory until
+// they are flushed to an SSTable. It's not safe for concurrent use.
+type memtable struct {
+	data map[string]record
+	size int64
+}
+
+func newMemtable() *memtable {
+	return &memtable{data: make(map[string]record)}
+}
+
+func (m *memtable) put(key string, rec record) {
+	if old, ok := m.data[key]; ok {
+		m.size -= recordSize(key, old)
+	}
+	m.data[key] = rec
+	m.size += recordSize(key, rec)
+}
+
+func (m *memtable) get(key string) (record, bool) {
+	rec, ok := m.data[key]
+	return rec, ok
+}
+
+func (m *memtable) empty() bool {
+	return len(m.data) == 0
+}
+
+// iterator returns the iterator over the copy of the current content,
+// so the memtable may be modified while the iterator is in use.
+func (m *memtable) iterator() iterator {
+	keys := slices.Sorted(maps.Keys(m.data))
+	recs := make([]record, len(keys))
+	for i, key := range keys {
+		recs[i] = m.data[key]
+	}
+	return &sliceIterator{keys: keys, recs: recs}
+}
+
+type sliceIterator struct {
+	keys []string
+	recs []record
+	pos  int
+}
+
+func (it *sliceIterator) valid() bool {
+	return it.pos < len(it.keys)
+}
+
+func (it *sliceIterator) key() string {
+	return it.keys[it.pos]
+}
+
+func (it *sliceIterator) record() record {
+	return it.recs[it.pos]
+}
+
+func (it *sliceIterator) next() {
+	it.pos++
+}
+
+func (it *sliceIterator) err() error {
+	return nil
+}
@@ -0,0 +1,476 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// The table file layout:
+//
+//	| data block 1 | ... | data block N | index block | bloom filter | footer |
+//
+// Every block and the bloom filter are followed by crc32 of their content.
+// A data block is a sequence of records in ascending key order, each record
+// is encoded as uvarint key length, key, uvarint value length, value,
+// varint expiration time and a flags byte holding the tombstone bit and
+// the value type in the higher bits. The index block contains
+// the number of data blocks followed by the last key, the offset and
+// the length of each of them. The footer is fixed-size and contains
+// offsets and lengths of the index block and the bloom filter.
+const (
+	tableMagic      uint64 = 0x4d454d4442535354 // "MEMDBSST"
+	tableFooterSize        = 40
+	tableFileExt           = ".sst"
+	checksumSize           = 4
+
+	tombstoneFlag byte = 1
+	typeShift          = 1
+)
+
+var ErrCorrupted = errors.New("table is corrupted")
+
+type blockHandle struct {
+	lastKey string
+	offset  uint64
+	length  uint64
+}
+
+// table is an immutable sorted file. Its index and bloom filter are kept
+// in memory, data blocks are read from the file on demand.
+type table struct {
+	num   uint64
+	path  string
+	file  *os.File
+	size  int64
+	index []blockHandle
+	bloom bloomFilter
+
+	// refs is the number of the table users, the engine holds one reference
+	// while the table is live. The file is closed when the last reference is
+	// released and removed if the table is obsolete.
+	refs     atomic.Int32
+	obsolete atomic.Bool
+}
+
+func tablePath(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d%s", num, tableFileExt))
+}
+
+// writeTable writes the records from the iterator to the new table file.
+// It returns nil table if there are no records to write.
+func writeTable(dir string, num uint64, it iterator, blockSize, bloomBitsPerKey int) (*table, error) {
+	path := tablePath(dir, num)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("create table %s: %w", path, err)
+	}
+
+	count, err := writeTableFile(file, it, blockSize, bloomBitsPerKey)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("close table %s: %w", path, closeErr)
+	}
+	if err != nil || count == 0 {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	if err = syncDir(dir); err != nil {
+		return nil, err
+	}
+	return openTable(dir, num)
+}
+
+func writeTableFile(file *os.File, it iterator, blockSize, bloomBitsPerKey int) (int, error) {
+	w := &tableWriter{w: bufio.NewWriter(file), blockSize: blockSize}
+	for ; it.valid(); it.next() {
+		if err := w.add(it.key(), it.record()); err != nil {
+			return 0, err
+		}
+	}
+	if err := it.err(); err != nil {
+		return 0, err
+	}
+	if w.count == 0 {
+		return 0, nil
+	}
+
+	if err := w.finish(bloomBitsPerKey); err != nil {
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("sync table %s: %w", file.Name(), err)
+	}
+	return w.count, nil
+}
+
+type tableWriter struct {
+	w         *bufio.Writer
+	blockSize int
+	offset    uint64
+	block     []byte
+	lastKey   string
+	index     []blockHandle
+	hashes    []uint32
+	count     int
+}
+
+func (w *tableWriter) add(key string, rec record) error {
+	flags := byte(rec.typ) << typeShift
+	if rec.tombstone {
+		flags |= tombstoneFlag
+	}
+
+	w.block = binary.AppendUvarint(w.block, uint64(len(key)))
+	w.block = append(w.block, key...)
+	w.block = binary.AppendUvarint(w.block, uint64(len(rec.value)))
+	w.block = append(w.block, rec.value...)
+	w.block = binary.AppendVarint(w.block, rec.expireAt)
+	w.block = append(w.block, flags)
+
+	w.lastKey = key
+	w.hashes = append(w.hashes, bloomHash(key))
+	w.count++
+
+	if len(w.block) >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func (w *tableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+
+	offset, length, err := w.writeChecked(w.block)
+	if err != nil {
+		return err
+	}
+	w.index = append(w.index, blockHandle{lastKey: w.lastKey, offset: offset, length: length})
+	w.block = w.block[:0]
+	return nil
+}
+
+// writeChecked writes the data followed by its checksum.
+func (w *tableWriter) writeChecked(data []byte) (offset, length uint64, err error) {
+	if _, err = w.w.Write(data); err != nil {
+		return 0, 0, fmt.Errorf("write table: %w", err)
+	}
+	if _, err = w.w.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))); err != nil {
+		return 0, 0, fmt.Errorf("write table: %w", err)
+	}
+
+	offset, length = w.offset, uint64(len(data)+checksumSize)
+	w.offset += length
+	return offset, length, nil
+}
+
+func (w *tableWriter) finish(bloomBitsPerKey int) error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	index := binary.AppendUvarint(nil, uint64(len(w.index)))
+	for _, h := range w.index {
+		index = binary.AppendUvarint(index, uint64(len(h.lastKey)))
+		index = append(index, h.lastKey...)
+		index = binary.AppendUvarint(index, h.offset)
+		index = binary.AppendUvarint(index, h.length)
+	}
+	indexOffset, indexLength, err := w.writeChecked(index)
+	if err != nil {
+		return err
+	}
+
+	bloomOffset, bloomLength, err := w.writeChecked(newBloomFilter(w.hashes, bloomBitsPerKey))
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, 0, tableFooterSize)
+	footer = binary.LittleEndian.AppendUint64(footer, indexOffset)
+	footer = binary.LittleEndian.AppendUint64(footer, indexLength)
+	footer = binary.LittleEndian.AppendUint64(footer, bloomOffset)
+	footer = binary.LittleEndian.AppendUint64(footer, bloomLength)
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+	if _, err = w.w.Write(footer); err != nil {
+		return fmt.Errorf("write table: %w", err)
+	}
+	if err = w.w.Flush(); err != nil {
+		return fmt.Errorf("write table: %w", err)
+	}
+	return nil
+}
+
+func openTable(dir string, num uint64) (_ *table, err error) {
+	path := tablePath(dir, num)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open table %s: %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat table %s: %w", path, err)
+	}
+
+	t := &table{num: num, path: path, file: file, size: info.Size()}
+	if t.size < tableFooterSize {
+		return nil, fmt.Errorf("%w: %s: too small", ErrCorrupted, path)
+	}
+
+	footer := make([]byte, tableFooterSize)
+	if _, err = file.ReadAt(footer, t.size-tableFooterSize); err != nil {
+		return nil, fmt.Errorf("read table %s: %w", path, err)
+	}
+	if binary.LittleEndian.Uint64(footer[32:]) != tableMagic {
+		return nil, fmt.Errorf("%w: %s: bad magic", ErrCorrupted, path)
+	}
+
+	index, err := t.readChecked(binary.LittleEndian.Uint64(footer[0:]), binary.LittleEndian.Uint64(footer[8:]))
+	if err != nil {
+		return nil, err
+	}
+	if t.index, err = decodeIndex(index); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrCorrupted, path, err)
+	}
+
+	bloom, err := t.readChecked(binary.LittleEndian.Uint64(footer[16:]), binary.LittleEndian.Uint64(footer[24:]))
+	if err != nil {
+		return nil, err
+	}
+	t.bloom = bloom
+
+	t.refs.Store(1)
+	return t, nil
+}
+
+func decodeIndex(data []byte) ([]blockHandle, error) {
+	r := byteReader{data: data}
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(data)) {
+		return nil, errMalformedBlock
+	}
+
+	index := make([]blockHandle, 0, n)
+	for range n {
+		h := blockHandle{lastKey: r.string(), offset: r.uvarint(), length: r.uvarint()}
+		if r.err != nil {
+			return nil, r.err
+		}
+		index = append(index, h)
+	}
+	return index, nil
+}
+
+// readChecked reads the data written by tableWriter.writeChecked.
+func (t *table) readChecked(offset, length uint64) ([]byte, error) {
+	if length < checksumSize || offset+length > uint64(t.size) { //nolint:gosec // size is not negative
+		return nil, fmt.Errorf("%w: %s: bad block handle", ErrCorrupted, t.path)
+	}
+
+	buf := make([]byte, length)
+	if _, err := t.file.ReadAt(buf, int64(offset)); err != nil { //nolint:gosec // offset is less than size
+		return nil, fmt.Errorf("read table %s: %w", t.path, err)
+	}
+
+	data, sum := buf[:length-checksumSize], buf[length-checksumSize:]
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: %s: checksum mismatch", ErrCorrupted, t.path)
+	}
+	return data, nil
+}
+
+// get returns the record of the key if the table contains it.
+func (t *table) get(key string) (record, bool, error) {
+	if !t.bloom.mayContain(key) {
+		return record{}, false, nil
+	}
+
+	i := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].lastKey >= key
+	})
+	if i == len(t.index) {
+		return record{}, false, nil
+	}
+
+	block, err := t.readBlock(i)
+	if err != nil {
+		return record{}, false, err
+	}
+	for _, ent := range block {
+		if ent.key == key {
+			return ent.rec, true, nil
+		}
+	}
+	return record{}, false, nil
+}
+
+type blockEntry struct {
+	key string
+	rec record
+}
+
+var errMalformedBlock = errors.New("malformed block")
+
+func (t *table) readBlock(i int) ([]blockEntry, error) {
+	data, err := t.readChecked(t.index[i].offset, t.index[i].length)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries []blockEntry
+		r       = byteReader{data: data}
+	)
+	for r.len() != 0 {
+		ent := blockEntry{key: r.string()}
+		ent.rec.value = r.string()
+		ent.rec.expireAt = r.varint()
+		flags := r.byte()
+		ent.rec.tombstone = flags&tombstoneFlag != 0
+		ent.rec.typ = storage.Type(flags >> typeShift)
+		if r.err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrCorrupted, t.path, r.err)
+		}
+		entries = append(entries, ent)
+	}
+	return entries, nil
+}
+
+func (t *table) ref() {
+	t.refs.Add(1)
+}
+
+func (t *table) unref() error {
+	if t.refs.Add(-1) != 0 {
+		return nil
+	}
+	if err := t.file.Close(); err != nil {
+		return fmt.Errorf("close table %s: %w", t.path, err)
+	}
+	if t.obsolete.Load() {
+		if err := os.Remove(t.path); err != nil {
+			return fmt.Errorf("remove table %s: %w", t.path, err)
+		}
+	}
+	return nil
+}
+
+func (t *table) iterator() iterator {
+	it := &tableIterator{t: t, blockIdx: -1}
+	it.next()
+	return it
+}
+
+type tableIterator struct {
+	t        *table
+	blockIdx int
+	block    []blockEntry
+	pos      int
+	curErr   error
+}
+
+func (it *tableIterator) valid() bool {
+	return it.curErr == nil && it.pos < len(it.block)
+}
+
+func (it *tableIterator) key() string {
+	return it.block[it.pos].key
+}
+
+func (it *tableIterator) record() record {
+	return it.block[it.pos].rec
+}
+
+func (it *tableIterator) err() error {
+	return it.curErr
+}
+
+func (it *tableIterator) next() {
+	it.pos++
+	for it.pos >= len(it.block) && it.blockIdx+1 < len(it.t.index) {
+		it.blockIdx++
+		it.pos = 0
+		it.block, it.curErr = it.t.readBlock(it.blockIdx)
+		if it.curErr != nil {
+			return
+		}
+	}
+}
+
+type byteReader struct {
+	data []byte
+	err  error
+}
+
+func (r *byteReader) len() int {
+	return len(r.data)
+}
+
+func (r *byteReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errMalformedBlock
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *byteReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errMalformedBlock
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *byteReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.data)) {
+		r.err = errMalformedBlock
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func (r *byteReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errMalformedBlock
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
@@ -0,0 +1,111 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable(t *testing.T) {
+	dir := t.TempDir()
+
+	mem := newMemtable()
+	for i := range 1000 {
+		mem.put(fmt.Sprintf("key-%04d", i), record{value: fmt.Sprintf("value-%d", i), expireAt: int64(i)})
+	}
+	mem.put("deleted", record{tombstone: true})
+
+	tbl, err := writeTable(dir, 1, mem.iterator(), 256, 10)
+	require.NoError(t, err)
+	defer tbl.unref()
+
+	assert.Greater(t, len(tbl.index), 1)
+
+	rec, ok, err := tbl.get("key-0042")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, record{value: "value-42", expireAt: 42}, rec)
+
+	rec, ok, err = tbl.get("deleted")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.True(t, rec.tombstone)
+
+	for _, key := range []string{"key-1000", "a", "zzz"} {
+		_, ok, err = tbl.get(key)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+
+	var keys []string
+	it := tbl.iterator()
+	for ; it.valid(); it.next() {
+		keys = append(keys, it.key())
+	}
+	require.NoError(t, it.err())
+	assert.Len(t, keys, 1001)
+	assert.IsIncreasing(t, keys)
+}
+
+func TestTable_empty(t *testing.T) {
+	dir := t.TempDir()
+
+	tbl, err := writeTable(dir, 1, newMemtable().iterator(), 256, 10)
+	require.NoError(t, err)
+	assert.Nil(t, tbl)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestTable_corrupted(t *testing.T) {
+	dir := t.TempDir()
+
+	mem := newMemtable()
+	mem.put("key", record{value: "value"})
+	tbl, err := writeTable(dir, 1, mem.iterator(), 256, 10)
+	require.NoError(t, err)
+	require.NoError(t, tbl.unref())
+
+	data, err := os.ReadFile(tablePath(dir, 1))
+	require.NoError(t, err)
+	data[1] ^= 0xff
+	require.NoError(t, os.WriteFile(tablePath(dir, 1), data, 0o600))
+
+	tbl, err = openTable(dir, 1)
+	require.NoError(t, err)
+	defer tbl.unref()
+
+	_, _, err = tbl.get("key")
+	require.ErrorIs(t, err, ErrCorrupted)
+
+	require.NoError(t, os.WriteFile(tablePath(dir, 2), data[:10], 0o600))
+	_, err = openTable(dir, 2)
+	require.ErrorIs(t, err, ErrCorrupted)
+}
+
+func TestBloomFilter(t *testing.T) {
+	const numKeys = 10000
+
+	hashes := make([]uint32, 0, numKeys)
+	for i := range numKeys {
+		hashes = append(hashes, bloomHash(fmt.Sprintf("key-%d", i)))
+	}
+	filter := newBloomFilter(hashes, 10)
+
+	for i := range numKeys {
+		require.True(t, filter.mayContain(fmt.Sprintf("key-%d", i)))
+	}
+
+	var falsePositives int
+	for i := range numKeys {
+		if filter.mayContain(fmt.Sprintf("missing-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/numKeys, 0.02)
+}
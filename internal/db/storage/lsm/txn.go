@@ -0,0 +1,342 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+	"github.com/Mort4lis/memdb/internal/db/storage"
+)
+
+// Atomic calls fn with the exclusive access to the engine. The writes made
+// through tx are buffered and committed as the single WAL record, so they
+// survive a crash all together or not at all. Nothing is written if fn fails.
+func (e *Engine) Atomic(ctx context.Context, fn func(tx storage.Tx) error) error {
+	e.mu.Lock()
+	if err := e.makeRoomForWrite(); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+
+	tx := &txn{e: e, writes: make(map[string]record)}
+	if err := fn(tx); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+
+	wait, err := tx.commit()
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return wait(ctx)
+}
+
+// txn buffers the writes until the commit. It's used while the lock is held.
+type txn struct {
+	e      *Engine
+	writes map[string]record
+	// events are emitted in order on the commit.
+	events []storage.Event
+}
+
+// put buffers the record of the key changed as the event type tells.
+func (t *txn) put(key string, rec record, typ storage.EventType) {
+	t.writes[key] = rec
+	t.events = append(t.events, storage.Event{Type: typ, Key: key})
+}
+
+// del buffers the tombstone of the key and reports whether the key was live,
+// only the removal of the live key is reported by the event.
+func (t *txn) del(key string) (bool, error) {
+	_, err := t.lookup(key)
+	if err != nil && !errors.Is(err, dberrors.ErrNotFound) {
+		return false, err
+	}
+	if err != nil {
+		t.writes[key] = record{tombstone: true}
+		return false, nil
+	}
+	t.put(key, record{tombstone: true}, storage.EventDel)
+	return true, nil
+}
+
+func (t *txn) Set(_ context.Context, key, value string) error {
+	t.put(key, record{value: value}, storage.EventSet)
+	return nil
+}
+
+func (t *txn) SetWithExpiration(_ context.Context, key, value string, expireAt time.Time) error {
+	if !expireAt.After(t.e.now()) {
+		_, err := t.del(key)
+		return err
+	}
+	t.put(key, record{value: value, expireAt: expireAt.UnixNano()}, storage.EventSet)
+	return nil
+}
+
+func (t *txn) Get(_ context.Context, key string) (string, error) {
+	rec, err := t.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	return rec.stringValue()
+}
+
+func (t *txn) Del(_ context.Context, key string) error {
+	_, err := t.del(key)
+	return err
+}
+
+func (t *txn) SetIf(
+	ctx context.Context, key, value string, expireAt time.Time, cond storage.Condition,
+) (storage.SetResult, error) {
+	var res storage.SetResult
+	rec, err := t.lookup(key)
+	if err == nil {
+		if res.Old, err = rec.stringValue(); err != nil {
+			return storage.SetResult{}, err
+		}
+		res.Existed = true
+	} else if !errors.Is(err, dberrors.ErrNotFound) {
+		return storage.SetResult{}, err
+	}
+	if cond != nil && !cond(res.Old, res.Existed) {
+		return res, nil
+	}
+
+	if expireAt.IsZero() {
+		err = t.Set(ctx, key, value)
+	} else {
+		err = t.SetWithExpiration(ctx, key, value, expireAt)
+	}
+	if err != nil {
+		return storage.SetResult{}, err
+	}
+	res.Written = true
+	return res, nil
+}
+
+func (t *txn) GetDel(_ context.Context, key string) (string, error) {
+	rec, err := t.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	value, err := rec.stringValue()
+	if err != nil {
+		return "", err
+	}
+	t.put(key, record{tombstone: true}, storage.EventDel)
+	return value, nil
+}
+
+func (t *txn) MSet(_ context.Context, pairs []storage.KeyValue) error {
+	for _, p := range pairs {
+		t.put(p.Key, record{value: p.Value}, storage.EventSet)
+	}
+	return nil
+}
+
+func (t *txn) MGet(_ context.Context, keys []string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		rec, err := t.lookup(key)
+		if errors.Is(err, dberrors.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.typ == storage.StringType {
+			values[key] = rec.value
+		}
+	}
+	return values, nil
+}
+
+func (t *txn) MDel(_ context.Context, keys []string) (int, error) {
+	var n int
+	for _, key := range keys {
+		live, err := t.del(key)
+		if err != nil {
+			return 0, err
+		}
+		if live {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (t *txn) View(_ context.Context, key string, fn storage.ViewFunc) error {
+	v, err := lookupValue(t.lookup, key)
+	if err != nil {
+		return err
+	}
+	return fn(v)
+}
+
+func (t *txn) MView(_ context.Context, keys []string, fn storage.MViewFunc) error {
+	vs, err := lookupValues(t.lookup, keys)
+	if err != nil {
+		return err
+	}
+	return fn(vs)
+}
+
+// Mutate decodes the value, so fn always changes the copy of it.
+func (t *txn) Mutate(_ context.Context, key string, fn storage.MutateFunc) error {
+	var current storage.Value
+	rec, err := t.lookup(key)
+	switch {
+	case err == nil:
+		if current, err = rec.decode(); err != nil {
+			return err
+		}
+	case !errors.Is(err, dberrors.ErrNotFound):
+		return err
+	}
+
+	v, err := fn(current)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if current != nil {
+			t.put(key, record{tombstone: true}, storage.EventDel)
+		}
+		return nil
+	}
+	t.put(key, record{value: storage.MarshalValue(v), typ: v.Type(), expireAt: rec.expireAt}, storage.EventSet)
+	return nil
+}
+
+func (t *txn) Update(_ context.Context, key string, fn storage.UpdateFunc) (string, error) {
+	rec, err := t.lookup(key)
+	exists := err == nil
+	if err != nil && !errors.Is(err, dberrors.ErrNotFound) {
+		return "", err
+	}
+	if exists && rec.typ != storage.StringType {
+		return "", dberrors.ErrWrongType
+	}
+
+	value, err := fn(rec.value, exists)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		rec = record{}
+	}
+	rec.value = value
+	t.put(key, rec, storage.EventSet)
+	return value, nil
+}
+
+func (t *txn) Expire(_ context.Context, key string, expireAt time.Time) (bool, error) {
+	rec, err := t.lookup(key)
+	if errors.Is(err, dberrors.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !expireAt.After(t.e.now()) {
+		t.put(key, record{tombstone: true}, storage.EventDel)
+		return true, nil
+	}
+	rec.expireAt = expireAt.UnixNano()
+	t.put(key, rec, storage.EventExpire)
+	return true, nil
+}
+
+func (t *txn) Persist(_ context.Context, key string) (bool, error) {
+	rec, err := t.lookup(key)
+	if errors.Is(err, dberrors.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil || rec.expireAt == 0 {
+		return false, err
+	}
+
+	rec.expireAt = 0
+	t.put(key, rec, storage.EventPersist)
+	return true, nil
+}
+
+func (t *txn) ExpireTime(_ context.Context, key string) (time.Time, error) {
+	rec, err := t.lookup(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rec.expireAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, rec.expireAt), nil
+}
+
+func (t *txn) Stats(_ context.Context) (storage.Stats, error) {
+	its, tables := t.e.sources()
+	defer t.e.release(tables)
+
+	pending := &memtable{data: t.writes}
+	its = append([]iterator{pending.iterator()}, its...)
+
+	var stats storage.Stats
+	err := t.e.scanIterators(its, func(string, record) {
+		stats.Keys++
+	})
+	if err != nil {
+		return storage.Stats{}, err
+	}
+
+	stats.UsedMemory = t.e.mem.size
+	if t.e.imm != nil {
+		stats.UsedMemory += t.e.imm.size
+	}
+	return stats, nil
+}
+
+func (t *txn) lookup(key string) (record, error) {
+	rec, ok := t.writes[key]
+	if !ok {
+		return t.e.lookup(key)
+	}
+	if !rec.live(t.e.now().UnixNano()) {
+		return record{}, dberrors.ErrNotFound
+	}
+	return rec, nil
+}
+
+// commit appends the buffered writes to the WAL and the memtable
+// and emits the events of the changes. Nothing is applied if the writes
+// fail to be appended to the WAL.
+func (t *txn) commit() (func(ctx context.Context) error, error) {
+	if len(t.writes) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	writes := make([]write, 0, len(t.writes))
+	for _, key := range slices.Sorted(maps.Keys(t.writes)) {
+		writes = append(writes, write{key: key, rec: t.writes[key]})
+	}
+
+	wait, err := t.e.wal.Append(encodeWALBatch(writes))
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range writes {
+		t.e.mem.put(w.key, w.rec)
+	}
+	for _, ev := range t.events {
+		t.e.emit(ev.Type, ev.Key)
+	}
+	if t.e.mem.size >= t.e.conf.memtableSize {
+		t.e.rotate()
+	}
+	return wait, nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// memoryBudget is the memory limit shared by the shards. The limit is checked
+// against the memory used by all of them, so the keys skewed to a single
+// shard may take all the memory, and the victims are evicted from any shard.
+type memoryBudget struct {
+	max  int64
+	used atomic.Int64
+
+	mu     sync.RWMutex
+	shards []*shard
+}
+
+func newMemoryBudget(maxMemory int64) *memoryBudget {
+	return &memoryBudget{max: maxMemory}
+}
+
+func (b *memoryBudget) register(shards ...*shard) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.shards = append(b.shards, shards...)
+}
+
+// exceeded reports whether growing by the given size exceeds the limit.
+// The concurrent writers to different shards check the limit independently,
+// so it may be exceeded by the entries they are writing at the same time.
+func (b *memoryBudget) exceeded(size int64) bool {
+	return b.max != 0 && b.used.Load()+size > b.max
+}
+
+// lockOthers calls fn for the shards other than the given one locked in
+// random order until fn returns false, and reports whether any of them was
+// busy. The busy shards are skipped rather than waited for: their writers
+// may be evicting from the given shard, which is locked by the caller,
+// so blocking on them in any order could deadlock. See shard.evict.
+func (b *memoryBudget) lockOthers(s *shard, fn func(other *shard) bool) (busy bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n := len(b.shards)
+	if n == 0 {
+		return false
+	}
+	start := rand.IntN(n) //nolint:gosec // weak random is enough here
+	for i := range n {
+		other := b.shards[(start+i)%n]
+		if other == s {
+			continue
+		}
+		if !other.mu.TryLock() {
+			busy = true
+			continue
+		}
+		next := fn(other)
+		other.mu.Unlock()
+		if !next {
+			return busy
+		}
+	}
+	return busy
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/Mort4lis/memdb/internal/pkg/glob"
+)
+
+const OrderedEngineName = "ordered"
+
+func init() {
+	Register(OrderedEngineName, func(_ *slog.Logger, _ func(v any) error, opts ...EngineOption) (Backend, error) {
+		return NewOrderedEngine(opts...), nil
+	})
+}
+
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// OrderedEngine keeps the keys in lexicographic order in addition to the hash map,
+// so it can serve range and prefix queries without scanning all the keys.
+type OrderedEngine struct {
+	*keyspace
+}
+
+func NewOrderedEngine(opts ...EngineOption) *OrderedEngine {
+	return &OrderedEngine{keyspace: newKeyspace(newEngineConfig(opts), 1, true)}
+}
+
+// Range returns the key-value pairs with start <= key < end in ascending order.
+// An empty end means there is no upper bound, non-positive limit means no limit.
+// The keys holding the values of other types than strings are skipped.
+func (e *OrderedEngine) Range(_ context.Context, start, end string, limit int) ([]KeyValue, error) {
+	s := e.shards[0]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return rangeShard(s, start, end, limit), nil
+}
+
+// Scan examines up to count keys starting from the cursor key inclusive and
+// returns the ones matching the glob pattern. An empty cursor starts a new
+// iteration, the returned cursor is the key to continue from or an empty
+// string if the iteration is over.
+//
+// The cursor is the key itself, so the keys existing during the whole
+// iteration are returned exactly once regardless of concurrent writes.
+func (e *OrderedEngine) Scan(_ context.Context, cursor, pattern string, count int) ([]string, string, error) {
+	s := e.shards[0]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys, next := scanShard(s, cursor, pattern, count)
+	return keys, next, nil
+}
+
+// Atomic calls fn with the exclusive access to the storage like
+// keyspace.Atomic, tx additionally supports range queries.
+func (e *OrderedEngine) Atomic(_ context.Context, fn func(tx Tx) error) error {
+	e.lockAll()
+	defer e.unlockAll()
+
+	tx := &orderedTxn{txn: newTxn(e.keyspace)}
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	return nil
+}
+
+type orderedTxn struct {
+	txn
+}
+
+func (t *orderedTxn) Range(_ context.Context, start, end string, limit int) ([]KeyValue, error) {
+	return rangeShard(t.k.shards[0], start, end, limit), nil
+}
+
+func (t *orderedTxn) Scan(_ context.Context, cursor, pattern string, count int) ([]string, string, error) {
+	keys, next := scanShard(t.k.shards[0], cursor, pattern, count)
+	return keys, next, nil
+}
+
+func rangeShard(s *shard, start, end string, limit int) []KeyValue {
+	var kvs []KeyValue
+	s.ascend(start, func(key string, ent *entry) bool {
+		if end != "" && key >= end {
+			return false
+		}
+		if value, ok := ent.value.(String); ok {
+			kvs = append(kvs, KeyValue{Key: key, Value: string(value)})
+		}
+		return limit <= 0 || len(kvs) < limit
+	})
+	return kvs
+}
+
+func scanShard(s *shard, cursor, pattern string, count int) ([]string, string) {
+	var (
+		keys     []string
+		next     string
+		examined int
+		prefix   = glob.Prefix(pattern)
+	)
+
+	from := max(cursor, prefix)
+	s.ascend(from, func(key string, _ *entry) bool {
+		if !strings.HasPrefix(key, prefix) {
+			// The keys having the prefix are adjacent, there are no more of them.
+			return false
+		}
+		if examined == count {
+			next = key
+			return false
+		}
+
+		examined++
+		if glob.Match(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, next
+}
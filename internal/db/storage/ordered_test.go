@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipList(t *testing.T) {
+	l := newSkipList()
+
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%04d", i)
+	}
+	for _, i := range rand.Perm(len(keys)) {
+		l.insert(keys[i])
+		l.insert(keys[i])
+	}
+	require.Equal(t, len(keys), l.len)
+
+	for i := 0; i < len(keys); i += 2 {
+		l.delete(keys[i])
+	}
+	l.delete("missing")
+
+	var got []string
+	for node := l.seek(""); node != nil; node = node.next[0] {
+		got = append(got, node.key)
+	}
+
+	var want []string
+	for i := 1; i < len(keys); i += 2 {
+		want = append(want, keys[i])
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, len(want), l.len)
+
+	assert.Equal(t, "key-0011", l.seek("key-0010").key)
+	assert.Equal(t, "key-0011", l.seek("key-0011").key)
+	assert.Nil(t, l.seek("key-9999"))
+}
+
+func TestOrderedEngine_Range(t *testing.T) {
+	e := NewOrderedEngine()
+	defer e.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"d", "a", "c", "b", "e"} {
+		require.NoError(t, e.Set(ctx, key, key+"-value"))
+	}
+	require.NoError(t, e.SetWithExpiration(ctx, "bb", "expired", time.Now().Add(time.Millisecond)))
+	time.Sleep(2 * time.Millisecond)
+
+	testCases := []struct {
+		name       string
+		start, end string
+		limit      int
+		want       []string
+	}{
+		{name: "all", start: "", end: "", want: []string{"a", "b", "c", "d", "e"}},
+		{name: "half-open", start: "b", end: "d", want: []string{"b", "c"}},
+		{name: "limit", start: "b", end: "", limit: 2, want: []string{"b", "c"}},
+		{name: "between keys", start: "aa", end: "cc", want: []string{"b", "c"}},
+		{name: "empty", start: "x", end: "z", want: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvs, err := e.Range(ctx, tc.start, tc.end, tc.limit)
+			require.NoError(t, err)
+
+			var keys []string
+			for _, kv := range kvs {
+				assert.Equal(t, kv.Key+"-value", kv.Value)
+				keys = append(keys, kv.Key)
+			}
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+}
+
+func TestOrderedEngine_Scan(t *testing.T) {
+	e := NewOrderedEngine()
+	defer e.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"user:1:name", "user:1:age", "user:2:name", "user:10:name", "session:1", "zzz"} {
+		require.NoError(t, e.Set(ctx, key, "value"))
+	}
+
+	scanAll := func(pattern string, count int) []string {
+		var (
+			all    []string
+			cursor string
+		)
+		for {
+			keys, next, err := e.Scan(ctx, cursor, pattern, count)
+			require.NoError(t, err)
+			all = append(all, keys...)
+			if next == "" {
+				return all
+			}
+			cursor = next
+		}
+	}
+
+	assert.Equal(t, []string{"session:1", "user:10:name", "user:1:age", "user:1:name", "user:2:name", "zzz"}, scanAll("*", 1))
+	assert.Equal(t, []string{"user:1:age", "user:1:name"}, scanAll("user:1:*", 1))
+	assert.Equal(t, []string{"user:10:name", "user:1:name", "user:2:name"}, scanAll("user:*:name", 2))
+	assert.Equal(t, []string{"user:1:name", "user:2:name"}, scanAll("user:?:name", 10))
+	assert.Empty(t, scanAll("nobody:*", 10))
+}
+
+func TestOrderedEngine_Scan_concurrentWrites(t *testing.T) {
+	e := NewOrderedEngine()
+	defer e.Close()
+
+	ctx := context.Background()
+	stable := make([]string, 500)
+	for i := range stable {
+		stable[i] = fmt.Sprintf("stable:%03d", i)
+		require.NoError(t, e.Set(ctx, stable[i], "value"))
+	}
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			key := fmt.Sprintf("stable:%03d:volatile", rand.IntN(len(stable)))
+			if i%2 == 0 {
+				assert.NoError(t, e.Set(ctx, key, "value"))
+			} else {
+				assert.NoError(t, e.Del(ctx, key))
+			}
+		}
+	}()
+
+	var (
+		got    []string
+		cursor string
+	)
+	for {
+		keys, next, err := e.Scan(ctx, cursor, "stable:???", 7)
+		require.NoError(t, err)
+		got = append(got, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	close(done)
+	wg.Wait()
+
+	assert.True(t, slices.IsSorted(got))
+	assert.Equal(t, stable, got)
+}
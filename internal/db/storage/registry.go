@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownEngine = errors.New("unknown storage engine")
+
+// UpdateFunc returns the new value of the key given the current one,
+// exists is false if the key doesn't exist.
+type UpdateFunc func(value string, exists bool) (string, error)
+
+// ViewFunc is called with the value of the key, nil if the key doesn't exist.
+// It must neither change nor retain the value.
+type ViewFunc func(v Value) error
+
+// MViewFunc is called with the values of the keys in the same order, nil for
+// the missing keys. It must neither change nor retain the values.
+type MViewFunc func(vs []Value) error
+
+// MutateFunc returns the new value of the key given the current one, nil
+// if the key doesn't exist. It may change the current value in place and
+// return it, nil removes the key. It must not change the value if it fails.
+type MutateFunc func(v Value) (Value, error)
+
+// Condition reports whether the conditional write is applied given
+// the current value of the key, exists is false if the key doesn't exist.
+type Condition func(value string, exists bool) bool
+
+var (
+	IfExists    Condition = func(_ string, exists bool) bool { return exists }
+	IfNotExists Condition = func(_ string, exists bool) bool { return !exists }
+)
+
+// IfEquals holds if the key exists and has the expected value.
+func IfEquals(expected string) Condition {
+	return func(value string, exists bool) bool {
+		return exists && value == expected
+	}
+}
+
+// SetResult describes the key before the conditional write.
+type SetResult struct {
+	Old     string
+	Existed bool
+	Written bool
+}
+
+// Tx is the view of the storage passed to the function applied atomically.
+type Tx interface {
+	Set(ctx context.Context, key, value string) error
+	SetWithExpiration(ctx context.Context, key, value string, expireAt time.Time) error
+	Get(ctx context.Context, key string) (string, error)
+	Del(ctx context.Context, key string) error
+	// SetIf stores the value if cond holds, nil cond always holds.
+	// Zero expireAt means the key doesn't expire.
+	SetIf(ctx context.Context, key, value string, expireAt time.Time, cond Condition) (SetResult, error)
+	// GetDel removes the key and returns its value.
+	GetDel(ctx context.Context, key string) (string, error)
+	// MSet stores all the pairs or none of them.
+	MSet(ctx context.Context, pairs []KeyValue) error
+	// MGet returns the values of the existing keys.
+	MGet(ctx context.Context, keys []string) (map[string]string, error)
+	// MDel removes the keys and returns the number of the existing ones.
+	MDel(ctx context.Context, keys []string) (int, error)
+	// Update replaces the value of the key with the one returned by fn
+	// keeping the deadline of the key, and returns the new value.
+	// Nothing is changed if fn fails.
+	Update(ctx context.Context, key string, fn UpdateFunc) (string, error)
+	// View calls fn with the value of the key of any type.
+	View(ctx context.Context, key string, fn ViewFunc) error
+	// MView calls fn with the values of the keys observed at the same moment.
+	MView(ctx context.Context, keys []string, fn MViewFunc) error
+	// Mutate replaces the value of the key of any type with the one returned
+	// by fn keeping the deadline of the key.
+	Mutate(ctx context.Context, key string, fn MutateFunc) error
+	Expire(ctx context.Context, key string, expireAt time.Time) (bool, error)
+	Persist(ctx context.Context, key string) (bool, error)
+	ExpireTime(ctx context.Context, key string) (time.Time, error)
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// Backend is implemented by every storage engine the database can run on.
+type Backend interface {
+	Tx
+	// Atomic calls fn so that the operations made through tx are observed
+	// by the other users of the storage as applied all at once. The changes
+	// made through tx are discarded if fn fails.
+	Atomic(ctx context.Context, fn func(tx Tx) error) error
+	Dump() map[string]Entry
+	// Snapshot captures the data cheaply and returns the function copying it,
+	// the function must be called once and may run concurrently with the changes.
+	Snapshot() func() map[string]Entry
+	Load(data map[string]Entry)
+	io.Closer
+}
+
+// Durable is implemented by the storage engines keeping the data on disk.
+// Such engines recover the data on their own when they are opened.
+type Durable interface {
+	Durable() bool
+}
+
+// Factory creates the storage engine. The decode function unmarshals
+// the engine's own configuration sub-section into the given value and
+// leaves the value untouched if there is no such sub-section.
+// The engine fails if it doesn't support the options given.
+type Factory func(logger *slog.Logger, decode func(v any) error, opts ...EngineOption) (Backend, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes the storage engine available by the provided name.
+// It panics if Register is called twice with the same name or if factory is nil.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("storage: register factory is nil")
+	}
+	if _, ok := factories[name]; ok {
+		panic("storage: register called twice for engine " + name)
+	}
+	factories[name] = factory
+}
+
+// Engines returns the sorted list of the registered engine names.
+func Engines() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	return slices.Sorted(maps.Keys(factories))
+}
+
+// New creates the storage engine registered by the provided name.
+func New(logger *slog.Logger, name string, decode func(v any) error, opts ...EngineOption) (Backend, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available engines: %s", ErrUnknownEngine, name, strings.Join(Engines(), ", "))
+	}
+
+	backend, err := factory(logger, decode, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create %s storage engine: %w", name, err)
+	}
+	return backend, nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	noConfig := func(any) error { return nil }
+
+	testCases := []struct {
+		name    string
+		engine  string
+		decode  func(v any) error
+		check   func(t *testing.T, backend Backend)
+		wantErr error
+	}{
+		{
+			name:   "in memory",
+			engine: InMemoryEngineName,
+			decode: noConfig,
+			check: func(t *testing.T, backend Backend) {
+				assert.IsType(t, &Engine{}, backend)
+			},
+		},
+		{
+			name:   "sharded with config",
+			engine: ShardedEngineName,
+			decode: func(v any) error {
+				v.(*ShardedEngineConfig).Shards = 3
+				return nil
+			},
+			check: func(t *testing.T, backend Backend) {
+				require.IsType(t, &ShardedEngine{}, backend)
+				assert.Len(t, backend.(*ShardedEngine).shards, 3)
+			},
+		},
+		{
+			name:   "sharded decode error",
+			engine: ShardedEngineName,
+			decode: func(any) error {
+				return errTest
+			},
+			wantErr: errTest,
+		},
+		{
+			name:    "unknown engine",
+			engine:  "unknown",
+			decode:  noConfig,
+			wantErr: ErrUnknownEngine,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, err := New(logger, tc.engine, tc.decode)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer backend.Close()
+
+			tc.check(t, backend)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	factory := func(*slog.Logger, func(v any) error, ...EngineOption) (Backend, error) {
+		return NewEngine(), nil
+	}
+
+	Register("test", factory)
+	t.Cleanup(func() {
+		factoriesMu.Lock()
+		delete(factories, "test")
+		factoriesMu.Unlock()
+	})
+
+	assert.Contains(t, Engines(), "test")
+	assert.Panics(t, func() { Register("test", factory) })
+	assert.Panics(t, func() { Register("nil", nil) })
+}
+
+var (
+	logger  = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	errTest = errors.New("test error")
+)
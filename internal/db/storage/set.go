@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+)
+
+// memberOverhead approximates the memory used by the map slot of the member.
+const memberOverhead = 24
+
+// Set is the unordered collection of the unique members.
+type Set struct {
+	members map[string]struct{}
+	size    int64
+}
+
+func NewSet() *Set {
+	return &Set{members: make(map[string]struct{})}
+}
+
+func (s *Set) Type() Type  { return SetType }
+func (s *Set) Size() int64 { return s.size }
+
+func (s *Set) Clone() Value {
+	return &Set{members: maps.Clone(s.members), size: s.size}
+}
+
+func (s *Set) Len() int {
+	return len(s.members)
+}
+
+func (s *Set) Contains(member string) bool {
+	_, ok := s.members[member]
+	return ok
+}
+
+// Add adds the member and returns false if it already exists.
+func (s *Set) Add(member string) bool {
+	if s.Contains(member) {
+		return false
+	}
+	s.members[member] = struct{}{}
+	s.size += int64(len(member) + memberOverhead)
+	return true
+}
+
+// Remove removes the member and returns false if it doesn't exist.
+func (s *Set) Remove(member string) bool {
+	if !s.Contains(member) {
+		return false
+	}
+	delete(s.members, member)
+	s.size -= int64(len(member) + memberOverhead)
+	return true
+}
+
+// Members returns the members in ascending order, it's never nil.
+func (s *Set) Members() []string {
+	members := slices.AppendSeq(make([]string, 0, len(s.members)), maps.Keys(s.members))
+	slices.Sort(members)
+	return members
+}
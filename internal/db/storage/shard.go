@@ -0,0 +1,535 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+// shard is an independent part of the keyspace guarded by its own lock.
+// The lock is held by the caller of the methods unless stated otherwise.
+type shard struct {
+	conf *EngineConfig
+	mem  *memoryBudget
+	now  func() time.Time
+
+	mu   sync.RWMutex
+	data map[string]*entry
+	// expires contains the keys having a deadline, it's used by
+	// the background expiration to avoid scanning all the keys.
+	expires map[string]struct{}
+	// index keeps the keys in order, it's nil if the shard is unordered.
+	index *skipList
+	// usedMemory is the part of the memory budget used by the shard.
+	usedMemory int64
+	// snap is set while the snapshot of the shard is being exported.
+	snap *shardSnapshot
+
+	evicted atomic.Uint64
+	expired atomic.Uint64
+}
+
+func newShard(conf *EngineConfig, mem *memoryBudget) *shard {
+	return &shard{
+		conf:    conf,
+		mem:     mem,
+		now:     time.Now,
+		data:    make(map[string]*entry),
+		expires: make(map[string]struct{}),
+	}
+}
+
+func (s *shard) set(key, value string) error {
+	return s.put(key, newEntry(String(value), 0, s.now().UnixNano()))
+}
+
+func (s *shard) setWithExpiration(key, value string, expireAt time.Time) error {
+	now := s.now()
+	if !expireAt.After(now) {
+		s.discard(key, EventDel)
+		return nil
+	}
+	return s.put(key, newEntry(String(value), expireAt.UnixNano(), now.UnixNano()))
+}
+
+func (s *shard) get(key string) (string, error) {
+	ent, ok := s.lookup(key)
+	if !ok {
+		return "", dberrors.ErrNotFound
+	}
+	value, ok := ent.value.(String)
+	if !ok {
+		return "", dberrors.ErrWrongType
+	}
+	return string(value), nil
+}
+
+func (s *shard) del(key string) {
+	s.discard(key, EventDel)
+}
+
+func (s *shard) setIf(key, value string, expireAt time.Time, cond Condition) (SetResult, error) {
+	var res SetResult
+	if ent, ok := s.lookup(key); ok {
+		value, ok := ent.value.(String)
+		if !ok {
+			return SetResult{}, dberrors.ErrWrongType
+		}
+		res.Old, res.Existed = string(value), true
+	}
+	if cond != nil && !cond(res.Old, res.Existed) {
+		return res, nil
+	}
+
+	var err error
+	if expireAt.IsZero() {
+		err = s.set(key, value)
+	} else {
+		err = s.setWithExpiration(key, value, expireAt)
+	}
+	if err != nil {
+		return SetResult{}, err
+	}
+	res.Written = true
+	return res, nil
+}
+
+func (s *shard) getDel(key string) (string, error) {
+	value, err := s.get(key)
+	if err != nil {
+		return "", err
+	}
+	s.discard(key, EventDel)
+	return value, nil
+}
+
+func (s *shard) update(key string, fn UpdateFunc) (string, error) {
+	var (
+		value    string
+		expireAt int64
+	)
+	ent, ok := s.lookup(key)
+	if ok {
+		current, isString := ent.value.(String)
+		if !isString {
+			return "", dberrors.ErrWrongType
+		}
+		value, expireAt = string(current), ent.expireAt
+	}
+
+	value, err := fn(value, ok)
+	if err != nil {
+		return "", err
+	}
+	if err = s.put(key, newEntry(String(value), expireAt, s.now().UnixNano())); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (s *shard) view(key string, fn ViewFunc) error {
+	ent, ok := s.lookup(key)
+	if !ok {
+		return fn(nil)
+	}
+	return fn(ent.value)
+}
+
+// mutate changes the value of the key keeping its deadline. The value may be
+// changed in place, so its new size is known only after fn. Like Redis does,
+// the memory limit is checked before the change, which may exceed it slightly.
+func (s *shard) mutate(key string, fn MutateFunc) error {
+	var (
+		current  Value
+		expireAt int64
+		oldSize  int64
+	)
+	ent, ok := s.lookup(key)
+	if ok {
+		current, expireAt, oldSize = ent.value, ent.expireAt, entrySize(key, ent)
+	}
+	if err := s.reserve(key, 1); err != nil {
+		return err
+	}
+
+	// fn may change the value in place.
+	s.preserve(key)
+	value, err := fn(current)
+	if err != nil {
+		return err
+	}
+	if ok {
+		// Account for the changes made in place.
+		s.charge(entrySize(key, ent) - oldSize)
+	}
+
+	switch {
+	case value == nil:
+		s.discard(key, EventDel)
+		return nil
+	case ok && value == current:
+		s.emit(EventSet, key)
+		return nil
+	default:
+		return s.put(key, newEntry(value, expireAt, s.now().UnixNano()))
+	}
+}
+
+func (s *shard) expire(key string, expireAt time.Time) bool {
+	ent, ok := s.lookup(key)
+	if !ok {
+		return false
+	}
+	if !expireAt.After(s.now()) {
+		s.discard(key, EventDel)
+		return true
+	}
+
+	s.preserve(key)
+	ent.expireAt = expireAt.UnixNano()
+	s.expires[key] = struct{}{}
+	s.emit(EventExpire, key)
+	return true
+}
+
+func (s *shard) persist(key string) bool {
+	ent, ok := s.lookup(key)
+	if !ok || ent.expireAt == 0 {
+		return false
+	}
+
+	s.preserve(key)
+	ent.expireAt = 0
+	delete(s.expires, key)
+	s.emit(EventPersist, key)
+	return true
+}
+
+func (s *shard) expireTime(key string) (time.Time, error) {
+	ent, ok := s.lookup(key)
+	if !ok {
+		return time.Time{}, dberrors.ErrNotFound
+	}
+	if ent.expireAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, ent.expireAt), nil
+}
+
+func (s *shard) stats() Stats {
+	return Stats{
+		Keys:        len(s.data),
+		UsedMemory:  s.usedMemory,
+		EvictedKeys: s.evicted.Load(),
+		ExpiredKeys: s.expired.Load(),
+	}
+}
+
+// lookup returns the entry treating expired keys as missing ones,
+// they are reclaimed later by the background expiration.
+func (s *shard) lookup(key string) (*entry, bool) {
+	ent, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	now := s.now().UnixNano()
+	if ent.expired(now) {
+		return nil, false
+	}
+	ent.touch(now)
+	return ent, true
+}
+
+// put stores the entry evicting other keys if the memory limit is reached.
+func (s *shard) put(key string, ent *entry) error {
+	size := entrySize(key, ent)
+	if s.mem.max != 0 && size > s.mem.max {
+		// Don't evict anything if the entry can't fit anyway.
+		return dberrors.ErrOutOfMemory
+	}
+	old, exists := s.data[key]
+	if exists {
+		size -= entrySize(key, old)
+	}
+	if err := s.reserve(key, size); err != nil {
+		return err
+	}
+
+	s.preserve(key)
+	s.data[key] = ent
+	if !exists && s.index != nil {
+		s.index.insert(key)
+	}
+	s.charge(size)
+	if ent.expireAt != 0 {
+		s.expires[key] = struct{}{}
+	} else {
+		delete(s.expires, key)
+	}
+	s.emit(EventSet, key)
+	return nil
+}
+
+func (s *shard) remove(key string) {
+	ent, ok := s.data[key]
+	if !ok {
+		return
+	}
+	s.preserve(key)
+
+	s.charge(-entrySize(key, ent))
+	delete(s.data, key)
+	delete(s.expires, key)
+	if s.index != nil {
+		s.index.delete(key)
+	}
+}
+
+// discard removes the key emitting the event if the key was live.
+func (s *shard) discard(key string, typ EventType) {
+	ent, ok := s.data[key]
+	if !ok {
+		return
+	}
+
+	live := !ent.expired(s.now().UnixNano())
+	s.remove(key)
+	if live {
+		s.emit(typ, key)
+	}
+}
+
+// emit notifies the listener of the engine about the change of the key.
+func (s *shard) emit(typ EventType, key string) {
+	if l := s.conf.eventListener; l != nil {
+		l(Event{Type: typ, DB: s.conf.database, Key: key, Time: s.now()})
+	}
+}
+
+// charge changes the memory used by the shard and its budget.
+func (s *shard) charge(size int64) {
+	s.usedMemory += size
+	s.mem.used.Add(size)
+}
+
+// reserve evicts keys until there is enough memory to grow by the given
+// size. The key being written is never chosen as a victim.
+func (s *shard) reserve(key string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	for s.mem.exceeded(size) {
+		if !s.evict(key) {
+			return dberrors.ErrOutOfMemory
+		}
+	}
+	return nil
+}
+
+const (
+	// evictionRetries is the number of times the busy shards are retried
+	// if the shard itself has nothing to evict, see evict.
+	evictionRetries = 5
+	// evictionRetryDelay is doubled by every next retry.
+	evictionRetryDelay = 100 * time.Microsecond
+)
+
+// evict removes the key chosen by the eviction policy among the samples
+// of the shard and another shard of the memory budget, so the shard having
+// few keys doesn't run out of them while the others keep theirs.
+// The other shards busy at the moment are skipped, they are retried if the
+// shard itself has nothing to evict. The write still fails if they stay busy,
+// e.g. being locked by the same transaction. It returns false if there is
+// nothing to evict.
+func (s *shard) evict(exclude string) bool {
+	policy := s.conf.evictionPolicy
+	for attempt := 0; ; attempt++ {
+		var (
+			own     = s.evictionCandidates(exclude)
+			evicted bool
+		)
+		busy := s.mem.lockOthers(s, func(other *shard) bool {
+			candidates := append(own[:len(own):len(own)], other.evictionCandidates("")...)
+			idx := policy.Victim(candidates)
+			if idx < 0 || idx >= len(candidates) {
+				// Neither shard has the keys to evict, try the next one.
+				return true
+			}
+			victim := s
+			if idx >= len(own) {
+				victim = other
+			}
+			victim.evictKey(candidates[idx].Key)
+			evicted = true
+			return false
+		})
+		if evicted {
+			return true
+		}
+
+		// The other shards are busy or there are none.
+		if idx := policy.Victim(own); idx >= 0 && idx < len(own) {
+			s.evictKey(own[idx].Key)
+			return true
+		}
+		if !busy || attempt == evictionRetries {
+			return false
+		}
+		time.Sleep(evictionRetryDelay << attempt)
+	}
+}
+
+func (s *shard) evictKey(key string) {
+	s.remove(key)
+	s.evicted.Add(1)
+	s.emit(EventEvicted, key)
+}
+
+// evictionCandidates returns the random sample of the keys the eviction
+// policy chooses the victim from.
+func (s *shard) evictionCandidates(exclude string) []EvictionCandidate {
+	var (
+		now        = s.now()
+		policy     = s.conf.evictionPolicy
+		candidates = make([]EvictionCandidate, 0, s.conf.evictionSampleSize)
+	)
+
+	collect := func(key string) bool {
+		if key == exclude {
+			return true
+		}
+
+		ent := s.data[key]
+		lastAccess := time.Unix(0, ent.lastAccess.Load())
+		candidates = append(candidates, EvictionCandidate{
+			Key:        key,
+			LastAccess: lastAccess,
+			Frequency:  lfuDecay(uint8(ent.frequency.Load()), now.Sub(lastAccess)), //nolint:gosec // frequency fits in uint8
+			ExpireAt:   time.Unix(0, ent.expireAt),
+		})
+		return len(candidates) < s.conf.evictionSampleSize
+	}
+
+	// Map iteration order is random, so the first keys make a random sample.
+	if policy.Volatile() {
+		for key := range s.expires {
+			if !collect(key) {
+				break
+			}
+		}
+	} else {
+		for key := range s.data {
+			if !collect(key) {
+				break
+			}
+		}
+	}
+	return candidates
+}
+
+// dump copies the live entries to data. It acquires the lock itself.
+func (s *shard) dump(data map[string]Entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now().UnixNano()
+	for key, ent := range s.data {
+		if ent.expired(now) {
+			continue
+		}
+		data[key] = ent.export()
+	}
+}
+
+// reset removes all the entries. It acquires the lock itself.
+func (s *shard) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snap != nil {
+		for key := range s.data {
+			s.preserve(key)
+		}
+	}
+	s.data = make(map[string]*entry)
+	s.expires = make(map[string]struct{})
+	s.charge(-s.usedMemory)
+	if s.index != nil {
+		s.index = newSkipList()
+	}
+}
+
+// load stores the entry ignoring the memory limit: it's better to load
+// everything than to lose the data silently on startup. It acquires the lock itself.
+func (s *shard) load(key string, ent Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restore(key, newEntry(ent.Value.Clone(), unixNano(ent.ExpireAt), s.now().UnixNano()))
+}
+
+// restore replaces the entry of the key ignoring the memory limit,
+// nil entry means the key is removed.
+func (s *shard) restore(key string, ent *entry) {
+	s.preserve(key)
+	s.remove(key)
+	if ent == nil {
+		return
+	}
+
+	s.data[key] = ent
+	s.charge(entrySize(key, ent))
+	if s.index != nil {
+		s.index.insert(key)
+	}
+	if ent.expireAt != 0 {
+		s.expires[key] = struct{}{}
+	}
+}
+
+// ascend calls fn for the live keys greater than or equal to the given one
+// in ascending order until fn returns false. The shard must be ordered.
+func (s *shard) ascend(from string, fn func(key string, ent *entry) bool) {
+	now := s.now().UnixNano()
+	for node := s.index.seek(from); node != nil; node = node.next[0] {
+		ent := s.data[node.key]
+		if ent.expired(now) {
+			continue
+		}
+		if !fn(node.key, ent) {
+			return
+		}
+	}
+}
+
+// expireSample removes expired keys from a random sample and returns
+// the number of removed keys. It acquires the lock itself.
+func (s *shard) expireSample() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		checked, expired int
+		now              = s.now().UnixNano()
+	)
+	// Map iteration order is random, so the first keys make a random sample.
+	for key := range s.expires {
+		if checked == s.conf.expirationSampleSize {
+			break
+		}
+		checked++
+
+		if s.data[key].expired(now) {
+			s.remove(key)
+			s.emit(EventExpired, key)
+			expired++
+		}
+	}
+
+	s.expired.Add(uint64(expired)) //nolint:gosec // expired is not negative
+	return expired
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+const ShardedEngineName = "sharded"
+
+func init() {
+	Register(ShardedEngineName, func(_ *slog.Logger, decode func(v any) error, opts ...EngineOption) (Backend, error) {
+		var conf ShardedEngineConfig
+		if err := decode(&conf); err != nil {
+			return nil, err
+		}
+		return NewShardedEngine(conf.Shards, opts...), nil
+	})
+}
+
+// ShardedEngineConfig is the configuration sub-section of the sharded engine.
+type ShardedEngineConfig struct {
+	Shards int `yaml:"shards"`
+}
+
+// ShardedEngine splits the keys among independent shards by the key hash,
+// so writes to different shards don't contend for the same lock.
+type ShardedEngine struct {
+	*keyspace
+}
+
+// NewShardedEngine creates the engine with the given number of shards.
+// If n is not positive, the number of shards depends on GOMAXPROCS.
+// The memory limit is shared by the shards.
+func NewShardedEngine(n int, opts ...EngineOption) *ShardedEngine {
+	if n <= 0 {
+		n = 4 * runtime.GOMAXPROCS(0) //nolint:mnd // ignore magic number
+	}
+	return &ShardedEngine{keyspace: newKeyspace(newEngineConfig(opts), n, false)}
+}
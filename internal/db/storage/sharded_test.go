@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dberrors "github.com/Mort4lis/memdb/internal/db/errors"
+)
+
+func TestShardedEngine(t *testing.T) {
+	e := NewShardedEngine(8)
+	defer e.Close()
+
+	ctx := context.Background()
+	const numKeys = 1000
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < numKeys; i += 4 {
+				assert.NoError(t, e.Set(ctx, fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range numKeys {
+		value, err := e.Get(ctx, fmt.Sprintf("key-%d", i))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("value-%d", i), value)
+	}
+	for _, s := range e.shards {
+		assert.NotEmpty(t, s.data, "keys must be distributed among all shards")
+	}
+
+	require.NoError(t, e.Del(ctx, "key-0"))
+	_, err := e.Get(ctx, "key-0")
+	require.ErrorIs(t, err, dberrors.ErrNotFound)
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, numKeys-1, stats.Keys)
+
+	data := e.Dump()
+	assert.Len(t, data, numKeys-1)
+
+	restored := NewShardedEngine(3)
+	defer restored.Close()
+
+	restored.Load(data)
+	assert.Equal(t, data, restored.Dump())
+}
+
+func TestShardedEngine_expiration(t *testing.T) {
+	e := NewShardedEngine(4, WithExpirationInterval(time.Millisecond))
+	defer e.Close()
+
+	ctx := context.Background()
+	expireAt := time.Now().Add(10 * time.Millisecond)
+	for i := range 100 {
+		require.NoError(t, e.SetWithExpiration(ctx, fmt.Sprintf("key-%d", i), "value", expireAt))
+	}
+
+	require.Eventually(t, func() bool {
+		stats, err := e.Stats(ctx)
+		return err == nil && stats.Keys == 0 && stats.ExpiredKeys == 100
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestShardedEngine_memoryLimit(t *testing.T) {
+	const numShards = 4
+
+	policy, err := EvictionPolicyByName(AllKeysRandomPolicy)
+	require.NoError(t, err)
+
+	e := NewShardedEngine(numShards, WithMaxMemory(int64(numShards*10*keySize)), WithEvictionPolicy(policy))
+	defer e.Close()
+
+	ctx := context.Background()
+	for i := range 1000 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("k-%03d", i), "value"))
+	}
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, stats.UsedMemory, stats.MaxMemory)
+	assert.Equal(t, uint64(1000-stats.Keys), stats.EvictedKeys)
+}
+
+func TestShardedEngine_sharedMemoryLimit(t *testing.T) {
+	const (
+		numShards = 4
+		keys      = 8
+	)
+	// The value takes the memory of half the keys, more than a shard would get
+	// if the limit was divided among the shards.
+	bigValue := strings.Repeat("x", keys/2*keySize-entryOverhead-len("big"))
+
+	testCases := []struct {
+		name        string
+		policy      string
+		fill        int
+		wantErr     error
+		wantEvicted bool
+	}{
+		{name: "skewed keys fit", policy: NoEvictionPolicy, fill: keys / 2},
+		{name: "evicted from other shards", policy: AllKeysRandomPolicy, fill: keys, wantEvicted: true},
+		{name: "out of memory", policy: NoEvictionPolicy, fill: keys, wantErr: dberrors.ErrOutOfMemory},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := EvictionPolicyByName(tc.policy)
+			require.NoError(t, err)
+
+			e := NewShardedEngine(numShards, WithMaxMemory(int64(keys*keySize)), WithEvictionPolicy(policy))
+			defer e.Close()
+
+			ctx := context.Background()
+			for i := range tc.fill {
+				require.NoError(t, e.Set(ctx, fmt.Sprintf("key-%d", i), "value"))
+			}
+			require.ErrorIs(t, e.Set(ctx, "big", bigValue), tc.wantErr)
+
+			stats, err := e.Stats(ctx)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, stats.UsedMemory, stats.MaxMemory)
+			assert.Equal(t, tc.wantEvicted, stats.EvictedKeys != 0)
+		})
+	}
+}
+
+func TestShardedEngine_evictionBusyShard(t *testing.T) {
+	const keys = 4
+
+	policy, err := EvictionPolicyByName(AllKeysRandomPolicy)
+	require.NoError(t, err)
+
+	e := NewShardedEngine(2, WithMaxMemory(int64(keys*keySize)), WithEvictionPolicy(policy))
+	defer e.Close()
+
+	// All the keys are in the second shard, the first one has nothing to evict.
+	var (
+		ctx    = context.Background()
+		filled int
+		key    string
+	)
+	for _, c := range "0123456789abcdefghijklmnopqrstuvwxyz" {
+		candidate := "key-" + string(c)
+		switch {
+		case e.shardFor(candidate) == e.shards[1] && filled < keys:
+			require.NoError(t, e.Set(ctx, candidate, "value"))
+			filled++
+		case e.shardFor(candidate) == e.shards[0]:
+			key = candidate
+		}
+	}
+	require.Equal(t, keys, filled)
+	require.NotEmpty(t, key)
+
+	// The writer waits for the busy shard instead of failing with out of memory.
+	e.shards[1].mu.Lock()
+	done := make(chan error)
+	go func() {
+		done <- e.Set(ctx, key, "value")
+	}()
+	time.Sleep(time.Millisecond)
+	e.shards[1].mu.Unlock()
+	require.NoError(t, <-done)
+
+	stats, err := e.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, keys, stats.Keys)
+	assert.Equal(t, uint64(1), stats.EvictedKeys)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"math/rand/v2"
+)
+
+const (
+	skipListMaxLevel = 32
+	// skipListP is the probability of a node to be promoted to the next level.
+	skipListP = 0.25
+)
+
+type skipListNode struct {
+	key  string
+	next []*skipListNode
+}
+
+// skipList keeps the keys in ascending lexicographic order.
+// It's not safe for concurrent use.
+type skipList struct {
+	head  *skipListNode
+	level int
+	len   int
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipListNode{next: make([]*skipListNode, skipListMaxLevel)},
+		level: 1,
+	}
+}
+
+// insert adds the key to the list. It's a no-op if the key already exists.
+func (l *skipList) insert(key string) {
+	var update [skipListMaxLevel]*skipListNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	if x.next[0] != nil && x.next[0].key == key {
+		return
+	}
+
+	level := randomSkipListLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+		}
+		l.level = level
+	}
+
+	node := &skipListNode{key: key, next: make([]*skipListNode, level)}
+	for i := range level {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	l.len++
+}
+
+// delete removes the key from the list. It's a no-op if there is no such key.
+func (l *skipList) delete(key string) {
+	var update [skipListMaxLevel]*skipListNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	node := x.next[0]
+	if node == nil || node.key != key {
+		return
+	}
+	for i := range node.next {
+		update[i].next[i] = node.next[i]
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.len--
+}
+
+// seek returns the first node with the key greater than or equal to the given one.
+func (l *skipList) seek(key string) *skipListNode {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
+
+func randomSkipListLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP { //nolint:gosec // it's not security sensitive
+		level++
+	}
+	return level
+}
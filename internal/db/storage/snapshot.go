@@ -0,0 +1,74 @@
+package storage
+
+// shardSnapshot keeps the entries of the keys changed after the snapshot
+// was taken until the shard is exported, see keyspace.Snapshot.
+type shardSnapshot struct {
+	// saved are the copies of the entries taken before the first change
+	// of their keys, nil means the key didn't exist.
+	saved map[string]*Entry
+}
+
+// preserve copies the entry of the key for the snapshot being exported
+// before the key is changed.
+func (s *shard) preserve(key string) {
+	if s.snap == nil {
+		return
+	}
+	if _, ok := s.snap.saved[key]; ok {
+		return
+	}
+
+	var saved *Entry
+	if ent, ok := s.data[key]; ok {
+		exported := ent.export()
+		saved = &exported
+	}
+	s.snap.saved[key] = saved
+}
+
+// export copies the entries as they were when the snapshot was taken and
+// stops preserving the changed keys. It acquires the lock itself.
+func (s *shard) export(data map[string]Entry) {
+	s.mu.RLock()
+	now := s.now().UnixNano()
+	for key, ent := range s.data {
+		if _, changed := s.snap.saved[key]; changed || ent.expired(now) {
+			continue
+		}
+		data[key] = ent.export()
+	}
+	for key, saved := range s.snap.saved {
+		if saved != nil && (saved.ExpireAt.IsZero() || saved.ExpireAt.UnixNano() > now) {
+			data[key] = *saved
+		}
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	s.snap = nil
+	s.mu.Unlock()
+}
+
+// Snapshot takes the snapshot of the data and returns the function
+// exporting it, which must be called once. Taking the snapshot only marks
+// the shards, so it's cheap. The shards are exported one by one while the
+// writers preserve the keys they change in the shards not exported yet.
+// The next snapshot waits until the previous one is exported.
+func (k *keyspace) Snapshot() func() map[string]Entry {
+	k.snapMu.Lock()
+	k.lockAll()
+	for _, s := range k.shards {
+		s.snap = &shardSnapshot{saved: make(map[string]*Entry)}
+	}
+	k.unlockAll()
+
+	return func() map[string]Entry {
+		defer k.snapMu.Unlock()
+
+		data := make(map[string]Entry)
+		for _, s := range k.shards {
+			s.export(data)
+		}
+		return data
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	for name, e := range map[string]Backend{
+		InMemoryEngineName: NewEngine(),
+		ShardedEngineName:  NewShardedEngine(4),
+		OrderedEngineName:  NewOrderedEngine(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer e.Close()
+
+			require.NoError(t, e.Set(ctx, "a", "1"))
+			require.NoError(t, e.SetWithExpiration(ctx, "b", "2", expireAt))
+			require.NoError(t, e.Mutate(ctx, "list", func(Value) (Value, error) {
+				l := NewList()
+				l.PushRight("x")
+				return l, nil
+			}))
+			want := e.Dump()
+
+			export := e.Snapshot()
+			require.NoError(t, e.Set(ctx, "a", "changed"))
+			_, err := e.Persist(ctx, "b")
+			require.NoError(t, err)
+			require.NoError(t, e.Mutate(ctx, "list", func(v Value) (Value, error) {
+				v.(*List).PushRight("y")
+				return v, nil
+			}))
+			require.NoError(t, e.Set(ctx, "new", "3"))
+			assert.Equal(t, want, export())
+
+			// The changes made after the export aren't preserved.
+			export = e.Snapshot()
+			e.Load(nil)
+			assert.Len(t, export(), 4)
+			assert.Empty(t, e.Dump())
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// StreamID identifies the entry of the stream. The IDs grow monotonically:
+// the first part is the time in milliseconds the entry is added at by
+// default, the sequence tells apart the entries added within the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	if c := cmp.Compare(id.Ms, other.Ms); c != 0 {
+		return c
+	}
+	return cmp.Compare(id.Seq, other.Seq)
+}
+
+// Next returns the least ID greater than id, false if id is the maximum one.
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq != math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms != math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	default:
+		return id, false
+	}
+}
+
+// StreamEntry is the entry of the stream, Fields are the field-value pairs.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// PendingEntry is the entry delivered to the consumer of the group
+// and not acknowledged yet.
+type PendingEntry struct {
+	ID          StreamID
+	Consumer    string
+	DeliveredAt time.Time
+	Deliveries  int
+}
+
+// The approximate memory used by the bookkeeping of the stream parts.
+const (
+	streamEntryOverhead  = 48
+	groupOverhead        = 64
+	pendingEntryOverhead = 64
+)
+
+// ConsumerGroup tracks the entries delivered to its consumers, every entry
+// is delivered to one consumer of the group and is pending until acknowledged.
+type ConsumerGroup struct {
+	lastDelivered StreamID
+	pending       map[StreamID]*PendingEntry
+}
+
+// Pending returns the pending entries in the ID order.
+func (g *ConsumerGroup) Pending() []PendingEntry {
+	entries := make([]PendingEntry, 0, len(g.pending))
+	for _, id := range g.pendingIDs() {
+		entries = append(entries, *g.pending[id])
+	}
+	return entries
+}
+
+// LastDelivered returns the ID of the last entry delivered to the group.
+func (g *ConsumerGroup) LastDelivered() StreamID {
+	return g.lastDelivered
+}
+
+func (g *ConsumerGroup) pendingIDs() []StreamID {
+	return slices.SortedFunc(maps.Keys(g.pending), StreamID.Compare)
+}
+
+func (g *ConsumerGroup) clone() *ConsumerGroup {
+	clone := &ConsumerGroup{lastDelivered: g.lastDelivered, pending: make(map[StreamID]*PendingEntry, len(g.pending))}
+	for id, pe := range g.pending {
+		copied := *pe
+		clone.pending[id] = &copied
+	}
+	return clone
+}
+
+// Stream is the append-only log of the entries ordered by their IDs.
+type Stream struct {
+	entries []StreamEntry
+	// lastID is the ID of the last entry ever added, it's kept
+	// when the entries are trimmed, so the IDs are never reused.
+	lastID StreamID
+	groups map[string]*ConsumerGroup
+	size   int64
+}
+
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*ConsumerGroup)}
+}
+
+func (s *Stream) Type() Type  { return StreamType }
+func (s *Stream) Size() int64 { return s.size }
+
+func (s *Stream) Clone() Value {
+	clone := &Stream{
+		entries: make([]StreamEntry, len(s.entries)),
+		lastID:  s.lastID,
+		groups:  make(map[string]*ConsumerGroup, len(s.groups)),
+		size:    s.size,
+	}
+	for i, entry := range s.entries {
+		clone.entries[i] = StreamEntry{ID: entry.ID, Fields: slices.Clone(entry.Fields)}
+	}
+	for name, g := range s.groups {
+		clone.groups[name] = g.clone()
+	}
+	return clone
+}
+
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// NextID returns the ID of the entry added at the given time, false
+// if the stream has run out of the IDs.
+func (s *Stream) NextID(ms uint64) (StreamID, bool) {
+	if ms > s.lastID.Ms {
+		return StreamID{Ms: ms}, true
+	}
+	return s.lastID.Next()
+}
+
+// Add appends the entry, false is returned if its ID isn't greater than the last one.
+func (s *Stream) Add(id StreamID, fields []string) bool {
+	if id.Compare(s.lastID) <= 0 {
+		return false
+	}
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+	s.size += entrySizeOf(fields)
+	return true
+}
+
+// Range returns up to count entries with the IDs from start to end inclusive,
+// in descending order if rev is true. Non-positive count means no limit.
+func (s *Stream) Range(start, end StreamID, count int, rev bool) []StreamEntry {
+	lo := s.search(start)
+	hi := s.search(end)
+	if hi < len(s.entries) && s.entries[hi].ID == end {
+		hi++
+	}
+	if lo >= hi {
+		return []StreamEntry{}
+	}
+
+	n := hi - lo
+	if count > 0 {
+		n = min(n, count)
+	}
+	entries := make([]StreamEntry, 0, n)
+	for i := range n {
+		if rev {
+			entries = append(entries, s.entries[hi-1-i])
+		} else {
+			entries = append(entries, s.entries[lo+i])
+		}
+	}
+	return entries
+}
+
+// Trim removes the oldest entries keeping at most maxLen ones
+// and returns the number of the removed entries.
+func (s *Stream) Trim(maxLen int) int {
+	n := len(s.entries) - max(maxLen, 0)
+	if n <= 0 {
+		return 0
+	}
+	for _, entry := range s.entries[:n] {
+		s.size -= entrySizeOf(entry.Fields)
+	}
+	s.entries = slices.Delete(s.entries, 0, n)
+	return n
+}
+
+// CreateGroup creates the group delivering the entries after the given ID,
+// false is returned if the group already exists.
+func (s *Stream) CreateGroup(name string, lastDelivered StreamID) bool {
+	if _, ok := s.groups[name]; ok {
+		return false
+	}
+	s.groups[name] = &ConsumerGroup{lastDelivered: lastDelivered, pending: make(map[StreamID]*PendingEntry)}
+	s.size += int64(len(name) + groupOverhead)
+	return true
+}
+
+func (s *Stream) Group(name string) (*ConsumerGroup, bool) {
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+// ReadGroup delivers up to count entries never delivered to the group to the
+// consumer. Unless noAck is set, they are pending until acknowledged.
+func (s *Stream) ReadGroup(g *ConsumerGroup, consumer string, count int, noAck bool, now time.Time) []StreamEntry {
+	from, ok := g.lastDelivered.Next()
+	if !ok {
+		return []StreamEntry{}
+	}
+
+	entries := s.Range(from, MaxStreamID, count, false)
+	for _, entry := range entries {
+		g.lastDelivered = entry.ID
+		if noAck {
+			continue
+		}
+		g.pending[entry.ID] = &PendingEntry{ID: entry.ID, Consumer: consumer, DeliveredAt: now, Deliveries: 1}
+		s.size += int64(len(consumer) + pendingEntryOverhead)
+	}
+	return entries
+}
+
+// ReadPending returns up to count entries pending for the consumer with
+// the IDs greater than the given one, i.e. the history of the consumer.
+// The entries trimmed from the stream are returned without fields.
+func (s *Stream) ReadPending(g *ConsumerGroup, consumer string, after StreamID, count int) []StreamEntry {
+	entries := []StreamEntry{}
+	for _, id := range g.pendingIDs() {
+		pe := g.pending[id]
+		if pe.Consumer != consumer || id.Compare(after) <= 0 {
+			continue
+		}
+		if count > 0 && len(entries) == count {
+			break
+		}
+
+		entry := StreamEntry{ID: id}
+		if i := s.search(id); i < len(s.entries) && s.entries[i].ID == id {
+			entry.Fields = s.entries[i].Fields
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Ack acknowledges the pending entries of the group and returns
+// the number of the entries which were pending.
+func (s *Stream) Ack(g *ConsumerGroup, ids ...StreamID) int {
+	var n int
+	for _, id := range ids {
+		pe, ok := g.pending[id]
+		if !ok {
+			continue
+		}
+		delete(g.pending, id)
+		s.size -= int64(len(pe.Consumer) + pendingEntryOverhead)
+		n++
+	}
+	return n
+}
+
+// search returns the index of the first entry with the ID not less than the given one.
+func (s *Stream) search(id StreamID) int {
+	i, _ := slices.BinarySearchFunc(s.entries, id, func(entry StreamEntry, id StreamID) int {
+		return entry.ID.Compare(id)
+	})
+	return i
+}
+
+func entrySizeOf(fields []string) int64 {
+	size := int64(streamEntryOverhead)
+	for _, f := range fields {
+		size += int64(len(f) + elemOverhead)
+	}
+	return size
+}
+
+// appendStream encodes the stream as the last ID, the entries and the groups
+// with their pending entries.
+func appendStream(buf []byte, s *Stream) []byte {
+	buf = appendStreamID(buf, s.lastID)
+	buf = binary.AppendUvarint(buf, uint64(len(s.entries)))
+	for _, entry := range s.entries {
+		buf = appendStreamID(buf, entry.ID)
+		buf = binary.AppendUvarint(buf, uint64(len(entry.Fields)))
+		for _, f := range entry.Fields {
+			buf = appendString(buf, f)
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(s.groups)))
+	for _, name := range slices.Sorted(maps.Keys(s.groups)) {
+		g := s.groups[name]
+		buf = appendString(buf, name)
+		buf = appendStreamID(buf, g.lastDelivered)
+		buf = binary.AppendUvarint(buf, uint64(len(g.pending)))
+		for _, pe := range g.Pending() {
+			buf = appendStreamID(buf, pe.ID)
+			buf = appendString(buf, pe.Consumer)
+			buf = binary.AppendVarint(buf, pe.DeliveredAt.UnixMilli())
+			buf = binary.AppendUvarint(buf, uint64(pe.Deliveries)) //nolint:gosec // deliveries are positive
+		}
+	}
+	return buf
+}
+
+func readStream(buf *[]byte) (*Stream, error) {
+	s := NewStream()
+	lastID, err := readStreamID(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := readUvarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	for range n {
+		id, err := readStreamID(buf)
+		if err != nil {
+			return nil, err
+		}
+		nfields, err := readUvarint(buf)
+		if err != nil || nfields > uint64(len(*buf)) {
+			return nil, ErrBadValue
+		}
+		fields := make([]string, 0, nfields)
+		for range nfields {
+			f, err := readString(buf)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+		}
+		if !s.Add(id, fields) {
+			return nil, fmt.Errorf("%w: stream entry %s out of order", ErrBadValue, id)
+		}
+	}
+	if lastID.Compare(s.lastID) < 0 {
+		return nil, fmt.Errorf("%w: last stream ID %s is behind the entries", ErrBadValue, lastID)
+	}
+	s.lastID = lastID
+
+	ngroups, err := readUvarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	for range ngroups {
+		if err = readConsumerGroup(buf, s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func readConsumerGroup(buf *[]byte, s *Stream) error {
+	name, err := readString(buf)
+	if err != nil {
+		return err
+	}
+	lastDelivered, err := readStreamID(buf)
+	if err != nil {
+		return err
+	}
+	s.CreateGroup(name, lastDelivered)
+	g := s.groups[name]
+
+	n, err := readUvarint(buf)
+	if err != nil {
+		return err
+	}
+	for range n {
+		id, err := readStreamID(buf)
+		if err != nil {
+			return err
+		}
+		consumer, err := readString(buf)
+		if err != nil {
+			return err
+		}
+		deliveredAt, size := binary.Varint(*buf)
+		if size <= 0 {
+			return ErrBadValue
+		}
+		*buf = (*buf)[size:]
+		deliveries, err := readUvarint(buf)
+		if err != nil {
+			return err
+		}
+
+		g.pending[id] = &PendingEntry{
+			ID:          id,
+			Consumer:    consumer,
+			DeliveredAt: time.UnixMilli(deliveredAt),
+			Deliveries:  int(deliveries), //nolint:gosec // deliveries fit in int
+		}
+		s.size += int64(len(consumer) + pendingEntryOverhead)
+	}
+	return nil
+}
+
+func appendStreamID(buf []byte, id StreamID) []byte {
+	buf = binary.AppendUvarint(buf, id.Ms)
+	return binary.AppendUvarint(buf, id.Seq)
+}
+
+func readStreamID(buf *[]byte) (StreamID, error) {
+	ms, err := readUvarint(buf)
+	if err != nil {
+		return StreamID{}, err
+	}
+	seq, err := readUvarint(buf)
+	if err != nil {
+		return StreamID{}, err
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// txn operates on the keyspace while all its shards are locked by Atomic.
+type txn struct {
+	k *keyspace
+	// undo keeps the copies of the entries taken before their keys are
+	// changed for the first time, nil means the key didn't exist.
+	undo map[string]*entry
+}
+
+func newTxn(k *keyspace) txn {
+	return txn{k: k, undo: make(map[string]*entry)}
+}
+
+// save copies the entries of the keys before they are changed.
+func (t *txn) save(keys ...string) {
+	for _, key := range keys {
+		if _, ok := t.undo[key]; ok {
+			continue
+		}
+		var saved *entry
+		if ent, ok := t.k.shardFor(key).data[key]; ok {
+			saved = newEntry(ent.value.Clone(), ent.expireAt, ent.lastAccess.Load())
+		}
+		t.undo[key] = saved
+	}
+}
+
+// rollback restores the entries of the keys changed by the transaction.
+// The keys evicted or expired meanwhile aren't restored.
+func (t *txn) rollback() {
+	for key, ent := range t.undo {
+		s := t.k.shardFor(key)
+		s.restore(key, ent)
+		if ent == nil {
+			s.emit(EventDel, key)
+		} else {
+			s.emit(EventSet, key)
+		}
+	}
+}
+
+func (t *txn) Set(_ context.Context, key, value string) error {
+	t.save(key)
+	return t.k.shardFor(key).set(key, value)
+}
+
+func (t *txn) SetWithExpiration(_ context.Context, key, value string, expireAt time.Time) error {
+	t.save(key)
+	return t.k.shardFor(key).setWithExpiration(key, value, expireAt)
+}
+
+func (t *txn) Get(_ context.Context, key string) (string, error) {
+	return t.k.shardFor(key).get(key)
+}
+
+func (t *txn) Del(_ context.Context, key string) error {
+	t.save(key)
+	t.k.shardFor(key).del(key)
+	return nil
+}
+
+func (t *txn) SetIf(_ context.Context, key, value string, expireAt time.Time, cond Condition) (SetResult, error) {
+	t.save(key)
+	return t.k.shardFor(key).setIf(key, value, expireAt, cond)
+}
+
+func (t *txn) GetDel(_ context.Context, key string) (string, error) {
+	t.save(key)
+	return t.k.shardFor(key).getDel(key)
+}
+
+func (t *txn) MSet(_ context.Context, pairs []KeyValue) error {
+	for _, p := range pairs {
+		t.save(p.Key)
+	}
+	return t.k.mset(pairs)
+}
+
+func (t *txn) MGet(_ context.Context, keys []string) (map[string]string, error) {
+	return t.k.mget(keys), nil
+}
+
+func (t *txn) MDel(_ context.Context, keys []string) (int, error) {
+	t.save(keys...)
+	return t.k.mdel(keys), nil
+}
+
+func (t *txn) View(_ context.Context, key string, fn ViewFunc) error {
+	return t.k.shardFor(key).view(key, fn)
+}
+
+func (t *txn) MView(_ context.Context, keys []string, fn MViewFunc) error {
+	return t.k.mview(keys, fn)
+}
+
+func (t *txn) Mutate(_ context.Context, key string, fn MutateFunc) error {
+	t.save(key)
+	return t.k.shardFor(key).mutate(key, fn)
+}
+
+func (t *txn) Update(_ context.Context, key string, fn UpdateFunc) (string, error) {
+	t.save(key)
+	return t.k.shardFor(key).update(key, fn)
+}
+
+func (t *txn) Expire(_ context.Context, key string, expireAt time.Time) (bool, error) {
+	t.save(key)
+	return t.k.shardFor(key).expire(key, expireAt), nil
+}
+
+func (t *txn) Persist(_ context.Context, key string) (bool, error) {
+	t.save(key)
+	return t.k.shardFor(key).persist(key), nil
+}
+
+func (t *txn) ExpireTime(_ context.Context, key string) (time.Time, error) {
+	return t.k.shardFor(key).expireTime(key)
+}
+
+func (t *txn) Stats(_ context.Context) (Stats, error) {
+	stats := make([]Stats, len(t.k.shards))
+	for i, s := range t.k.shards {
+		stats[i] = s.stats()
+	}
+	return t.k.totalStats(stats), nil
+}
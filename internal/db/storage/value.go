@@ -0,0 +1,416 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+var ErrBadValue = errors.New("bad encoded value")
+
+// Type is the type of the value stored by the key.
+type Type uint8
+
+const (
+	StringType Type = iota
+	HashType
+	ListType
+	SetType
+	SortedSetType
+	StreamType
+)
+
+var typeNames = map[Type]string{
+	StringType:    "string",
+	HashType:      "hash",
+	ListType:      "list",
+	SetType:       "set",
+	SortedSetType: "zset",
+	StreamType:    "stream",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", uint8(t))
+}
+
+// Value is the value stored by the key.
+type Value interface {
+	Type() Type
+	// Size approximates the memory used by the value.
+	Size() int64
+	// Clone returns the copy not sharing memory with the value.
+	Clone() Value
+}
+
+// String is the plain string value.
+type String string
+
+func (s String) Type() Type   { return StringType }
+func (s String) Size() int64  { return int64(len(s)) }
+func (s String) Clone() Value { return s }
+
+// fieldOverhead approximates the memory used by the map slot of the field.
+const fieldOverhead = 32
+
+// Hash maps the fields to the values.
+type Hash struct {
+	fields map[string]string
+	size   int64
+}
+
+func NewHash() *Hash {
+	return &Hash{fields: make(map[string]string)}
+}
+
+func (h *Hash) Type() Type  { return HashType }
+func (h *Hash) Size() int64 { return h.size }
+
+func (h *Hash) Clone() Value {
+	return &Hash{fields: maps.Clone(h.fields), size: h.size}
+}
+
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// Set sets the field and returns true if it's a new one.
+func (h *Hash) Set(field, value string) bool {
+	old, exists := h.fields[field]
+	if exists {
+		h.size -= int64(len(old))
+	} else {
+		h.size += int64(len(field) + fieldOverhead)
+	}
+	h.fields[field] = value
+	h.size += int64(len(value))
+	return !exists
+}
+
+// Del removes the field and returns false if it doesn't exist.
+func (h *Hash) Del(field string) bool {
+	value, ok := h.fields[field]
+	if !ok {
+		return false
+	}
+	delete(h.fields, field)
+	h.size -= int64(len(field) + len(value) + fieldOverhead)
+	return true
+}
+
+// Fields returns the fields in ascending order.
+func (h *Hash) Fields() []string {
+	return slices.Sorted(maps.Keys(h.fields))
+}
+
+// elemOverhead approximates the memory used by the slot of the list element.
+const elemOverhead = 16
+
+// List is the sequence of the elements, it's the ring buffer growing on demand,
+// so the elements are pushed and popped at both ends in constant time.
+type List struct {
+	elems []string
+	head  int
+	n     int
+	size  int64
+}
+
+func NewList() *List {
+	return &List{}
+}
+
+func (l *List) Type() Type  { return ListType }
+func (l *List) Size() int64 { return l.size }
+
+func (l *List) Clone() Value {
+	return &List{elems: l.Range(0, -1), n: l.n, size: l.size}
+}
+
+func (l *List) Len() int {
+	return l.n
+}
+
+// Index returns the element by its index, the negative index counts from the end.
+func (l *List) Index(i int) (string, bool) {
+	if i < 0 {
+		i += l.n
+	}
+	if i < 0 || i >= l.n {
+		return "", false
+	}
+	return l.elems[l.slot(i)], true
+}
+
+// PushLeft inserts the elements at the head one by one, so they go in reverse order.
+func (l *List) PushLeft(elems ...string) {
+	for _, elem := range elems {
+		l.grow()
+		l.head = (l.head - 1 + len(l.elems)) % len(l.elems)
+		l.elems[l.head] = elem
+		l.n++
+		l.size += int64(len(elem) + elemOverhead)
+	}
+}
+
+// PushRight appends the elements to the tail.
+func (l *List) PushRight(elems ...string) {
+	for _, elem := range elems {
+		l.grow()
+		l.elems[l.slot(l.n)] = elem
+		l.n++
+		l.size += int64(len(elem) + elemOverhead)
+	}
+}
+
+func (l *List) PopLeft() (string, bool) {
+	if l.n == 0 {
+		return "", false
+	}
+	elem := l.elems[l.head]
+	l.elems[l.head] = ""
+	l.head = (l.head + 1) % len(l.elems)
+	l.n--
+	l.size -= int64(len(elem) + elemOverhead)
+	return elem, true
+}
+
+func (l *List) PopRight() (string, bool) {
+	if l.n == 0 {
+		return "", false
+	}
+	i := l.slot(l.n - 1)
+	elem := l.elems[i]
+	l.elems[i] = ""
+	l.n--
+	l.size -= int64(len(elem) + elemOverhead)
+	return elem, true
+}
+
+// Range returns the elements from start to stop inclusive. The negative
+// indexes count from the end, the indexes out of the list are clamped.
+func (l *List) Range(start, stop int) []string {
+	start, stop = l.bounds(start, stop)
+	elems := make([]string, 0, max(stop-start, 0))
+	for i := start; i < stop; i++ {
+		elems = append(elems, l.elems[l.slot(i)])
+	}
+	return elems
+}
+
+// Trim keeps only the elements from start to stop inclusive, the indexes
+// are treated like by Range.
+func (l *List) Trim(start, stop int) {
+	start, stop = l.bounds(start, stop)
+	if start >= stop {
+		*l = List{}
+		return
+	}
+	for l.n > stop {
+		l.PopRight()
+	}
+	for range start {
+		l.PopLeft()
+	}
+}
+
+// bounds converts the inclusive indexes to the half-open range within the list.
+func (l *List) bounds(start, stop int) (int, int) {
+	if start < 0 {
+		start += l.n
+	}
+	if stop < 0 {
+		stop += l.n
+	}
+	return max(start, 0), min(stop+1, l.n)
+}
+
+func (l *List) slot(i int) int {
+	return (l.head + i) % len(l.elems)
+}
+
+func (l *List) grow() {
+	if l.n < len(l.elems) {
+		return
+	}
+	elems := make([]string, max(2*len(l.elems), 4)) //nolint:mnd // initial capacity
+	for i := range l.n {
+		elems[i] = l.elems[l.slot(i)]
+	}
+	l.elems, l.head = elems, 0
+}
+
+// MarshalValue encodes the value as the string, the strings are kept as is.
+func MarshalValue(v Value) string {
+	switch v := v.(type) {
+	case String:
+		return string(v)
+	case *Hash:
+		var buf []byte
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		for _, field := range v.Fields() {
+			buf = appendString(buf, field)
+			buf = appendString(buf, v.fields[field])
+		}
+		return string(buf)
+	case *List:
+		var buf []byte
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		for _, elem := range v.Range(0, -1) {
+			buf = appendString(buf, elem)
+		}
+		return string(buf)
+	case *Set:
+		var buf []byte
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		for _, member := range v.Members() {
+			buf = appendString(buf, member)
+		}
+		return string(buf)
+	case *SortedSet:
+		var buf []byte
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		for _, m := range v.Range(0, -1) {
+			buf = appendString(buf, m.Member)
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(m.Score))
+		}
+		return string(buf)
+	case *Stream:
+		return string(appendStream(nil, v))
+	default:
+		panic(fmt.Sprintf("unknown value type %T", v))
+	}
+}
+
+// UnmarshalValue decodes the value of the given type encoded by MarshalValue.
+func UnmarshalValue(t Type, data string) (Value, error) {
+	switch t {
+	case StringType:
+		return String(data), nil
+	case HashType:
+		buf := []byte(data)
+		n, err := readUvarint(&buf)
+		if err != nil {
+			return nil, err
+		}
+		h := NewHash()
+		for range n {
+			field, err := readString(&buf)
+			if err != nil {
+				return nil, err
+			}
+			value, err := readString(&buf)
+			if err != nil {
+				return nil, err
+			}
+			h.Set(field, value)
+		}
+		if len(buf) != 0 {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrBadValue, len(buf))
+		}
+		return h, nil
+	case ListType:
+		buf := []byte(data)
+		n, err := readUvarint(&buf)
+		if err != nil {
+			return nil, err
+		}
+		l := NewList()
+		for range n {
+			elem, err := readString(&buf)
+			if err != nil {
+				return nil, err
+			}
+			l.PushRight(elem)
+		}
+		if len(buf) != 0 {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrBadValue, len(buf))
+		}
+		return l, nil
+	case SetType:
+		buf := []byte(data)
+		n, err := readUvarint(&buf)
+		if err != nil {
+			return nil, err
+		}
+		set := NewSet()
+		for range n {
+			member, err := readString(&buf)
+			if err != nil {
+				return nil, err
+			}
+			set.Add(member)
+		}
+		if len(buf) != 0 {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrBadValue, len(buf))
+		}
+		return set, nil
+	case SortedSetType:
+		buf := []byte(data)
+		n, err := readUvarint(&buf)
+		if err != nil {
+			return nil, err
+		}
+		z := NewSortedSet()
+		for range n {
+			member, err := readString(&buf)
+			if err != nil {
+				return nil, err
+			}
+			if len(buf) < 8 { //nolint:mnd // float64 size
+				return nil, ErrBadValue
+			}
+			z.Add(member, math.Float64frombits(binary.LittleEndian.Uint64(buf)))
+			buf = buf[8:]
+		}
+		if len(buf) != 0 {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrBadValue, len(buf))
+		}
+		return z, nil
+	case StreamType:
+		buf := []byte(data)
+		s, err := readStream(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) != 0 {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrBadValue, len(buf))
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %d", ErrBadValue, t)
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readUvarint(buf *[]byte) (uint64, error) {
+	n, size := binary.Uvarint(*buf)
+	if size <= 0 {
+		return 0, ErrBadValue
+	}
+	*buf = (*buf)[size:]
+	return n, nil
+}
+
+func readString(buf *[]byte) (string, error) {
+	n, err := readUvarint(buf)
+	if err != nil || n > uint64(len(*buf)) {
+		return "", ErrBadValue
+	}
+	s := string((*buf)[:n])
+	*buf = (*buf)[n:]
+	return s, nil
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalValue(t *testing.T) {
+	hash := NewHash()
+	hash.Set("name", "John")
+	hash.Set("", "empty\x00field")
+	hash.Set("email", "")
+
+	for _, v := range []Value{String(""), String("value"), NewHash(), hash} {
+		got, err := UnmarshalValue(v.Type(), MarshalValue(v))
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+
+	list := NewList()
+	list.PushRight("b", "", "c")
+	list.PushLeft("a")
+	got, err := UnmarshalValue(ListType, MarshalValue(list))
+	require.NoError(t, err)
+	assert.Equal(t, list.Range(0, -1), got.(*List).Range(0, -1))
+
+	set := NewSet()
+	set.Add("a")
+	set.Add("b")
+	got, err = UnmarshalValue(SetType, MarshalValue(set))
+	require.NoError(t, err)
+	assert.Equal(t, Value(set), got)
+
+	z := NewSortedSet()
+	z.Add("a", 1.5)
+	z.Add("b", math.Inf(-1))
+	got, err = UnmarshalValue(SortedSetType, MarshalValue(z))
+	require.NoError(t, err)
+	assert.Equal(t, z.Range(0, -1), got.(*SortedSet).Range(0, -1))
+	_, err = UnmarshalValue(SortedSetType, MarshalValue(z)[:5])
+	require.ErrorIs(t, err, ErrBadValue)
+
+	stream := NewStream()
+	stream.Add(StreamID{Ms: 1}, []string{"f", "v"})
+	stream.Add(StreamID{Ms: 1, Seq: 1}, []string{"f", ""})
+	stream.CreateGroup("g", StreamID{})
+	g, _ := stream.Group("g")
+	stream.ReadGroup(g, "alice", 1, false, time.UnixMilli(100))
+	stream.Trim(1)
+	got, err = UnmarshalValue(StreamType, MarshalValue(stream))
+	require.NoError(t, err)
+	assert.Equal(t, Value(stream), got)
+	_, err = UnmarshalValue(StreamType, MarshalValue(stream)[:8])
+	require.ErrorIs(t, err, ErrBadValue)
+
+	_, err = UnmarshalValue(HashType, MarshalValue(hash)+"x")
+	require.ErrorIs(t, err, ErrBadValue)
+	_, err = UnmarshalValue(HashType, "\x05")
+	require.ErrorIs(t, err, ErrBadValue)
+	_, err = UnmarshalValue(Type(100), "")
+	require.ErrorIs(t, err, ErrBadValue)
+}
+
+func TestHash(t *testing.T) {
+	hash := NewHash()
+	assert.True(t, hash.Set("b", "22"))
+	assert.True(t, hash.Set("a", "1"))
+	assert.False(t, hash.Set("b", "2"))
+	assert.Equal(t, []string{"a", "b"}, hash.Fields())
+	assert.Equal(t, int64(2*fieldOverhead+4), hash.Size())
+
+	clone := hash.Clone().(*Hash)
+	assert.True(t, hash.Del("a"))
+	assert.False(t, hash.Del("a"))
+	assert.Equal(t, 1, hash.Len())
+	assert.Equal(t, int64(fieldOverhead+2), hash.Size())
+	assert.Equal(t, 2, clone.Len())
+}
+
+func TestList(t *testing.T) {
+	l := NewList()
+	l.PushRight("c", "d")
+	l.PushLeft("b", "a")
+	l.PushRight("e", "f", "g")
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g"}, l.Range(0, -1))
+	assert.Equal(t, int64(7*(1+elemOverhead)), l.Size())
+
+	testCases := []struct {
+		start, stop int
+		want        []string
+	}{
+		{start: 1, stop: 2, want: []string{"b", "c"}},
+		{start: -2, stop: -1, want: []string{"f", "g"}},
+		{start: -100, stop: 0, want: []string{"a"}},
+		{start: 5, stop: 100, want: []string{"f", "g"}},
+		{start: 3, stop: 1, want: []string{}},
+		{start: 7, stop: 10, want: []string{}},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, l.Range(tc.start, tc.stop), "range %d %d", tc.start, tc.stop)
+	}
+
+	elem, ok := l.Index(-1)
+	assert.True(t, ok)
+	assert.Equal(t, "g", elem)
+	_, ok = l.Index(7)
+	assert.False(t, ok)
+
+	clone := l.Clone().(*List)
+	elem, _ = l.PopLeft()
+	assert.Equal(t, "a", elem)
+	elem, _ = l.PopRight()
+	assert.Equal(t, "g", elem)
+	l.Trim(1, -2)
+	assert.Equal(t, []string{"c", "d", "e"}, l.Range(0, -1))
+	assert.Equal(t, int64(3*(1+elemOverhead)), l.Size())
+	assert.Equal(t, 7, clone.Len())
+
+	l.Trim(5, 10)
+	assert.Equal(t, 0, l.Len())
+	assert.Equal(t, int64(0), l.Size())
+	_, ok = l.PopLeft()
+	assert.False(t, ok)
+	l.PushLeft("x")
+	assert.Equal(t, []string{"x"}, l.Range(0, -1))
+}
+
+func TestSet(t *testing.T) {
+	set := NewSet()
+	assert.True(t, set.Add("b"))
+	assert.True(t, set.Add("a"))
+	assert.False(t, set.Add("b"))
+	assert.Equal(t, []string{"a", "b"}, set.Members())
+	assert.Equal(t, int64(2*(1+memberOverhead)), set.Size())
+
+	clone := set.Clone().(*Set)
+	assert.True(t, set.Remove("a"))
+	assert.False(t, set.Remove("a"))
+	assert.False(t, set.Contains("a"))
+	assert.True(t, clone.Contains("a"))
+	assert.Equal(t, int64(1+memberOverhead), set.Size())
+}
+
+func TestSortedSet(t *testing.T) {
+	z := NewSortedSet()
+	const n = 1000
+	for i := range n {
+		// The members with the same score go in lexicographic order.
+		assert.True(t, z.Add(fmt.Sprintf("m%04d", n-1-i), float64((n-1-i)/2)))
+	}
+	assert.False(t, z.Add("m0000", 0))
+	assert.Equal(t, n, z.Len())
+
+	for i := range n {
+		member := fmt.Sprintf("m%04d", i)
+		rank, ok := z.Rank(member)
+		require.True(t, ok)
+		require.Equal(t, i, rank)
+		require.Equal(t, []ScoredMember{{Member: member, Score: float64(i / 2)}}, z.Range(i, i))
+	}
+
+	// The score change moves the member.
+	assert.False(t, z.Add("m0000", 1000))
+	rank, _ := z.Rank("m0000")
+	assert.Equal(t, n-1, rank)
+	assert.Equal(t, []ScoredMember{{Member: "m0001", Score: 0}, {Member: "m0002", Score: 1}}, z.Range(0, 1))
+	assert.Equal(t, []ScoredMember{{Member: "m0000", Score: 1000}}, z.Range(-1, -1))
+
+	testCases := []struct {
+		name          string
+		minScore      ScoreBound
+		maxScore      ScoreBound
+		offset, count int
+		want          []string
+	}{
+		{name: "inclusive", minScore: ScoreBound{Score: 1}, maxScore: ScoreBound{Score: 2}, count: -1, want: []string{"m0002", "m0003", "m0004", "m0005"}},
+		{name: "exclusive", minScore: ScoreBound{Score: 1, Exclusive: true}, maxScore: ScoreBound{Score: 3, Exclusive: true}, count: -1, want: []string{"m0004", "m0005"}},
+		{name: "limit", minScore: ScoreBound{Score: math.Inf(-1)}, maxScore: ScoreBound{Score: math.Inf(1)}, offset: 2, count: 2, want: []string{"m0003", "m0004"}},
+		{name: "empty", minScore: ScoreBound{Score: 2000}, maxScore: ScoreBound{Score: math.Inf(1)}, count: -1, want: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, m := range z.RangeByScore(tc.minScore, tc.maxScore, tc.offset, tc.count) {
+				got = append(got, m.Member)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	clone := z.Clone().(*SortedSet)
+	for i := range n {
+		require.True(t, z.Remove(fmt.Sprintf("m%04d", i)))
+	}
+	assert.Equal(t, 0, z.Len())
+	assert.Equal(t, int64(0), z.Size())
+	assert.Equal(t, []ScoredMember{}, z.Range(0, -1))
+	assert.Equal(t, n, clone.Len())
+	assert.Equal(t, n, len(clone.Range(0, -1)))
+}
+
+func TestStream(t *testing.T) {
+	s := NewStream()
+	id, ok := s.NextID(5)
+	require.True(t, ok)
+	assert.Equal(t, StreamID{Ms: 5}, id)
+
+	require.True(t, s.Add(id, []string{"n", "1"}))
+	require.False(t, s.Add(id, []string{"n", "1"}), "ID must grow")
+	id, _ = s.NextID(3)
+	assert.Equal(t, StreamID{Ms: 5, Seq: 1}, id, "clock goes back")
+	require.True(t, s.Add(id, []string{"n", "2"}))
+	require.True(t, s.Add(StreamID{Ms: 7}, []string{"n", "3"}))
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, StreamID{Ms: 7}, s.LastID())
+
+	ids := func(entries []StreamEntry) []string {
+		out := []string{}
+		for _, entry := range entries {
+			out = append(out, entry.ID.String())
+		}
+		return out
+	}
+	assert.Equal(t, []string{"5-0", "5-1", "7-0"}, ids(s.Range(StreamID{}, MaxStreamID, 0, false)))
+	assert.Equal(t, []string{"7-0", "5-1"}, ids(s.Range(StreamID{}, MaxStreamID, 2, true)))
+	assert.Equal(t, []string{"5-1"}, ids(s.Range(StreamID{Ms: 5, Seq: 1}, StreamID{Ms: 6}, 0, false)))
+	assert.Equal(t, []string{}, ids(s.Range(StreamID{Ms: 8}, MaxStreamID, 0, false)))
+
+	require.True(t, s.CreateGroup("g", StreamID{Ms: 5}))
+	require.False(t, s.CreateGroup("g", StreamID{}))
+	g, ok := s.Group("g")
+	require.True(t, ok)
+
+	now := time.UnixMilli(1000)
+	assert.Equal(t, []string{"5-1"}, ids(s.ReadGroup(g, "alice", 1, false, now)))
+	assert.Equal(t, []string{"7-0"}, ids(s.ReadGroup(g, "bob", 0, false, now)))
+	assert.Equal(t, []string{}, ids(s.ReadGroup(g, "bob", 0, false, now)))
+	assert.Equal(t, []PendingEntry{
+		{ID: StreamID{Ms: 5, Seq: 1}, Consumer: "alice", DeliveredAt: now, Deliveries: 1},
+		{ID: StreamID{Ms: 7}, Consumer: "bob", DeliveredAt: now, Deliveries: 1},
+	}, g.Pending())
+	assert.Equal(t, []string{"7-0"}, ids(s.ReadPending(g, "bob", StreamID{}, 0)))
+
+	size := s.Size()
+	clone := s.Clone().(*Stream)
+	assert.Equal(t, 2, s.Trim(1))
+	assert.Equal(t, 0, s.Trim(1))
+	assert.Less(t, s.Size(), size)
+	assert.Equal(t, []StreamEntry{{ID: StreamID{Ms: 5, Seq: 1}}}, s.ReadPending(g, "alice", StreamID{}, 0))
+
+	assert.Equal(t, 1, s.Ack(g, StreamID{Ms: 5, Seq: 1}, StreamID{Ms: 5}))
+	assert.Len(t, g.Pending(), 1)
+	assert.Equal(t, 3, clone.Len())
+	cg, _ := clone.Group("g")
+	assert.Len(t, cg.Pending(), 2)
+
+	_, ok = MaxStreamID.Next()
+	assert.False(t, ok)
+}
@@ -0,0 +1,279 @@
+package storage
+
+// zsetMemberOverhead approximates the memory used by the member in the map
+// and the skip list node.
+const zsetMemberOverhead = 64
+
+// ScoredMember is the member of the sorted set with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBound is the bound of the score range.
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+// SortedSet is the collection of the unique members ordered by their scores,
+// the members with the same score are ordered lexicographically. The map
+// gives the score of the member, the skip list keeps the order.
+type SortedSet struct {
+	scores map[string]float64
+	list   *zskipList
+	size   int64
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{scores: make(map[string]float64), list: newZSkipList()}
+}
+
+func (z *SortedSet) Type() Type  { return SortedSetType }
+func (z *SortedSet) Size() int64 { return z.size }
+
+func (z *SortedSet) Clone() Value {
+	clone := NewSortedSet()
+	for x := z.list.head.next[0].node; x != nil; x = x.next[0].node {
+		clone.Add(x.member, x.score)
+	}
+	return clone
+}
+
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// Add adds the member or updates its score, it returns true if the member is new.
+func (z *SortedSet) Add(member string, score float64) bool {
+	old, exists := z.scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.list.delete(member, old)
+	} else {
+		z.size += int64(len(member) + zsetMemberOverhead)
+	}
+	z.scores[member] = score
+	z.list.insert(member, score)
+	return !exists
+}
+
+// Remove removes the member and returns false if it doesn't exist.
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+	delete(z.scores, member)
+	z.list.delete(member, score)
+	z.size -= int64(len(member) + zsetMemberOverhead)
+	return true
+}
+
+// Rank returns the 0-based position of the member in ascending order.
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+	return z.list.rank(member, score), true
+}
+
+// Range returns the members from start to stop rank inclusive. The negative
+// ranks count from the end, the ranks out of the set are clamped.
+func (z *SortedSet) Range(start, stop int) []ScoredMember {
+	n := z.Len()
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start, stop = max(start, 0), min(stop, n-1)
+	if start > stop {
+		return []ScoredMember{}
+	}
+
+	members := make([]ScoredMember, 0, stop-start+1)
+	for x := z.list.byRank(start); x != nil && len(members) < cap(members); x = x.next[0].node {
+		members = append(members, ScoredMember{Member: x.member, Score: x.score})
+	}
+	return members
+}
+
+// RangeByScore returns the members having the scores between min and max
+// skipping offset of them first. The negative count means no limit.
+func (z *SortedSet) RangeByScore(minScore, maxScore ScoreBound, offset, count int) []ScoredMember {
+	members := []ScoredMember{}
+	for x := z.list.seek(minScore); x != nil && count != 0; x = x.next[0].node {
+		if x.score > maxScore.Score || (maxScore.Exclusive && x.score == maxScore.Score) {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		members = append(members, ScoredMember{Member: x.member, Score: x.score})
+		count--
+	}
+	return members
+}
+
+type zskipListLevel struct {
+	node *zskipListNode
+	// span is the number of the nodes the link jumps over, it gives the ranks.
+	span int
+}
+
+type zskipListNode struct {
+	member string
+	score  float64
+	next   []zskipListLevel
+}
+
+// less reports whether the node goes before the member with the score.
+func (n *zskipListNode) less(member string, score float64) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+func (n *zskipListNode) lessOrEqual(member string, score float64) bool {
+	return n.score < score || (n.score == score && n.member <= member)
+}
+
+// zskipList keeps the members ordered by the scores and the members, the links
+// know their spans, so the ranks are found in logarithmic time like in Redis.
+type zskipList struct {
+	head  *zskipListNode
+	level int
+	len   int
+}
+
+func newZSkipList() *zskipList {
+	return &zskipList{
+		head:  &zskipListNode{next: make([]zskipListLevel, skipListMaxLevel)},
+		level: 1,
+	}
+}
+
+// insert adds the member, it must not be in the list yet.
+func (l *zskipList) insert(member string, score float64) {
+	var (
+		update [skipListMaxLevel]*zskipListNode
+		rank   [skipListMaxLevel]int
+	)
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i != l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && x.next[i].node.less(member, score) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	level := randomSkipListLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			update[i].next[i].span = l.len
+		}
+		l.level = level
+	}
+
+	node := &zskipListNode{member: member, score: score, next: make([]zskipListLevel, level)}
+	for i := range level {
+		node.next[i].node = update[i].next[i].node
+		update[i].next[i].node = node
+		node.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].next[i].span++
+	}
+	l.len++
+}
+
+// delete removes the member with the score. It's a no-op if there is no such member.
+func (l *zskipList) delete(member string, score float64) {
+	var update [skipListMaxLevel]*zskipListNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.less(member, score) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	node := x.next[0].node
+	if node == nil || node.member != member || node.score != score {
+		return
+	}
+	for i := range l.level {
+		if update[i].next[i].node == node {
+			update[i].next[i].span += node.next[i].span - 1
+			update[i].next[i].node = node.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1].node == nil {
+		l.level--
+	}
+	l.len--
+}
+
+// rank returns the 0-based position of the member with the score, it must be in the list.
+func (l *zskipList) rank(member string, score float64) int {
+	var rank int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.lessOrEqual(member, score) {
+			rank += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+	return rank - 1
+}
+
+// byRank returns the node at the 0-based position or nil.
+func (l *zskipList) byRank(rank int) *zskipListNode {
+	var traversed int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && traversed+x.next[i].span <= rank+1 {
+			traversed += x.next[i].span
+			x = x.next[i].node
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// seek returns the first node with the score within the bound.
+func (l *zskipList) seek(bound ScoreBound) *zskipListNode {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && outOfBound(x.next[i].node.score, bound) {
+			x = x.next[i].node
+		}
+	}
+	return x.next[0].node
+}
+
+// outOfBound reports whether the score is below the lower bound.
+func outOfBound(score float64, bound ScoreBound) bool {
+	return score < bound.Score || (bound.Exclusive && score == bound.Score)
+}
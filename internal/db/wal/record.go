@@ -0,0 +1,118 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const recordHeaderSize = 8
+
+var (
+	errCorruptedRecord = errors.New("corrupted record")
+	errTruncatedRecord = errors.New("truncated record")
+)
+
+type Record struct {
+	LSN       uint64
+	CommandID int
+	Args      []string
+}
+
+// encode serializes the record in the following format:
+//
+//	| payload length (4 bytes) | crc32 of payload (4 bytes) | payload |
+//
+// where the payload is a sequence of uvarints: LSN, command id, number of
+// arguments and length of each argument followed by its bytes.
+func (r Record) encode() []byte {
+	size := 3 * binary.MaxVarintLen64
+	for _, arg := range r.Args {
+		size += binary.MaxVarintLen64 + len(arg)
+	}
+
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+size)
+	buf = binary.AppendUvarint(buf, r.LSN)
+	buf = binary.AppendUvarint(buf, uint64(r.CommandID)) //nolint:gosec // command id is always positive
+	buf = binary.AppendUvarint(buf, uint64(len(r.Args)))
+	for _, arg := range r.Args {
+		buf = binary.AppendUvarint(buf, uint64(len(arg)))
+		buf = append(buf, arg...)
+	}
+
+	payload := buf[recordHeaderSize:]
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload))) //nolint:gosec // record size is bounded by segment size
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	return buf
+}
+
+// readRecord reads the next record from r and returns it together with
+// the number of consumed bytes. io.EOF is returned only if there is no data
+// left at all, errTruncatedRecord if the record was cut off in the middle.
+// The record can't be longer than the left bytes of the segment, the longer
+// one has the torn header and isn't read not to allocate the memory for it.
+func readRecord(r *bufio.Reader, left int64) (Record, int, error) {
+	var header [recordHeaderSize]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) && n == 0 {
+			return Record{}, 0, io.EOF
+		}
+		return Record{}, 0, errTruncatedRecord
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if int64(size) > left-recordHeaderSize {
+		return Record{}, 0, errTruncatedRecord
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Record{}, 0, errTruncatedRecord
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return Record{}, 0, errCorruptedRecord
+	}
+
+	rec, err := decodePayload(payload)
+	if err != nil {
+		return Record{}, 0, err
+	}
+	return rec, recordHeaderSize + int(size), nil
+}
+
+func decodePayload(payload []byte) (Record, error) {
+	var (
+		rec    Record
+		values [3]uint64
+	)
+
+	for i := range values {
+		v, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return rec, errCorruptedRecord
+		}
+		values[i] = v
+		payload = payload[n:]
+	}
+
+	rec.LSN = values[0]
+	rec.CommandID = int(values[1]) //nolint:gosec // command id is always small
+	rec.Args = make([]string, 0, values[2])
+	for range values[2] {
+		size, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload[n:])) < size {
+			return rec, errCorruptedRecord
+		}
+		payload = payload[n:]
+		rec.Args = append(rec.Args, string(payload[:size]))
+		payload = payload[size:]
+	}
+	if len(payload) != 0 {
+		return rec, fmt.Errorf("%w: %d trailing bytes", errCorruptedRecord, len(payload))
+	}
+	return rec, nil
+}
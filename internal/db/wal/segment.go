@@ -0,0 +1,92 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const segmentFileExt = ".wal"
+
+type segment struct {
+	firstLSN uint64
+	path     string
+}
+
+func segmentPath(dir string, firstLSN uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", firstLSN, segmentFileExt))
+}
+
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read directory %s: %w", dir, err)
+	}
+
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentFileExt) {
+			continue
+		}
+
+		lsn, err := strconv.ParseUint(strings.TrimSuffix(name, segmentFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{firstLSN: lsn, path: filepath.Join(dir, name)})
+	}
+
+	slices.SortFunc(segments, func(a, b segment) int {
+		switch {
+		case a.firstLSN < b.firstLSN:
+			return -1
+		case a.firstLSN > b.firstLSN:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return segments, nil
+}
+
+// readSegment calls fn for every record stored in the segment file and
+// returns the offset right after the last valid record. A broken record
+// is reported with errTruncatedRecord or errCorruptedRecord: the caller
+// decides whether it's a torn write after a crash or a real damage.
+func readSegment(path string, fn func(Record) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open segment %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat segment %s: %w", path, err)
+	}
+
+	var (
+		offset int64
+		reader = bufio.NewReader(file)
+	)
+	for {
+		rec, n, err := readRecord(reader, info.Size()-offset)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("read segment %s at offset %d: %w", path, offset, err)
+		}
+		if err = fn(rec); err != nil {
+			return offset, err
+		}
+		offset += int64(n)
+	}
+}
@@ -0,0 +1,431 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	SyncFlushMode  = "sync"
+	BatchFlushMode = "batch"
+	NoneFlushMode  = "none"
+)
+
+var ErrClosed = errors.New("wal is closed")
+
+type Config struct {
+	dataDir        string
+	maxSegmentSize int64
+	flushMode      string
+	batchTimeout   time.Duration
+	batchSize      int
+}
+
+type Option func(c *Config)
+
+func WithDataDirectory(dir string) Option {
+	return func(c *Config) {
+		c.dataDir = dir
+	}
+}
+
+func WithMaxSegmentSize(n int64) Option {
+	return func(c *Config) {
+		c.maxSegmentSize = n
+	}
+}
+
+func WithFlushMode(mode string) Option {
+	return func(c *Config) {
+		c.flushMode = mode
+	}
+}
+
+func WithFlushBatchTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.batchTimeout = d
+	}
+}
+
+func WithFlushBatchSize(n int) Option {
+	return func(c *Config) {
+		c.batchSize = n
+	}
+}
+
+const (
+	defaultDataDir        = "./data/wal"
+	defaultMaxSegmentSize = 10 << 20
+	defaultFlushMode      = BatchFlushMode
+	defaultBatchTimeout   = 10 * time.Millisecond
+	defaultBatchSize      = 64 << 10
+)
+
+type batch struct {
+	buf      []byte
+	firstLSN uint64
+	done     chan struct{}
+	err      error
+}
+
+func newBatch() *batch {
+	return &batch{done: make(chan struct{})}
+}
+
+// segmentFile is the segment file being appended to.
+type segmentFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+type WAL struct {
+	logger *slog.Logger
+	conf   Config
+
+	// mu guards LSN allocation and the pending batch.
+	mu      sync.Mutex
+	lastLSN uint64
+	pending *batch
+	closed  bool
+
+	// fileMu guards the active segment file.
+	fileMu      sync.Mutex
+	file        segmentFile
+	segmentSize int64
+	err         error
+
+	flushCh chan struct{}
+	closeCh chan struct{}
+	doneCh  chan struct{}
+}
+
+func Open(logger *slog.Logger, opts ...Option) (*WAL, error) {
+	conf := Config{
+		dataDir:        defaultDataDir,
+		maxSegmentSize: defaultMaxSegmentSize,
+		flushMode:      defaultFlushMode,
+		batchTimeout:   defaultBatchTimeout,
+		batchSize:      defaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	switch conf.flushMode {
+	case SyncFlushMode, BatchFlushMode, NoneFlushMode:
+	default:
+		return nil, fmt.Errorf("unsupported flush mode: %s", conf.flushMode)
+	}
+
+	if err := os.MkdirAll(conf.dataDir, 0o750); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	w := &WAL{
+		logger:  logger.With(slog.String("component", "wal")),
+		conf:    conf,
+		pending: newBatch(),
+		flushCh: make(chan struct{}, 1),
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+
+	if conf.flushMode == BatchFlushMode {
+		go w.flushLoop()
+	} else {
+		close(w.doneCh)
+	}
+	return w, nil
+}
+
+// recover restores the last LSN from the latest segment, cuts off a torn
+// record left by a crash and opens the segment for appending.
+func (w *WAL) recover() error {
+	segments, err := listSegments(w.conf.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	last := segments[len(segments)-1]
+	w.lastLSN = last.firstLSN - 1
+	offset, err := readSegment(last.path, func(rec Record) error {
+		w.lastLSN = rec.LSN
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errTruncatedRecord) && !errors.Is(err, errCorruptedRecord) {
+			return err
+		}
+		w.logger.Warn(
+			"truncate broken tail of segment",
+			slog.String("path", last.path),
+			slog.Int64("offset", offset),
+			slog.Any("error", err),
+		)
+	}
+
+	file, err := os.OpenFile(last.path, os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("open segment %s: %w", last.path, err)
+	}
+	if err = file.Truncate(offset); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("truncate segment %s: %w", last.path, err)
+	}
+	if _, err = file.Seek(offset, 0); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("seek segment %s: %w", last.path, err)
+	}
+
+	w.file = file
+	w.segmentSize = offset
+	return nil
+}
+
+func (w *WAL) LastLSN() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastLSN
+}
+
+// AdvanceLSN moves the last LSN forward if it's less than the given one.
+// It's needed when the log is behind the loaded snapshot (e.g. the log
+// directory was cleaned), otherwise new records would be ignored on replay.
+func (w *WAL) AdvanceLSN(lsn uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastLSN = max(w.lastLSN, lsn)
+}
+
+// Write appends the command to the log. It returns when the record is
+// persisted according to the configured flush mode.
+func (w *WAL) Write(ctx context.Context, cmdID int, args []string) error {
+	wait, err := w.Append(cmdID, args)
+	if err != nil {
+		return err
+	}
+	return wait(ctx)
+}
+
+// Append adds the command to the log and returns the function waiting until
+// the record is persisted according to the configured flush mode. Records
+// are ordered by Append calls, so the caller may append under its own lock
+// and wait for persistence after releasing it. The error means the record
+// isn't appended, e.g. the log is closed or the record fails to be written
+// in the sync mode, while the batch fails to be written after Append returns.
+func (w *WAL) Append(cmdID int, args []string) (func(ctx context.Context) error, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, ErrClosed
+	}
+
+	w.lastLSN++
+	rec := Record{LSN: w.lastLSN, CommandID: cmdID, Args: args}
+
+	if w.conf.flushMode != BatchFlushMode {
+		defer w.mu.Unlock()
+		if err := w.writeSegment(rec.encode(), rec.LSN, w.conf.flushMode == SyncFlushMode); err != nil {
+			return nil, err
+		}
+		return func(context.Context) error { return nil }, nil
+	}
+
+	b := w.pending
+	if len(b.buf) == 0 {
+		b.firstLSN = rec.LSN
+	}
+	b.buf = append(b.buf, rec.encode()...)
+	if len(b.buf) >= w.conf.batchSize {
+		select {
+		case w.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	w.mu.Unlock()
+
+	return func(ctx context.Context) error {
+		select {
+		case <-b.done:
+			return b.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil
+}
+
+func (w *WAL) flushLoop() {
+	defer close(w.doneCh)
+
+	ticker := time.NewTicker(w.conf.batchTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.closeCh:
+			w.flush()
+			return
+		case <-ticker.C:
+		case <-w.flushCh:
+		}
+		w.flush()
+	}
+}
+
+func (w *WAL) flush() {
+	w.mu.Lock()
+	b := w.pending
+	w.pending = newBatch()
+	w.mu.Unlock()
+
+	if len(b.buf) != 0 {
+		b.err = w.writeSegment(b.buf, b.firstLSN, true)
+	}
+	close(b.done)
+}
+
+func (w *WAL) writeSegment(buf []byte, firstLSN uint64, sync bool) error {
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	if w.file == nil || w.segmentSize >= w.conf.maxSegmentSize {
+		if err := w.rotate(firstLSN); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(buf)
+	if err != nil {
+		// Drop the partially written data and move the offset back, otherwise
+		// the records appended after it would follow the hole and be
+		// unreachable during recovery.
+		if truncErr := w.file.Truncate(w.segmentSize); truncErr != nil {
+			w.err = fmt.Errorf("wal is broken: %w", truncErr)
+		} else if _, seekErr := w.file.Seek(w.segmentSize, io.SeekStart); seekErr != nil {
+			w.err = fmt.Errorf("wal is broken: %w", seekErr)
+		}
+		return fmt.Errorf("write segment: %w", err)
+	}
+	w.segmentSize += int64(n)
+
+	if sync {
+		if err = w.file.Sync(); err != nil {
+			return fmt.Errorf("sync segment: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *WAL) rotate(firstLSN uint64) error {
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("sync segment: %w", err)
+		}
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+		w.file = nil
+	}
+
+	path := segmentPath(w.conf.dataDir, firstLSN)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("create segment %s: %w", path, err)
+	}
+
+	w.file = file
+	w.segmentSize = 0
+	return nil
+}
+
+// Replay calls fn for every record with LSN greater than fromLSN
+// in the order they were written.
+func (w *WAL) Replay(fromLSN uint64, fn func(Record) error) error {
+	segments, err := listSegments(w.conf.dataDir)
+	if err != nil {
+		return err
+	}
+
+	for i, seg := range segments {
+		if i+1 < len(segments) && segments[i+1].firstLSN <= fromLSN+1 {
+			continue
+		}
+
+		_, err = readSegment(seg.path, func(rec Record) error {
+			if rec.LSN <= fromLSN {
+				return nil
+			}
+			return fn(rec)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact removes segments which contain only records with LSN
+// less than or equal to the given one. The active segment is never removed.
+func (w *WAL) Compact(lsn uint64) error {
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
+
+	segments, err := listSegments(w.conf.dataDir)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i+1].firstLSN > lsn+1 {
+			break
+		}
+		if err = os.Remove(segments[i].path); err != nil {
+			return fmt.Errorf("remove segment %s: %w", segments[i].path, err)
+		}
+	}
+	return nil
+}
+
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.closeCh)
+	<-w.doneCh
+
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync segment: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close segment: %w", err)
+	}
+	return nil
+}
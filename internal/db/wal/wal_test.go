@@ -0,0 +1,332 @@
+package wal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	logger        = slog.New(slog.NewTextHandler(os.Stdout, nil))
+	errUnexpected = errors.New("unexpected")
+)
+
+func TestWAL_WriteReplay(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "sync flush mode",
+			opts: []Option{WithFlushMode(SyncFlushMode)},
+		},
+		{
+			name: "batch flush mode by timeout",
+			opts: []Option{
+				WithFlushMode(BatchFlushMode),
+				WithFlushBatchTimeout(time.Millisecond),
+			},
+		},
+		{
+			name: "batch flush mode by size",
+			opts: []Option{
+				WithFlushMode(BatchFlushMode),
+				WithFlushBatchTimeout(time.Hour),
+				WithFlushBatchSize(1),
+			},
+		},
+		{
+			name: "none flush mode",
+			opts: []Option{WithFlushMode(NoneFlushMode)},
+		},
+		{
+			name: "segment rotation",
+			opts: []Option{
+				WithFlushMode(SyncFlushMode),
+				WithMaxSegmentSize(64),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append(tc.opts, WithDataDirectory(t.TempDir()))
+
+			w, err := Open(logger, opts...)
+			require.NoError(t, err)
+
+			want := writeRecords(t, w, 20)
+			require.NoError(t, w.Close())
+
+			w, err = Open(logger, opts...)
+			require.NoError(t, err)
+			defer w.Close()
+
+			assert.Equal(t, uint64(len(want)), w.LastLSN())
+			assert.Equal(t, want, replayRecords(t, w, 0))
+			assert.Equal(t, want[15:], replayRecords(t, w, 15))
+		})
+	}
+}
+
+func TestWAL_concurrentWrites(t *testing.T) {
+	w, err := Open(logger, WithDataDirectory(t.TempDir()), WithFlushBatchTimeout(time.Millisecond))
+	require.NoError(t, err)
+	defer w.Close()
+
+	const numWriters, numRecords = 8, 50
+
+	var wg sync.WaitGroup
+	for i := range numWriters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range numRecords {
+				assert.NoError(t, w.Write(context.Background(), 1, []string{fmt.Sprintf("key-%d-%d", i, j)}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	records := replayRecords(t, w, 0)
+	require.Len(t, records, numWriters*numRecords)
+	for i, rec := range records {
+		assert.Equal(t, uint64(i+1), rec.LSN)
+	}
+}
+
+func TestWAL_recoverTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithDataDirectory(dir), WithFlushMode(SyncFlushMode)}
+
+	w, err := Open(logger, opts...)
+	require.NoError(t, err)
+	want := writeRecords(t, w, 3)
+	require.NoError(t, w.Close())
+
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	// Simulate a crash in the middle of writing the fourth record.
+	torn := Record{LSN: 4, CommandID: 1, Args: []string{"key", "value"}}.encode()
+	file, err := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0o640)
+	require.NoError(t, err)
+	_, err = file.Write(torn[:len(torn)-3])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	w, err = Open(logger, opts...)
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.Equal(t, uint64(3), w.LastLSN())
+	assert.Equal(t, want, replayRecords(t, w, 0))
+
+	require.NoError(t, w.Write(context.Background(), 2, []string{"key"}))
+	want = append(want, Record{LSN: 4, CommandID: 2, Args: []string{"key"}})
+	assert.Equal(t, want, replayRecords(t, w, 0))
+}
+
+func TestWAL_recoverTornHeader(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithDataDirectory(dir), WithFlushMode(SyncFlushMode)}
+
+	w, err := Open(logger, opts...)
+	require.NoError(t, err)
+	want := writeRecords(t, w, 3)
+	require.NoError(t, w.Close())
+
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	// The torn header claims the record much longer than the segment.
+	header := make([]byte, recordHeaderSize)
+	binary.LittleEndian.PutUint32(header, math.MaxUint32)
+	file, err := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0o640)
+	require.NoError(t, err)
+	_, err = file.Write(append(header, "payload"...))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	w, err = Open(logger, opts...)
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.Equal(t, uint64(3), w.LastLSN())
+	assert.Equal(t, want, replayRecords(t, w, 0))
+}
+
+// failingFile writes a half of the data once and fails.
+type failingFile struct {
+	segmentFile
+	failed bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.failed {
+		return f.segmentFile.Write(p)
+	}
+	f.failed = true
+	n, _ := f.segmentFile.Write(p[:len(p)/2])
+	return n, errUnexpected
+}
+
+func TestWAL_partialWrite(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithDataDirectory(dir), WithFlushMode(SyncFlushMode)}
+
+	w, err := Open(logger, opts...)
+	require.NoError(t, err)
+	want := writeRecords(t, w, 2)
+
+	w.file = &failingFile{segmentFile: w.file}
+	err = w.Write(context.Background(), 1, []string{"lost"})
+	require.ErrorIs(t, err, errUnexpected)
+	require.NoError(t, w.Write(context.Background(), 2, []string{"key"}))
+	require.NoError(t, w.Close())
+
+	// The record written after the failed one is reachable.
+	w, err = Open(logger, opts...)
+	require.NoError(t, err)
+	defer w.Close()
+
+	want = append(want, Record{LSN: 4, CommandID: 2, Args: []string{"key"}})
+	assert.Equal(t, want, replayRecords(t, w, 0))
+}
+
+func TestWAL_corruptedSegment(t *testing.T) {
+	dir := t.TempDir()
+	opts := []Option{WithDataDirectory(dir), WithFlushMode(SyncFlushMode), WithMaxSegmentSize(1)}
+
+	w, err := Open(logger, opts...)
+	require.NoError(t, err)
+	writeRecords(t, w, 3)
+	require.NoError(t, w.Close())
+
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+
+	data, err := os.ReadFile(segments[0].path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(segments[0].path, data, 0o640))
+
+	w, err = Open(logger, opts...)
+	require.NoError(t, err)
+	defer w.Close()
+
+	err = w.Replay(0, func(Record) error { return nil })
+	require.ErrorIs(t, err, errCorruptedRecord)
+}
+
+func TestWAL_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := Open(logger, WithDataDirectory(dir), WithFlushMode(SyncFlushMode), WithMaxSegmentSize(1))
+	require.NoError(t, err)
+	defer w.Close()
+
+	want := writeRecords(t, w, 5)
+
+	require.NoError(t, w.Compact(3))
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Len(t, segments, 2)
+	assert.Equal(t, want[3:], replayRecords(t, w, 3))
+
+	require.NoError(t, w.Compact(100))
+	segments, err = listSegments(dir)
+	require.NoError(t, err)
+	assert.Len(t, segments, 1, "active segment must be kept")
+}
+
+func TestWAL_AdvanceLSN(t *testing.T) {
+	w, err := Open(logger, WithDataDirectory(t.TempDir()), WithFlushMode(SyncFlushMode))
+	require.NoError(t, err)
+	defer w.Close()
+
+	writeRecords(t, w, 2)
+	w.AdvanceLSN(1)
+	assert.Equal(t, uint64(2), w.LastLSN())
+
+	w.AdvanceLSN(10)
+	require.NoError(t, w.Write(context.Background(), 1, []string{"key"}))
+	assert.Equal(t, uint64(11), w.LastLSN())
+}
+
+func TestWAL_Append(t *testing.T) {
+	w, err := Open(logger, WithDataDirectory(t.TempDir()), WithFlushBatchTimeout(time.Hour))
+	require.NoError(t, err)
+	defer w.Close()
+
+	waits := make([]func(ctx context.Context) error, 0, 3)
+	for i := range 3 {
+		wait, appendErr := w.Append(1, []string{fmt.Sprintf("key-%d", i)})
+		require.NoError(t, appendErr)
+		waits = append(waits, wait)
+	}
+	assert.Equal(t, uint64(3), w.LastLSN())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, waits[0](ctx), context.DeadlineExceeded)
+
+	w.flush()
+	for _, wait := range waits {
+		require.NoError(t, wait(context.Background()))
+	}
+
+	records := replayRecords(t, w, 0)
+	require.Len(t, records, 3)
+	for i, rec := range records {
+		assert.Equal(t, []string{fmt.Sprintf("key-%d", i)}, rec.Args)
+	}
+}
+
+func TestWAL_writeAfterClose(t *testing.T) {
+	w, err := Open(logger, WithDataDirectory(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	err = w.Write(context.Background(), 1, []string{"key"})
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = w.Append(1, []string{"key"})
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func writeRecords(t *testing.T, w *WAL, n int) []Record {
+	t.Helper()
+
+	records := make([]Record, 0, n)
+	for i := range n {
+		args := []string{fmt.Sprintf("key-%d", i), fmt.Sprintf("value %d", i)}
+		require.NoError(t, w.Write(context.Background(), i%3+1, args))
+		records = append(records, Record{LSN: uint64(i + 1), CommandID: i%3 + 1, Args: args})
+	}
+	return records
+}
+
+func replayRecords(t *testing.T, w *WAL, fromLSN uint64) []Record {
+	t.Helper()
+
+	var records []Record
+	err := w.Replay(fromLSN, func(rec Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	require.NoError(t, err)
+	return records
+}
@@ -0,0 +1,36 @@
+package network
+
+import (
+	"io"
+)
+
+// Codec reads the requests from the connection and writes the responses
+// back, it defines how the messages are delimited on the wire. The messages
+// are read and written by different goroutines.
+type Codec interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(msg []byte) error
+}
+
+// NewCodecFunc creates the codec of the connection. The codec rejects
+// the messages larger than maxSize bytes with ErrFrameTooLarge.
+type NewCodecFunc func(rw io.ReadWriter, maxSize int) Codec
+
+// framedCodec delimits the messages by the length prefix.
+type framedCodec struct {
+	w  io.Writer
+	fr *FrameReader
+}
+
+// NewFramedCodec creates the codec of the memdb protocol.
+func NewFramedCodec(rw io.ReadWriter, maxSize int) Codec {
+	return &framedCodec{w: rw, fr: NewFrameReader(rw, maxSize)}
+}
+
+func (c *framedCodec) ReadMessage() ([]byte, error) {
+	return c.fr.ReadFrame()
+}
+
+func (c *framedCodec) WriteMessage(msg []byte) error {
+	return WriteFrame(c.w, msg)
+}
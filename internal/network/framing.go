@@ -0,0 +1,60 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The messages are framed by prefixing them with their length
+// encoded as 4 bytes unsigned integer in big-endian order.
+const frameHeaderSize = 4
+
+var ErrFrameTooLarge = errors.New("frame is too large")
+
+// FrameReader reads the length-prefixed messages from the stream
+// reassembling them regardless of how the stream is segmented.
+type FrameReader struct {
+	r       *bufio.Reader
+	maxSize int
+	header  [frameHeaderSize]byte
+}
+
+// NewFrameReader creates the reader rejecting the messages larger than maxSize bytes.
+func NewFrameReader(r io.Reader, maxSize int) *FrameReader {
+	return &FrameReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// ReadFrame returns the next message. io.EOF is returned only if the stream
+// ends between the messages, io.ErrUnexpectedEOF is returned otherwise.
+func (r *FrameReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(r.r, r.header[:]); err != nil {
+		return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+	}
+
+	size := binary.BigEndian.Uint32(r.header[:])
+	if uint64(size) > uint64(r.maxSize) { //nolint:gosec // maxSize is not negative
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err //nolint:wrapcheck // ignore
+	}
+	return payload, nil
+}
+
+// WriteFrame writes the message prefixed with its length in a single write.
+func WriteFrame(w io.Writer, payload []byte) error {
+	buf := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload))) //nolint:gosec // messages are limited far below 4 GiB
+	copy(buf[frameHeaderSize:], payload)
+
+	_, err := w.Write(buf)
+	return err //nolint:wrapcheck // ignore
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameReader(t *testing.T) {
+	frames := func(msgs ...string) []byte {
+		var buf bytes.Buffer
+		for _, msg := range msgs {
+			require.NoError(t, WriteFrame(&buf, []byte(msg)))
+		}
+		return buf.Bytes()
+	}
+
+	testCases := []struct {
+		name    string
+		r       io.Reader
+		maxSize int
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "coalesced",
+			r:       bytes.NewReader(frames("hello", "", "world")),
+			maxSize: 16,
+			want:    []string{"hello", "", "world"},
+			wantErr: io.EOF,
+		},
+		{
+			name:    "fragmented",
+			r:       iotest.OneByteReader(bytes.NewReader(frames("hello", "world"))),
+			maxSize: 16,
+			want:    []string{"hello", "world"},
+			wantErr: io.EOF,
+		},
+		{
+			name:    "max size",
+			r:       bytes.NewReader(frames("hello", "hello, world")),
+			maxSize: 5,
+			want:    []string{"hello"},
+			wantErr: ErrFrameTooLarge,
+		},
+		{
+			name:    "truncated header",
+			r:       bytes.NewReader(frames("hello")[:2]),
+			maxSize: 16,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "truncated payload",
+			r:       bytes.NewReader(frames("hello")[:frameHeaderSize]),
+			maxSize: 16,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fr := NewFrameReader(tc.r, tc.maxSize)
+
+			var got []string
+			for {
+				msg, err := fr.ReadFrame()
+				if err != nil {
+					require.ErrorIs(t, err, tc.wantErr)
+					break
+				}
+				got = append(got, string(msg))
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
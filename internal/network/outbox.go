@@ -0,0 +1,189 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrOutputBufferOverflow is returned by Session.Push when the client
+	// doesn't read the pushed messages fast enough, it's disconnected then.
+	ErrOutputBufferOverflow = errors.New("output buffer overflow")
+	ErrSessionClosed        = errors.New("session is closed")
+	ErrPushNotSupported     = errors.New("session doesn't support pushed messages")
+)
+
+// outbox queues the messages written to the connection by its writer
+// goroutine. The slot of the reply is reserved before the request is handled,
+// so the messages pushed meanwhile are written after the reply.
+type outbox struct {
+	mu    sync.Mutex
+	slots []*outboxSlot
+	// pushed and replied are the sizes of the pushed messages and the replies
+	// waiting to be written.
+	pushed  int
+	replied int
+	limit   int
+	err     error
+	wake    chan struct{}
+	// room is signaled when the replies are written, see waitRoom.
+	room chan struct{}
+	// onOverflow closes the connection, so the writer blocked by the client
+	// not reading the messages is interrupted.
+	onOverflow func()
+}
+
+type outboxSlot struct {
+	msg    []byte
+	filled bool
+	push   bool
+}
+
+// newOutbox creates the outbox holding up to limit bytes of the pushed
+// messages, zero means no limit. onOverflow is called once the limit is exceeded.
+// The replies are limited separately, see waitRoom.
+func newOutbox(limit int, onOverflow func()) *outbox {
+	return &outbox{
+		limit:      limit,
+		wake:       make(chan struct{}, 1),
+		room:       make(chan struct{}, 1),
+		onOverflow: onOverflow,
+	}
+}
+
+// reserve queues the slot of the reply to the request being handled.
+func (o *outbox) reserve() *outboxSlot {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	slot := &outboxSlot{}
+	o.slots = append(o.slots, slot)
+	return slot
+}
+
+// fill puts the reply to the reserved slot.
+func (o *outbox) fill(slot *outboxSlot, msg []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	slot.msg, slot.filled = msg, true
+	o.replied += len(msg)
+	o.signal()
+}
+
+// waitRoom waits until the replies waiting to be written take less than
+// the limit, so the client sending the requests without reading the replies
+// isn't served until it catches up. It returns once the outbox is closed.
+func (o *outbox) waitRoom(ctx context.Context) error {
+	for {
+		o.mu.Lock()
+		full := o.limit > 0 && o.replied >= o.limit && o.err == nil
+		o.mu.Unlock()
+		if !full {
+			return nil
+		}
+
+		select {
+		case <-o.room:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// push queues the message without waiting for it to be written. The outbox
+// is closed with ErrOutputBufferOverflow if the limit is exceeded.
+func (o *outbox) push(msg []byte) error {
+	o.mu.Lock()
+	if o.err != nil {
+		o.mu.Unlock()
+		return o.err
+	}
+	if o.limit > 0 && o.pushed+len(msg) > o.limit {
+		o.err = ErrOutputBufferOverflow
+		o.signal()
+		o.signalRoom()
+		o.mu.Unlock()
+
+		if o.onOverflow != nil {
+			o.onOverflow()
+		}
+		return ErrOutputBufferOverflow
+	}
+
+	o.slots = append(o.slots, &outboxSlot{msg: msg, filled: true, push: true})
+	o.pushed += len(msg)
+	o.signal()
+	o.mu.Unlock()
+	return nil
+}
+
+// close stops accepting the pushed messages, the queued ones are still written.
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.err == nil {
+		o.err = ErrSessionClosed
+	}
+	o.signal()
+	o.signalRoom()
+}
+
+// next waits for the message at the head of the queue. It returns the error
+// once the outbox is closed and there is nothing more to write, on overflow
+// the queued messages are dropped.
+func (o *outbox) next() ([]byte, error) {
+	for {
+		o.mu.Lock()
+		if errors.Is(o.err, ErrOutputBufferOverflow) {
+			o.mu.Unlock()
+			return nil, ErrOutputBufferOverflow
+		}
+		if len(o.slots) != 0 && o.slots[0].filled {
+			slot := o.slots[0]
+			o.slots[0] = nil
+			o.slots = o.slots[1:]
+			if slot.push {
+				o.pushed -= len(slot.msg)
+			} else {
+				o.replied -= len(slot.msg)
+				o.signalRoom()
+			}
+			o.mu.Unlock()
+			return slot.msg, nil
+		}
+		err := o.err
+		o.mu.Unlock()
+
+		if err != nil {
+			// The reply of the aborted request is never filled.
+			return nil, err
+		}
+		<-o.wake
+	}
+}
+
+// overflowed reports whether the client is disconnected because of the overflow.
+func (o *outbox) overflowed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return errors.Is(o.err, ErrOutputBufferOverflow)
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+		// The writer is already signaled.
+	}
+}
+
+func (o *outbox) signalRoom() {
+	select {
+	case o.room <- struct{}{}:
+	default:
+		// The reader is already signaled.
+	}
+}
@@ -0,0 +1,39 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+// codec passes the commands to the handler as the arrays
+// of bulk strings even if they are sent inline.
+type codec struct {
+	w io.Writer
+	r *Reader
+}
+
+// NewCodec creates the codec of the RESP listener. The handler receives
+// the commands encoded by AppendCommand and returns the encoded replies.
+func NewCodec(rw io.ReadWriter, maxSize int) network.Codec {
+	return &codec{w: rw, r: NewReader(rw, maxSize)}
+}
+
+func (c *codec) ReadMessage() ([]byte, error) {
+	args, err := c.r.ReadCommand()
+	if err != nil {
+		return nil, err
+	}
+	return AppendCommand(nil, args), nil
+}
+
+func (c *codec) WriteMessage(msg []byte) error {
+	_, err := c.w.Write(msg)
+	return err //nolint:wrapcheck // ignore
+}
+
+// ParseCommand decodes the command encoded by AppendCommand.
+func ParseCommand(msg []byte) ([]string, error) {
+	return NewReader(bytes.NewReader(msg), len(msg)).ReadCommand()
+}
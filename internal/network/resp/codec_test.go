@@ -0,0 +1,61 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func TestCodec(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	srv, err := network.NewTCPServer(
+		logger,
+		network.WithServerListen(":0"),
+		network.WithServerCodec(NewCodec),
+	)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, srv.Shutdown(context.Background()))
+	}()
+
+	// The handler replies with the number of arguments of the command.
+	go srv.ServeHandler(network.TCPHandlerFunc(func(_ context.Context, req string) string {
+		args, err := ParseCommand([]byte(req))
+		if err != nil {
+			return "-ERR " + err.Error() + "\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", len(args))
+	}))
+
+	conn, err := net.Dial("tcp", fmt.Sprintf(":%d", srv.ListenPort()))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(time.Second)))
+
+	// The commands are sent back to back and split in the middle.
+	input := "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\nPING\r\n*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n"
+	for _, part := range []string{input[:7], input[7:30], input[30:]} {
+		_, err = conn.Write([]byte(part))
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+	}
+
+	r := bufio.NewReader(conn)
+	for _, want := range []string{":2", ":1", ":3"} {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, want, strings.TrimSuffix(line, "\r\n"))
+	}
+}
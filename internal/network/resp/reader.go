@@ -0,0 +1,141 @@
+// Package resp implements the Redis serialization protocol (RESP),
+// so the database can be used by the Redis clients.
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+// Reader reads the commands sent by the clients. A command is either
+// the array of bulk strings or the inline command, i.e. the line of
+// space separated arguments.
+type Reader struct {
+	r       *bufio.Reader
+	maxSize int
+}
+
+// NewReader creates the reader rejecting the commands whose arguments
+// are larger than maxSize bytes in total.
+func NewReader(r io.Reader, maxSize int) *Reader {
+	return &Reader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// ReadCommand returns the arguments of the next command. Empty inline
+// commands are skipped. io.EOF is returned only between the commands.
+func (r *Reader) ReadCommand() ([]string, error) {
+	for {
+		prefix, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+		}
+		if prefix[0] == arrayPrefix {
+			return r.readArray()
+		}
+
+		args, err := r.readInline()
+		if err != nil || len(args) != 0 {
+			return args, err
+		}
+	}
+}
+
+func (r *Reader) readArray() ([]string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := parseLength(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	if n > r.maxSize {
+		return nil, fmt.Errorf("%w: %d arguments", network.ErrFrameTooLarge, n)
+	}
+
+	args, size := make([]string, 0, n), 0
+	for range n {
+		line, err = r.readLine()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if len(line) == 0 || line[0] != bulkStringPrefix {
+			return nil, fmt.Errorf("%w: expected bulk string, got %q", ErrProtocol, line)
+		}
+
+		var length int
+		if length, err = parseLength(line[1:]); err != nil {
+			return nil, err
+		}
+		if size += length; size > r.maxSize {
+			return nil, fmt.Errorf("%w: %d bytes", network.ErrFrameTooLarge, size)
+		}
+
+		buf := make([]byte, length+len(crlf))
+		if _, err = io.ReadFull(r.r, buf); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if !bytes.HasSuffix(buf, []byte(crlf)) {
+			return nil, fmt.Errorf("%w: bulk string is not terminated", ErrProtocol)
+		}
+		args = append(args, string(buf[:length]))
+	}
+	return args, nil
+}
+
+func (r *Reader) readInline() ([]string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(line)), nil
+}
+
+// readLine returns the line without the terminating CRLF or LF.
+func (r *Reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > r.maxSize+len(crlf) {
+			return nil, fmt.Errorf("%w: line is too long", network.ErrFrameTooLarge)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			if len(line) == 0 {
+				return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+			}
+			return nil, unexpectedEOF(err)
+		}
+		break
+	}
+
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), nil
+}
+
+func parseLength(b []byte) (int, error) {
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: invalid length %q", ErrProtocol, b)
+	}
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
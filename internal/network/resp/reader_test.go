@@ -0,0 +1,109 @@
+package resp
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mort4lis/memdb/internal/network"
+)
+
+func TestReader_ReadCommand(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		maxSize int
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name:  "array",
+			input: "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$11\r\nhello world\r\n",
+			want:  [][]string{{"SET", "key", "hello world"}},
+		},
+		{
+			name:  "binary value",
+			input: "*2\r\n$3\r\nGET\r\n$4\r\na\r\nb\r\n",
+			want:  [][]string{{"GET", "a\r\nb"}},
+		},
+		{
+			name:  "empty value",
+			input: "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$0\r\n\r\n",
+			want:  [][]string{{"SET", "key", ""}},
+		},
+		{
+			name:  "inline",
+			input: "SET key  value\r\n\r\nGET key\n",
+			want:  [][]string{{"SET", "key", "value"}, {"GET", "key"}},
+		},
+		{
+			name:  "pipelined",
+			input: "*1\r\n$5\r\nMULTI\r\n*1\r\n$4\r\nEXEC\r\n",
+			want:  [][]string{{"MULTI"}, {"EXEC"}},
+		},
+		{
+			name:    "too large",
+			input:   "*2\r\n$3\r\nGET\r\n$20\r\n",
+			maxSize: 16,
+			wantErr: network.ErrFrameTooLarge,
+		},
+		{
+			name:    "invalid length",
+			input:   "*2\r\n$x\r\n",
+			wantErr: ErrProtocol,
+		},
+		{
+			name:    "not bulk string",
+			input:   "*1\r\n:1\r\n",
+			wantErr: ErrProtocol,
+		},
+		{
+			name:    "not terminated",
+			input:   "*1\r\n$3\r\nGETX\r\n",
+			wantErr: ErrProtocol,
+		},
+		{
+			name:    "truncated",
+			input:   "*2\r\n$3\r\nGET\r\n",
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			maxSize := tc.maxSize
+			if maxSize == 0 {
+				maxSize = 1024
+			}
+
+			// Every byte is read separately to check the commands are reassembled.
+			r := NewReader(iotest.OneByteReader(strings.NewReader(tc.input)), maxSize)
+
+			var got [][]string
+			for {
+				args, err := r.ReadCommand()
+				if err != nil {
+					wantErr := tc.wantErr
+					if wantErr == nil {
+						wantErr = io.EOF
+					}
+					require.ErrorIs(t, err, wantErr)
+					break
+				}
+				got = append(got, args)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	args := []string{"SET", "key", "hello\r\nworld", ""}
+	got, err := ParseCommand(AppendCommand(nil, args))
+	require.NoError(t, err)
+	assert.Equal(t, args, got)
+}
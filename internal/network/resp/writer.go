@@ -0,0 +1,124 @@
+package resp
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	simpleStringPrefix = '+'
+	errorPrefix        = '-'
+	integerPrefix      = ':'
+	bulkStringPrefix   = '$'
+	arrayPrefix        = '*'
+	nullPrefix         = '_'
+	mapPrefix          = '%'
+	pushPrefix         = '>'
+
+	crlf = "\r\n"
+)
+
+// Protocol versions negotiated by HELLO.
+const (
+	Version2 = 2
+	Version3 = 3
+)
+
+// Writer encodes the replies. The types missing in RESP2 are encoded
+// as their RESP2 counterparts unless the writer is of version 3.
+type Writer struct {
+	version int
+	buf     []byte
+}
+
+func NewWriter(version int) *Writer {
+	return &Writer{version: version}
+}
+
+func (w *Writer) SimpleString(s string) {
+	w.line(simpleStringPrefix, s)
+}
+
+// Error writes the error reply, the code is the first word of the
+// message by convention, e.g. ERR or WRONGTYPE. Line breaks in the message
+// are replaced by spaces as the error reply can't contain them.
+func (w *Writer) Error(code, msg string) {
+	w.line(errorPrefix, code+" "+errorReplacer.Replace(msg))
+}
+
+var errorReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+func (w *Writer) Integer(n int64) {
+	w.line(integerPrefix, strconv.FormatInt(n, 10))
+}
+
+func (w *Writer) BulkString(s string) {
+	w.line(bulkStringPrefix, strconv.Itoa(len(s)))
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, crlf...)
+}
+
+// Array writes the header of the array, the elements are written next.
+func (w *Writer) Array(n int) {
+	w.line(arrayPrefix, strconv.Itoa(n))
+}
+
+// Map writes the header of the map, n keys and values are written next
+// one after another. It's written as the flat array in RESP2.
+func (w *Writer) Map(n int) {
+	if w.version < Version3 {
+		w.Array(2 * n) //nolint:mnd // keys and values
+		return
+	}
+	w.line(mapPrefix, strconv.Itoa(n))
+}
+
+// Push writes the header of the out-of-band message, e.g. the pub/sub
+// message, the elements are written next. It's written as the array in RESP2.
+func (w *Writer) Push(n int) {
+	if w.version < Version3 {
+		w.Array(n)
+		return
+	}
+	w.line(pushPrefix, strconv.Itoa(n))
+}
+
+// Null writes the missing value, it's the null bulk string in RESP2.
+func (w *Writer) Null() {
+	if w.version < Version3 {
+		w.buf = append(w.buf, "$-1"+crlf...)
+		return
+	}
+	w.buf = append(w.buf, nullPrefix)
+	w.buf = append(w.buf, crlf...)
+}
+
+// NullArray writes the missing array, it's the null array in RESP2.
+func (w *Writer) NullArray() {
+	if w.version < Version3 {
+		w.buf = append(w.buf, "*-1"+crlf...)
+		return
+	}
+	w.Null()
+}
+
+// Bytes returns the encoded replies.
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+func (w *Writer) line(prefix byte, s string) {
+	w.buf = append(w.buf, prefix)
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, crlf...)
+}
+
+// AppendCommand encodes the command as the array of bulk strings.
+func AppendCommand(b []byte, args []string) []byte {
+	w := Writer{buf: b}
+	w.Array(len(args))
+	for _, arg := range args {
+		w.BulkString(arg)
+	}
+	return w.buf
+}
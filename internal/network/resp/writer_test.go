@@ -0,0 +1,45 @@
+package resp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	write := func(w *Writer) {
+		w.Map(1)
+		w.BulkString("key")
+		w.Array(4)
+		w.SimpleString("OK")
+		w.Integer(-1)
+		w.Null()
+		w.NullArray()
+		w.Error("ERR", "unknown")
+	}
+
+	testCases := []struct {
+		name    string
+		version int
+		want    string
+	}{
+		{
+			name:    "resp2",
+			version: Version2,
+			want:    "*2\r\n$3\r\nkey\r\n*4\r\n+OK\r\n:-1\r\n$-1\r\n*-1\r\n-ERR unknown\r\n",
+		},
+		{
+			name:    "resp3",
+			version: Version3,
+			want:    "%1\r\n$3\r\nkey\r\n*4\r\n+OK\r\n:-1\r\n_\r\n_\r\n-ERR unknown\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewWriter(tc.version)
+			write(w)
+			assert.Equal(t, tc.want, string(w.Bytes()))
+		})
+	}
+}
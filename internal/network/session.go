@@ -0,0 +1,151 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Session keeps the state of the client connection shared by its requests.
+type Session struct {
+	id          uint64
+	remoteAddr  net.Addr
+	connectedAt time.Time
+
+	mu         sync.Mutex
+	user       string
+	db         int
+	subscribed bool
+	attrs      map[any]any
+	// out and conn are nil unless the session belongs to the connection served by TCPServer.
+	out  *outbox
+	conn net.Conn
+}
+
+func NewSession(id uint64, remoteAddr net.Addr) *Session {
+	return &Session{
+		id:          id,
+		remoteAddr:  remoteAddr,
+		connectedAt: time.Now(),
+		attrs:       make(map[any]any),
+	}
+}
+
+// ID returns the identifier of the connection unique within the server.
+func (s *Session) ID() uint64 {
+	return s.id
+}
+
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+func (s *Session) ConnectedAt() time.Time {
+	return s.connectedAt
+}
+
+// User returns the name of the authenticated user, it's empty until
+// the client is authenticated.
+func (s *Session) User() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+func (s *Session) SetUser(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+// DB returns the index of the selected database.
+func (s *Session) DB() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db
+}
+
+func (s *Session) SelectDB(db int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db = db
+}
+
+// Push sends the message to the client outside of the request-response flow
+// without waiting for it to be written. If the client doesn't keep up with
+// the messages, ErrOutputBufferOverflow is returned and it's disconnected.
+func (s *Session) Push(msg []byte) error {
+	s.mu.Lock()
+	out := s.out
+	s.mu.Unlock()
+
+	if out == nil {
+		return ErrPushNotSupported
+	}
+	return out.push(msg)
+}
+
+// Close disconnects the client. The request being handled is completed,
+// but its reply isn't written.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("close connection: %w", err)
+	}
+	return nil
+}
+
+// Subscribed reports whether the client waits for the pushed messages.
+func (s *Session) Subscribed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribed
+}
+
+// SetSubscribed marks the client as waiting for the pushed messages,
+// such clients aren't disconnected by the idle timeout.
+func (s *Session) SetSubscribed(subscribed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribed = subscribed
+}
+
+// Value returns the attribute associated with the key or nil.
+func (s *Session) Value(key any) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attrs[key]
+}
+
+// SetValue associates the attribute with the key, nil value removes it.
+func (s *Session) SetValue(key, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if value == nil {
+		delete(s.attrs, key)
+		return
+	}
+	s.attrs[key] = value
+}
+
+type sessionCtxKey struct{}
+
+func ContextWithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionCtxKey{}, s)
+}
+
+// SessionFromContext returns the session of the connection the request came from.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionCtxKey{}).(*Session)
+	return s, ok
+}
@@ -0,0 +1,39 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	type attrKey struct{}
+
+	s := NewSession(1, nil)
+	assert.Equal(t, uint64(1), s.ID())
+	assert.Empty(t, s.User())
+	assert.Zero(t, s.DB())
+	assert.Nil(t, s.Value(attrKey{}))
+
+	s.SetUser("alice")
+	s.SelectDB(3)
+	s.SetValue(attrKey{}, "value")
+	assert.Equal(t, "alice", s.User())
+	assert.Equal(t, 3, s.DB())
+	assert.Equal(t, "value", s.Value(attrKey{}))
+
+	s.SetValue(attrKey{}, nil)
+	assert.Nil(t, s.Value(attrKey{}))
+}
+
+func TestSessionFromContext(t *testing.T) {
+	_, ok := SessionFromContext(context.Background())
+	assert.False(t, ok)
+
+	s := NewSession(1, nil)
+	got, ok := SessionFromContext(ContextWithSession(context.Background(), s))
+	require.True(t, ok)
+	assert.Same(t, s, got)
+}
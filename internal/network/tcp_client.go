@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/Mort4lis/memdb/internal/pkg/netutils"
@@ -36,6 +37,8 @@ func WithClientWriteTimeout(d time.Duration) TCPClientOption {
 	}
 }
 
+// WithClientReadBufferSize limits the size of the response. The buffer
+// is allocated by the length of every response, not in advance.
 func WithClientReadBufferSize(n int) TCPClientOption {
 	return func(c *TCPClientConfig) {
 		c.readBufferSize = n
@@ -43,12 +46,26 @@ func WithClientReadBufferSize(n int) TCPClientOption {
 }
 
 const (
-	defaultReadBufferSize = 4096
+	// defaultReadBufferSize is large enough for MGET, HGETALL, LRANGE
+	// and XRANGE replies of the big keys.
+	defaultReadBufferSize = 64 << 20
+	// messagesBufferSize is the number of the received messages
+	// waiting to be consumed in the subscribe mode.
+	messagesBufferSize = 64
 )
 
+var ErrSubscribeMode = errors.New("client is in subscribe mode")
+
 type TCPClient struct {
 	conn net.Conn
+	fr   *FrameReader
 	conf TCPClientConfig
+
+	mu sync.Mutex
+	// messages is not nil in the subscribe mode.
+	messages  chan string
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func NewTCPClient(addr string, opts ...TCPClientOption) (*TCPClient, error) {
@@ -71,34 +88,80 @@ func NewTCPClient(addr string, opts ...TCPClientOption) (*TCPClient, error) {
 		return nil, fmt.Errorf("dial server: %w", err)
 	}
 	return &TCPClient{
-		conn: conn,
-		conf: conf,
+		conn:   conn,
+		fr:     NewFrameReader(conn, conf.readBufferSize),
+		conf:   conf,
+		closed: make(chan struct{}),
 	}, nil
 }
 
+// Send sends the request and waits for the response. The responses
+// larger than the read buffer size are rejected with ErrFrameTooLarge.
 func (c *TCPClient) Send(req string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.messages != nil {
+		return "", ErrSubscribeMode
+	}
+
 	netutils.SetWriteDeadline(c.conn, c.conf.writeTimeout)
-	if _, err := c.conn.Write([]byte(req)); err != nil {
+	if err := WriteFrame(c.conn, []byte(req)); err != nil {
 		return "", fmt.Errorf("write tcp socket: %w", err)
 	}
 
-	buf := make([]byte, c.conf.readBufferSize)
-
 	netutils.SetReadDeadline(c.conn, c.conf.readTimeout)
-	n, err := c.conn.Read(buf)
+	resp, err := c.fr.ReadFrame()
 	if err != nil {
 		return "", fmt.Errorf("read tcp socket: %w", err)
 	}
-	if n == c.conf.readBufferSize {
-		return "", errors.New("buffer is full")
+	return string(resp), nil
+}
+
+// Subscribe sends the request switching the client to the subscribe mode,
+// e.g. SUBSCRIBE. The replies and the messages pushed by the server are
+// delivered on the returned channel in the order they arrive, the channel
+// is closed with the connection. In the subscribe mode, the requests are
+// sent by Subscribe, Send fails with ErrSubscribeMode.
+func (c *TCPClient) Subscribe(req string) (<-chan string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	netutils.SetWriteDeadline(c.conn, c.conf.writeTimeout)
+	if err := WriteFrame(c.conn, []byte(req)); err != nil {
+		return nil, fmt.Errorf("write tcp socket: %w", err)
+	}
+
+	if c.messages == nil {
+		c.messages = make(chan string, messagesBufferSize)
+		// The messages are pushed whenever they are published.
+		netutils.ClearReadDeadline(c.conn)
+		go c.readMessages(c.messages)
+	}
+	return c.messages, nil
+}
+
+func (c *TCPClient) readMessages(messages chan<- string) {
+	defer close(messages)
+	for {
+		msg, err := c.fr.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		select {
+		case messages <- string(msg):
+		case <-c.closed:
+			return
+		}
 	}
-	return string(buf[:n]), nil
 }
 
 func (c *TCPClient) Close() error {
 	if c.conn == nil {
 		return nil
 	}
+	c.closeOnce.Do(func() { close(c.closed) })
 	if err := c.conn.Close(); err != nil {
 		return fmt.Errorf("close connection: %w", err)
 	}
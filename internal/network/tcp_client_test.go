@@ -1,9 +1,10 @@
 package network
 
 import (
-	"errors"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,12 +27,12 @@ func TestTCPClient(t *testing.T) {
 				return
 			}
 
-			_, err = conn.Read(make([]byte, 512))
+			_, err = NewFrameReader(conn, 512).ReadFrame()
 			if err != nil {
 				errCh <- err
 				return
 			}
-			_, err = conn.Write([]byte(serverResponse))
+			err = WriteFrame(conn, []byte(serverResponse))
 			if err != nil {
 				errCh <- err
 				return
@@ -79,7 +80,7 @@ func TestTCPClient(t *testing.T) {
 				require.NoError(t, err)
 				return cli
 			},
-			wantErr: errors.New("buffer is full"),
+			wantErr: ErrFrameTooLarge,
 		},
 		{
 			name: "Client with connection error",
@@ -106,10 +107,82 @@ func TestTCPClient(t *testing.T) {
 				require.NoError(t, err)
 				assert.Equal(t, serverResponse, resp)
 			} else {
-				require.Error(t, err)
-				assert.Equal(t, tc.wantErr, err)
+				require.ErrorIs(t, err, tc.wantErr)
 			}
 			assert.NoError(t, cli.Close())
 		})
 	}
 }
+
+func TestTCPClient_Subscribe(t *testing.T) {
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// The server replies to the request and pushes the messages later.
+		fr := NewFrameReader(conn, 512)
+		for _, resp := range []string{"subscribed", "message-1", "message-2"} {
+			if resp == "subscribed" {
+				if _, err = fr.ReadFrame(); err != nil {
+					return
+				}
+			}
+			time.Sleep(timeout)
+			if err = WriteFrame(conn, []byte(resp)); err != nil {
+				return
+			}
+		}
+	}()
+
+	cli, err := NewTCPClient(lis.Addr().String(), WithClientReadTimeout(timeout))
+	require.NoError(t, err)
+	defer cli.Close()
+
+	messages, err := cli.Subscribe("SUBSCRIBE channel")
+	require.NoError(t, err)
+	_, err = cli.Send("GET key")
+	require.ErrorIs(t, err, ErrSubscribeMode)
+
+	var got []string
+	for msg := range messages {
+		got = append(got, msg)
+	}
+	// The channel is closed with the connection, the read timeout doesn't apply.
+	assert.Equal(t, []string{"subscribed", "message-1", "message-2"}, got)
+}
+
+func TestTCPClient_largeResponse(t *testing.T) {
+	lis, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	// The response is much larger than the server's request limit.
+	want := strings.Repeat("x", 1<<20)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, err = NewFrameReader(conn, 512).ReadFrame(); err != nil {
+			return
+		}
+		_ = WriteFrame(conn, []byte(want))
+	}()
+
+	cli, err := NewTCPClient(lis.Addr().String(), WithClientReadTimeout(time.Second))
+	require.NoError(t, err)
+	defer cli.Close()
+
+	resp, err := cli.Send("LRANGE list 0 -1")
+	require.NoError(t, err)
+	assert.Equal(t, want, resp)
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Mort4lis/memdb/internal/pkg/concurrency"
@@ -24,12 +25,19 @@ func (fn TCPHandlerFunc) Handle(ctx context.Context, req string) string {
 	return fn(ctx, req)
 }
 
+// SessionHook is called when the client connects or disconnects.
+type SessionHook func(ctx context.Context, s *Session)
+
 type TCPServerConfig struct {
-	addr           string
-	maxConnections int
-	maxMessageSize int
-	idleTimeout    time.Duration
-	writeTimeout   time.Duration
+	addr            string
+	maxConnections  int
+	maxMessageSize  int
+	idleTimeout     time.Duration
+	writeTimeout    time.Duration
+	maxOutputBuffer int
+	newCodec        NewCodecFunc
+	onConnect       []SessionHook
+	onDisconnect    []SessionHook
 }
 
 type TCPServerOption func(c *TCPServerConfig)
@@ -64,10 +72,44 @@ func WithServerWriteTimeout(d time.Duration) TCPServerOption {
 	}
 }
 
+// WithServerMaxOutputBuffer sets the size of the pushed messages the client
+// may fall behind by before it's disconnected, zero means no limit. The requests
+// aren't read while the replies not written yet take the same size.
+func WithServerMaxOutputBuffer(n int) TCPServerOption {
+	return func(c *TCPServerConfig) {
+		c.maxOutputBuffer = n
+	}
+}
+
+// WithServerCodec sets the wire protocol of the server,
+// the length-prefixed framing is used by default.
+func WithServerCodec(fn NewCodecFunc) TCPServerOption {
+	return func(c *TCPServerConfig) {
+		c.newCodec = fn
+	}
+}
+
+// WithServerOnConnect adds the hook called before serving the connection.
+func WithServerOnConnect(fn SessionHook) TCPServerOption {
+	return func(c *TCPServerConfig) {
+		c.onConnect = append(c.onConnect, fn)
+	}
+}
+
+// WithServerOnDisconnect adds the hook called after the connection is closed.
+func WithServerOnDisconnect(fn SessionHook) TCPServerOption {
+	return func(c *TCPServerConfig) {
+		c.onDisconnect = append(c.onDisconnect, fn)
+	}
+}
+
 const (
 	defaultListenAddr     = ":7991"
 	defaultMaxConnections = 100
 	defaultMaxMessageSize = 4096
+	// defaultMaxOutputBuffer is the size of the pushed messages
+	// the subscriber may fall behind by, and of the replies.
+	defaultMaxOutputBuffer = 1 << 20
 )
 
 type TCPServer struct {
@@ -77,13 +119,23 @@ type TCPServer struct {
 	logger *slog.Logger
 	cancel func()
 	conf   TCPServerConfig
+
+	lastSessionID atomic.Uint64
+
+	// conns are the connections being served, their reading is stopped
+	// on shutdown, so the idle clients don't hold it up.
+	connsMu  sync.Mutex
+	conns    map[net.Conn]struct{}
+	shutdown bool
 }
 
 func NewTCPServer(logger *slog.Logger, opts ...TCPServerOption) (*TCPServer, error) {
 	conf := TCPServerConfig{
-		addr:           defaultListenAddr,
-		maxConnections: defaultMaxConnections,
-		maxMessageSize: defaultMaxMessageSize,
+		addr:            defaultListenAddr,
+		maxConnections:  defaultMaxConnections,
+		maxMessageSize:  defaultMaxMessageSize,
+		maxOutputBuffer: defaultMaxOutputBuffer,
+		newCodec:        NewFramedCodec,
 	}
 	for _, opt := range opts {
 		opt(&conf)
@@ -100,6 +152,7 @@ func NewTCPServer(logger *slog.Logger, opts ...TCPServerOption) (*TCPServer, err
 		logger: logger,
 		wg:     &sync.WaitGroup{},
 		sema:   concurrency.NewSemaphore(conf.maxConnections),
+		conns:  make(map[net.Conn]struct{}),
 	}, nil
 }
 
@@ -143,57 +196,154 @@ func (s *TCPServer) ServeHandler(h TCPHandler) {
 }
 
 func (s *TCPServer) handleConnection(ctx context.Context, conn net.Conn, h TCPHandler) {
-	logger := s.logger.With(slog.String("client_address", conn.RemoteAddr().String()))
+	sess := NewSession(s.lastSessionID.Add(1), conn.RemoteAddr())
+	sess.out = newOutbox(s.conf.maxOutputBuffer, func() { _ = conn.Close() })
+	sess.conn = conn
+	ctx = ContextWithSession(ctx, sess)
+
+	logger := s.logger.With(
+		slog.Uint64("session_id", sess.ID()),
+		slog.String("client_address", conn.RemoteAddr().String()),
+	)
 	logger.Info("Connected client")
 
+	s.track(conn)
+	defer s.untrack(conn)
+
+	codec := s.conf.newCodec(conn, s.conf.maxMessageSize)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		s.writeMessages(logger, conn, codec, sess.out)
+	}()
+
 	defer func() {
 		if err := recover(); err != nil {
 			logger.Error("caught panic", slog.Any("panic", err))
 		}
-		if err := conn.Close(); err != nil {
+		// Let the writer flush the replies.
+		sess.out.close()
+		<-writerDone
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			logger.Error("failed to close connection", slog.Any("error", err))
 		}
+		for _, fn := range s.conf.onDisconnect {
+			fn(ctx, sess)
+		}
 		logger.Info("Disconnected client")
 	}()
 
-	buf := make([]byte, s.conf.maxMessageSize)
+	for _, fn := range s.conf.onConnect {
+		fn(ctx, sess)
+	}
+
 	for {
 		var (
-			n   int
+			req []byte
 			err error
 		)
 
+		// The client not reading the replies isn't read from either.
+		if err = sess.out.waitRoom(ctx); err != nil {
+			return
+		}
 		err = concurrency.WithContextCheck(ctx, func() error {
-			netutils.SetReadDeadline(conn, s.conf.idleTimeout)
-			n, err = conn.Read(buf)
-			return err //nolint:wrapcheck // ignore
+			s.setReadDeadline(conn, sess)
+			req, err = codec.ReadMessage()
+			return err
 		})
+		if errors.Is(err, ErrFrameTooLarge) {
+			logger.Warn("max message size reached", slog.Any("error", err))
+			return
+		}
 		if err != nil {
-			if !errors.Is(err, io.EOF) {
+			// The connection closed by the writer is already logged,
+			// the reading is stopped on shutdown.
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && ctx.Err() == nil {
 				logger.Error("failed to read data", slog.Any("error", err))
 			}
 			return
 		}
-		if n == len(buf) {
-			logger.Warn("max message size reached")
-			return
-		}
 
+		slot := sess.out.reserve()
 		var resp string
 		err = concurrency.WithContextCheck(ctx, func() error {
-			resp = h.Handle(ctx, string(buf[:n]))
+			resp = h.Handle(ctx, string(req))
 			return nil
 		})
+		if err != nil || ctx.Err() != nil {
+			// The server is shutting down, the reply is dropped.
+			return
+		}
+		sess.out.fill(slot, []byte(resp))
+	}
+}
 
-		err = concurrency.WithContextCheck(ctx, func() error {
+// setReadDeadline applies the idle timeout unless the client waits for the pushed messages.
+func (s *TCPServer) setReadDeadline(conn net.Conn, sess *Session) {
+	if s.conf.idleTimeout == 0 {
+		return
+	}
+	if sess.Subscribed() {
+		netutils.ClearReadDeadline(conn)
+		return
+	}
+	netutils.SetReadDeadline(conn, s.conf.idleTimeout)
+}
+
+// track adds the connection to the served ones. The reading of the connection
+// accepted during the shutdown is stopped at once.
+func (s *TCPServer) track(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if s.shutdown {
+		stopReading(conn)
+		return
+	}
+	s.conns[conn] = struct{}{}
+}
+
+func (s *TCPServer) untrack(conn net.Conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+// stopReading makes the reads of the connection return io.EOF, so its handler
+// finishes once the reply to the request in progress is written.
+func stopReading(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseRead() error }); ok && c.CloseRead() == nil {
+		return
+	}
+	_ = conn.Close()
+}
+
+// writeMessages writes the replies and the pushed messages until the outbox
+// is closed. On failure the connection is closed to stop reading the requests.
+func (s *TCPServer) writeMessages(logger *slog.Logger, conn net.Conn, codec Codec, out *outbox) {
+	for {
+		msg, err := out.next()
+		if err == nil {
 			netutils.SetWriteDeadline(conn, s.conf.writeTimeout)
-			_, err = conn.Write([]byte(resp))
-			return err //nolint:wrapcheck // ignore
-		})
-		if err != nil {
-			logger.Error("failed to write data", slog.Any("error", err))
+			err = codec.WriteMessage(msg)
+		}
+
+		switch {
+		case err == nil:
+			continue
+		case out.overflowed():
+			// The connection is already closed by the publisher.
+			logger.Warn("output buffer limit reached, disconnecting slow client")
+		case errors.Is(err, ErrSessionClosed):
 			return
+		default:
+			logger.Error("failed to write data", slog.Any("error", err))
+			out.close()
+			_ = conn.Close()
 		}
+		return
 	}
 }
 
@@ -209,6 +359,15 @@ func (s *TCPServer) Shutdown(ctx context.Context) error {
 		s.cancel()
 	}
 
+	// Interrupt the connections waiting for the requests, e.g. the subscribed
+	// ones having no read deadline.
+	s.connsMu.Lock()
+	s.shutdown = true
+	for conn := range s.conns {
+		stopReading(conn)
+	}
+	s.connsMu.Unlock()
+
 	doneCh := make(chan struct{})
 	go func() {
 		s.wg.Wait()
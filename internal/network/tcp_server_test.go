@@ -1,12 +1,16 @@
 package network
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -75,7 +79,7 @@ func TestTCPServer_ServeHandler_maxMessageSizeReached(t *testing.T) {
 		[]TCPServerOption{WithServerMaxMessageSize(maxMessageSize)},
 		func(_, conn2 net.Conn) {
 			setDeadline(t, conn2)
-			_, err = conn2.Write(buf)
+			err = WriteFrame(conn2, buf)
 			require.NoError(t, err)
 
 			_, err = conn2.Read(buf)
@@ -84,6 +88,66 @@ func TestTCPServer_ServeHandler_maxMessageSizeReached(t *testing.T) {
 	)
 }
 
+func TestTCPServer_ServeHandler_fragmentedWrites(t *testing.T) {
+	runTCPServerTest(t, defaultHandlerFunc, nil, func(conn1, _ net.Conn) {
+		var frame bytes.Buffer
+		require.NoError(t, WriteFrame(&frame, []byte("hello")))
+
+		// Every byte including the length prefix comes in its own segment.
+		for _, b := range frame.Bytes() {
+			_, err := conn1.Write([]byte{b})
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond)
+		}
+
+		setDeadline(t, conn1)
+		resp, err := NewFrameReader(conn1, 512).ReadFrame()
+		require.NoError(t, err)
+		assert.Equal(t, "hello-response", string(resp))
+	})
+}
+
+func TestTCPServer_ServeHandler_coalescedWrites(t *testing.T) {
+	runTCPServerTest(t, defaultHandlerFunc, nil, func(conn1, _ net.Conn) {
+		reqs := []string{"first", "", "third"}
+
+		// All the requests are sent back to back in a single segment.
+		var frames bytes.Buffer
+		for _, req := range reqs {
+			require.NoError(t, WriteFrame(&frames, []byte(req)))
+		}
+		setDeadline(t, conn1)
+		_, err := conn1.Write(frames.Bytes())
+		require.NoError(t, err)
+
+		fr := NewFrameReader(conn1, 512)
+		for _, req := range reqs {
+			resp, err := fr.ReadFrame()
+			require.NoError(t, err)
+			assert.Equal(t, req+"-response", string(resp))
+		}
+	})
+}
+
+func TestTCPServer_ServeHandler_largeMessage(t *testing.T) {
+	const size = 1 << 20
+
+	runTCPServerTest(
+		t,
+		defaultHandlerFunc,
+		[]TCPServerOption{WithServerMaxMessageSize(2 * size)},
+		func(conn1, _ net.Conn) {
+			req := strings.Repeat("x", size)
+			require.NoError(t, conn1.SetDeadline(time.Now().Add(time.Second)))
+			require.NoError(t, WriteFrame(conn1, []byte(req)))
+
+			resp, err := NewFrameReader(conn1, 2*size).ReadFrame()
+			require.NoError(t, err)
+			assert.Equal(t, req+"-response", string(resp))
+		},
+	)
+}
+
 func TestTCPServer_ServeHandler_maxConnectionsReached(t *testing.T) {
 	const maxConnections = 1
 
@@ -93,7 +157,7 @@ func TestTCPServer_ServeHandler_maxConnectionsReached(t *testing.T) {
 		[]TCPServerOption{WithServerMaxConnections(maxConnections)},
 		func(_, conn2 net.Conn) {
 			setDeadline(t, conn2)
-			_, err := conn2.Write([]byte("hello"))
+			err := WriteFrame(conn2, []byte("hello"))
 			require.NoError(t, err)
 
 			buf := make([]byte, 512)
@@ -103,6 +167,273 @@ func TestTCPServer_ServeHandler_maxConnectionsReached(t *testing.T) {
 	)
 }
 
+func TestTCPServer_ServeHandler_session(t *testing.T) {
+	type counterKey struct{}
+
+	// The handler counts the requests of the connection in its session.
+	h := TCPHandlerFunc(func(ctx context.Context, _ string) string {
+		sess, ok := SessionFromContext(ctx)
+		if !ok {
+			return "no session"
+		}
+
+		n, _ := sess.Value(counterKey{}).(int)
+		sess.SetValue(counterKey{}, n+1)
+		return fmt.Sprintf("%d:%d", sess.ID(), n+1)
+	})
+
+	runTCPServerTest(t, h, nil, func(conn1, conn2 net.Conn) {
+		resp1, err := doRequest(conn1, "req")
+		require.NoError(t, err)
+		resp2, err := doRequest(conn1, "req")
+		require.NoError(t, err)
+		resp3, err := doRequest(conn2, "req")
+		require.NoError(t, err)
+
+		id1, n1, _ := strings.Cut(resp1, ":")
+		id2, n2, _ := strings.Cut(resp2, ":")
+		id3, n3, _ := strings.Cut(resp3, ":")
+		assert.Equal(t, []string{"1", "2", "1"}, []string{n1, n2, n3})
+		assert.Equal(t, id1, id2)
+		assert.NotEqual(t, id1, id3)
+	})
+}
+
+func TestTCPServer_ServeHandler_sessionHooks(t *testing.T) {
+	var (
+		connectedCh    = make(chan *Session, 2)
+		disconnectedCh = make(chan *Session, 2)
+	)
+
+	h := TCPHandlerFunc(func(ctx context.Context, _ string) string {
+		sess, _ := SessionFromContext(ctx)
+		return sess.RemoteAddr().String()
+	})
+	opts := []TCPServerOption{
+		WithServerOnConnect(func(_ context.Context, s *Session) {
+			connectedCh <- s
+		}),
+		WithServerOnDisconnect(func(_ context.Context, s *Session) {
+			disconnectedCh <- s
+		}),
+	}
+
+	runTCPServerTest(t, h, opts, func(conn1, conn2 net.Conn) {
+		resp, err := doRequest(conn1, "req")
+		require.NoError(t, err)
+		assert.Equal(t, conn1.LocalAddr().String(), resp)
+
+		connected := map[uint64]*Session{}
+		for range 2 {
+			s := <-connectedCh
+			assert.False(t, s.ConnectedAt().IsZero())
+			connected[s.ID()] = s
+		}
+		assert.Len(t, connected, 2)
+
+		require.NoError(t, conn2.Close())
+		select {
+		case s := <-disconnectedCh:
+			assert.Same(t, connected[s.ID()], s)
+			assert.Equal(t, conn2.LocalAddr().String(), s.RemoteAddr().String())
+		case <-time.After(time.Second):
+			t.Fatal("disconnect hook isn't called")
+		}
+	})
+}
+
+func TestTCPServer_ServeHandler_push(t *testing.T) {
+	sessCh := make(chan *Session, 1)
+	h := TCPHandlerFunc(func(ctx context.Context, req string) string {
+		sess, _ := SessionFromContext(ctx)
+		// The message pushed while handling the request goes after the reply.
+		if err := sess.Push([]byte("pushed-" + req)); err != nil {
+			return err.Error()
+		}
+		sess.SetSubscribed(true)
+		sessCh <- sess
+		return req + "-response"
+	})
+
+	runTCPServerTest(t, h, []TCPServerOption{WithServerIdleTimeout(timeout)}, func(conn1, _ net.Conn) {
+		require.NoError(t, WriteFrame(conn1, []byte("req")))
+		sess := <-sessCh
+
+		// The subscribed client isn't disconnected by the idle timeout.
+		time.Sleep(2 * timeout)
+		require.NoError(t, sess.Push([]byte("later")))
+
+		require.NoError(t, conn1.SetDeadline(time.Now().Add(time.Second)))
+		fr := NewFrameReader(conn1, 512)
+		for _, want := range []string{"req-response", "pushed-req", "later"} {
+			msg, err := fr.ReadFrame()
+			require.NoError(t, err)
+			assert.Equal(t, want, string(msg))
+		}
+	})
+}
+
+func TestTCPServer_ServeHandler_outputBufferOverflow(t *testing.T) {
+	const maxOutputBuffer = 16
+
+	sessCh := make(chan *Session, 1)
+	h := TCPHandlerFunc(func(ctx context.Context, _ string) string {
+		sess, _ := SessionFromContext(ctx)
+		sessCh <- sess
+		return "ok"
+	})
+
+	runTCPServerTest(t, h, []TCPServerOption{WithServerMaxOutputBuffer(maxOutputBuffer)}, func(conn1, _ net.Conn) {
+		resp, err := doRequest(conn1, "req")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", resp)
+		sess := <-sessCh
+
+		// The message doesn't fit the buffer, so the client is disconnected
+		// instead of the publisher waiting for it.
+		err = sess.Push([]byte(strings.Repeat("x", maxOutputBuffer+1)))
+		require.ErrorIs(t, err, ErrOutputBufferOverflow)
+		require.ErrorIs(t, sess.Push([]byte("x")), ErrOutputBufferOverflow)
+
+		require.NoError(t, conn1.SetDeadline(time.Now().Add(time.Second)))
+		_, err = conn1.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestTCPServer_ServeHandler_repliesLimit(t *testing.T) {
+	const (
+		requests  = 200
+		replySize = 256 << 10
+	)
+
+	var handled atomic.Int64
+	h := TCPHandlerFunc(func(context.Context, string) string {
+		handled.Add(1)
+		return strings.Repeat("x", replySize)
+	})
+
+	runTCPServerTest(t, h, []TCPServerOption{WithServerMaxOutputBuffer(1 << 10)}, func(conn1, _ net.Conn) {
+		go func() {
+			for range requests {
+				if err := WriteFrame(conn1, []byte("req")); err != nil {
+					return
+				}
+			}
+		}()
+
+		// The replies not read by the client stop the reading of the requests
+		// once the socket buffers are full.
+		time.Sleep(200 * time.Millisecond)
+		assert.Less(t, handled.Load(), int64(requests))
+
+		require.NoError(t, conn1.SetDeadline(time.Now().Add(5*time.Second)))
+		fr := NewFrameReader(conn1, replySize)
+		for range requests {
+			msg, err := fr.ReadFrame()
+			require.NoError(t, err)
+			require.Len(t, msg, replySize)
+		}
+		assert.Equal(t, int64(requests), handled.Load())
+	})
+}
+
+func TestSession_Close(t *testing.T) {
+	sessCh := make(chan *Session, 1)
+	h := TCPHandlerFunc(func(ctx context.Context, _ string) string {
+		sess, _ := SessionFromContext(ctx)
+		sessCh <- sess
+		return "ok"
+	})
+
+	runTCPServerTest(t, h, nil, func(conn1, _ net.Conn) {
+		_, err := doRequest(conn1, "req")
+		require.NoError(t, err)
+		sess := <-sessCh
+
+		require.NoError(t, sess.Close())
+		require.NoError(t, sess.Close())
+
+		require.NoError(t, conn1.SetDeadline(time.Now().Add(time.Second)))
+		_, err = conn1.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestSession_Push_notServed(t *testing.T) {
+	sess := NewSession(1, nil)
+	require.ErrorIs(t, sess.Push([]byte("msg")), ErrPushNotSupported)
+	require.NoError(t, sess.Close())
+}
+
+func TestTCPServer_Shutdown_blockedHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	srv, err := NewTCPServer(logger, WithServerListen(":0"))
+	require.NoError(t, err)
+
+	blocked := make(chan struct{})
+	go srv.ServeHandler(TCPHandlerFunc(func(ctx context.Context, _ string) string {
+		// E.g. the blocking pop waiting for the data.
+		close(blocked)
+		<-ctx.Done()
+		return "unblocked"
+	}))
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf(":%d", srv.ListenPort()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = WriteFrame(conn, []byte("req"))
+	require.NoError(t, err)
+	<-blocked
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	// The connection is closed without the response.
+	setDeadline(t, conn)
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestTCPServer_Shutdown_idleClients(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	srv, err := NewTCPServer(logger, WithServerListen(":0"), WithServerIdleTimeout(time.Hour))
+	require.NoError(t, err)
+
+	go srv.ServeHandler(TCPHandlerFunc(func(ctx context.Context, req string) string {
+		sess, _ := SessionFromContext(ctx)
+		sess.SetSubscribed(req == "subscribe")
+		return req + "-response"
+	}))
+	time.Sleep(100 * time.Millisecond)
+
+	conns := make([]net.Conn, 0, 2)
+	for _, req := range []string{"subscribe", "get"} {
+		conn, dialErr := net.Dial("tcp", fmt.Sprintf(":%d", srv.ListenPort()))
+		require.NoError(t, dialErr)
+		defer conn.Close()
+
+		resp, reqErr := doRequest(conn, req)
+		require.NoError(t, reqErr)
+		assert.Equal(t, req+"-response", resp)
+		conns = append(conns, conn)
+	}
+
+	// The clients waiting for the messages don't hold up the shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	for _, conn := range conns {
+		setDeadline(t, conn)
+		_, err = conn.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+	}
+}
+
 func runTCPServerTest(t *testing.T, h TCPHandler, opts []TCPServerOption, fn tcpServerTestFunc) {
 	t.Helper()
 
@@ -140,15 +471,13 @@ func doRequest(conn net.Conn, req string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	_, err = conn.Write([]byte(req))
-	if err != nil {
+	if err = WriteFrame(conn, []byte(req)); err != nil {
 		return "", err
 	}
 
-	buf := make([]byte, 512)
-	n, err := conn.Read(buf)
+	resp, err := NewFrameReader(conn, 512).ReadFrame()
 	if err != nil {
 		return "", err
 	}
-	return string(buf[:n]), nil
+	return string(resp), nil
 }
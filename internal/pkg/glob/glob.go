@@ -0,0 +1,121 @@
+// Package glob implements Redis-style glob-pattern matching: '*' matches
+// any sequence of characters, '?' matches any single character, "[abc]"
+// matches any character from the set, "[^abc]" matches any character not
+// in the set, "[a-z]" matches any character from the range and "\x"
+// matches the character x literally.
+package glob
+
+import (
+	"strings"
+)
+
+// Match reports whether name matches the pattern.
+// Malformed patterns never match anything except themselves literally.
+func Match(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if Match(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+			name = name[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(name) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], name[0])
+			if !ok {
+				// Unterminated class, treat '[' literally.
+				if name[0] != '[' {
+					return false
+				}
+				name = name[1:]
+				pattern = pattern[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			name = name[1:]
+			pattern = rest
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+			name = name[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(name) == 0
+}
+
+// matchClass matches the character against the class following '['.
+// It returns the rest of the pattern after the closing ']'.
+func matchClass(pattern string, c byte) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return matched != negate, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if lo <= c && c <= hi {
+				matched = true
+			}
+			i += 2
+		case pattern[i] == c:
+			matched = true
+		}
+	}
+	return false, "", false
+}
+
+// Prefix returns the literal prefix every name matching the pattern starts with.
+func Prefix(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return b.String()
+		case '\\':
+			if i+1 == len(pattern) {
+				return b.String()
+			}
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package glob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*", name: "", want: true},
+		{pattern: "*", name: "anything", want: true},
+		{pattern: "user:*", name: "user:42:name", want: true},
+		{pattern: "user:*", name: "session:1", want: false},
+		{pattern: "*:name", name: "user:42:name", want: true},
+		{pattern: "h?llo", name: "hello", want: true},
+		{pattern: "h?llo", name: "hllo", want: false},
+		{pattern: "h*llo", name: "hllo", want: true},
+		{pattern: "h[ae]llo", name: "hallo", want: true},
+		{pattern: "h[ae]llo", name: "hillo", want: false},
+		{pattern: "h[^e]llo", name: "hallo", want: true},
+		{pattern: "h[^e]llo", name: "hello", want: false},
+		{pattern: "h[a-b]llo", name: "hbllo", want: true},
+		{pattern: "h[a-b]llo", name: "hcllo", want: false},
+		{pattern: `h\*llo`, name: "h*llo", want: true},
+		{pattern: `h\*llo`, name: "hello", want: false},
+		{pattern: "h[llo", name: "h[llo", want: true},
+		{pattern: "a**b", name: "axyzb", want: true},
+		{pattern: "abc", name: "abcd", want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+"/"+tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Match(tc.pattern, tc.name))
+		})
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	assert.Equal(t, "user:42:", Prefix("user:42:*"))
+	assert.Equal(t, "", Prefix("*"))
+	assert.Equal(t, "h", Prefix("h?llo"))
+	assert.Equal(t, "a*b", Prefix(`a\*b[c]`))
+	assert.Equal(t, "abc", Prefix("abc"))
+}
@@ -23,3 +23,10 @@ func SetWriteDeadline(conn net.Conn, timeout time.Duration) {
 		slog.Error("failed to set write deadline", slog.Any("error", err)) //nolint:sloglint // ignore global logger
 	}
 }
+
+// ClearReadDeadline makes the reads wait for the data with no deadline.
+func ClearReadDeadline(conn net.Conn) {
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		slog.Error("failed to clear read deadline", slog.Any("error", err)) //nolint:sloglint // ignore global logger
+	}
+}